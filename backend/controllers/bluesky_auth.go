@@ -0,0 +1,237 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"social-sync-backend/middleware"
+)
+
+// blueskyDefaultPDS is the Personal Data Server used when the user doesn't name their own
+const blueskyDefaultPDS = "https://bsky.social"
+
+// ConnectBlueskyHandler logs in to a PDS with an app password (Settings > App Passwords
+// in Bluesky) and stores the session. Unlike a full password, an app password can be
+// revoked without affecting the account.
+func ConnectBlueskyHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			Identifier  string `json:"identifier"` // handle or email
+			AppPassword string `json:"appPassword"`
+			Service     string `json:"service"` // PDS URL, defaults to https://bsky.social
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		req.Identifier = strings.TrimPrefix(strings.TrimSpace(req.Identifier), "@")
+		if req.Identifier == "" || req.AppPassword == "" {
+			http.Error(w, "identifier and appPassword are required", http.StatusBadRequest)
+			return
+		}
+
+		pds := blueskyDefaultPDS
+		if req.Service != "" {
+			pds = normalizeInstanceURL(req.Service)
+		}
+
+		payload, _ := json.Marshal(map[string]string{"identifier": req.Identifier, "password": req.AppPassword})
+		var session blueskySessionResponse
+		if err := xrpcRequest(pds, "POST", "com.atproto.server.createSession", "", nil, bytes.NewReader(payload), "application/json", &session); err != nil {
+			http.Error(w, "Bluesky login failed: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var profile struct {
+			DisplayName string `json:"displayName"`
+			Avatar      string `json:"avatar"`
+		}
+		params := url.Values{"actor": {session.DID}}
+		if err := xrpcRequest(pds, "GET", "app.bsky.actor.getProfile", session.AccessJwt, params, nil, "", &profile); err != nil {
+			// The profile is only cosmetic, the session is what matters
+			profile.DisplayName = session.Handle
+		}
+		profileName := profile.DisplayName
+		if profileName == "" {
+			profileName = session.Handle
+		}
+		profileName = fmt.Sprintf("%s (@%s)", profileName, session.Handle)
+
+		_, err = db.Exec(`
+			INSERT INTO social_accounts (
+				user_id, platform, social_id, access_token, access_token_expires_at,
+				refresh_token, profile_picture_url, profile_name, connected_at
+			) VALUES (
+				$1, 'bluesky', $2, $3, $4, $5, $6, $7, NOW()
+			)
+			ON CONFLICT (user_id, platform) DO UPDATE SET
+				access_token = EXCLUDED.access_token,
+				access_token_expires_at = EXCLUDED.access_token_expires_at,
+				refresh_token = EXCLUDED.refresh_token,
+				social_id = EXCLUDED.social_id,
+				profile_picture_url = EXCLUDED.profile_picture_url,
+				profile_name = EXCLUDED.profile_name,
+				connected_at = NOW()
+		`,
+			userID,
+			blueskySocialID(pds, session.DID),
+			session.AccessJwt,
+			blueskyAccessExpiry(),
+			session.RefreshJwt,
+			nullIfEmpty(profile.Avatar),
+			profileName,
+		)
+		if err != nil {
+			http.Error(w, "Failed to save Bluesky account: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message":     "Bluesky account connected",
+			"handle":      session.Handle,
+			"did":         session.DID,
+			"profileName": profileName,
+		})
+	}
+}
+
+type blueskySessionResponse struct {
+	DID        string `json:"did"`
+	Handle     string `json:"handle"`
+	AccessJwt  string `json:"accessJwt"`
+	RefreshJwt string `json:"refreshJwt"`
+}
+
+// blueskySession is a logged-in PDS session. Calls that fail with an expired token
+// refresh the session once, save the new tokens and retry.
+type blueskySession struct {
+	db         *sql.DB
+	userID     string
+	PDS        string
+	DID        string
+	accessJwt  string
+	refreshJwt string
+}
+
+// blueskySocialID stores the PDS with the DID, as Mastodon stores the instance with the account id
+func blueskySocialID(pds, did string) string {
+	return pds + "|" + did
+}
+
+// Access tokens last about two hours; we refresh a little early
+func blueskyAccessExpiry() time.Time {
+	return time.Now().Add(90 * time.Minute)
+}
+
+func loadBlueskySession(db *sql.DB, userID string) (*blueskySession, error) {
+	acc, err := loadPlatformAccount(db, userID, "bluesky")
+	if err != nil {
+		return nil, err
+	}
+	pds, did, ok := strings.Cut(acc.SocialID, "|")
+	if !ok {
+		return nil, fmt.Errorf("invalid Bluesky account id, reconnect Bluesky")
+	}
+	return &blueskySession{db: db, userID: userID, PDS: pds, DID: did, accessJwt: acc.AccessToken, refreshJwt: acc.RefreshToken}, nil
+}
+
+// call makes an authenticated XRPC call. body may be nil; it's re-read on retry, so it
+// must be a *bytes.Reader.
+func (s *blueskySession) call(method, nsid string, params url.Values, body *bytes.Reader, contentType string, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		reader = body
+	}
+	err := xrpcRequest(s.PDS, method, nsid, s.accessJwt, params, reader, contentType, out)
+	if xerr, ok := err.(*xrpcError); !ok || xerr.Name != "ExpiredToken" {
+		return err
+	}
+
+	if err := s.refresh(); err != nil {
+		return err
+	}
+	if body != nil {
+		body.Seek(0, io.SeekStart)
+	}
+	return xrpcRequest(s.PDS, method, nsid, s.accessJwt, params, reader, contentType, out)
+}
+
+func (s *blueskySession) refresh() error {
+	var session blueskySessionResponse
+	if err := xrpcRequest(s.PDS, "POST", "com.atproto.server.refreshSession", s.refreshJwt, nil, nil, "", &session); err != nil {
+		return fmt.Errorf("Bluesky session expired, reconnect Bluesky: %v", err)
+	}
+	s.accessJwt, s.refreshJwt = session.AccessJwt, session.RefreshJwt
+	_, err := s.db.Exec(`
+		UPDATE social_accounts
+		SET access_token = $1, refresh_token = $2, access_token_expires_at = $3, last_synced_at = NOW()
+		WHERE user_id = $4 AND platform = 'bluesky'
+	`, s.accessJwt, s.refreshJwt, blueskyAccessExpiry(), s.userID)
+	if err != nil {
+		return fmt.Errorf("failed to save refreshed Bluesky session: %v", err)
+	}
+	return nil
+}
+
+// xrpcError is an XRPC error response, e.g. {"error":"ExpiredToken","message":"..."}
+type xrpcError struct {
+	Status  int
+	Name    string `json:"error"`
+	Message string `json:"message"`
+}
+
+func (e *xrpcError) Error() string {
+	return fmt.Sprintf("%s: %s (status %d)", e.Name, e.Message, e.Status)
+}
+
+// xrpcRequest calls /xrpc/{nsid} on a PDS and decodes the JSON response into out
+func xrpcRequest(pds, method, nsid, token string, params url.Values, body io.Reader, contentType string, out interface{}) error {
+	endpoint := strings.TrimRight(pds, "/") + "/xrpc/" + nsid
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		raw, _ := io.ReadAll(resp.Body)
+		xerr := &xrpcError{Status: resp.StatusCode}
+		if json.Unmarshal(raw, xerr) != nil || xerr.Name == "" {
+			xerr.Name, xerr.Message = "XRPCError", string(raw)
+		}
+		return xerr
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
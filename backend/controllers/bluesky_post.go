@@ -0,0 +1,420 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+)
+
+const (
+	blueskyCharLimit = 300
+	blueskyMaxImages = 4
+	blueskyMaxBlob   = 1000000 // bytes per image
+)
+
+type BlueskyPostRequest struct {
+	Text      string   `json:"text"`
+	MediaUrls []string `json:"mediaUrls"` // images for the first post
+	AltTexts  []string `json:"altTexts"`  // alt text per image, in mediaUrls order
+	Thread    []string `json:"thread"`    // follow-up posts, each replying to the previous one
+	SplitLong bool     `json:"splitLong"` // split text over 300 characters into a numbered thread
+	Langs     []string `json:"langs"`     // e.g. ["en"]
+	DraftID   string   `json:"draftId"`   // optional; links the post to a draft for later delete
+}
+
+// blueskyRef is a strong reference to a record, used for reply roots and parents
+type blueskyRef struct {
+	URI string `json:"uri"`
+	CID string `json:"cid"`
+}
+
+// PostToBlueskyHandler creates app.bsky.feed.post records with rich text facets, image
+// embeds and an optional reply thread
+func PostToBlueskyHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		var req BlueskyPostRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		text := strings.TrimSpace(req.Text)
+		if text == "" && len(req.MediaUrls) == 0 {
+			http.Error(w, "Text cannot be empty", http.StatusBadRequest)
+			return
+		}
+		if len(req.MediaUrls) > blueskyMaxImages {
+			http.Error(w, "Bluesky allows at most 4 images per post", http.StatusBadRequest)
+			return
+		}
+
+		posts := []string{text}
+		if utf8.RuneCountInString(text) > blueskyCharLimit {
+			if !req.SplitLong {
+				http.Error(w, "Text exceeds Bluesky's 300 character limit", http.StatusBadRequest)
+				return
+			}
+			posts = splitMastodonThread(text, blueskyCharLimit)
+		}
+		for i, t := range req.Thread {
+			if t = strings.TrimSpace(t); t == "" {
+				continue
+			}
+			if utf8.RuneCountInString(t) > blueskyCharLimit {
+				http.Error(w, fmt.Sprintf("Thread post %d exceeds Bluesky's 300 character limit", i+1), http.StatusBadRequest)
+				return
+			}
+			posts = append(posts, t)
+		}
+
+		session, err := loadBlueskySession(db, userID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Bluesky account not connected", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var embed map[string]interface{}
+		if len(req.MediaUrls) > 0 {
+			images := []map[string]interface{}{}
+			for i, mediaURL := range req.MediaUrls {
+				blob, err := uploadBlueskyBlob(session, mediaURL)
+				if err != nil {
+					http.Error(w, fmt.Sprintf("Image upload failed: %v", err), http.StatusBadGateway)
+					return
+				}
+				alt := ""
+				if i < len(req.AltTexts) {
+					alt = req.AltTexts[i]
+				}
+				images = append(images, map[string]interface{}{"alt": alt, "image": blob})
+			}
+			embed = map[string]interface{}{"$type": "app.bsky.embed.images", "images": images}
+		}
+
+		var root, parent *blueskyRef
+		var created []blueskyRef
+		for i, postText := range posts {
+			record := map[string]interface{}{
+				"$type":     "app.bsky.feed.post",
+				"text":      postText,
+				"createdAt": time.Now().UTC().Format(time.RFC3339Nano),
+			}
+			if facets := detectBlueskyFacets(session, postText); len(facets) > 0 {
+				record["facets"] = facets
+			}
+			if len(req.Langs) > 0 {
+				record["langs"] = req.Langs
+			}
+			if i == 0 && embed != nil {
+				record["embed"] = embed
+			}
+			if parent != nil {
+				record["reply"] = map[string]interface{}{"root": root, "parent": parent}
+			}
+
+			ref, err := createBlueskyRecord(session, record)
+			if err != nil {
+				// Earlier posts in the thread are already live, so record and report them
+				// alongside the error
+				recordBlueskyThread(db, req.DraftID, userID, session.DID, created)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadGateway)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"error":  fmt.Sprintf("Bluesky post %d of %d failed: %v", i+1, len(posts), err),
+					"thread": blueskyThreadInfo(session.DID, created),
+				})
+				return
+			}
+			created = append(created, *ref)
+			if root == nil {
+				root = ref
+			}
+			parent = ref
+		}
+
+		recordBlueskyThread(db, req.DraftID, userID, session.DID, created)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Posted to Bluesky successfully",
+			"uri":     root.URI,
+			"url":     blueskyPostURL(session.DID, root.URI),
+			"thread":  blueskyThreadInfo(session.DID, created),
+		})
+	}
+}
+
+func blueskyThreadInfo(did string, refs []blueskyRef) []map[string]string {
+	info := []map[string]string{}
+	for _, ref := range refs {
+		info = append(info, map[string]string{"uri": ref.URI, "cid": ref.CID, "url": blueskyPostURL(did, ref.URI)})
+	}
+	return info
+}
+
+// blueskyPostURL turns at://did/app.bsky.feed.post/rkey into its bsky.app link
+func blueskyPostURL(did, atURI string) string {
+	rkey := atURI[strings.LastIndex(atURI, "/")+1:]
+	return fmt.Sprintf("https://bsky.app/profile/%s/post/%s", did, rkey)
+}
+
+func createBlueskyRecord(session *blueskySession, record map[string]interface{}) (*blueskyRef, error) {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"repo":       session.DID,
+		"collection": "app.bsky.feed.post",
+		"record":     record,
+	})
+	var ref blueskyRef
+	if err := session.call("POST", "com.atproto.repo.createRecord", nil, bytes.NewReader(payload), "application/json", &ref); err != nil {
+		return nil, err
+	}
+	return &ref, nil
+}
+
+// recordBlueskyThread records the posts of a thread, root first, against the draft
+func recordBlueskyThread(db *sql.DB, draftID, userID, did string, created []blueskyRef) {
+	if len(created) == 0 {
+		return
+	}
+	uris := make([]string, 0, len(created))
+	for _, ref := range created {
+		uris = append(uris, ref.URI)
+	}
+	recordPublishedThread(db, draftID, "bluesky", userID, uris, blueskyPostURL(did, created[0].URI))
+}
+
+// uploadBlueskyBlob downloads an image from a public address and uploads it as a blob,
+// returning the blob object to embed in a record
+func uploadBlueskyBlob(session *blueskySession, mediaURL string) (json.RawMessage, error) {
+	resp, err := lib.PublicHTTPClient(30 * time.Second).Get(mediaURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download image: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download image: status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, blueskyMaxBlob+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > blueskyMaxBlob {
+		return nil, fmt.Errorf("image is larger than Bluesky's 1MB limit")
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType = http.DetectContentType(data)
+	}
+
+	var res struct {
+		Blob json.RawMessage `json:"blob"`
+	}
+	if err := session.call("POST", "com.atproto.repo.uploadBlob", nil, bytes.NewReader(data), contentType, &res); err != nil {
+		return nil, err
+	}
+	return res.Blob, nil
+}
+
+var (
+	blueskyMentionRe = regexp.MustCompile(`(?:^|[\s(])(@([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)+[a-zA-Z]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)`)
+	blueskyLinkRe    = regexp.MustCompile(`https?://[^\s<>"]+`)
+	blueskyTagRe     = regexp.MustCompile(`(?:^|\s)(#[^\s#[:punct:]][^\s#]*)`)
+)
+
+// detectBlueskyFacets finds mentions, links and hashtags. Facet indices are UTF-8 byte
+// offsets, which is what Go's regexp reports. Mentions of handles that don't resolve are
+// left as plain text.
+func detectBlueskyFacets(session *blueskySession, text string) []map[string]interface{} {
+	facets := []map[string]interface{}{}
+	addFacet := func(start, end int, feature map[string]interface{}) {
+		facets = append(facets, map[string]interface{}{
+			"index":    map[string]int{"byteStart": start, "byteEnd": end},
+			"features": []map[string]interface{}{feature},
+		})
+	}
+
+	for _, m := range blueskyMentionRe.FindAllStringSubmatchIndex(text, -1) {
+		handle := text[m[2]+1 : m[3]]
+		var res struct {
+			DID string `json:"did"`
+		}
+		if err := session.call("GET", "com.atproto.identity.resolveHandle", url.Values{"handle": {handle}}, nil, "", &res); err != nil {
+			continue
+		}
+		addFacet(m[2], m[3], map[string]interface{}{"$type": "app.bsky.richtext.facet#mention", "did": res.DID})
+	}
+
+	for _, m := range blueskyLinkRe.FindAllStringIndex(text, -1) {
+		end := m[0] + len(strings.TrimRight(text[m[0]:m[1]], ".,;:!?)"))
+		addFacet(m[0], end, map[string]interface{}{"$type": "app.bsky.richtext.facet#link", "uri": text[m[0]:end]})
+	}
+
+	for _, m := range blueskyTagRe.FindAllStringSubmatchIndex(text, -1) {
+		tag := strings.TrimRight(text[m[2]:m[3]], ".,;:!?)")
+		// Bluesky doesn't treat purely numeric tags like #1 as hashtags
+		if len(tag) < 2 || len(tag) > 65 || strings.Trim(tag[1:], "0123456789") == "" {
+			continue
+		}
+		addFacet(m[2], m[2]+len(tag), map[string]interface{}{"$type": "app.bsky.richtext.facet#tag", "tag": tag[1:]})
+	}
+	return facets
+}
+
+// GetBlueskyPostsHandler fetches the user's recent Bluesky posts
+func GetBlueskyPostsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+		feed, err := fetchBlueskyAuthorFeed(db, userID, 50)
+		if err != nil {
+			writeBlueskyFetchError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": feed})
+	}
+}
+
+// GetBlueskyAnalyticsHandler summarises likes, reposts, replies and quotes over recent posts
+func GetBlueskyAnalyticsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+		feed, err := fetchBlueskyAuthorFeed(db, userID, 50)
+		if err != nil {
+			writeBlueskyFetchError(w, err)
+			return
+		}
+
+		totalLikes, totalReposts, totalReplies, totalQuotes := 0, 0, 0, 0
+		postsWithEngagement := []map[string]interface{}{}
+		for _, post := range feed {
+			likes := intFromMap(post, "likeCount")
+			reposts := intFromMap(post, "repostCount")
+			replies := intFromMap(post, "replyCount")
+			quotes := intFromMap(post, "quoteCount")
+			totalLikes += likes
+			totalReposts += reposts
+			totalReplies += replies
+			totalQuotes += quotes
+
+			var text interface{}
+			if record, ok := post["record"].(map[string]interface{}); ok {
+				text = record["text"]
+			}
+			postsWithEngagement = append(postsWithEngagement, map[string]interface{}{
+				"uri":          post["uri"],
+				"text":         text,
+				"indexed_at":   post["indexedAt"],
+				"like_count":   likes,
+				"repost_count": reposts,
+				"reply_count":  replies,
+				"quote_count":  quotes,
+				"engagement":   likes + reposts + replies + quotes,
+			})
+		}
+
+		sort.SliceStable(postsWithEngagement, func(i, j int) bool {
+			return postsWithEngagement[i]["engagement"].(int) > postsWithEngagement[j]["engagement"].(int)
+		})
+		topN := 5
+		if len(postsWithEngagement) < topN {
+			topN = len(postsWithEngagement)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"totalPosts":   len(postsWithEngagement),
+			"totalLikes":   totalLikes,
+			"totalReposts": totalReposts,
+			"totalReplies": totalReplies,
+			"totalQuotes":  totalQuotes,
+			"topPosts":     postsWithEngagement[:topN],
+			"totalClicks":  countUserLinkClicks(db, userID, "bluesky"),
+		})
+	}
+}
+
+// fetchBlueskyAuthorFeed returns the user's own posts (not reposts) with their counts
+func fetchBlueskyAuthorFeed(db *sql.DB, userID string, limit int) ([]map[string]interface{}, error) {
+	session, err := loadBlueskySession(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		Feed []struct {
+			Post   map[string]interface{} `json:"post"`
+			Reason interface{}            `json:"reason"`
+		} `json:"feed"`
+	}
+	params := url.Values{
+		"actor":  {session.DID},
+		"limit":  {fmt.Sprint(limit)},
+		"filter": {"posts_no_replies"},
+	}
+	if err := session.call("GET", "app.bsky.feed.getAuthorFeed", params, nil, "", &res); err != nil {
+		return nil, err
+	}
+	posts := []map[string]interface{}{}
+	for _, item := range res.Feed {
+		if item.Reason != nil {
+			continue
+		}
+		posts = append(posts, item.Post)
+	}
+	return posts, nil
+}
+
+func writeBlueskyFetchError(w http.ResponseWriter, err error) {
+	if err == sql.ErrNoRows {
+		http.Error(w, "Bluesky account not connected", http.StatusBadRequest)
+		return
+	}
+	log.Printf("Bluesky fetch error: %v", err)
+	http.Error(w, "Failed to fetch Bluesky posts: "+err.Error(), http.StatusBadGateway)
+}
+
+// deleteBlueskyPost deletes the record behind an at:// URI. Bluesky has no edits.
+func deleteBlueskyPost(db *sql.DB, acc *platformAccount, post *models.PublishedPost) error {
+	session, err := loadBlueskySession(db, acc.UserID)
+	if err != nil {
+		return err
+	}
+	rkey := post.RemoteID[strings.LastIndex(post.RemoteID, "/")+1:]
+	payload, _ := json.Marshal(map[string]string{
+		"repo":       session.DID,
+		"collection": "app.bsky.feed.post",
+		"rkey":       rkey,
+	})
+	return session.call("POST", "com.atproto.repo.deleteRecord", nil, bytes.NewReader(payload), "application/json", nil)
+}
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestDetectBlueskyFacets(t *testing.T) {
+	// A PDS that only knows alice.bsky.social
+	pds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/xrpc/com.atproto.identity.resolveHandle" || r.URL.Query().Get("handle") != "alice.bsky.social" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "InvalidRequest", "message": "Unable to resolve handle"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"did": "did:plc:alice"})
+	}))
+	defer pds.Close()
+	session := &blueskySession{PDS: pds.URL}
+
+	type facet struct {
+		Start, End int
+		Type       string
+		Value      string
+	}
+	tests := []struct {
+		name string
+		text string
+		want []facet
+	}{
+		{"plain text", "nothing to see here", nil},
+		{"mention", "hi @alice.bsky.social!", []facet{{3, 21, "mention", "did:plc:alice"}}},
+		{"unresolved mention", "hi @nobody.example.com", nil},
+		{"link trims punctuation", "see https://example.com/a.", []facet{{4, 25, "link", "https://example.com/a"}}},
+		{"tag", "go #golang now", []facet{{3, 10, "tag", "golang"}}},
+		{"numeric tag ignored", "item #1", nil},
+		// é is two bytes and 🎉 four, so offsets after them are byte offsets, not runes
+		{"byte offsets after multibyte text", "café 🎉 #party", []facet{{11, 17, "tag", "party"}}},
+		{"link after emoji", "🎉 https://x.org", []facet{{5, 18, "link", "https://x.org"}}},
+		{"mention, link and tag", "@alice.bsky.social https://a.io #x1", []facet{
+			{0, 18, "mention", "did:plc:alice"},
+			{19, 31, "link", "https://a.io"},
+			{32, 35, "tag", "x1"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []facet
+			for _, f := range detectBlueskyFacets(session, tt.text) {
+				index := f["index"].(map[string]int)
+				feature := f["features"].([]map[string]interface{})[0]
+				var typ, value string
+				switch feature["$type"] {
+				case "app.bsky.richtext.facet#mention":
+					typ, value = "mention", feature["did"].(string)
+				case "app.bsky.richtext.facet#link":
+					typ, value = "link", feature["uri"].(string)
+				case "app.bsky.richtext.facet#tag":
+					typ, value = "tag", feature["tag"].(string)
+				}
+				got = append(got, facet{index["byteStart"], index["byteEnd"], typ, value})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("detectBlueskyFacets(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
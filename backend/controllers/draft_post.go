@@ -2,8 +2,10 @@ package controllers
 
 import (
 	"bytes"
+	"database/sql"
 	"encoding/json"
 	"io"
+	"log"
 	"net/http"
 	"social-sync-backend/lib"
 	"social-sync-backend/middleware"
@@ -28,6 +30,7 @@ func CreateDraftPost(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Content       string     `json:"content"`
 		Media         []string   `json:"media"`
+		MediaIDs      []string   `json:"media_ids"` // media library items, added before the URLs in media
 		Platforms     []string   `json:"platforms"`
 		ScheduledTime *time.Time `json:"scheduled_time"`
 	}
@@ -35,19 +38,41 @@ func CreateDraftPost(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
+	media, err := resolveDraftMedia(workspaceID, req.MediaIDs, req.Media)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Scheduled media must still be usable, on these platforms, when the post goes out
+	if req.ScheduledTime != nil {
+		violations, err := checkMediaRights(workspaceID, media, req.Platforms, *req.ScheduledTime)
+		if err != nil {
+			log.Printf("Failed to check media rights: %v", err)
+			http.Error(w, "Failed to check media rights", http.StatusInternalServerError)
+			return
+		}
+		if len(violations) > 0 {
+			writeMediaRightsError(w, "schedule this draft", violations)
+			return
+		}
+	}
 
 	draftID := uuid.NewString()
 	now := time.Now()
 	status := "draft"
 
-	_, err := lib.DB.Exec(`
+	_, err = lib.DB.Exec(`
 		INSERT INTO draft_posts (id, workspace_id, created_by, content, media, platforms, status, scheduled_time, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-	`, draftID, workspaceID, userID, req.Content, pqStringArrayToJSONB(req.Media), pqStringArray(req.Platforms), status, req.ScheduledTime, now, now)
+	`, draftID, workspaceID, userID, req.Content, pqStringArrayToJSONB(media), pqStringArray(req.Platforms), status, req.ScheduledTime, now, now)
 	if err != nil {
 		http.Error(w, "Failed to create draft", http.StatusInternalServerError)
 		return
 	}
+	mediaIDs, err := syncDraftMediaUsages(workspaceID, draftID, media)
+	if err != nil {
+		log.Printf("Failed to record media usage for draft %s: %v", draftID, err)
+	}
 
 	// Fetch author info
 	var authorName, authorEmail, authorAvatar string
@@ -63,7 +88,8 @@ func CreateDraftPost(w http.ResponseWriter, r *http.Request) {
 		"workspace_id":   workspaceID,
 		"created_by":     userID,
 		"content":        req.Content,
-		"media":          req.Media,
+		"media":          media,
+		"media_ids":      mediaIDs,
 		"platforms":      req.Platforms,
 		"status":         status,
 		"scheduled_time": req.ScheduledTime,
@@ -95,6 +121,7 @@ func ListDraftPosts(w http.ResponseWriter, r *http.Request) {
 
 	rows, err := lib.DB.Query(`
 		SELECT d.id, d.workspace_id, d.created_by, d.content, d.media, d.platforms, d.status, d.scheduled_time, d.published_time, d.created_at, d.updated_at,
+		       ARRAY(SELECT mu.media_id::text FROM media_usages mu WHERE mu.draft_id = d.id ORDER BY mu.position),
 		       u.id, u.name, u.email, u.profile_picture
 		FROM draft_posts d
 		LEFT JOIN users u ON d.created_by = u.id
@@ -117,12 +144,13 @@ func ListDraftPosts(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var d models.DraftPost
 		var mediaJSON []byte
-		var platforms pqStringArray
+		var platforms, mediaIDs pqStringArray
 		var authorID, authorName, authorEmail, authorAvatar *string
-		if err := rows.Scan(&d.ID, &d.WorkspaceID, &d.CreatedBy, &d.Content, &mediaJSON, &platforms, &d.Status, &d.ScheduledTime, &d.PublishedTime, &d.CreatedAt, &d.UpdatedAt, &authorID, &authorName, &authorEmail, &authorAvatar); err != nil {
+		if err := rows.Scan(&d.ID, &d.WorkspaceID, &d.CreatedBy, &d.Content, &mediaJSON, &platforms, &d.Status, &d.ScheduledTime, &d.PublishedTime, &d.CreatedAt, &d.UpdatedAt, &mediaIDs, &authorID, &authorName, &authorEmail, &authorAvatar); err != nil {
 			continue
 		}
 		d.Media = jsonBytesToStringSlice(mediaJSON)
+		d.MediaIDs = []string(mediaIDs)
 		d.Platforms = []string(platforms)
 		m := map[string]interface{}{
 			"id":             d.ID,
@@ -130,6 +158,7 @@ func ListDraftPosts(w http.ResponseWriter, r *http.Request) {
 			"created_by":     d.CreatedBy,
 			"content":        d.Content,
 			"media":          d.Media,
+			"media_ids":      d.MediaIDs,
 			"platforms":      d.Platforms,
 			"status":         d.Status,
 			"scheduled_time": d.ScheduledTime,
@@ -183,6 +212,7 @@ func UpdateDraftPost(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Content       *string    `json:"content"`
 		Media         *[]string  `json:"media"`
+		MediaIDs      *[]string  `json:"media_ids"`
 		Platforms     *[]string  `json:"platforms"`
 		ScheduledTime *time.Time `json:"scheduled_time"`
 		Status        *string    `json:"status"`
@@ -200,11 +230,37 @@ func UpdateDraftPost(w http.ResponseWriter, r *http.Request) {
 		args = append(args, *req.Content)
 		argIdx++
 	}
-	if req.Media != nil {
+	// media_ids and media together replace the draft's media list
+	var media []string
+	if req.Media != nil || req.MediaIDs != nil {
+		var ids, urls []string
+		if req.MediaIDs != nil {
+			ids = *req.MediaIDs
+		}
+		if req.Media != nil {
+			urls = *req.Media
+		}
+		var err error
+		if media, err = resolveDraftMedia(vars["workspaceId"], ids, urls); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		setClauses = append(setClauses, "media = $"+itoa(argIdx))
-		args = append(args, pqStringArrayToJSONB(*req.Media))
+		args = append(args, pqStringArrayToJSONB(media))
 		argIdx++
 	}
+	if req.Media != nil || req.MediaIDs != nil || req.Platforms != nil || req.ScheduledTime != nil || req.Status != nil {
+		violations, err := scheduledDraftRightsViolations(vars["workspaceId"], draftID, media, req.Platforms, req.ScheduledTime, req.Status)
+		if err != nil {
+			log.Printf("Failed to check media rights for draft %s: %v", draftID, err)
+			http.Error(w, "Failed to check media rights", http.StatusInternalServerError)
+			return
+		}
+		if len(violations) > 0 {
+			writeMediaRightsError(w, "schedule this draft", violations)
+			return
+		}
+	}
 	if req.Platforms != nil {
 		setClauses = append(setClauses, "platforms = $"+itoa(argIdx))
 		args = append(args, pqStringArray(*req.Platforms))
@@ -234,6 +290,13 @@ func UpdateDraftPost(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to update draft", http.StatusInternalServerError)
 		return
 	}
+	if media != nil {
+		mediaIDs, err := syncDraftMediaUsages(vars["workspaceId"], draftID, media)
+		if err != nil {
+			log.Printf("Failed to record media usage for draft %s: %v", draftID, err)
+		}
+		req.Media, req.MediaIDs = &media, &mediaIDs
+	}
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Draft updated successfully"})
 
@@ -244,6 +307,43 @@ func UpdateDraftPost(w http.ResponseWriter, r *http.Request) {
 	hub.broadcast(vars["workspaceId"], websocket.TextMessage, msg)
 }
 
+// scheduledDraftRightsViolations checks a draft update against media rights, merging the
+// changed fields (nil when unchanged) with the stored draft. Drafts without a scheduled
+// time, or already published, aren't checked here; publishing checks them.
+func scheduledDraftRightsViolations(workspaceID, draftID string, media []string, platforms *[]string, scheduledTime *time.Time, status *string) ([]MediaRightsViolation, error) {
+	var storedMedia []byte
+	var storedPlatforms pqStringArray
+	var storedTime *time.Time
+	var storedStatus string
+	err := lib.DB.QueryRow(`
+		SELECT media, platforms, scheduled_time, status FROM draft_posts WHERE id = $1
+	`, draftID).Scan(&storedMedia, &storedPlatforms, &storedTime, &storedStatus)
+	if err == sql.ErrNoRows {
+		return nil, nil // the update itself reports nothing changed
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if media == nil {
+		media = jsonBytesToStringSlice(storedMedia)
+	}
+	effectivePlatforms := []string(storedPlatforms)
+	if platforms != nil {
+		effectivePlatforms = *platforms
+	}
+	if scheduledTime != nil {
+		storedTime = scheduledTime
+	}
+	if status != nil {
+		storedStatus = *status
+	}
+	if storedTime == nil || storedStatus == "published" {
+		return nil, nil
+	}
+	return checkMediaRights(workspaceID, media, effectivePlatforms, *storedTime)
+}
+
 // DeleteDraftPost deletes a draft post
 func DeleteDraftPost(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -272,7 +372,10 @@ func PublishDraftPost(w http.ResponseWriter, r *http.Request) {
 
 	// Check if user is admin/editor in the workspace
 	var workspaceID string
-	err := lib.DB.QueryRow(`SELECT workspace_id FROM draft_posts WHERE id = $1`, draftID).Scan(&workspaceID)
+	var content *string
+	var platforms pqStringArray
+	var media []byte
+	err := lib.DB.QueryRow(`SELECT workspace_id, content, platforms, media FROM draft_posts WHERE id = $1`, draftID).Scan(&workspaceID, &content, &platforms, &media)
 	if err != nil {
 		http.Error(w, "Draft not found", http.StatusNotFound)
 		return
@@ -282,6 +385,71 @@ func PublishDraftPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Media deleted from the library since the draft was written would publish as broken links
+	trashed, err := trashedDraftMedia(draftID)
+	if err != nil {
+		log.Printf("Failed to check media for draft %s: %v", draftID, err)
+		http.Error(w, "Failed to check draft media", http.StatusInternalServerError)
+		return
+	}
+	if len(trashed) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":         "Some of this draft's media has been deleted; restore it or remove it from the draft",
+			"deleted_media": trashed,
+		})
+		return
+	}
+
+	violations, err := checkMediaRights(workspaceID, jsonBytesToStringSlice(media), platforms, time.Now())
+	if err != nil {
+		log.Printf("Failed to check media rights for draft %s: %v", draftID, err)
+		http.Error(w, "Failed to check media rights", http.StatusInternalServerError)
+		return
+	}
+	if len(violations) > 0 {
+		writeMediaRightsError(w, "publish this draft", violations)
+		return
+	}
+
+	// Tag links with the workspace's UTM settings for each target platform
+	platformContent := map[string]string{}
+	for _, platform := range platforms {
+		text := ""
+		if content != nil {
+			text = *content
+		}
+		rewritten, err := rewriteContentLinks(workspaceID, draftID, userID, platform, text)
+		if err != nil {
+			log.Printf("Failed to rewrite links for draft %s on %s: %v", draftID, platform, err)
+			http.Error(w, "Failed to prepare links for publishing", http.StatusInternalServerError)
+			return
+		}
+		platformContent[platform] = rewritten
+	}
+
+	resp := map[string]interface{}{
+		"message":          "Draft published successfully",
+		"platform_content": platformContent,
+	}
+	// The webhook platform is delivered server-side; the others are posted by the client.
+	// It's delivered before the draft is marked published, so a failed delivery leaves
+	// the draft unpublished for the user to retry.
+	if webhookContent, ok := platformContent[webhookPlatform]; ok {
+		if _, err := publishDraftToWebhook(workspaceID, draftID, userID, webhookContent, jsonBytesToStringSlice(media), platforms); err != nil {
+			log.Printf("Failed to deliver draft %s to webhook: %v", draftID, err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadGateway)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":   "Failed to deliver the draft to the workspace webhook; it has not been published",
+				"webhook": publishedPostResult{Result: "failed", Error: err.Error()},
+			})
+			return
+		}
+		resp["webhook"] = publishedPostResult{Result: "ok"}
+	}
+
 	now := time.Now()
 	_, err = lib.DB.Exec(`
 		UPDATE draft_posts SET status = 'published', published_time = $1, updated_at = $1 WHERE id = $2
@@ -290,8 +458,9 @@ func PublishDraftPost(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to publish draft", http.StatusInternalServerError)
 		return
 	}
+
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Draft published successfully"})
+	json.NewEncoder(w).Encode(resp)
 
 	msg, _ := json.Marshal(map[string]interface{}{
 		"type":    "draft_published",
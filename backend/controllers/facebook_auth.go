@@ -14,6 +14,7 @@ import (
 	"github.com/google/uuid"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/facebook"
+	"social-sync-backend/lib"
 	"social-sync-backend/middleware"
 )
 
@@ -34,6 +35,8 @@ func getFacebookOAuthConfig() *oauth2.Config {
 			"pages_manage_posts", "instagram_basic",
 			"instagram_content_publish", "pages_read_engagement",
 			"read_insights", "instagram_manage_insights",
+			"pages_read_user_content", "pages_manage_engagement",
+			"instagram_manage_comments",
 		},
 		Endpoint: facebook.Endpoint,
 	}
@@ -90,7 +93,7 @@ func FacebookCallbackHandler(db *sql.DB) http.HandlerFunc {
 		}
 		client := config.Client(context.Background(), token)
 
-		pagesResp, err := client.Get("https://graph.facebook.com/v18.0/me/accounts")
+		pagesResp, err := client.Get(lib.GraphURL("me/accounts"))
 		if err != nil {
 			http.Error(w, "Failed to fetch pages: "+err.Error(), http.StatusInternalServerError)
 			return
@@ -117,7 +120,7 @@ func FacebookCallbackHandler(db *sql.DB) http.HandlerFunc {
 		pageID := page.ID
 		pageAccessToken := page.AccessToken
 		pageName := page.Name
-		pictureURL := fmt.Sprintf("https://graph.facebook.com/v18.0/%s/picture?type=large", pageID)
+		pictureURL := lib.GraphURL("%s/picture?type=large", pageID)
 
 		_, err = db.Exec(`
 			INSERT INTO social_accounts (
@@ -5,18 +5,54 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
+	"path"
+	"strconv"
 	"strings"
+	"time"
 
+	"social-sync-backend/lib"
 	"social-sync-backend/middleware"
 )
 
 type FacebookPostRequest struct {
 	Message   string   `json:"message"`
 	MediaUrls []string `json:"mediaUrls"`
+	DraftID   string   `json:"draftId"` // optional; links the post to a draft for later edit/delete
+
+	// Media library items; their stored MIME type decides photo vs video
+	MediaIDs    []string `json:"mediaIds"`
+	WorkspaceID string   `json:"workspaceId"` // required with mediaIds
+
+	// Link post. The preview fields override the scraped Open Graph preview; Facebook
+	// only honours them for links on a domain owned by the Page.
+	Link            string `json:"link"`
+	LinkName        string `json:"linkName"`
+	LinkDescription string `json:"linkDescription"`
+	LinkCaption     string `json:"linkCaption"`
+	LinkPicture     string `json:"linkPicture"`
+
+	// ScheduledPublishTime hands scheduling to Facebook (10 minutes to 30 days ahead).
+	// Published=false without a schedule creates an unpublished Page post.
+	ScheduledPublishTime *time.Time `json:"scheduledPublishTime"`
+	Published            *bool      `json:"published"`
 }
 
+type facebookMedia struct {
+	URL     string
+	IsVideo bool
+}
+
+const (
+	facebookMinScheduleLead = 10 * time.Minute
+	facebookMaxScheduleLead = 30 * 24 * time.Hour
+)
+
+// PostToFacebookHandler publishes, schedules or saves as unpublished a Page post.
+// Facebook has no single post mixing photos and videos, so mixed media goes out as one
+// multi-photo post followed by one post per video, all sharing the message.
 func PostToFacebookHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, err := middleware.GetUserIDFromContext(r)
@@ -31,10 +67,28 @@ func PostToFacebookHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		if strings.TrimSpace(req.Message) == "" {
+		if strings.TrimSpace(req.Message) == "" && req.Link == "" {
 			http.Error(w, "Message cannot be empty", http.StatusBadRequest)
 			return
 		}
+		if req.Link != "" && (len(req.MediaUrls) > 0 || len(req.MediaIDs) > 0) {
+			http.Error(w, "A link post cannot also carry media", http.StatusBadRequest)
+			return
+		}
+
+		// published=false plus scheduled_publish_time is how Graph schedules; published=false
+		// on its own leaves the post unpublished on the Page
+		published := req.Published == nil || *req.Published
+		var scheduledAt int64
+		if req.ScheduledPublishTime != nil {
+			lead := time.Until(*req.ScheduledPublishTime)
+			if lead < facebookMinScheduleLead || lead > facebookMaxScheduleLead {
+				http.Error(w, "scheduledPublishTime must be between 10 minutes and 30 days from now", http.StatusBadRequest)
+				return
+			}
+			scheduledAt = req.ScheduledPublishTime.Unix()
+			published = false
+		}
 
 		var accessToken, pageID string
 		err = db.QueryRow(`
@@ -47,138 +101,186 @@ func PostToFacebookHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		urlEncode := func(s string) string {
-			return url.QueryEscape(s)
+		media, err := resolveFacebookMedia(userID, req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
-		// CASE 1: Text only
-		if len(req.MediaUrls) == 0 {
-			postURL := fmt.Sprintf("https://graph.facebook.com/%s/feed", pageID)
-			payload := strings.NewReader(fmt.Sprintf("message=%s&access_token=%s", urlEncode(req.Message), urlEncode(accessToken)))
-
-			resp, err := http.Post(postURL, "application/x-www-form-urlencoded", payload)
-			if err != nil {
-				http.Error(w, "Failed to publish text post", http.StatusInternalServerError)
-				return
+		// publishState adds the published/scheduling fields shared by every post we create
+		publishState := func(form url.Values) url.Values {
+			form.Set("access_token", accessToken)
+			if !published {
+				form.Set("published", "false")
 			}
-			defer resp.Body.Close()
-
-			body, _ := io.ReadAll(resp.Body)
-			if resp.StatusCode != http.StatusOK {
-				http.Error(w, fmt.Sprintf("Facebook API error: %s", body), http.StatusInternalServerError)
-				return
+			if scheduledAt > 0 {
+				form.Set("scheduled_publish_time", strconv.FormatInt(scheduledAt, 10))
 			}
-
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte("Text post published successfully"))
-			return
+			return form
 		}
 
-		// Separate images and videos
-		var imageUrls, videoUrls []string
-		for _, url := range req.MediaUrls {
-			if strings.Contains(url, ".mp4") || strings.Contains(url, "/video/") {
-				videoUrls = append(videoUrls, url)
+		var images, videos []facebookMedia
+		for _, m := range media {
+			if m.IsVideo {
+				videos = append(videos, m)
 			} else {
-				imageUrls = append(imageUrls, url)
+				images = append(images, m)
 			}
 		}
 
-		// CASE 2: Single video only
-		if len(videoUrls) > 0 && len(imageUrls) == 0 {
-			if len(videoUrls) > 1 {
-				http.Error(w, "Facebook only supports posting one video at a time", http.StatusBadRequest)
-				return
-			}
-
-			videoURL := fmt.Sprintf("https://graph.facebook.com/%s/videos", pageID)
-			payload := strings.NewReader(fmt.Sprintf("file_url=%s&description=%s&access_token=%s",
-				urlEncode(videoUrls[0]), urlEncode(req.Message), urlEncode(accessToken)))
+		var postIDs []string
 
-			resp, err := http.Post(videoURL, "application/x-www-form-urlencoded", payload)
-			if err != nil {
-				http.Error(w, "Failed to upload video", http.StatusInternalServerError)
-				return
+		// Text, link or multi-photo feed post
+		if len(images) > 0 || len(videos) == 0 {
+			form := url.Values{}
+			if req.Message != "" {
+				form.Set("message", req.Message)
 			}
-			defer resp.Body.Close()
-
-			body, _ := io.ReadAll(resp.Body)
-			if resp.StatusCode != http.StatusOK {
-				http.Error(w, fmt.Sprintf("Facebook video upload failed: %s", body), http.StatusInternalServerError)
-				return
+			if req.Link != "" {
+				form.Set("link", req.Link)
+				setIfNotEmpty(form, "name", req.LinkName)
+				setIfNotEmpty(form, "description", req.LinkDescription)
+				setIfNotEmpty(form, "caption", req.LinkCaption)
+				setIfNotEmpty(form, "picture", req.LinkPicture)
 			}
-
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte("Video post published successfully"))
-			return
-		}
-
-		// CASE 3: Multiple images only
-		if len(imageUrls) > 0 && len(videoUrls) == 0 {
-			var attachedMediaIDs []string
-
-			for _, mediaURL := range imageUrls {
-				uploadURL := fmt.Sprintf("https://graph.facebook.com/%s/photos?access_token=%s", pageID, urlEncode(accessToken))
-				payload := fmt.Sprintf("url=%s&published=false", urlEncode(mediaURL))
-
-				resp, err := http.Post(uploadURL, "application/x-www-form-urlencoded", strings.NewReader(payload))
+			for i, img := range images {
+				photoID, err := uploadFacebookPhoto(pageID, accessToken, img.URL, scheduledAt > 0)
 				if err != nil {
-					http.Error(w, "Failed to upload image", http.StatusInternalServerError)
+					http.Error(w, fmt.Sprintf("Image upload failed: %v", err), http.StatusBadGateway)
 					return
 				}
-				body, _ := io.ReadAll(resp.Body)
-				resp.Body.Close()
-
-				if resp.StatusCode != http.StatusOK {
-					http.Error(w, fmt.Sprintf("Image upload failed: %s", body), http.StatusInternalServerError)
-					return
-				}
-
-				var fbRes struct {
-					ID string `json:"id"`
-				}
-				if err := json.Unmarshal(body, &fbRes); err != nil || fbRes.ID == "" {
-					http.Error(w, "Failed to parse media ID", http.StatusInternalServerError)
-					return
-				}
-				attachedMediaIDs = append(attachedMediaIDs, fbRes.ID)
+				form.Set(fmt.Sprintf("attached_media[%d]", i), fmt.Sprintf(`{"media_fbid":"%s"}`, photoID))
 			}
 
-			// Post with attached images
-			var mediaParams []string
-			for i, id := range attachedMediaIDs {
-				mediaParams = append(mediaParams, fmt.Sprintf(`attached_media[%d]={"media_fbid":"%s"}`, i, id))
+			postID, err := postFacebookForm(lib.GraphURL("%s/feed", pageID), publishState(form))
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Facebook API error: %v", err), http.StatusBadGateway)
+				return
 			}
+			recordFacebookPost(db, req.DraftID, userID, postID)
+			postIDs = append(postIDs, postID)
+		}
 
-			postURL := fmt.Sprintf("https://graph.facebook.com/%s/feed", pageID)
-			finalPayload := fmt.Sprintf(
-				"message=%s&%s&access_token=%s",
-				urlEncode(req.Message),
-				strings.Join(mediaParams, "&"),
-				urlEncode(accessToken),
-			)
-
-			resp, err := http.Post(postURL, "application/x-www-form-urlencoded", strings.NewReader(finalPayload))
+		// One post per video
+		for _, video := range videos {
+			form := url.Values{}
+			form.Set("file_url", video.URL)
+			form.Set("description", req.Message)
+			videoID, err := postFacebookForm(lib.GraphURL("%s/videos", pageID), publishState(form))
 			if err != nil {
-				http.Error(w, "Failed to publish image post", http.StatusInternalServerError)
+				// Earlier posts in a mixed set are already live, so report them alongside the error
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadGateway)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"error":   fmt.Sprintf("Facebook video upload failed: %v", err),
+					"postIds": postIDs,
+				})
 				return
 			}
-			body, _ := io.ReadAll(resp.Body)
-			resp.Body.Close()
+			recordFacebookPost(db, req.DraftID, userID, videoID)
+			postIDs = append(postIDs, videoID)
+		}
 
-			if resp.StatusCode != http.StatusOK {
-				http.Error(w, fmt.Sprintf("Post failed: %s", body), http.StatusInternalServerError)
-				return
+		status := "published"
+		if scheduledAt > 0 {
+			status = "scheduled"
+		} else if !published {
+			status = "unpublished"
+		}
+		resp := map[string]interface{}{
+			"postIds": postIDs,
+			"status":  status,
+		}
+		if scheduledAt > 0 {
+			resp["scheduledPublishTime"] = req.ScheduledPublishTime.UTC()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// resolveFacebookMedia turns media library items and raw URLs into photos and videos,
+// using the stored MIME type for library items and the served Content-Type for URLs
+func resolveFacebookMedia(userID string, req FacebookPostRequest) ([]facebookMedia, error) {
+	var media []facebookMedia
+	if len(req.MediaIDs) > 0 {
+		if req.WorkspaceID == "" || !isWorkspaceMember(userID, req.WorkspaceID) {
+			return nil, fmt.Errorf("workspaceId is missing or you are not a member of it")
+		}
+		for _, id := range req.MediaIDs {
+			m, err := loadMediaFile(id, req.WorkspaceID, "")
+			if err != nil {
+				return nil, fmt.Errorf("media %s not found", id)
 			}
+			applyRendition(m, "facebook", "feed")
+			media = append(media, facebookMedia{URL: m.FileURL, IsVideo: strings.HasPrefix(m.MimeType, "video/")})
+		}
+	}
+	for _, u := range req.MediaUrls {
+		media = append(media, facebookMedia{URL: u, IsVideo: strings.HasPrefix(detectMimeType(u), "video/")})
+	}
+	return media, nil
+}
 
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte("Image post published successfully"))
-			return
+// detectMimeType asks the server for the Content-Type and falls back to the file extension.
+// mediaURL comes from the client, so only public addresses are asked.
+func detectMimeType(mediaURL string) string {
+	if resp, err := lib.PublicHTTPClient(10 * time.Second).Head(mediaURL); err == nil {
+		resp.Body.Close()
+		if ct, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil && resp.StatusCode == http.StatusOK &&
+			ct != "application/octet-stream" {
+			return ct
 		}
+	}
+	if u, err := url.Parse(mediaURL); err == nil {
+		return mime.TypeByExtension(strings.ToLower(path.Ext(u.Path)))
+	}
+	return ""
+}
+
+// uploadFacebookPhoto stages an unpublished photo for attached_media. Photos for a
+// scheduled post must be temporary, or Facebook rejects the schedule.
+func uploadFacebookPhoto(pageID, accessToken, photoURL string, temporary bool) (string, error) {
+	form := url.Values{}
+	form.Set("url", photoURL)
+	form.Set("published", "false")
+	if temporary {
+		form.Set("temporary", "true")
+	}
+	form.Set("access_token", accessToken)
+	return postFacebookForm(lib.GraphURL("%s/photos", pageID), form)
+}
 
-		// CASE 4: Mixed media not supported
-		http.Error(w, "Facebook does not support mixed image and video posts", http.StatusBadRequest)
+// postFacebookForm posts a Graph API form and returns the created object's ID
+func postFacebookForm(endpoint string, form url.Values) (string, error) {
+	resp, err := http.Post(endpoint, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
 	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s", body)
+	}
+	var res struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil || res.ID == "" {
+		return "", fmt.Errorf("no id in response: %s", body)
+	}
+	return res.ID, nil
+}
+
+func setIfNotEmpty(form url.Values, key, value string) {
+	if value != "" {
+		form.Set(key, value)
+	}
+}
+
+// recordFacebookPost links a Facebook post to its draft
+func recordFacebookPost(db *sql.DB, draftID, userID, postID string) {
+	recordPublishedPost(db, draftID, "facebook", userID, postID, "https://www.facebook.com/"+postID)
 }
 
 // GetFacebookPostsHandler fetches the user's Facebook Page posts
@@ -206,7 +308,7 @@ func GetFacebookPostsHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Fetch posts from Facebook Graph API
-		graphURL := fmt.Sprintf("https://graph.facebook.com/v20.0/%s/posts?fields=message,created_time,full_picture,permalink_url,likes.summary(true),comments.summary(true)&access_token=%s", pageID, accessToken)
+		graphURL := lib.GraphURL("%s/posts?fields=message,created_time,full_picture,permalink_url,likes.summary(true),comments.summary(true)&access_token=%s", pageID, url.QueryEscape(accessToken))
 		resp, err := http.Get(graphURL)
 		if err != nil {
 			http.Error(w, "Failed to contact Facebook API", http.StatusInternalServerError)
@@ -232,7 +334,7 @@ func GetFacebookPostsHandler(db *sql.DB) http.HandlerFunc {
 			if !ok || postID == "" {
 				continue
 			}
-			attachmentsURL := fmt.Sprintf("https://graph.facebook.com/v20.0/%s/attachments?access_token=%s", postID, accessToken)
+			attachmentsURL := lib.GraphURL("%s/attachments?access_token=%s", postID, url.QueryEscape(accessToken))
 			attachResp, err := http.Get(attachmentsURL)
 			if err != nil || attachResp.StatusCode != http.StatusOK {
 				continue
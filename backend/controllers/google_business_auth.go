@@ -0,0 +1,282 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"social-sync-backend/middleware"
+
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// getGoogleBusinessOAuthConfig shares the Google client with login and YouTube but asks
+// for the Business Profile scope, which needs its own consent and redirect.
+func getGoogleBusinessOAuthConfig() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
+		ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("GOOGLE_BUSINESS_REDIRECT_URI"),
+		Scopes:       []string{"https://www.googleapis.com/auth/business.manage"},
+		Endpoint:     google.Endpoint,
+	}
+}
+
+// GoogleBusinessRedirectHandler initiates the OAuth flow for Google Business Profile
+func GoogleBusinessRedirectHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appUserIDStr, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated.", http.StatusUnauthorized)
+			return
+		}
+		if _, err := uuid.Parse(appUserIDStr); err != nil {
+			http.Error(w, "Invalid user ID format.", http.StatusInternalServerError)
+			return
+		}
+
+		state, err := newOAuthState("google_business", appUserIDStr)
+		if err != nil {
+			log.Println("Failed to save Google Business OAuth state:", err)
+			http.Error(w, "Failed to start Google Business authorization", http.StatusInternalServerError)
+			return
+		}
+		// Force consent so Google always hands back a refresh token
+		authURL := getGoogleBusinessOAuthConfig().AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce)
+		http.Redirect(w, r, authURL, http.StatusTemporaryRedirect)
+	}
+}
+
+// GoogleBusinessCallbackHandler saves the account. Until a location is selected the
+// social_id holds the first business account and posting is refused.
+func GoogleBusinessCallbackHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appUserIDStr, ok, err := consumeOAuthState("google_business", r.URL.Query().Get("state"))
+		if err != nil {
+			log.Println("Failed to check Google Business OAuth state:", err)
+			http.Error(w, "Failed to check state parameter", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Invalid or expired state parameter", http.StatusBadRequest)
+			return
+		}
+
+		code := r.URL.Query().Get("code")
+		if code == "" {
+			http.Error(w, "Missing code parameter", http.StatusBadRequest)
+			return
+		}
+
+		token, err := getGoogleBusinessOAuthConfig().Exchange(context.Background(), code)
+		if err != nil {
+			http.Error(w, "Token exchange failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		accounts, err := fetchGoogleBusinessAccounts(token.AccessToken)
+		if err != nil {
+			http.Error(w, "Failed to fetch Business Profile accounts: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(accounts) == 0 {
+			http.Error(w, "This Google account doesn't manage any Business Profiles", http.StatusBadRequest)
+			return
+		}
+
+		var expiresAt *time.Time
+		if !token.Expiry.IsZero() {
+			expiresAt = &token.Expiry
+		}
+
+		_, err = db.Exec(`
+			INSERT INTO social_accounts (
+				user_id, platform, social_id, access_token, access_token_expires_at,
+				refresh_token, profile_name, connected_at
+			) VALUES (
+				$1, 'google_business', $2, $3, $4, $5, $6, NOW()
+			)
+			ON CONFLICT (user_id, platform) DO UPDATE SET
+				access_token = EXCLUDED.access_token,
+				access_token_expires_at = EXCLUDED.access_token_expires_at,
+				refresh_token = COALESCE(NULLIF(EXCLUDED.refresh_token, ''), social_accounts.refresh_token),
+				social_id = EXCLUDED.social_id,
+				profile_name = EXCLUDED.profile_name,
+				connected_at = NOW()
+		`,
+			appUserIDStr,
+			accounts[0].Name,
+			token.AccessToken,
+			expiresAt,
+			token.RefreshToken,
+			accounts[0].AccountName,
+		)
+		if err != nil {
+			http.Error(w, "Failed to save Google Business Profile account: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "http://localhost:3000/home/manage-accounts?connected=google_business", http.StatusSeeOther)
+	}
+}
+
+type googleBusinessAccount struct {
+	Name        string `json:"name"` // accounts/{id}
+	AccountName string `json:"accountName"`
+}
+
+type googleBusinessLocation struct {
+	Name    string `json:"name"` // accounts/{id}/locations/{id}
+	Title   string `json:"title"`
+	Address string `json:"address,omitempty"`
+}
+
+func fetchGoogleBusinessAccounts(accessToken string) ([]googleBusinessAccount, error) {
+	var resp struct {
+		Accounts []googleBusinessAccount `json:"accounts"`
+	}
+	err := getJSON("https://mybusinessaccountmanagement.googleapis.com/v1/accounts",
+		map[string]string{"Authorization": "Bearer " + accessToken}, &resp)
+	return resp.Accounts, err
+}
+
+// fetchGoogleBusinessLocations lists every location the user manages across all accounts
+func fetchGoogleBusinessLocations(accessToken string) ([]googleBusinessLocation, error) {
+	accounts, err := fetchGoogleBusinessAccounts(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{"Authorization": "Bearer " + accessToken}
+	locations := []googleBusinessLocation{}
+	for _, account := range accounts {
+		pageToken := ""
+		for {
+			var resp struct {
+				Locations []struct {
+					Name           string `json:"name"` // locations/{id}
+					Title          string `json:"title"`
+					StorefrontAddr struct {
+						AddressLines []string `json:"addressLines"`
+						Locality     string   `json:"locality"`
+					} `json:"storefrontAddress"`
+				} `json:"locations"`
+				NextPageToken string `json:"nextPageToken"`
+			}
+			endpoint := fmt.Sprintf("https://mybusinessbusinessinformation.googleapis.com/v1/%s/locations?readMask=name,title,storefrontAddress&pageSize=100&pageToken=%s",
+				account.Name, url.QueryEscape(pageToken))
+			if err := getJSON(endpoint, headers, &resp); err != nil {
+				return nil, err
+			}
+			for _, l := range resp.Locations {
+				address := strings.Join(l.StorefrontAddr.AddressLines, ", ")
+				if l.StorefrontAddr.Locality != "" {
+					address = strings.TrimPrefix(address+", "+l.StorefrontAddr.Locality, ", ")
+				}
+				locations = append(locations, googleBusinessLocation{
+					// Posts still live on the v4 API, which wants the account in the path
+					Name:    account.Name + "/" + l.Name,
+					Title:   l.Title,
+					Address: address,
+				})
+			}
+			if resp.NextPageToken == "" {
+				break
+			}
+			pageToken = resp.NextPageToken
+		}
+	}
+	return locations, nil
+}
+
+// GetGoogleBusinessLocationsHandler lists the locations the connected account can post to
+func GetGoogleBusinessLocationsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+		acc, err := oauthAccessToken(db, userID, "google_business", getGoogleBusinessOAuthConfig())
+		if err != nil {
+			writePlatformAccountError(w, "Google Business Profile", err)
+			return
+		}
+
+		locations, err := fetchGoogleBusinessLocations(acc.AccessToken)
+		if err != nil {
+			http.Error(w, "Failed to fetch Business Profile locations: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"locations": locations,
+			"selected":  acc.SocialID,
+		})
+	}
+}
+
+// SelectGoogleBusinessLocationHandler chooses the location posts are published to
+func SelectGoogleBusinessLocationHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			Location string `json:"location"` // accounts/{id}/locations/{id}
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Location == "" {
+			http.Error(w, "location is required", http.StatusBadRequest)
+			return
+		}
+
+		acc, err := oauthAccessToken(db, userID, "google_business", getGoogleBusinessOAuthConfig())
+		if err != nil {
+			writePlatformAccountError(w, "Google Business Profile", err)
+			return
+		}
+
+		locations, err := fetchGoogleBusinessLocations(acc.AccessToken)
+		if err != nil {
+			http.Error(w, "Failed to fetch Business Profile locations: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		var selected *googleBusinessLocation
+		for i := range locations {
+			if locations[i].Name == req.Location {
+				selected = &locations[i]
+				break
+			}
+		}
+		if selected == nil {
+			http.Error(w, "You don't manage that Business Profile location", http.StatusForbidden)
+			return
+		}
+
+		_, err = db.Exec(`
+			UPDATE social_accounts
+			SET social_id = $1, profile_name = $2, last_synced_at = NOW()
+			WHERE user_id = $3 AND platform = 'google_business'
+		`, selected.Name, selected.Title, userID)
+		if err != nil {
+			http.Error(w, "Failed to save location selection", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(selected)
+	}
+}
@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+)
+
+// Local posts were never migrated off the v4 API
+const googleBusinessPostsBase = "https://mybusiness.googleapis.com/v4"
+
+var googleBusinessActionTypes = map[string]bool{
+	"BOOK": true, "ORDER": true, "SHOP": true, "LEARN_MORE": true, "SIGN_UP": true, "CALL": true,
+}
+
+type GoogleBusinessPostRequest struct {
+	TopicType    string `json:"topicType"` // STANDARD ("What's new"), OFFER or EVENT
+	Summary      string `json:"summary"`
+	LanguageCode string `json:"languageCode"`
+	CallToAction *struct {
+		ActionType string `json:"actionType"`
+		URL        string `json:"url"` // not used by CALL, which dials the listing's phone number
+	} `json:"callToAction"`
+	MediaURLs []string `json:"mediaUrls"` // photos
+	Event     *struct {
+		Title     string    `json:"title"`
+		StartTime time.Time `json:"startTime"`
+		EndTime   time.Time `json:"endTime"`
+	} `json:"event"` // required for EVENT and OFFER posts
+	Offer *struct {
+		CouponCode      string `json:"couponCode"`
+		RedeemOnlineURL string `json:"redeemOnlineUrl"`
+		TermsConditions string `json:"termsConditions"`
+	} `json:"offer"`
+	DraftID string `json:"draftId"` // optional; links the post to a draft for later edit/delete
+}
+
+// PostToGoogleBusinessHandler publishes a local post to the selected location
+func PostToGoogleBusinessHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		var req GoogleBusinessPostRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if req.TopicType == "" {
+			req.TopicType = "STANDARD"
+		}
+		if req.LanguageCode == "" {
+			req.LanguageCode = "en"
+		}
+
+		post, err := buildGoogleBusinessPost(&req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		acc, err := oauthAccessToken(db, userID, "google_business", getGoogleBusinessOAuthConfig())
+		if err != nil {
+			writePlatformAccountError(w, "Google Business Profile", err)
+			return
+		}
+		if !strings.Contains(acc.SocialID, "/locations/") {
+			http.Error(w, "Select a Business Profile location before posting", http.StatusBadRequest)
+			return
+		}
+
+		var created struct {
+			Name      string `json:"name"`
+			SearchURL string `json:"searchUrl"`
+			State     string `json:"state"`
+		}
+		endpoint := fmt.Sprintf("%s/%s/localPosts", googleBusinessPostsBase, acc.SocialID)
+		if err := sendPlatformJSON("POST", endpoint, acc.AccessToken, post, &created); err != nil {
+			http.Error(w, "Google Business Profile API error: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		recordPublishedPost(db, req.DraftID, "google_business", userID, created.Name, created.SearchURL)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Business Profile post created",
+			"id":      created.Name,
+			"url":     created.SearchURL,
+			"state":   created.State, // LIVE, or PROCESSING while Google reviews it
+		})
+	}
+}
+
+// buildGoogleBusinessPost validates the request and converts it to a LocalPost
+func buildGoogleBusinessPost(req *GoogleBusinessPostRequest) (map[string]interface{}, error) {
+	switch req.TopicType {
+	case "STANDARD", "OFFER", "EVENT":
+	default:
+		return nil, fmt.Errorf("topicType must be STANDARD, OFFER or EVENT")
+	}
+	if len([]rune(req.Summary)) > 1500 {
+		return nil, fmt.Errorf("summary is limited to 1500 characters")
+	}
+	if req.TopicType == "STANDARD" && req.Summary == "" && len(req.MediaURLs) == 0 {
+		return nil, fmt.Errorf("summary or mediaUrls is required")
+	}
+	if req.TopicType == "OFFER" && req.CallToAction != nil {
+		return nil, fmt.Errorf("offer posts use offer.redeemOnlineUrl instead of a callToAction")
+	}
+
+	post := map[string]interface{}{
+		"languageCode": req.LanguageCode,
+		"topicType":    req.TopicType,
+	}
+	if req.Summary != "" {
+		post["summary"] = req.Summary
+	}
+
+	if req.CallToAction != nil {
+		if !googleBusinessActionTypes[req.CallToAction.ActionType] {
+			return nil, fmt.Errorf("callToAction.actionType must be one of BOOK, ORDER, SHOP, LEARN_MORE, SIGN_UP or CALL")
+		}
+		if req.CallToAction.ActionType != "CALL" && req.CallToAction.URL == "" {
+			return nil, fmt.Errorf("callToAction.url is required for %s", req.CallToAction.ActionType)
+		}
+		cta := map[string]string{"actionType": req.CallToAction.ActionType}
+		if req.CallToAction.ActionType != "CALL" {
+			cta["url"] = req.CallToAction.URL
+		}
+		post["callToAction"] = cta
+	}
+
+	if req.TopicType != "STANDARD" {
+		if req.Event == nil || req.Event.Title == "" || req.Event.StartTime.IsZero() || req.Event.EndTime.IsZero() {
+			return nil, fmt.Errorf("%s posts need event.title, event.startTime and event.endTime", strings.ToLower(req.TopicType))
+		}
+		if !req.Event.EndTime.After(req.Event.StartTime) {
+			return nil, fmt.Errorf("event.endTime must be after event.startTime")
+		}
+		post["event"] = map[string]interface{}{
+			"title": req.Event.Title,
+			"schedule": map[string]interface{}{
+				"startDate": googleDate(req.Event.StartTime),
+				"startTime": googleTimeOfDay(req.Event.StartTime),
+				"endDate":   googleDate(req.Event.EndTime),
+				"endTime":   googleTimeOfDay(req.Event.EndTime),
+			},
+		}
+	}
+	if req.TopicType == "OFFER" && req.Offer != nil {
+		offer := map[string]interface{}{}
+		setIfNotEmptyMap(offer, "couponCode", req.Offer.CouponCode)
+		setIfNotEmptyMap(offer, "redeemOnlineUrl", req.Offer.RedeemOnlineURL)
+		setIfNotEmptyMap(offer, "termsConditions", req.Offer.TermsConditions)
+		post["offer"] = offer
+	}
+
+	if len(req.MediaURLs) > 0 {
+		media := make([]map[string]string, 0, len(req.MediaURLs))
+		for _, u := range req.MediaURLs {
+			media = append(media, map[string]string{"mediaFormat": "PHOTO", "sourceUrl": u})
+		}
+		post["media"] = media
+	}
+	return post, nil
+}
+
+// googleDate and googleTimeOfDay render google.type.Date and google.type.TimeOfDay
+func googleDate(t time.Time) map[string]int {
+	return map[string]int{"year": t.Year(), "month": int(t.Month()), "day": t.Day()}
+}
+
+func googleTimeOfDay(t time.Time) map[string]int {
+	return map[string]int{"hours": t.Hour(), "minutes": t.Minute()}
+}
+
+// editGoogleBusinessPost replaces the post summary; the remote id is the full localPost name
+func editGoogleBusinessPost(db *sql.DB, acc *platformAccount, post *models.PublishedPost, content string) error {
+	refreshed, err := oauthAccessToken(db, acc.UserID, "google_business", getGoogleBusinessOAuthConfig())
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s/%s?updateMask=summary", googleBusinessPostsBase, post.RemoteID)
+	return sendPlatformJSON("PATCH", endpoint, refreshed.AccessToken, map[string]string{"summary": content}, nil)
+}
+
+func deleteGoogleBusinessPost(db *sql.DB, acc *platformAccount, post *models.PublishedPost) error {
+	refreshed, err := oauthAccessToken(db, acc.UserID, "google_business", getGoogleBusinessOAuthConfig())
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/%s", googleBusinessPostsBase, post.RemoteID), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+refreshed.AccessToken)
+	return doPlatformRequest(req)
+}
@@ -4,10 +4,10 @@ import (
 	// "context"
 	"database/sql"
 	"encoding/json"
-	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"social-sync-backend/lib"
 	"social-sync-backend/middleware"
 	// "strings"
 	// "time"
@@ -36,7 +36,7 @@ func ConnectInstagramHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Step 1: Get IG Business ID
-		graphURL := fmt.Sprintf("https://graph.facebook.com/v18.0/%s?fields=instagram_business_account&access_token=%s", pageID, fbAccessToken)
+		graphURL := lib.GraphURL("%s?fields=instagram_business_account&access_token=%s", pageID, fbAccessToken)
 		resp, err := http.Get(graphURL)
 		if err != nil {
 			log.Println("Graph API error:", err)
@@ -78,7 +78,7 @@ func ConnectInstagramHandler(db *sql.DB) http.HandlerFunc {
 		igID := igResp.InstagramBusinessAccount.ID
 
 		// Step 2: Fetch IG profile info
-		profileURL := fmt.Sprintf("https://graph.facebook.com/v18.0/%s?fields=username,profile_picture_url&access_token=%s", igID, fbAccessToken)
+		profileURL := lib.GraphURL("%s?fields=username,profile_picture_url&access_token=%s", igID, fbAccessToken)
 		profileResp, err := http.Get(profileURL)
 		if err != nil {
 			http.Error(w, "Failed to fetch Instagram profile", http.StatusInternalServerError)
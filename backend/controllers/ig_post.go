@@ -5,86 +5,36 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"strings"
-	"time"
 
+	"social-sync-backend/lib"
 	"social-sync-backend/middleware" // Assuming this path is correct for your project
-)
+	"social-sync-backend/models"
 
-// Define the Instagram Graph API version to use
-const instagramAPIVersion = "v20.0" // <--- IMPORTANT: Update to the latest stable version
+	"github.com/lib/pq"
+)
 
 type InstagramPostRequest struct {
 	Caption   string   `json:"caption"`
 	MediaUrls []string `json:"mediaUrls"`
+	DraftID   string   `json:"draftId"` // optional; links the post to a draft for later edit/delete
+
+	PostType          string   `json:"postType"`          // feed (default), reel or story; several feed items make a carousel
+	AltTexts          []string `json:"altTexts"`          // alt text per image, in mediaUrls order
+	CoverURL          string   `json:"coverUrl"`          // reel cover image
+	ThumbOffset       *int     `json:"thumbOffset"`       // reel cover frame in milliseconds, when no coverUrl
+	ShareToFeed       *bool    `json:"shareToFeed"`       // reels also appear in the feed; defaults to true
+	FirstComment      string   `json:"firstComment"`      // posted on the published media, e.g. hashtags
+	FirstCommentDelay int      `json:"firstCommentDelay"` // seconds to wait after publishing before commenting
 }
 
-// waitForMediaReady polls Instagram media container status until ready or timeout
-// This function checks the status of individual media containers (images/videos)
-// and also the carousel container itself.
-func waitForMediaReady(mediaID, accessToken string) error {
-	// Construct the URL to check the media container's status
-	statusURL := fmt.Sprintf("https://graph.facebook.com/%s/%s?fields=status_code&access_token=%s", instagramAPIVersion, mediaID, accessToken)
-
-	const maxRetries = 30                // Increased retries for more robust waiting (from 10)
-	const delay = 5 * time.Second        // Increased delay (from 3s), total wait time now up to 150 seconds
-	const initialDelay = 3 * time.Second // Initial delay before the first retry
-
-	// Small initial delay before starting the loop to allow Instagram some initial processing time
-	time.Sleep(initialDelay)
-
-	for i := 0; i < maxRetries; i++ {
-		resp, err := http.Get(statusURL)
-		if err != nil {
-			return fmt.Errorf("failed to get media status: %w", err) // Return immediately on network error
-		}
-		body, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			return fmt.Errorf("failed to read media status response: %w", err) // Return immediately on read error
-		}
-
-		if resp.StatusCode != http.StatusOK {
-			// Check if it's a specific Instagram error that means it will never be ready
-			var errRes struct {
-				Error struct {
-					Message string `json:"message"`
-					Code    int    `json:"code"`
-					Type    string `json:"type"`
-				} `json:"error"`
-			}
-			if json.Unmarshal(body, &errRes) == nil {
-				if errRes.Error.Code == 100 && strings.Contains(strings.ToLower(errRes.Error.Message), "invalid parameter") {
-					// This often indicates a permanent issue with the media itself (e.g., corrupted, unsupported format)
-					return fmt.Errorf("media processing failed due to invalid media content: %s", errRes.Error.Message)
-				}
-			}
-			return fmt.Errorf("media status check failed with HTTP status %d: %s", resp.StatusCode, body)
-		}
-
-		var res struct {
-			StatusCode string `json:"status_code"`
-		}
-		if err := json.Unmarshal(body, &res); err != nil {
-			return fmt.Errorf("failed to parse media status response: %w", err)
-		}
-
-		if res.StatusCode == "FINISHED" {
-			return nil // Media is ready to publish
-		} else if res.StatusCode == "ERROR" {
-			return fmt.Errorf("media upload failed with status 'ERROR'")
-		}
-
-		// Media is not yet finished, wait and retry
-		time.Sleep(delay)
-	}
-
-	// If loop finishes, it means media wasn't ready within the max retries
-	return fmt.Errorf("media not ready for ID %s after %d retries (%s total wait)", mediaID, maxRetries, time.Duration(maxRetries)*delay)
-}
-
+// PostToInstagramHandler creates the media containers and queues the post. Instagram
+// processes containers asynchronously, so a background job (ProcessInstagramPublishJobs)
+// polls them and publishes; progress is available from GetInstagramPublishJobHandler and
+// over the workspace WebSocket.
 func PostToInstagramHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, err := middleware.GetUserIDFromContext(r)
@@ -99,7 +49,17 @@ func PostToInstagramHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		if strings.TrimSpace(req.Caption) == "" {
+		postType := req.PostType
+		if postType == "" {
+			postType = "feed"
+		}
+		if postType != "feed" && postType != "reel" && postType != "story" {
+			http.Error(w, "postType must be feed, reel or story", http.StatusBadRequest)
+			return
+		}
+
+		// Stories have no caption
+		if postType != "story" && strings.TrimSpace(req.Caption) == "" {
 			http.Error(w, "Caption cannot be empty", http.StatusBadRequest)
 			return
 		}
@@ -113,6 +73,24 @@ func PostToInstagramHandler(db *sql.DB) http.HandlerFunc {
 			http.Error(w, "Instagram carousel posts can have at most 10 media items", http.StatusBadRequest)
 			return
 		}
+		if postType != "feed" && mediaCount > 1 {
+			http.Error(w, fmt.Sprintf("Instagram %ss take a single media item", postType), http.StatusBadRequest)
+			return
+		}
+		isVideo := instagramVideoFlags(req.MediaUrls)
+		// Single feed videos are published as Reels; Instagram no longer has feed-only videos
+		if postType == "feed" && mediaCount == 1 && isVideo[0] {
+			postType = "reel"
+		}
+		if postType == "reel" && !isVideo[0] {
+			http.Error(w, "Instagram Reels must be a video", http.StatusBadRequest)
+			return
+		}
+		// Library media is swapped for its Instagram rendition for this placement
+		req.MediaUrls = renditionURLs(req.MediaUrls, "instagram", postType)
+		if postType == "feed" && mediaCount > 1 {
+			postType = "carousel"
+		}
 
 		var accessToken, instagramUserID string
 		err = db.QueryRow(`
@@ -124,163 +102,216 @@ func PostToInstagramHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		mediaContainerIDs := make([]string, 0, mediaCount)
-
-		// Declare 'body' here once for the entire function scope
-		var body []byte
+		altText := func(i int) string {
+			if i < len(req.AltTexts) {
+				return strings.TrimSpace(req.AltTexts[i])
+			}
+			return ""
+		}
 
-		for _, mediaURL := range req.MediaUrls {
-			form := url.Values{}
-			form.Set("is_carousel_item", "true") // All media items are considered carousel items for this flow
+		job := &models.InstagramPublishJob{
+			UserID:            userID,
+			PostType:          postType,
+			FirstCommentDelay: req.FirstCommentDelay,
+		}
+		if req.Caption != "" && postType != "story" {
+			job.Caption = &req.Caption
+		}
+		if c := strings.TrimSpace(req.FirstComment); c != "" {
+			job.FirstComment = &c
+		}
 
-			lower := strings.ToLower(mediaURL)
-			if strings.HasSuffix(lower, ".mp4") || strings.HasSuffix(lower, ".mov") {
-				form.Set("media_type", "VIDEO")
-				form.Set("video_url", mediaURL)
-			} else {
-				form.Set("media_type", "IMAGE")
-				form.Set("image_url", mediaURL)
+		// Step 1: Create the media containers
+		switch postType {
+		case "carousel":
+			for i, mediaURL := range req.MediaUrls {
+				form := instagramMediaForm(mediaURL, isVideo[i], altText(i))
+				form.Set("is_carousel_item", "true")
+				id, err := createInstagramContainer(instagramUserID, accessToken, form)
+				if err != nil {
+					http.Error(w, fmt.Sprintf("Media container creation failed: %v", err), http.StatusInternalServerError)
+					return
+				}
+				job.ChildContainerIDs = append(job.ChildContainerIDs, id)
 			}
+			job.Status = "waiting_children"
 
-			form.Set("access_token", accessToken)
-
-			// Step 1: Create individual media container
-			createMediaURL := fmt.Sprintf("https://graph.facebook.com/%s/%s/media", instagramAPIVersion, instagramUserID)
-			resp, err := http.Post(
-				createMediaURL,
-				"application/x-www-form-urlencoded",
-				strings.NewReader(form.Encode()),
-			)
-			if err != nil {
-				http.Error(w, "Failed to create media container", http.StatusInternalServerError)
-				return
+		default:
+			form := url.Values{}
+			switch postType {
+			case "reel":
+				form.Set("media_type", "REELS")
+				form.Set("video_url", req.MediaUrls[0])
+				form.Set("caption", req.Caption)
+				shareToFeed := req.ShareToFeed == nil || *req.ShareToFeed
+				form.Set("share_to_feed", fmt.Sprintf("%t", shareToFeed))
+				if req.CoverURL != "" {
+					form.Set("cover_url", req.CoverURL)
+				} else if req.ThumbOffset != nil {
+					form.Set("thumb_offset", fmt.Sprintf("%d", *req.ThumbOffset))
+				}
+			case "story":
+				form = instagramMediaForm(req.MediaUrls[0], isVideo[0], "")
+				form.Set("media_type", "STORIES")
+			default:
+				form = instagramMediaForm(req.MediaUrls[0], isVideo[0], altText(0))
+				form.Set("caption", req.Caption)
 			}
-			// Use '=' for reassignment, not ':='
-			body, err = io.ReadAll(resp.Body)
-			resp.Body.Close()
+			id, err := createInstagramContainer(instagramUserID, accessToken, form)
 			if err != nil {
-				http.Error(w, "Failed to read media container creation response", http.StatusInternalServerError)
-				return
-			}
-
-			if resp.StatusCode != http.StatusOK {
-				http.Error(w, fmt.Sprintf("Media container creation failed: %s", body), http.StatusInternalServerError)
+				http.Error(w, fmt.Sprintf("Media container creation failed: %v", err), http.StatusInternalServerError)
 				return
 			}
+			job.ContainerID = &id
+			job.Status = "waiting_container"
+		}
 
-			var result struct {
-				ID string `json:"id"`
-			}
-			if err := json.Unmarshal(body, &result); err != nil || result.ID == "" {
-				http.Error(w, "Invalid response from media container creation", http.StatusInternalServerError)
-				return
-			}
-
-			// Step 2: Wait for individual media container to be ready
-			if err := waitForMediaReady(result.ID, accessToken); err != nil {
-				http.Error(w, fmt.Sprintf("Media item failed to process: %v", err), http.StatusInternalServerError)
-				return
+		if req.DraftID != "" {
+			job.DraftID = &req.DraftID
+			var workspaceID string
+			if err := db.QueryRow(`SELECT workspace_id FROM draft_posts WHERE id = $1`, req.DraftID).Scan(&workspaceID); err == nil {
+				job.WorkspaceID = &workspaceID
 			}
+		}
 
-			mediaContainerIDs = append(mediaContainerIDs, result.ID)
+		// Step 2: Hand the rest to the background job
+		if err := createInstagramPublishJob(db, job); err != nil {
+			log.Printf("Failed to queue Instagram post: %v", err)
+			http.Error(w, "Failed to queue Instagram post", http.StatusInternalServerError)
+			return
 		}
 
-		if mediaCount == 1 {
-			// Single media post publish (This path handles both images and videos)
-			publishForm := url.Values{}
-			publishForm.Set("creation_id", mediaContainerIDs[0])
-			publishForm.Set("caption", req.Caption) // Add caption for single media posts
-			publishForm.Set("access_token", accessToken)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":   "Instagram post is processing and will be published shortly",
+			"job_id":    job.ID,
+			"post_type": job.PostType,
+			"status":    job.Status,
+		})
+	}
+}
 
-			publishURL := fmt.Sprintf("https://graph.facebook.com/%s/%s/media_publish", instagramAPIVersion, instagramUserID)
-			publishResp, err := http.Post(publishURL, "application/x-www-form-urlencoded", strings.NewReader(publishForm.Encode()))
-			if err != nil {
-				http.Error(w, "Failed to publish post", http.StatusInternalServerError)
-				return
-			}
-			// Use '=' for reassignment, not ':='
-			body, err = io.ReadAll(publishResp.Body)
-			publishResp.Body.Close()
-			if err != nil {
-				http.Error(w, "Failed to read publish response", http.StatusInternalServerError)
-				return
-			}
+// instagramMediaForm builds the container fields for one image or video
+func instagramMediaForm(mediaURL string, isVideo bool, altText string) url.Values {
+	form := url.Values{}
+	if isVideo {
+		form.Set("media_type", "VIDEO")
+		form.Set("video_url", mediaURL)
+	} else {
+		form.Set("image_url", mediaURL)
+		if altText != "" {
+			form.Set("alt_text", altText)
+		}
+	}
+	return form
+}
 
-			if publishResp.StatusCode != http.StatusOK {
-				http.Error(w, fmt.Sprintf("Publish failed: %s", body), http.StatusInternalServerError)
-				return
+// instagramVideoFlags says which media URLs are videos: library media by its mime_type,
+// other URLs by asking their server (see detectMimeType)
+func instagramVideoFlags(mediaURLs []string) []bool {
+	libraryTypes := map[string]string{}
+	rows, err := lib.DB.Query(`
+		SELECT file_url, mime_type FROM media WHERE file_url = ANY($1) AND deleted_at IS NULL
+	`, pq.Array(mediaURLs))
+	if err != nil {
+		log.Printf("Failed to look up media types: %v", err)
+	} else {
+		for rows.Next() {
+			var fileURL, mimeType string
+			if err := rows.Scan(&fileURL, &mimeType); err == nil {
+				libraryTypes[fileURL] = mimeType
 			}
+		}
+		rows.Close()
+	}
 
-		} else {
-			// Carousel post creation and publish
-			carouselForm := url.Values{}
-			carouselForm.Set("media_type", "CAROUSEL")
-			carouselForm.Set("children", strings.Join(mediaContainerIDs, ","))
-			carouselForm.Set("caption", req.Caption)
-			carouselForm.Set("access_token", accessToken)
-
-			// Step 3: Create carousel container
-			createCarouselURL := fmt.Sprintf("https://graph.facebook.com/%s/%s/media", instagramAPIVersion, instagramUserID)
-			carouselResp, err := http.Post(createCarouselURL, "application/x-www-form-urlencoded", strings.NewReader(carouselForm.Encode()))
-			if err != nil {
-				http.Error(w, "Failed to create carousel container", http.StatusInternalServerError)
-				return
-			}
-			// Use '=' for reassignment, not ':='
-			body, err = io.ReadAll(carouselResp.Body)
-			carouselResp.Body.Close()
-			if err != nil {
-				http.Error(w, "Failed to read carousel container creation response", http.StatusInternalServerError)
-				return
-			}
+	flags := make([]bool, len(mediaURLs))
+	for i, u := range mediaURLs {
+		mimeType, ok := libraryTypes[u]
+		if !ok {
+			mimeType = detectMimeType(u)
+		}
+		flags[i] = strings.HasPrefix(mimeType, "video/")
+	}
+	return flags
+}
 
-			if carouselResp.StatusCode != http.StatusOK {
-				http.Error(w, fmt.Sprintf("Carousel container creation failed: %s", body), http.StatusInternalServerError)
-				return
-			}
+// createInstagramContainer creates a media container and returns its ID
+func createInstagramContainer(instagramUserID, accessToken string, form url.Values) (string, error) {
+	form.Set("access_token", accessToken)
+	createMediaURL := lib.GraphURL("%s/media", instagramUserID)
+	return postInstagramForm(createMediaURL, form)
+}
 
-			var carouselResult struct {
-				ID string `json:"id"`
-			}
-			if err := json.Unmarshal(body, &carouselResult); err != nil || carouselResult.ID == "" {
-				http.Error(w, "Invalid carousel container creation response", http.StatusInternalServerError)
-				return
-			}
+// postInstagramForm posts a Graph API form and returns the "id" in the response
+func postInstagramForm(endpoint string, form url.Values) (string, error) {
+	resp, err := http.Post(endpoint, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
 
-			// Step 4: Wait for carousel container to be ready
-			if err := waitForMediaReady(carouselResult.ID, accessToken); err != nil {
-				http.Error(w, fmt.Sprintf("Carousel post failed to process: %v", err), http.StatusInternalServerError)
-				return
-			}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s", body)
+	}
 
-			// Step 5: Publish the carousel
-			publishForm := url.Values{}
-			publishForm.Set("creation_id", carouselResult.ID)
-			publishForm.Set("access_token", accessToken)
+	var result struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || result.ID == "" {
+		return "", fmt.Errorf("invalid response: %s", body)
+	}
+	return result.ID, nil
+}
 
-			publishURL := fmt.Sprintf("https://graph.facebook.com/%s/%s/media_publish", instagramAPIVersion, instagramUserID)
-			publishResp, err := http.Post(publishURL, "application/x-www-form-urlencoded", strings.NewReader(publishForm.Encode()))
-			if err != nil {
-				http.Error(w, "Failed to publish carousel post", http.StatusInternalServerError)
-				return
-			}
-			// Use '=' for reassignment, not ':='
-			body, err = io.ReadAll(publishResp.Body)
-			publishResp.Body.Close()
-			if err != nil {
-				http.Error(w, "Failed to read publish response", http.StatusInternalServerError)
-				return
-			}
+// checkInstagramContainer returns a container's status_code: IN_PROGRESS, FINISHED,
+// PUBLISHED, ERROR or EXPIRED
+func checkInstagramContainer(containerID, accessToken string) (string, error) {
+	statusURL := lib.GraphURL("%s?fields=status_code,status&access_token=%s", containerID, url.QueryEscape(accessToken))
+	resp, err := http.Get(statusURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to get media status: %w", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to read media status response: %w", err)
+	}
 
-			if publishResp.StatusCode != http.StatusOK {
-				http.Error(w, fmt.Sprintf("Carousel publish failed: %s", body), http.StatusInternalServerError)
-				return
+	if resp.StatusCode != http.StatusOK {
+		// Check if it's a specific Instagram error that means it will never be ready
+		var errRes struct {
+			Error struct {
+				Message string `json:"message"`
+				Code    int    `json:"code"`
+				Type    string `json:"type"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(body, &errRes) == nil {
+			if errRes.Error.Code == 100 && strings.Contains(strings.ToLower(errRes.Error.Message), "invalid parameter") {
+				// This often indicates a permanent issue with the media itself (e.g., corrupted, unsupported format)
+				return "ERROR", fmt.Errorf("media processing failed due to invalid media content: %s", errRes.Error.Message)
 			}
 		}
+		return "", fmt.Errorf("media status check failed with HTTP status %d: %s", resp.StatusCode, body)
+	}
 
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("Instagram post published successfully"))
+	var res struct {
+		StatusCode string `json:"status_code"`
+		Status     string `json:"status"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return "", fmt.Errorf("failed to parse media status response: %w", err)
+	}
+	if res.StatusCode == "ERROR" || res.StatusCode == "EXPIRED" {
+		return res.StatusCode, fmt.Errorf("media container %s: %s", strings.ToLower(res.StatusCode), res.Status)
 	}
+	return res.StatusCode, nil
 }
 
 // GetInstagramPostsHandler fetches the user's Instagram posts
@@ -292,13 +323,13 @@ func GetInstagramPostsHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Get Instagram access token
-		var accessToken string
+		// Get Instagram account ID and access token
+		var igUserID, accessToken string
 		err = db.QueryRow(`
-			SELECT access_token
+			SELECT social_id, access_token
 			FROM social_accounts
 			WHERE user_id = $1 AND platform = 'instagram'
-		`, userID).Scan(&accessToken)
+		`, userID).Scan(&igUserID, &accessToken)
 		if err == sql.ErrNoRows {
 			http.Error(w, "Instagram account not connected", http.StatusBadRequest)
 			return
@@ -308,7 +339,8 @@ func GetInstagramPostsHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Fetch posts from Instagram Graph API
-		graphURL := "https://graph.instagram.com/me/media?fields=id,caption,media_type,media_url,permalink,thumbnail_url,timestamp,like_count,comments_count&access_token=" + accessToken
+		graphURL := lib.GraphURL("%s/media?fields=id,caption,media_type,media_url,permalink,thumbnail_url,timestamp,like_count,comments_count&access_token=%s",
+			igUserID, url.QueryEscape(accessToken))
 		resp, err := http.Get(graphURL)
 		if err != nil {
 			http.Error(w, "Failed to contact Instagram API", http.StatusInternalServerError)
@@ -0,0 +1,301 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	instagramCheckInterval = 10 * time.Second
+	// Reels can take several minutes to process
+	instagramMaxChecks = 90
+	// instagramJobClaim is how long a claimed job is left to its instance before another
+	// may pick it up. It covers a whole batch; saving a job releases it sooner.
+	instagramJobClaim = 10 * time.Minute
+)
+
+const instagramJobColumns = `
+	id, user_id, workspace_id, draft_id, post_type, caption, child_container_ids, container_id, status,
+	ig_media_id, permalink, first_comment, first_comment_delay, first_comment_at, first_comment_status,
+	first_comment_id, checks, next_check_at, error, created_at, updated_at`
+
+// GetInstagramPublishJobHandler reports the progress of a queued Instagram post
+func GetInstagramPublishJobHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		row := db.QueryRow(`SELECT `+instagramJobColumns+` FROM instagram_publish_jobs WHERE id = $1 AND user_id = $2`,
+			mux.Vars(r)["jobId"], userID)
+		job, err := scanInstagramPublishJob(row)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Instagram post not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch Instagram post", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(job)
+	}
+}
+
+// ProcessInstagramPublishJobs advances every queued Instagram post that is due: it polls
+// container status, publishes finished containers and posts pending first comments.
+// It runs from the cron in main.go. Jobs are claimed with SKIP LOCKED so several instances
+// can run it side by side without publishing a post twice; the claim lasts until the job
+// is saved, or instagramJobClaim if its instance dies first.
+func ProcessInstagramPublishJobs(db *sql.DB) {
+	rows, err := db.Query(`
+		UPDATE instagram_publish_jobs
+		SET claimed_until = $1
+		WHERE id IN (
+			SELECT id FROM instagram_publish_jobs
+			WHERE ((status IN ('waiting_children', 'waiting_container') AND next_check_at <= now())
+			    OR (status = 'published' AND first_comment_status = 'pending' AND first_comment_at <= now()))
+			  AND (claimed_until IS NULL OR claimed_until < now())
+			ORDER BY next_check_at
+			LIMIT 25
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+instagramJobColumns,
+		time.Now().Add(instagramJobClaim))
+	if err != nil {
+		log.Println("Failed to claim Instagram publish jobs:", err)
+		return
+	}
+	var jobs []*models.InstagramPublishJob
+	for rows.Next() {
+		job, err := scanInstagramPublishJob(rows)
+		if err != nil {
+			log.Println("Failed to scan Instagram publish job:", err)
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	rows.Close()
+
+	for _, job := range jobs {
+		advanceInstagramPublishJob(db, job)
+	}
+}
+
+func advanceInstagramPublishJob(db *sql.DB, job *models.InstagramPublishJob) {
+	acc, err := loadPlatformAccount(db, job.UserID, "instagram")
+	if err != nil {
+		failInstagramPublishJob(db, job, fmt.Errorf("Instagram account not connected"))
+		return
+	}
+
+	switch job.Status {
+	case "waiting_children":
+		for _, childID := range job.ChildContainerIDs {
+			status, err := checkInstagramContainer(childID, acc.AccessToken)
+			if status == "ERROR" || status == "EXPIRED" {
+				failInstagramPublishJob(db, job, fmt.Errorf("Media item failed to process: %v", err))
+				return
+			}
+			if err != nil || status != "FINISHED" {
+				retryInstagramPublishJob(db, job, err)
+				return
+			}
+		}
+
+		// Step 3: Every item is ready, so create the carousel container
+		form := url.Values{}
+		form.Set("media_type", "CAROUSEL")
+		form.Set("children", strings.Join(job.ChildContainerIDs, ","))
+		if job.Caption != nil {
+			form.Set("caption", *job.Caption)
+		}
+		containerID, err := createInstagramContainer(acc.SocialID, acc.AccessToken, form)
+		if err != nil {
+			failInstagramPublishJob(db, job, fmt.Errorf("Carousel container creation failed: %v", err))
+			return
+		}
+		job.ContainerID = &containerID
+		job.Status = "waiting_container"
+		job.Checks = 0
+		job.NextCheckAt = time.Now().Add(instagramCheckInterval)
+		saveInstagramPublishJob(db, job)
+
+	case "waiting_container":
+		// A media ID means an earlier run published but couldn't save the job; publishing
+		// again would post twice
+		if job.IGMediaID == nil {
+			status, err := checkInstagramContainer(*job.ContainerID, acc.AccessToken)
+			if status == "ERROR" || status == "EXPIRED" {
+				failInstagramPublishJob(db, job, fmt.Errorf("Post failed to process: %v", err))
+				return
+			}
+			if err != nil || status != "FINISHED" {
+				retryInstagramPublishJob(db, job, err)
+				return
+			}
+
+			// Step 4: Publish
+			publishForm := url.Values{}
+			publishForm.Set("creation_id", *job.ContainerID)
+			publishForm.Set("access_token", acc.AccessToken)
+			publishURL := lib.GraphURL("%s/media_publish", acc.SocialID)
+			mediaID, err := postInstagramForm(publishURL, publishForm)
+			if err != nil {
+				failInstagramPublishJob(db, job, fmt.Errorf("Publish failed: %v", err))
+				return
+			}
+			job.IGMediaID = &mediaID
+			if _, err := db.Exec(`
+				UPDATE instagram_publish_jobs SET ig_media_id = $1, updated_at = now() WHERE id = $2
+			`, mediaID, job.ID); err != nil {
+				log.Printf("Failed to record published media %s on Instagram publish job %s: %v", mediaID, job.ID, err)
+			}
+		}
+
+		mediaID := *job.IGMediaID
+		job.Status = "published"
+		if permalink := fetchInstagramPermalink(mediaID, acc.AccessToken); permalink != "" {
+			job.Permalink = &permalink
+		}
+		if job.FirstComment != nil {
+			pending := "pending"
+			commentAt := time.Now().Add(time.Duration(job.FirstCommentDelay) * time.Second)
+			job.FirstCommentStatus = &pending
+			job.FirstCommentAt = &commentAt
+		}
+		saveInstagramPublishJob(db, job)
+		recordPublishedPost(db, derefString(job.DraftID), "instagram", job.UserID, mediaID, derefString(job.Permalink))
+
+		if job.FirstComment != nil && !job.FirstCommentAt.After(time.Now()) {
+			postInstagramFirstComment(db, job, acc)
+		}
+
+	case "published":
+		postInstagramFirstComment(db, job, acc)
+	}
+}
+
+// postInstagramFirstComment comments on the published media, typically with hashtags
+func postInstagramFirstComment(db *sql.DB, job *models.InstagramPublishJob, acc *platformAccount) {
+	form := url.Values{}
+	form.Set("message", *job.FirstComment)
+	form.Set("access_token", acc.AccessToken)
+	commentURL := lib.GraphURL("%s/comments", *job.IGMediaID)
+
+	commentID, err := postInstagramForm(commentURL, form)
+	status := "posted"
+	if err != nil {
+		log.Printf("Failed to post first comment on Instagram media %s: %v", *job.IGMediaID, err)
+		status = "failed"
+		msg := fmt.Sprintf("First comment failed: %v", err)
+		job.Error = &msg
+	} else {
+		job.FirstCommentID = &commentID
+	}
+	job.FirstCommentStatus = &status
+	saveInstagramPublishJob(db, job)
+}
+
+// retryInstagramPublishJob schedules another status check, giving up after instagramMaxChecks
+func retryInstagramPublishJob(db *sql.DB, job *models.InstagramPublishJob, checkErr error) {
+	job.Checks++
+	if job.Checks >= instagramMaxChecks {
+		failInstagramPublishJob(db, job, fmt.Errorf("media not ready after %d checks", job.Checks))
+		return
+	}
+	if checkErr != nil {
+		log.Printf("Instagram publish job %s status check failed: %v", job.ID, checkErr)
+	}
+	job.NextCheckAt = time.Now().Add(instagramCheckInterval)
+	saveInstagramPublishJob(db, job)
+}
+
+func failInstagramPublishJob(db *sql.DB, job *models.InstagramPublishJob, err error) {
+	log.Printf("Instagram publish job %s failed: %v", job.ID, err)
+	msg := err.Error()
+	job.Status = "failed"
+	job.Error = &msg
+	saveInstagramPublishJob(db, job)
+}
+
+func fetchInstagramPermalink(mediaID, accessToken string) string {
+	var media struct {
+		Permalink string `json:"permalink"`
+	}
+	endpoint := lib.GraphURL("%s?fields=permalink&access_token=%s", mediaID, url.QueryEscape(accessToken))
+	if err := getJSON(endpoint, nil, &media); err != nil {
+		log.Printf("Failed to fetch permalink for Instagram media %s: %v", mediaID, err)
+	}
+	return media.Permalink
+}
+
+func createInstagramPublishJob(db *sql.DB, job *models.InstagramPublishJob) error {
+	return db.QueryRow(`
+		INSERT INTO instagram_publish_jobs (user_id, workspace_id, draft_id, post_type, caption, child_container_ids,
+		                                    container_id, status, first_comment, first_comment_delay, next_check_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, now() + interval '5 seconds')
+		RETURNING id, next_check_at, created_at, updated_at
+	`, job.UserID, job.WorkspaceID, job.DraftID, job.PostType, job.Caption, pqStringArray(job.ChildContainerIDs),
+		job.ContainerID, job.Status, job.FirstComment, job.FirstCommentDelay).Scan(&job.ID, &job.NextCheckAt, &job.CreatedAt, &job.UpdatedAt)
+}
+
+// saveInstagramPublishJob persists the job, releasing any claim on it, and broadcasts its
+// status to the workspace
+func saveInstagramPublishJob(db *sql.DB, job *models.InstagramPublishJob) {
+	_, err := db.Exec(`
+		UPDATE instagram_publish_jobs
+		SET container_id = $1, status = $2, ig_media_id = $3, permalink = $4, first_comment_at = $5,
+		    first_comment_status = $6, first_comment_id = $7, checks = $8, next_check_at = $9, error = $10,
+		    claimed_until = NULL, updated_at = now()
+		WHERE id = $11
+	`, job.ContainerID, job.Status, job.IGMediaID, job.Permalink, job.FirstCommentAt, job.FirstCommentStatus,
+		job.FirstCommentID, job.Checks, job.NextCheckAt, job.Error, job.ID)
+	if err != nil {
+		log.Printf("Failed to save Instagram publish job %s: %v", job.ID, err)
+	}
+
+	if job.WorkspaceID == nil {
+		return
+	}
+	msg, _ := json.Marshal(map[string]interface{}{
+		"type":               "instagram_publish_status",
+		"jobId":              job.ID,
+		"draftId":            job.DraftID,
+		"postType":           job.PostType,
+		"status":             job.Status,
+		"permalink":          job.Permalink,
+		"firstCommentStatus": job.FirstCommentStatus,
+		"error":              job.Error,
+	})
+	hub.broadcast(*job.WorkspaceID, websocket.TextMessage, msg)
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanInstagramPublishJob(row rowScanner) (*models.InstagramPublishJob, error) {
+	var j models.InstagramPublishJob
+	err := row.Scan(&j.ID, &j.UserID, &j.WorkspaceID, &j.DraftID, &j.PostType, &j.Caption, &j.ChildContainerIDs,
+		&j.ContainerID, &j.Status, &j.IGMediaID, &j.Permalink, &j.FirstComment, &j.FirstCommentDelay, &j.FirstCommentAt,
+		&j.FirstCommentStatus, &j.FirstCommentID, &j.Checks, &j.NextCheckAt, &j.Error, &j.CreatedAt, &j.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
@@ -0,0 +1,740 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+type inboxFetcher func(db *sql.DB, acc *platformAccount) ([]models.InboxItem, error)
+type inboxReplier func(db *sql.DB, acc *platformAccount, item *models.InboxItem, message string) error
+
+var inboxFetchers = map[string]inboxFetcher{
+	"facebook":  fetchFacebookInbox,
+	"instagram": fetchInstagramInbox,
+	"youtube":   fetchYouTubeInbox,
+	"mastodon":  fetchMastodonInbox,
+}
+
+var inboxRepliers = map[string]inboxReplier{
+	"facebook":  replyFacebookComment,
+	"instagram": replyInstagramComment,
+	"youtube":   replyYouTubeComment,
+	"mastodon":  replyMastodonStatus,
+}
+
+// graphTimeLayout is the timestamp format used by the Facebook and Instagram Graph APIs
+const graphTimeLayout = "2006-01-02T15:04:05-0700"
+
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// ListInboxItems lists inbox items for a workspace.
+// Optional query params: platform, status (read|unread), assignee (user ID, "me" or "none"), limit.
+func ListInboxItems(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	vars := mux.Vars(r)
+	workspaceID := vars["workspaceId"]
+
+	if !isWorkspaceMember(userID, workspaceID) {
+		http.Error(w, "Not a member of this workspace", http.StatusForbidden)
+		return
+	}
+
+	query := `
+		SELECT i.id, i.workspace_id, i.account_user_id, i.platform, i.external_id, i.post_external_id,
+		       i.author_name, i.author_avatar, i.content, i.permalink, i.is_read, i.assignee_id,
+		       i.replied_at, i.received_at, i.created_at, i.updated_at, u.name
+		FROM inbox_items i
+		LEFT JOIN users u ON i.assignee_id = u.id
+		WHERE i.workspace_id = $1
+	`
+	args := []interface{}{workspaceID}
+	argIndex := 2
+
+	if platform := r.URL.Query().Get("platform"); platform != "" {
+		query += fmt.Sprintf(" AND i.platform = $%d", argIndex)
+		args = append(args, platform)
+		argIndex++
+	}
+	switch r.URL.Query().Get("status") {
+	case "read":
+		query += " AND i.is_read = true"
+	case "unread":
+		query += " AND i.is_read = false"
+	}
+	switch assignee := r.URL.Query().Get("assignee"); assignee {
+	case "":
+	case "none":
+		query += " AND i.assignee_id IS NULL"
+	default:
+		if assignee == "me" {
+			assignee = userID
+		}
+		query += fmt.Sprintf(" AND i.assignee_id = $%d", argIndex)
+		args = append(args, assignee)
+		argIndex++
+	}
+
+	limit := 50
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 200 {
+		limit = l
+	}
+	query += fmt.Sprintf(" ORDER BY i.received_at DESC NULLS LAST LIMIT $%d", argIndex)
+	args = append(args, limit)
+
+	rows, err := lib.DB.Query(query, args...)
+	if err != nil {
+		log.Println("Failed to query inbox items:", err)
+		http.Error(w, "Failed to fetch inbox", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	items := []models.InboxItem{}
+	for rows.Next() {
+		var item models.InboxItem
+		if err := rows.Scan(&item.ID, &item.WorkspaceID, &item.AccountUserID, &item.Platform, &item.ExternalID,
+			&item.PostExternalID, &item.AuthorName, &item.AuthorAvatar, &item.Content, &item.Permalink,
+			&item.IsRead, &item.AssigneeID, &item.RepliedAt, &item.ReceivedAt, &item.CreatedAt,
+			&item.UpdatedAt, &item.AssigneeName); err != nil {
+			log.Println("Failed to scan inbox item:", err)
+			http.Error(w, "Failed to fetch inbox", http.StatusInternalServerError)
+			return
+		}
+		items = append(items, item)
+	}
+
+	var unread int
+	if err := lib.DB.QueryRow(`SELECT COUNT(*) FROM inbox_items WHERE workspace_id = $1 AND is_read = false`, workspaceID).Scan(&unread); err != nil {
+		log.Println("Failed to count unread inbox items:", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"items":  items,
+		"unread": unread,
+	})
+}
+
+// SyncInbox pulls comments and replies from the caller's connected accounts into the workspace inbox
+func SyncInbox(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	vars := mux.Vars(r)
+	workspaceID := vars["workspaceId"]
+
+	if !isWorkspaceMember(userID, workspaceID) {
+		http.Error(w, "Not a member of this workspace", http.StatusForbidden)
+		return
+	}
+
+	rows, err := lib.DB.Query(`
+		SELECT platform, social_id, access_token, COALESCE(refresh_token, '')
+		FROM social_accounts
+		WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		log.Println("Failed to load social accounts for inbox sync:", err)
+		http.Error(w, "Failed to load social accounts", http.StatusInternalServerError)
+		return
+	}
+	var accounts []platformAccount
+	for rows.Next() {
+		acc := platformAccount{UserID: userID}
+		if err := rows.Scan(&acc.Platform, &acc.SocialID, &acc.AccessToken, &acc.RefreshToken); err != nil {
+			rows.Close()
+			http.Error(w, "Failed to load social accounts", http.StatusInternalServerError)
+			return
+		}
+		accounts = append(accounts, acc)
+	}
+	rows.Close()
+
+	synced := map[string]int{}
+	syncErrors := map[string]string{}
+	for i := range accounts {
+		acc := &accounts[i]
+		fetch, ok := inboxFetchers[acc.Platform]
+		if !ok {
+			continue
+		}
+		items, err := fetch(lib.DB, acc)
+		if err != nil {
+			log.Printf("Inbox sync failed for %s (user %s): %v", acc.Platform, userID, err)
+			syncErrors[acc.Platform] = err.Error()
+			continue
+		}
+		for _, item := range items {
+			if err := upsertInboxItem(workspaceID, userID, item); err != nil {
+				log.Printf("Failed to store %s inbox item %s: %v", acc.Platform, item.ExternalID, err)
+				continue
+			}
+			synced[acc.Platform]++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"synced": synced,
+		"errors": syncErrors,
+	})
+
+	msg, _ := json.Marshal(map[string]interface{}{
+		"type":   "inbox_synced",
+		"synced": synced,
+	})
+	hub.broadcast(workspaceID, websocket.TextMessage, msg)
+}
+
+// UpdateInboxItem sets the read state and/or assignee of an inbox item.
+// An empty assignee_id clears the assignment.
+func UpdateInboxItem(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	vars := mux.Vars(r)
+	workspaceID := vars["workspaceId"]
+	itemID := vars["itemId"]
+
+	if !isWorkspaceMember(userID, workspaceID) {
+		http.Error(w, "Not a member of this workspace", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		IsRead     *bool   `json:"is_read"`
+		AssigneeID *string `json:"assignee_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	setClauses := []string{}
+	args := []interface{}{}
+	argIdx := 1
+	if req.IsRead != nil {
+		setClauses = append(setClauses, "is_read = $"+itoa(argIdx))
+		args = append(args, *req.IsRead)
+		argIdx++
+	}
+	if req.AssigneeID != nil {
+		if *req.AssigneeID != "" && !isWorkspaceMember(*req.AssigneeID, workspaceID) {
+			http.Error(w, "Assignee is not a member of this workspace", http.StatusBadRequest)
+			return
+		}
+		setClauses = append(setClauses, "assignee_id = $"+itoa(argIdx))
+		args = append(args, nullIfEmpty(*req.AssigneeID))
+		argIdx++
+	}
+	if len(setClauses) == 0 {
+		http.Error(w, "No fields to update", http.StatusBadRequest)
+		return
+	}
+	setClauses = append(setClauses, "updated_at = $"+itoa(argIdx))
+	args = append(args, time.Now())
+	argIdx++
+
+	args = append(args, itemID, workspaceID)
+	query := "UPDATE inbox_items SET " + joinClauses(setClauses, ", ") +
+		" WHERE id = $" + itoa(argIdx) + " AND workspace_id = $" + itoa(argIdx+1)
+	result, err := lib.DB.Exec(query, args...)
+	if err != nil {
+		log.Println("Failed to update inbox item:", err)
+		http.Error(w, "Failed to update inbox item", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Inbox item not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Inbox item updated successfully"})
+
+	msg, _ := json.Marshal(map[string]interface{}{
+		"type":   "inbox_item_updated",
+		"itemId": itemID,
+		"update": req,
+	})
+	hub.broadcast(workspaceID, websocket.TextMessage, msg)
+}
+
+// ReplyToInboxItem replies to an inbox item through its platform's API,
+// using the social account the item was synced from. Only the account's owner or an
+// admin/editor may reply.
+func ReplyToInboxItem(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	vars := mux.Vars(r)
+	workspaceID := vars["workspaceId"]
+	itemID := vars["itemId"]
+
+	if !isWorkspaceMember(userID, workspaceID) {
+		http.Error(w, "Not a member of this workspace", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	message := strings.TrimSpace(req.Message)
+	if message == "" {
+		http.Error(w, "Message cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	var item models.InboxItem
+	err := lib.DB.QueryRow(`
+		SELECT id, account_user_id, platform, external_id, post_external_id
+		FROM inbox_items WHERE id = $1 AND workspace_id = $2
+	`, itemID, workspaceID).Scan(&item.ID, &item.AccountUserID, &item.Platform, &item.ExternalID, &item.PostExternalID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Inbox item not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Failed to load inbox item:", err)
+		http.Error(w, "Failed to load inbox item", http.StatusInternalServerError)
+		return
+	}
+
+	// Replies go out as the connected account's owner, so only they or an admin/editor
+	// may send them
+	if item.AccountUserID != userID && !IsUserAdminOrEditor(userID, workspaceID) {
+		http.Error(w, "Not authorized to reply from this account", http.StatusForbidden)
+		return
+	}
+
+	reply, ok := inboxRepliers[item.Platform]
+	if !ok {
+		http.Error(w, "Replying is not supported for "+item.Platform, http.StatusBadRequest)
+		return
+	}
+
+	acc, err := loadPlatformAccount(lib.DB, item.AccountUserID, item.Platform)
+	if err == sql.ErrNoRows {
+		http.Error(w, "The "+item.Platform+" account this item came from is no longer connected", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to load social account", http.StatusInternalServerError)
+		return
+	}
+
+	if err := reply(lib.DB, acc, &item, message); err != nil {
+		log.Printf("Failed to reply to %s item %s: %v", item.Platform, item.ExternalID, err)
+		http.Error(w, "Failed to send reply: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	now := time.Now()
+	if _, err := lib.DB.Exec(`
+		UPDATE inbox_items SET replied_at = $1, is_read = true, updated_at = $1 WHERE id = $2 AND workspace_id = $3
+	`, now, itemID, workspaceID); err != nil {
+		log.Println("Failed to mark inbox item as replied:", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":    "Reply sent successfully",
+		"replied_at": now,
+	})
+
+	msg, _ := json.Marshal(map[string]interface{}{
+		"type":   "inbox_item_replied",
+		"itemId": itemID,
+	})
+	hub.broadcast(workspaceID, websocket.TextMessage, msg)
+}
+
+func upsertInboxItem(workspaceID, accountUserID string, item models.InboxItem) error {
+	_, err := lib.DB.Exec(`
+		INSERT INTO inbox_items (
+			workspace_id, account_user_id, platform, external_id, post_external_id,
+			author_name, author_avatar, content, permalink, received_at, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, now(), now())
+		ON CONFLICT (workspace_id, platform, external_id) DO UPDATE SET
+			author_name = EXCLUDED.author_name,
+			author_avatar = EXCLUDED.author_avatar,
+			content = EXCLUDED.content,
+			permalink = EXCLUDED.permalink,
+			updated_at = now()
+		WHERE inbox_items.content IS DISTINCT FROM EXCLUDED.content
+	`, workspaceID, accountUserID, item.Platform, item.ExternalID, item.PostExternalID,
+		item.AuthorName, item.AuthorAvatar, item.Content, item.Permalink, item.ReceivedAt)
+	return err
+}
+
+// isWorkspaceMember checks if a user belongs to a workspace in any role
+func isWorkspaceMember(userID, workspaceID string) bool {
+	var exists bool
+	err := lib.DB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM workspace_members WHERE user_id = $1 AND workspace_id = $2)
+	`, userID, workspaceID).Scan(&exists)
+	return err == nil && exists
+}
+
+// --- Fetchers ---
+
+func fetchFacebookInbox(db *sql.DB, acc *platformAccount) ([]models.InboxItem, error) {
+	graphURL := lib.GraphURL("%s/posts?fields=id,comments.limit(50){id,message,from,created_time,permalink_url}&limit=25&access_token=%s",
+		acc.SocialID, url.QueryEscape(acc.AccessToken))
+
+	var fbResp struct {
+		Data []struct {
+			ID       string `json:"id"`
+			Comments struct {
+				Data []struct {
+					ID           string `json:"id"`
+					Message      string `json:"message"`
+					CreatedTime  string `json:"created_time"`
+					PermalinkURL string `json:"permalink_url"`
+					From         struct {
+						ID   string `json:"id"`
+						Name string `json:"name"`
+					} `json:"from"`
+				} `json:"data"`
+			} `json:"comments"`
+		} `json:"data"`
+	}
+	if err := getJSON(graphURL, nil, &fbResp); err != nil {
+		return nil, err
+	}
+
+	var items []models.InboxItem
+	for _, post := range fbResp.Data {
+		for _, c := range post.Comments.Data {
+			if c.From.ID == acc.SocialID {
+				continue // the page's own replies
+			}
+			items = append(items, models.InboxItem{
+				Platform:       "facebook",
+				ExternalID:     c.ID,
+				PostExternalID: nullIfEmpty(post.ID),
+				AuthorName:     nullIfEmpty(c.From.Name),
+				Content:        nullIfEmpty(c.Message),
+				Permalink:      nullIfEmpty(c.PermalinkURL),
+				ReceivedAt:     parseTimePtr(graphTimeLayout, c.CreatedTime),
+			})
+		}
+	}
+	return items, nil
+}
+
+func fetchInstagramInbox(db *sql.DB, acc *platformAccount) ([]models.InboxItem, error) {
+	graphURL := lib.GraphURL("%s/media?fields=id,permalink,comments.limit(50){id,text,username,timestamp}&limit=25&access_token=%s",
+		acc.SocialID, url.QueryEscape(acc.AccessToken))
+
+	var igResp struct {
+		Data []struct {
+			ID        string `json:"id"`
+			Permalink string `json:"permalink"`
+			Comments  struct {
+				Data []struct {
+					ID        string `json:"id"`
+					Text      string `json:"text"`
+					Username  string `json:"username"`
+					Timestamp string `json:"timestamp"`
+				} `json:"data"`
+			} `json:"comments"`
+		} `json:"data"`
+	}
+	if err := getJSON(graphURL, nil, &igResp); err != nil {
+		return nil, err
+	}
+
+	var items []models.InboxItem
+	for _, media := range igResp.Data {
+		for _, c := range media.Comments.Data {
+			items = append(items, models.InboxItem{
+				Platform:       "instagram",
+				ExternalID:     c.ID,
+				PostExternalID: nullIfEmpty(media.ID),
+				AuthorName:     nullIfEmpty(c.Username),
+				Content:        nullIfEmpty(c.Text),
+				Permalink:      nullIfEmpty(media.Permalink),
+				ReceivedAt:     parseTimePtr(graphTimeLayout, c.Timestamp),
+			})
+		}
+	}
+	return items, nil
+}
+
+func fetchYouTubeInbox(db *sql.DB, acc *platformAccount) ([]models.InboxItem, error) {
+	threadsURL := "https://www.googleapis.com/youtube/v3/commentThreads?part=snippet&maxResults=50&allThreadsRelatedToChannelId=" + url.QueryEscape(acc.SocialID)
+	resp, err := doYouTubeRequest(db, acc.UserID, &acc.AccessToken, acc.RefreshToken, func(token string) (*http.Request, error) {
+		req, err := http.NewRequest("GET", threadsURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("YouTube API error (status %d): %s", resp.StatusCode, body)
+	}
+
+	var threads struct {
+		Items []struct {
+			Snippet struct {
+				VideoID         string `json:"videoId"`
+				TopLevelComment struct {
+					ID      string `json:"id"`
+					Snippet struct {
+						TextDisplay           string `json:"textDisplay"`
+						TextOriginal          string `json:"textOriginal"`
+						AuthorDisplayName     string `json:"authorDisplayName"`
+						AuthorProfileImageURL string `json:"authorProfileImageUrl"`
+						AuthorChannelID       struct {
+							Value string `json:"value"`
+						} `json:"authorChannelId"`
+						PublishedAt string `json:"publishedAt"`
+					} `json:"snippet"`
+				} `json:"topLevelComment"`
+			} `json:"snippet"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&threads); err != nil {
+		return nil, fmt.Errorf("failed to decode YouTube comment threads: %w", err)
+	}
+
+	var items []models.InboxItem
+	for _, t := range threads.Items {
+		c := t.Snippet.TopLevelComment
+		if c.Snippet.AuthorChannelID.Value == acc.SocialID {
+			continue // the channel's own comments
+		}
+		text := c.Snippet.TextOriginal
+		if text == "" {
+			text = c.Snippet.TextDisplay
+		}
+		permalink := fmt.Sprintf("https://www.youtube.com/watch?v=%s&lc=%s", t.Snippet.VideoID, c.ID)
+		items = append(items, models.InboxItem{
+			Platform:       "youtube",
+			ExternalID:     c.ID,
+			PostExternalID: nullIfEmpty(t.Snippet.VideoID),
+			AuthorName:     nullIfEmpty(c.Snippet.AuthorDisplayName),
+			AuthorAvatar:   nullIfEmpty(c.Snippet.AuthorProfileImageURL),
+			Content:        nullIfEmpty(text),
+			Permalink:      &permalink,
+			ReceivedAt:     parseTimePtr(time.RFC3339, c.Snippet.PublishedAt),
+		})
+	}
+	return items, nil
+}
+
+func fetchMastodonInbox(db *sql.DB, acc *platformAccount) ([]models.InboxItem, error) {
+	instanceURL, err := mastodonInstanceURL(acc.SocialID)
+	if err != nil {
+		return nil, err
+	}
+
+	var notifications []struct {
+		Type      string `json:"type"`
+		CreatedAt string `json:"created_at"`
+		Account   struct {
+			Acct        string `json:"acct"`
+			DisplayName string `json:"display_name"`
+			Avatar      string `json:"avatar"`
+		} `json:"account"`
+		Status *struct {
+			ID          string `json:"id"`
+			Content     string `json:"content"`
+			URL         string `json:"url"`
+			InReplyToID string `json:"in_reply_to_id"`
+		} `json:"status"`
+	}
+	headers := map[string]string{"Authorization": "Bearer " + acc.AccessToken}
+	if err := getJSON(instanceURL+"/api/v1/notifications?types[]=mention&limit=40", headers, &notifications); err != nil {
+		return nil, err
+	}
+
+	var items []models.InboxItem
+	for _, n := range notifications {
+		if n.Type != "mention" || n.Status == nil {
+			continue
+		}
+		author := n.Account.DisplayName
+		if author == "" {
+			author = n.Account.Acct
+		}
+		author = fmt.Sprintf("%s (@%s)", author, n.Account.Acct)
+		text := strings.TrimSpace(html.UnescapeString(htmlTagPattern.ReplaceAllString(n.Status.Content, " ")))
+		items = append(items, models.InboxItem{
+			Platform:       "mastodon",
+			ExternalID:     n.Status.ID,
+			PostExternalID: nullIfEmpty(n.Status.InReplyToID),
+			AuthorName:     &author,
+			AuthorAvatar:   nullIfEmpty(n.Account.Avatar),
+			Content:        nullIfEmpty(text),
+			Permalink:      nullIfEmpty(n.Status.URL),
+			ReceivedAt:     parseTimePtr(time.RFC3339, n.CreatedAt),
+		})
+	}
+	return items, nil
+}
+
+// --- Repliers ---
+
+func replyFacebookComment(db *sql.DB, acc *platformAccount, item *models.InboxItem, message string) error {
+	form := url.Values{}
+	form.Set("message", message)
+	form.Set("access_token", acc.AccessToken)
+	return postGraphForm(lib.GraphURL("%s/comments", item.ExternalID), form)
+}
+
+func replyInstagramComment(db *sql.DB, acc *platformAccount, item *models.InboxItem, message string) error {
+	form := url.Values{}
+	form.Set("message", message)
+	form.Set("access_token", acc.AccessToken)
+	return postGraphForm(lib.GraphURL("%s/replies", item.ExternalID), form)
+}
+
+func replyYouTubeComment(db *sql.DB, acc *platformAccount, item *models.InboxItem, message string) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"snippet": map[string]string{
+			"parentId":     item.ExternalID,
+			"textOriginal": message,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := doYouTubeRequest(db, acc.UserID, &acc.AccessToken, acc.RefreshToken, func(token string) (*http.Request, error) {
+		req, err := http.NewRequest("POST", "https://www.googleapis.com/youtube/v3/comments?part=snippet", bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("YouTube API error (status %d): %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+func replyMastodonStatus(db *sql.DB, acc *platformAccount, item *models.InboxItem, message string) error {
+	instanceURL, err := mastodonInstanceURL(acc.SocialID)
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{"Authorization": "Bearer " + acc.AccessToken}
+
+	// Mention the author so the reply reaches them, and keep the original visibility
+	var status struct {
+		Visibility string `json:"visibility"`
+		Account    struct {
+			Acct string `json:"acct"`
+		} `json:"account"`
+	}
+	if err := getJSON(instanceURL+"/api/v1/statuses/"+url.PathEscape(item.ExternalID), headers, &status); err != nil {
+		return err
+	}
+	text := message
+	if status.Account.Acct != "" && !strings.Contains(message, "@"+status.Account.Acct) {
+		text = "@" + status.Account.Acct + " " + message
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"status":         text,
+		"in_reply_to_id": item.ExternalID,
+		"visibility":     status.Visibility,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", instanceURL+"/api/v1/statuses", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+acc.AccessToken)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Mastodon API error (status %d): %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+// --- Helpers ---
+
+// getJSON performs a GET request and decodes a 200 JSON response into out
+func getJSON(rawURL string, headers map[string]string, out interface{}) error {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API error (status %d): %s", resp.StatusCode, body)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// postGraphForm posts a form to the Graph API and fails on a non-200 response
+func postGraphForm(endpoint string, form url.Values) error {
+	resp, err := http.Post(endpoint, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Graph API error (status %d): %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+func parseTimePtr(layout, value string) *time.Time {
+	t, err := time.Parse(layout, value)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,396 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+
+	"github.com/gorilla/mux"
+)
+
+// defaultUTMPlatform is the settings row used when a platform has none of its own
+const defaultUTMPlatform = "default"
+
+var linkPattern = regexp.MustCompile(`https?://[^\s<>"']+`)
+
+const shortCodeAlphabet = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// GetUTMSettings lists the UTM settings configured for a workspace
+func GetUTMSettings(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	vars := mux.Vars(r)
+	workspaceID := vars["workspaceId"]
+
+	if !isWorkspaceMember(userID, workspaceID) {
+		http.Error(w, "Not a member of this workspace", http.StatusForbidden)
+		return
+	}
+
+	rows, err := lib.DB.Query(`
+		SELECT workspace_id, platform, enabled, utm_source, utm_medium, utm_campaign,
+		       utm_term, utm_content, use_short_links, updated_at
+		FROM workspace_utm_settings
+		WHERE workspace_id = $1
+		ORDER BY platform
+	`, workspaceID)
+	if err != nil {
+		log.Println("Failed to query UTM settings:", err)
+		http.Error(w, "Failed to fetch UTM settings", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	settings := []models.UTMSetting{}
+	for rows.Next() {
+		var s models.UTMSetting
+		if err := rows.Scan(&s.WorkspaceID, &s.Platform, &s.Enabled, &s.UTMSource, &s.UTMMedium,
+			&s.UTMCampaign, &s.UTMTerm, &s.UTMContent, &s.UseShortLinks, &s.UpdatedAt); err != nil {
+			log.Println("Failed to scan UTM setting:", err)
+			http.Error(w, "Failed to fetch UTM settings", http.StatusInternalServerError)
+			return
+		}
+		settings = append(settings, s)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// UpdateUTMSettings upserts the UTM settings for one or more platforms (admin/editor only).
+// Values may contain {platform} and {draft_id} placeholders.
+func UpdateUTMSettings(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	vars := mux.Vars(r)
+	workspaceID := vars["workspaceId"]
+
+	if !IsUserAdminOrEditor(userID, workspaceID) {
+		http.Error(w, "Not authorized to change UTM settings", http.StatusForbidden)
+		return
+	}
+
+	var req []struct {
+		models.UTMSetting
+		Enabled *bool `json:"enabled"` // defaults to true
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := lib.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to update UTM settings", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	for _, s := range req {
+		platform := strings.ToLower(strings.TrimSpace(s.Platform))
+		if platform == "" {
+			platform = defaultUTMPlatform
+		}
+		enabled := s.Enabled == nil || *s.Enabled
+		_, err := tx.Exec(`
+			INSERT INTO workspace_utm_settings (
+				workspace_id, platform, enabled, utm_source, utm_medium, utm_campaign,
+				utm_term, utm_content, use_short_links, updated_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, now())
+			ON CONFLICT (workspace_id, platform) DO UPDATE SET
+				enabled = EXCLUDED.enabled,
+				utm_source = EXCLUDED.utm_source,
+				utm_medium = EXCLUDED.utm_medium,
+				utm_campaign = EXCLUDED.utm_campaign,
+				utm_term = EXCLUDED.utm_term,
+				utm_content = EXCLUDED.utm_content,
+				use_short_links = EXCLUDED.use_short_links,
+				updated_at = now()
+		`, workspaceID, platform, enabled, s.UTMSource, s.UTMMedium, s.UTMCampaign,
+			s.UTMTerm, s.UTMContent, s.UseShortLinks)
+		if err != nil {
+			log.Println("Failed to save UTM setting:", err)
+			http.Error(w, "Failed to update UTM settings", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to update UTM settings", http.StatusInternalServerError)
+		return
+	}
+
+	GetUTMSettings(w, r)
+}
+
+// ShortLinkRedirectHandler logs a click and redirects to the short link's target
+func ShortLinkRedirectHandler(w http.ResponseWriter, r *http.Request) {
+	code := mux.Vars(r)["code"]
+
+	var linkID, platform, targetURL string
+	err := lib.DB.QueryRow(`
+		SELECT id, platform, target_url FROM short_links WHERE code = $1
+	`, code).Scan(&linkID, &platform, &targetURL)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Println("Failed to look up short link:", err)
+		http.Error(w, "Failed to resolve link", http.StatusInternalServerError)
+		return
+	}
+
+	referrer := nullIfEmpty(r.Referer())
+	userAgent := nullIfEmpty(r.UserAgent())
+	if _, err := lib.DB.Exec(`
+		INSERT INTO link_clicks (short_link_id, platform, referrer, user_agent, clicked_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, linkID, platform, referrer, userAgent, time.Now()); err != nil {
+		// A lost click must never break the redirect
+		log.Println("Failed to record link click:", err)
+	}
+
+	http.Redirect(w, r, targetURL, http.StatusFound)
+}
+
+// GetLinkAnalytics lists the workspace's short links with their click counts.
+// Optional query params: draft_id, platform.
+func GetLinkAnalytics(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	vars := mux.Vars(r)
+	workspaceID := vars["workspaceId"]
+
+	if !isWorkspaceMember(userID, workspaceID) {
+		http.Error(w, "Not a member of this workspace", http.StatusForbidden)
+		return
+	}
+
+	query := `
+		SELECT s.id, s.code, s.workspace_id, s.draft_id, s.created_by, s.platform, s.target_url,
+		       s.created_at, COUNT(c.id)
+		FROM short_links s
+		LEFT JOIN link_clicks c ON c.short_link_id = s.id
+		WHERE s.workspace_id = $1
+	`
+	args := []interface{}{workspaceID}
+	argIndex := 2
+
+	if draftID := r.URL.Query().Get("draft_id"); draftID != "" {
+		query += fmt.Sprintf(" AND s.draft_id = $%d", argIndex)
+		args = append(args, draftID)
+		argIndex++
+	}
+	if platform := r.URL.Query().Get("platform"); platform != "" {
+		query += fmt.Sprintf(" AND s.platform = $%d", argIndex)
+		args = append(args, platform)
+		argIndex++
+	}
+	query += " GROUP BY s.id ORDER BY s.created_at DESC"
+
+	rows, err := lib.DB.Query(query, args...)
+	if err != nil {
+		log.Println("Failed to query link analytics:", err)
+		http.Error(w, "Failed to fetch link analytics", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	links := []models.ShortLink{}
+	totalClicks := 0
+	clicksByPlatform := map[string]int{}
+	for rows.Next() {
+		var l models.ShortLink
+		if err := rows.Scan(&l.ID, &l.Code, &l.WorkspaceID, &l.DraftID, &l.CreatedBy, &l.Platform,
+			&l.TargetURL, &l.CreatedAt, &l.Clicks); err != nil {
+			log.Println("Failed to scan short link:", err)
+			http.Error(w, "Failed to fetch link analytics", http.StatusInternalServerError)
+			return
+		}
+		totalClicks += l.Clicks
+		clicksByPlatform[l.Platform] += l.Clicks
+		links = append(links, l)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"links":            links,
+		"totalClicks":      totalClicks,
+		"clicksByPlatform": clicksByPlatform,
+	})
+}
+
+// rewriteContentLinks applies the workspace's UTM settings for a platform to every
+// link in content and, if enabled, swaps each link for a tracked short link.
+// Content is returned unchanged when no settings apply.
+func rewriteContentLinks(workspaceID, draftID, userID, platform, content string) (string, error) {
+	setting, err := loadUTMSetting(workspaceID, platform)
+	if err != nil || setting == nil || !setting.Enabled {
+		return content, err
+	}
+
+	shortBase := shortLinkBaseURL()
+	var rewriteErr error
+	rewritten := linkPattern.ReplaceAllStringFunc(content, func(match string) string {
+		if rewriteErr != nil {
+			return match
+		}
+		// Keep trailing punctuation out of the link
+		link := strings.TrimRight(match, ".,;:!?)]}'\"")
+		trailing := match[len(link):]
+		if strings.HasPrefix(link, shortBase+"/r/") {
+			return match
+		}
+
+		tagged := applyUTMParams(link, setting, platform, draftID)
+		if setting.UseShortLinks {
+			code, err := createShortLink(workspaceID, draftID, userID, platform, tagged)
+			if err != nil {
+				rewriteErr = err
+				return match
+			}
+			tagged = shortBase + "/r/" + code
+		}
+		return tagged + trailing
+	})
+	if rewriteErr != nil {
+		return content, rewriteErr
+	}
+	return rewritten, nil
+}
+
+// loadUTMSetting returns the platform's settings, falling back to the workspace default
+func loadUTMSetting(workspaceID, platform string) (*models.UTMSetting, error) {
+	var s models.UTMSetting
+	err := lib.DB.QueryRow(`
+		SELECT workspace_id, platform, enabled, utm_source, utm_medium, utm_campaign,
+		       utm_term, utm_content, use_short_links, updated_at
+		FROM workspace_utm_settings
+		WHERE workspace_id = $1 AND platform IN ($2, $3)
+		ORDER BY (platform = $3) ASC
+		LIMIT 1
+	`, workspaceID, strings.ToLower(platform), defaultUTMPlatform).Scan(
+		&s.WorkspaceID, &s.Platform, &s.Enabled, &s.UTMSource, &s.UTMMedium,
+		&s.UTMCampaign, &s.UTMTerm, &s.UTMContent, &s.UseShortLinks, &s.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// applyUTMParams adds the configured UTM parameters to rawURL without
+// overriding parameters the link already carries
+func applyUTMParams(rawURL string, s *models.UTMSetting, platform, draftID string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	q := u.Query()
+	params := []struct {
+		key   string
+		value *string
+	}{
+		{"utm_source", s.UTMSource},
+		{"utm_medium", s.UTMMedium},
+		{"utm_campaign", s.UTMCampaign},
+		{"utm_term", s.UTMTerm},
+		{"utm_content", s.UTMContent},
+	}
+	changed := false
+	for _, p := range params {
+		if p.value == nil || *p.value == "" || q.Get(p.key) != "" {
+			continue
+		}
+		value := strings.ReplaceAll(*p.value, "{platform}", platform)
+		value = strings.ReplaceAll(value, "{draft_id}", draftID)
+		q.Set(p.key, value)
+		changed = true
+	}
+	if !changed {
+		return rawURL
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// createShortLink stores a new short link and returns its code
+func createShortLink(workspaceID, draftID, userID, platform, targetURL string) (string, error) {
+	for attempt := 0; attempt < 5; attempt++ {
+		code, err := generateShortCode(7)
+		if err != nil {
+			return "", err
+		}
+		result, err := lib.DB.Exec(`
+			INSERT INTO short_links (code, workspace_id, draft_id, created_by, platform, target_url, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (code) DO NOTHING
+		`, code, workspaceID, nullIfEmpty(draftID), nullIfEmpty(userID), platform, targetURL, time.Now())
+		if err != nil {
+			return "", err
+		}
+		if n, _ := result.RowsAffected(); n == 1 {
+			return code, nil
+		}
+	}
+	return "", fmt.Errorf("failed to allocate a unique short link code")
+}
+
+func generateShortCode(length int) (string, error) {
+	max := big.NewInt(int64(len(shortCodeAlphabet)))
+	b := make([]byte, length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = shortCodeAlphabet[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// shortLinkBaseURL is the public origin that serves /r/{code}
+func shortLinkBaseURL() string {
+	base := os.Getenv("SHORT_LINK_BASE_URL")
+	if base == "" {
+		base = "http://localhost:8080"
+	}
+	return strings.TrimSuffix(base, "/")
+}
+
+// countUserLinkClicks totals clicks on short links a user published to a platform
+func countUserLinkClicks(db *sql.DB, userID, platform string) int {
+	var clicks int
+	err := db.QueryRow(`
+		SELECT COUNT(c.id)
+		FROM link_clicks c
+		INNER JOIN short_links s ON c.short_link_id = s.id
+		WHERE s.created_by = $1 AND s.platform = $2
+	`, userID, platform).Scan(&clicks)
+	if err != nil {
+		log.Printf("Failed to count link clicks for user %s: %v", userID, err)
+		return 0
+	}
+	return clicks
+}
+
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,297 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"social-sync-backend/middleware"
+
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+)
+
+// getLinkedInOAuthConfig returns OAuth2 config for LinkedIn with environment variables
+func getLinkedInOAuthConfig() *oauth2.Config {
+	redirectURL := os.Getenv("LINKEDIN_REDIRECT_URL")
+	if redirectURL == "" {
+		log.Fatal("LINKEDIN_REDIRECT_URL is empty!")
+	}
+
+	return &oauth2.Config{
+		ClientID:     os.Getenv("LINKEDIN_CLIENT_ID"),
+		ClientSecret: os.Getenv("LINKEDIN_CLIENT_SECRET"),
+		RedirectURL:  redirectURL,
+		// openid/profile identify the member; the organization scopes let us list, post as
+		// and read statistics for the pages the member administers
+		Scopes: []string{
+			"openid", "profile", "w_member_social",
+			"r_organization_admin", "r_organization_social", "w_organization_social",
+		},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   "https://www.linkedin.com/oauth/v2/authorization",
+			TokenURL:  "https://www.linkedin.com/oauth/v2/accessToken",
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}
+}
+
+// LinkedInRedirectHandler initiates the OAuth flow and redirects to the LinkedIn auth page
+func LinkedInRedirectHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		config := getLinkedInOAuthConfig()
+
+		appUserIDStr, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated.", http.StatusUnauthorized)
+			return
+		}
+		if _, err := uuid.Parse(appUserIDStr); err != nil {
+			http.Error(w, "Invalid user ID format.", http.StatusInternalServerError)
+			return
+		}
+
+		state, err := newOAuthState("linkedin", appUserIDStr)
+		if err != nil {
+			log.Println("Failed to save LinkedIn OAuth state:", err)
+			http.Error(w, "Failed to start LinkedIn authorization", http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, config.AuthCodeURL(state), http.StatusTemporaryRedirect)
+	}
+}
+
+// LinkedInCallbackHandler exchanges the code, saves the member account and redirects to the frontend.
+// Posts go out as the member until an organization page is picked with SelectLinkedInOrganizationHandler.
+func LinkedInCallbackHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appUserIDStr, ok, err := consumeOAuthState("linkedin", r.URL.Query().Get("state"))
+		if err != nil {
+			log.Println("Failed to check LinkedIn OAuth state:", err)
+			http.Error(w, "Failed to check state parameter", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Invalid or expired state parameter", http.StatusBadRequest)
+			return
+		}
+
+		if errMsg := r.URL.Query().Get("error_description"); errMsg != "" {
+			http.Error(w, "LinkedIn authorization failed: "+errMsg, http.StatusBadRequest)
+			return
+		}
+		code := r.URL.Query().Get("code")
+		if code == "" {
+			http.Error(w, "Missing code parameter", http.StatusBadRequest)
+			return
+		}
+
+		token, err := getLinkedInOAuthConfig().Exchange(context.Background(), code)
+		if err != nil {
+			http.Error(w, "Token exchange failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		member, err := fetchLinkedInMember(token.AccessToken)
+		if err != nil {
+			log.Printf("LinkedIn userinfo error: %v", err)
+			http.Error(w, "Failed to fetch LinkedIn profile", http.StatusInternalServerError)
+			return
+		}
+
+		var expiresAt *time.Time
+		if !token.Expiry.IsZero() {
+			expiresAt = &token.Expiry
+		}
+
+		_, err = db.Exec(`
+			INSERT INTO social_accounts (
+				user_id, platform, social_id, access_token, access_token_expires_at,
+				refresh_token, profile_picture_url, profile_name, connected_at
+			) VALUES (
+				$1, 'linkedin', $2, $3, $4, $5, $6, $7, NOW()
+			)
+			ON CONFLICT (user_id, platform) DO UPDATE SET
+				access_token = EXCLUDED.access_token,
+				access_token_expires_at = EXCLUDED.access_token_expires_at,
+				refresh_token = EXCLUDED.refresh_token,
+				social_id = EXCLUDED.social_id,
+				profile_picture_url = EXCLUDED.profile_picture_url,
+				profile_name = EXCLUDED.profile_name,
+				connected_at = NOW()
+		`,
+			appUserIDStr,
+			member.URN,
+			token.AccessToken,
+			expiresAt,
+			nullIfEmpty(token.RefreshToken),
+			nullIfEmpty(member.Picture),
+			member.Name,
+		)
+		if err != nil {
+			http.Error(w, "Failed to save LinkedIn account: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "http://localhost:3000/home/manage-accounts?connected=linkedin", http.StatusSeeOther)
+	}
+}
+
+// linkedInAuthor is a member or organization that can own posts
+type linkedInAuthor struct {
+	URN     string `json:"urn"` // urn:li:person:... or urn:li:organization:...
+	Name    string `json:"name"`
+	Picture string `json:"picture,omitempty"`
+}
+
+// fetchLinkedInMember reads the signed-in member from the OpenID userinfo endpoint
+func fetchLinkedInMember(accessToken string) (*linkedInAuthor, error) {
+	var info struct {
+		Sub     string `json:"sub"`
+		Name    string `json:"name"`
+		Picture string `json:"picture"`
+	}
+	headers := map[string]string{"Authorization": "Bearer " + accessToken}
+	if err := getJSON("https://api.linkedin.com/v2/userinfo", headers, &info); err != nil {
+		return nil, err
+	}
+	if info.Sub == "" {
+		return nil, fmt.Errorf("LinkedIn returned no member id")
+	}
+	return &linkedInAuthor{URN: "urn:li:person:" + info.Sub, Name: info.Name, Picture: info.Picture}, nil
+}
+
+// fetchLinkedInOrganizations lists the organization pages the member administers
+func fetchLinkedInOrganizations(accessToken string) ([]linkedInAuthor, error) {
+	var acls struct {
+		Elements []struct {
+			Organization string `json:"organization"`
+		} `json:"elements"`
+	}
+	aclURL := linkedInAPIBase + "/organizationAcls?q=roleAssignee&role=ADMINISTRATOR&state=APPROVED&count=100"
+	if err := getJSON(aclURL, linkedInHeaders(accessToken), &acls); err != nil {
+		return nil, err
+	}
+
+	orgs := []linkedInAuthor{}
+	for _, acl := range acls.Elements {
+		id := strings.TrimPrefix(acl.Organization, "urn:li:organization:")
+		var org struct {
+			LocalizedName string `json:"localizedName"`
+		}
+		if err := getJSON(linkedInAPIBase+"/organizations/"+url.PathEscape(id), linkedInHeaders(accessToken), &org); err != nil {
+			log.Printf("Failed to fetch LinkedIn organization %s: %v", id, err)
+			continue
+		}
+		orgs = append(orgs, linkedInAuthor{URN: acl.Organization, Name: org.LocalizedName})
+	}
+	return orgs, nil
+}
+
+// GetLinkedInOrganizationsHandler lists the member profile and the organization pages
+// the connected account can post as, marking the one currently selected
+func GetLinkedInOrganizationsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		acc, err := linkedInAccount(db, userID)
+		if err != nil {
+			writeLinkedInAccountError(w, err)
+			return
+		}
+
+		member, err := fetchLinkedInMember(acc.AccessToken)
+		if err != nil {
+			http.Error(w, "Failed to fetch LinkedIn profile: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		orgs, err := fetchLinkedInOrganizations(acc.AccessToken)
+		if err != nil {
+			http.Error(w, "Failed to fetch LinkedIn organizations: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"member":        member,
+			"organizations": orgs,
+			"selected":      acc.SocialID,
+		})
+	}
+}
+
+// SelectLinkedInOrganizationHandler sets who LinkedIn posts are published as. An empty
+// organizationUrn switches back to the member's own profile.
+func SelectLinkedInOrganizationHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			OrganizationURN string `json:"organizationUrn"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		acc, err := linkedInAccount(db, userID)
+		if err != nil {
+			writeLinkedInAccountError(w, err)
+			return
+		}
+
+		var author *linkedInAuthor
+		if req.OrganizationURN == "" {
+			author, err = fetchLinkedInMember(acc.AccessToken)
+			if err != nil {
+				http.Error(w, "Failed to fetch LinkedIn profile: "+err.Error(), http.StatusBadGateway)
+				return
+			}
+		} else {
+			orgs, err := fetchLinkedInOrganizations(acc.AccessToken)
+			if err != nil {
+				http.Error(w, "Failed to fetch LinkedIn organizations: "+err.Error(), http.StatusBadGateway)
+				return
+			}
+			for i := range orgs {
+				if orgs[i].URN == req.OrganizationURN {
+					author = &orgs[i]
+					break
+				}
+			}
+			if author == nil {
+				http.Error(w, "You are not an administrator of that LinkedIn page", http.StatusForbidden)
+				return
+			}
+		}
+
+		_, err = db.Exec(`
+			UPDATE social_accounts
+			SET social_id = $1, profile_name = $2, profile_picture_url = COALESCE($3, profile_picture_url), last_synced_at = NOW()
+			WHERE user_id = $4 AND platform = 'linkedin'
+		`, author.URN, author.Name, nullIfEmpty(author.Picture), userID)
+		if err != nil {
+			http.Error(w, "Failed to save LinkedIn page selection", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(author)
+	}
+}
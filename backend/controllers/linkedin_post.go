@@ -0,0 +1,467 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+)
+
+const (
+	linkedInAPIBase = "https://api.linkedin.com/rest"
+	// linkedInVersion is the YYYYMM version of the versioned REST API, sent on every call
+	linkedInVersion = "202406"
+	// linkedInMaxUploadBytes is LinkedIn's document limit, above anything it takes as an image
+	linkedInMaxUploadBytes  = 100 << 20
+	linkedInDownloadTimeout = 2 * time.Minute
+)
+
+var errLinkedInTokenExpired = errors.New("LinkedIn access token expired, reconnect LinkedIn")
+
+type LinkedInPostRequest struct {
+	Content   string   `json:"content"`
+	MediaUrls []string `json:"mediaUrls"` // images; several make a multi-image post
+	AltTexts  []string `json:"altTexts"`  // alt text per image, in mediaUrls order
+	DraftID   string   `json:"draftId"`   // optional; links the post to a draft for later edit/delete
+
+	// A PDF, PPT or DOC shown as a swipeable document; cannot be combined with images
+	DocumentURL   string `json:"documentUrl"`
+	DocumentTitle string `json:"documentTitle"`
+
+	Visibility string `json:"visibility"` // PUBLIC (default) or CONNECTIONS, which only applies to members
+}
+
+// PostToLinkedInHandler publishes a text, image or document post as the member or the
+// organization page picked with SelectLinkedInOrganizationHandler
+func PostToLinkedInHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		var req LinkedInPostRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		if strings.TrimSpace(req.Content) == "" {
+			http.Error(w, "Content cannot be empty", http.StatusBadRequest)
+			return
+		}
+		if req.DocumentURL != "" && len(req.MediaUrls) > 0 {
+			http.Error(w, "A LinkedIn post can carry images or a document, not both", http.StatusBadRequest)
+			return
+		}
+		if len(req.MediaUrls) > 20 {
+			http.Error(w, "LinkedIn allows at most 20 images per post", http.StatusBadRequest)
+			return
+		}
+		visibility := req.Visibility
+		if visibility == "" {
+			visibility = "PUBLIC"
+		}
+		if visibility != "PUBLIC" && visibility != "CONNECTIONS" {
+			http.Error(w, "visibility must be PUBLIC or CONNECTIONS", http.StatusBadRequest)
+			return
+		}
+
+		acc, err := linkedInAccount(db, userID)
+		if err != nil {
+			writeLinkedInAccountError(w, err)
+			return
+		}
+		if visibility == "CONNECTIONS" && strings.HasPrefix(acc.SocialID, "urn:li:organization:") {
+			http.Error(w, "Organization posts must be PUBLIC", http.StatusBadRequest)
+			return
+		}
+
+		post := map[string]interface{}{
+			"author":     acc.SocialID,
+			"commentary": linkedInCommentary(req.Content),
+			"visibility": visibility,
+			"distribution": map[string]interface{}{
+				"feedDistribution":               "MAIN_FEED",
+				"targetEntities":                 []string{},
+				"thirdPartyDistributionChannels": []string{},
+			},
+			"lifecycleState":            "PUBLISHED",
+			"isReshareDisabledByAuthor": false,
+		}
+
+		switch {
+		case req.DocumentURL != "":
+			documentURN, err := uploadLinkedInAsset(acc, "documents", req.DocumentURL)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Document upload failed: %v", err), http.StatusBadGateway)
+				return
+			}
+			title := req.DocumentTitle
+			if title == "" {
+				title = "Document"
+			}
+			post["content"] = map[string]interface{}{
+				"media": map[string]string{"id": documentURN, "title": title},
+			}
+
+		case len(req.MediaUrls) > 0:
+			var images []map[string]string
+			for i, mediaURL := range req.MediaUrls {
+				imageURN, err := uploadLinkedInAsset(acc, "images", mediaURL)
+				if err != nil {
+					http.Error(w, fmt.Sprintf("Image upload failed: %v", err), http.StatusBadGateway)
+					return
+				}
+				image := map[string]string{"id": imageURN}
+				if i < len(req.AltTexts) && req.AltTexts[i] != "" {
+					image["altText"] = req.AltTexts[i]
+				}
+				images = append(images, image)
+			}
+			if len(images) == 1 {
+				post["content"] = map[string]interface{}{"media": images[0]}
+			} else {
+				post["content"] = map[string]interface{}{"multiImage": map[string]interface{}{"images": images}}
+			}
+		}
+
+		postURN, err := createLinkedInPost(acc.AccessToken, post)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("LinkedIn API error: %v", err), http.StatusBadGateway)
+			return
+		}
+
+		postURL := "https://www.linkedin.com/feed/update/" + postURN
+		recordPublishedPost(db, req.DraftID, "linkedin", userID, postURN, postURL)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Posted to LinkedIn successfully",
+			"postUrn": postURN,
+			"url":     postURL,
+		})
+	}
+}
+
+// GetLinkedInAnalyticsHandler returns likes and comments for the user's LinkedIn posts,
+// plus impressions, clicks and shares for organization page posts. Pass ?postUrn= for a
+// single post; otherwise the most recent posts published from drafts are used.
+func GetLinkedInAnalyticsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		acc, err := linkedInAccount(db, userID)
+		if err != nil {
+			writeLinkedInAccountError(w, err)
+			return
+		}
+
+		postURNs := []string{}
+		if urn := r.URL.Query().Get("postUrn"); urn != "" {
+			postURNs = append(postURNs, urn)
+		} else {
+			rows, err := db.Query(`
+				SELECT remote_id FROM published_posts
+				WHERE published_by = $1 AND platform = 'linkedin' AND status = 'live'
+				ORDER BY published_at DESC
+				LIMIT 40
+			`, userID)
+			if err != nil {
+				http.Error(w, "Failed to load LinkedIn posts", http.StatusInternalServerError)
+				return
+			}
+			for rows.Next() {
+				var urn string
+				if err := rows.Scan(&urn); err == nil {
+					postURNs = append(postURNs, urn)
+				}
+			}
+			rows.Close()
+		}
+
+		isOrganization := strings.HasPrefix(acc.SocialID, "urn:li:organization:")
+		totalLikes, totalComments, totalImpressions, totalClicks, totalShares := 0, 0, 0, 0, 0
+		posts := []map[string]interface{}{}
+		for _, urn := range postURNs {
+			stats, err := fetchLinkedInPostStats(acc, urn, isOrganization)
+			if err != nil {
+				log.Printf("Failed to fetch LinkedIn stats for %s: %v", urn, err)
+				continue
+			}
+			totalLikes += stats["likes"]
+			totalComments += stats["comments"]
+			totalImpressions += stats["impressions"]
+			totalClicks += stats["clicks"]
+			totalShares += stats["shares"]
+			posts = append(posts, map[string]interface{}{
+				"urn":         urn,
+				"url":         "https://www.linkedin.com/feed/update/" + urn,
+				"likes":       stats["likes"],
+				"comments":    stats["comments"],
+				"impressions": stats["impressions"],
+				"clicks":      stats["clicks"],
+				"shares":      stats["shares"],
+				"engagement":  stats["likes"] + stats["comments"] + stats["shares"],
+			})
+		}
+
+		sort.SliceStable(posts, func(i, j int) bool {
+			return posts[i]["engagement"].(int) > posts[j]["engagement"].(int)
+		})
+		topN := 5
+		if len(posts) < topN {
+			topN = len(posts)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"totalPosts":       len(posts),
+			"totalLikes":       totalLikes,
+			"totalComments":    totalComments,
+			"totalShares":      totalShares,
+			"totalImpressions": totalImpressions,
+			"totalPostClicks":  totalClicks,
+			"posts":            posts,
+			"topPosts":         posts[:topN],
+			"totalClicks":      countUserLinkClicks(db, userID, "linkedin"),
+		})
+	}
+}
+
+// fetchLinkedInPostStats reads social actions for any post. Impressions, clicks and shares
+// are only reported for organization posts.
+func fetchLinkedInPostStats(acc *platformAccount, postURN string, isOrganization bool) (map[string]int, error) {
+	var actions struct {
+		LikesSummary struct {
+			TotalLikes int `json:"totalLikes"`
+		} `json:"likesSummary"`
+		CommentsSummary struct {
+			AggregatedTotalComments int `json:"aggregatedTotalComments"`
+		} `json:"commentsSummary"`
+	}
+	if err := getJSON(linkedInAPIBase+"/socialActions/"+url.PathEscape(postURN), linkedInHeaders(acc.AccessToken), &actions); err != nil {
+		return nil, err
+	}
+	stats := map[string]int{
+		"likes":    actions.LikesSummary.TotalLikes,
+		"comments": actions.CommentsSummary.AggregatedTotalComments,
+	}
+	if !isOrganization {
+		return stats, nil
+	}
+
+	// Share statistics are keyed by the post's URN type
+	param := "shares"
+	if strings.HasPrefix(postURN, "urn:li:ugcPost:") {
+		param = "ugcPosts"
+	}
+	statsURL := fmt.Sprintf("%s/organizationalEntityShareStatistics?q=organizationalEntity&organizationalEntity=%s&%s=List(%s)",
+		linkedInAPIBase, url.QueryEscape(acc.SocialID), param, url.QueryEscape(postURN))
+	var shareStats struct {
+		Elements []struct {
+			TotalShareStatistics struct {
+				ImpressionCount int `json:"impressionCount"`
+				ClickCount      int `json:"clickCount"`
+				ShareCount      int `json:"shareCount"`
+			} `json:"totalShareStatistics"`
+		} `json:"elements"`
+	}
+	if err := getJSON(statsURL, linkedInHeaders(acc.AccessToken), &shareStats); err != nil {
+		return nil, err
+	}
+	if len(shareStats.Elements) > 0 {
+		total := shareStats.Elements[0].TotalShareStatistics
+		stats["impressions"] = total.ImpressionCount
+		stats["clicks"] = total.ClickCount
+		stats["shares"] = total.ShareCount
+	}
+	return stats, nil
+}
+
+// uploadLinkedInAsset registers an upload for kind ("images" or "documents"), copies the
+// file from sourceURL to LinkedIn and returns the asset URN
+func uploadLinkedInAsset(acc *platformAccount, kind, sourceURL string) (string, error) {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"initializeUploadRequest": map[string]string{"owner": acc.SocialID},
+	})
+	req, err := newLinkedInRequest("POST", linkedInAPIBase+"/"+kind+"?action=initializeUpload", acc.AccessToken, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("initialize upload failed (status %d): %s", resp.StatusCode, body)
+	}
+
+	var init struct {
+		Value struct {
+			UploadURL string `json:"uploadUrl"`
+			Image     string `json:"image"`
+			Document  string `json:"document"`
+		} `json:"value"`
+	}
+	if err := json.Unmarshal(body, &init); err != nil {
+		return "", err
+	}
+	assetURN := init.Value.Image
+	if kind == "documents" {
+		assetURN = init.Value.Document
+	}
+	if init.Value.UploadURL == "" || assetURN == "" {
+		return "", fmt.Errorf("no upload URL in response: %s", body)
+	}
+
+	source, size, _, err := fetchPublicMedia(sourceURL, linkedInMaxUploadBytes, linkedInDownloadTimeout)
+	if err != nil {
+		return "", fmt.Errorf("failed to download media: %v", err)
+	}
+	defer func() {
+		source.Close()
+		os.Remove(source.Name())
+	}()
+
+	uploadReq, err := http.NewRequest("PUT", init.Value.UploadURL, source)
+	if err != nil {
+		return "", err
+	}
+	uploadReq.ContentLength = size
+	uploadReq.Header.Set("Authorization", "Bearer "+acc.AccessToken)
+	if err := doPlatformRequest(uploadReq); err != nil {
+		return "", err
+	}
+	return assetURN, nil
+}
+
+// createLinkedInPost creates a post and returns its URN from the x-restli-id header
+func createLinkedInPost(accessToken string, post map[string]interface{}) (string, error) {
+	payload, _ := json.Marshal(post)
+	req, err := newLinkedInRequest("POST", linkedInAPIBase+"/posts", accessToken, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("status %d: %s", resp.StatusCode, body)
+	}
+	postURN := resp.Header.Get("x-restli-id")
+	if postURN == "" {
+		return "", fmt.Errorf("LinkedIn did not return a post id")
+	}
+	return postURN, nil
+}
+
+var (
+	linkedInReservedChars = regexp.MustCompile(`[\\|{}@\[\]()<>#*_~]`)
+	linkedInHashtag       = regexp.MustCompile(`\\#((?:[\pL\pN]|\\_)+)`)
+)
+
+// linkedInCommentary escapes the characters LinkedIn's "little text" format reserves, so
+// they show up literally, and turns #words back into real hashtags
+func linkedInCommentary(text string) string {
+	escaped := linkedInReservedChars.ReplaceAllString(text, `\$0`)
+	return linkedInHashtag.ReplaceAllStringFunc(escaped, func(tag string) string {
+		// Underscores inside the tag were escaped above and must stay literal in the template
+		return `{hashtag|\#|` + strings.ReplaceAll(tag[2:], `\_`, "_") + `}`
+	})
+}
+
+func newLinkedInRequest(method, endpoint, accessToken string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range linkedInHeaders(accessToken) {
+		req.Header.Set(k, v)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+func linkedInHeaders(accessToken string) map[string]string {
+	return map[string]string{
+		"Authorization":             "Bearer " + accessToken,
+		"LinkedIn-Version":          linkedInVersion,
+		"X-Restli-Protocol-Version": "2.0.0",
+	}
+}
+
+// linkedInAccount loads the connected LinkedIn account. LinkedIn only issues refresh tokens
+// to approved partner apps, so an expired token means the user has to reconnect.
+func linkedInAccount(db *sql.DB, userID string) (*platformAccount, error) {
+	var expiresAt *time.Time
+	err := db.QueryRow(`
+		SELECT access_token_expires_at FROM social_accounts WHERE user_id = $1 AND platform = 'linkedin'
+	`, userID).Scan(&expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt != nil && time.Now().After(*expiresAt) {
+		return nil, errLinkedInTokenExpired
+	}
+	return loadPlatformAccount(db, userID, "linkedin")
+}
+
+func writeLinkedInAccountError(w http.ResponseWriter, err error) {
+	switch {
+	case err == sql.ErrNoRows:
+		http.Error(w, "LinkedIn account not connected", http.StatusBadRequest)
+	case errors.Is(err, errLinkedInTokenExpired):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	default:
+		http.Error(w, "Failed to get LinkedIn account", http.StatusInternalServerError)
+	}
+}
+
+// editLinkedInPost replaces the commentary of a live post
+func editLinkedInPost(db *sql.DB, acc *platformAccount, post *models.PublishedPost, content string) error {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"patch": map[string]interface{}{
+			"$set": map[string]string{"commentary": linkedInCommentary(content)},
+		},
+	})
+	req, err := newLinkedInRequest("POST", linkedInAPIBase+"/posts/"+url.PathEscape(post.RemoteID), acc.AccessToken, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-RestLi-Method", "PARTIAL_UPDATE")
+	return doPlatformRequest(req)
+}
+
+func deleteLinkedInPost(db *sql.DB, acc *platformAccount, post *models.PublishedPost) error {
+	req, err := newLinkedInRequest("DELETE", linkedInAPIBase+"/posts/"+url.PathEscape(post.RemoteID), acc.AccessToken, nil)
+	if err != nil {
+		return err
+	}
+	return doPlatformRequest(req)
+}
@@ -8,17 +8,36 @@ import (
 	"io"
 	"mime/multipart"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"social-sync-backend/lib"
 	"social-sync-backend/middleware"
 )
 
 type MastodonPostRequest struct {
-	Message    string   `json:"message"`
-	Visibility string   `json:"visibility,omitempty"` // public, unlisted, private, direct
-	Images     []string `json:"images,omitempty"`     // Base64 encoded images or URLs
+	Message     string        `json:"message"`
+	Visibility  string        `json:"visibility,omitempty"`     // public, unlisted, private, direct
+	Images      []string      `json:"images,omitempty"`         // Base64 encoded images or URLs
+	DraftID     string        `json:"draftId,omitempty"`        // Links the toot to a draft for later edit/delete
+	SpoilerText string        `json:"spoiler_text,omitempty"`   // Content warning shown before the status
+	Sensitive   bool          `json:"sensitive,omitempty"`      // Hide media behind a warning
+	Language    string        `json:"language,omitempty"`       // ISO 639-1 code
+	AltTexts    []string      `json:"alt_texts,omitempty"`      // Alt description per image, in upload order
+	Poll        *MastodonPoll `json:"poll,omitempty"`           // Cannot be combined with media
+	InReplyToID string        `json:"in_reply_to_id,omitempty"` // Reply to an existing status
+	Thread      []string      `json:"thread,omitempty"`         // Follow-up statuses, each a reply to the previous one
+	SplitLong   bool          `json:"split_long,omitempty"`     // Split a message over the limit into a numbered thread
+}
+
+type MastodonPoll struct {
+	Options    []string `json:"options"`
+	ExpiresIn  int      `json:"expires_in"` // Seconds
+	Multiple   bool     `json:"multiple,omitempty"`
+	HideTotals bool     `json:"hide_totals,omitempty"`
 }
 
 type MastodonMediaResponse struct {
@@ -52,8 +71,7 @@ func PostToMastodonHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		var message string
-		var visibility string
+		var req MastodonPostRequest
 
 		contentType := r.Header.Get("Content-Type")
 		fmt.Printf("DEBUG: Content-Type: %s\n", contentType)
@@ -67,20 +85,36 @@ func PostToMastodonHandler(db *sql.DB) http.HandlerFunc {
 				return
 			}
 
-			message = strings.TrimSpace(r.FormValue("message"))
-			visibility = r.FormValue("visibility")
+			req.Message = r.FormValue("message")
+			req.Visibility = r.FormValue("visibility")
+			req.DraftID = r.FormValue("draft_id")
+			req.SpoilerText = r.FormValue("spoiler_text")
+			req.Sensitive = r.FormValue("sensitive") == "true"
+			req.Language = r.FormValue("language")
+			req.AltTexts = r.MultipartForm.Value["alt_text"]
+			req.InReplyToID = r.FormValue("in_reply_to_id")
+			req.Thread = r.MultipartForm.Value["thread"]
+			req.SplitLong = r.FormValue("split_long") == "true"
+			if options := r.MultipartForm.Value["poll_options"]; len(options) > 0 {
+				expiresIn, _ := strconv.Atoi(r.FormValue("poll_expires_in"))
+				req.Poll = &MastodonPoll{
+					Options:    options,
+					ExpiresIn:  expiresIn,
+					Multiple:   r.FormValue("poll_multiple") == "true",
+					HideTotals: r.FormValue("poll_hide_totals") == "true",
+				}
+			}
 		} else {
 			fmt.Printf("DEBUG: Parsing JSON request\n")
-			var req MastodonPostRequest
 			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 				fmt.Printf("DEBUG: Error decoding JSON request body: %v\n", err)
 				http.Error(w, "Invalid request body", http.StatusBadRequest)
 				return
 			}
-			message = strings.TrimSpace(req.Message)
-			visibility = req.Visibility
 		}
 
+		message := strings.TrimSpace(req.Message)
+		visibility := req.Visibility
 		if message == "" {
 			fmt.Printf("DEBUG: Message is empty\n")
 			http.Error(w, "Message cannot be empty", http.StatusBadRequest)
@@ -88,12 +122,24 @@ func PostToMastodonHandler(db *sql.DB) http.HandlerFunc {
 		}
 		fmt.Printf("DEBUG: Request message: %s\n", message)
 
-		if len(message) > 500 {
-			fmt.Printf("DEBUG: Message too long: %d characters\n", len(message))
-			http.Error(w, "Message exceeds Mastodon's 500 character limit", http.StatusBadRequest)
+		statuses, err := buildMastodonThread(message, req.Thread, req.SplitLong, req.SpoilerText)
+		if err != nil {
+			fmt.Printf("DEBUG: %v\n", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
+		if req.Poll != nil {
+			if err := validateMastodonPoll(req.Poll); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if r.MultipartForm != nil && len(r.MultipartForm.File["images"]) > 0 {
+				http.Error(w, "Mastodon posts cannot have both a poll and media", http.StatusBadRequest)
+				return
+			}
+		}
+
 		if visibility == "" {
 			visibility = "public"
 		}
@@ -135,27 +181,10 @@ func PostToMastodonHandler(db *sql.DB) http.HandlerFunc {
 		}
 		fmt.Printf("DEBUG: Found Mastodon account, social_id: %s\n", socialID)
 
-		// Extract instance URL from social_id
-		var instanceURL string
-		if strings.Contains(socialID, "://") {
-			lastColonIndex := strings.LastIndex(socialID, ":")
-			if lastColonIndex == -1 {
-				fmt.Printf("DEBUG: Invalid social_id format (no colon found): %s\n", socialID)
-				http.Error(w, "Invalid Mastodon account data", http.StatusInternalServerError)
-				return
-			}
-			instanceURL = socialID[:lastColonIndex]
-		} else {
-			parts := strings.Split(socialID, ":")
-			if len(parts) < 2 {
-				fmt.Printf("DEBUG: Invalid social_id format: %s\n", socialID)
-				http.Error(w, "Invalid Mastodon account data", http.StatusInternalServerError)
-				return
-			}
-			instanceURL = parts[0]
-			if !strings.HasPrefix(instanceURL, "http://") && !strings.HasPrefix(instanceURL, "https://") {
-				instanceURL = "https://" + instanceURL
-			}
+		instanceURL, err := mastodonInstanceURL(socialID)
+		if err != nil {
+			http.Error(w, "Invalid Mastodon account data", http.StatusInternalServerError)
+			return
 		}
 		fmt.Printf("DEBUG: Instance URL: %s\n", instanceURL)
 
@@ -197,15 +226,20 @@ func PostToMastodonHandler(db *sql.DB) http.HandlerFunc {
 					}
 					defer file.Close()
 
-					cloudinaryURL, err := lib.UploadToCloudinary(file, "mastodon-images", fileHeader.Filename)
+					blob, err := lib.Blobs.Put(r.Context(), "mastodon-images/"+fileHeader.Filename, file, fileHeader.Size, fileHeader.Header.Get("Content-Type"))
 					if err != nil {
-						fmt.Printf("DEBUG: Error uploading to Cloudinary: %v\n", err)
+						fmt.Printf("DEBUG: Error uploading to blob store: %v\n", err)
 						http.Error(w, "Failed to upload media", http.StatusInternalServerError)
 						return
 					}
-					fmt.Printf("DEBUG: Media uploaded to Cloudinary: %s\n", cloudinaryURL)
+					fmt.Printf("DEBUG: Media uploaded to blob store: %s\n", blob.URL)
 
-					mediaID, err := uploadImageToMastodon(instanceURL, accessToken, cloudinaryURL, fileHeader.Filename)
+					altText := ""
+					if i < len(req.AltTexts) {
+						altText = strings.TrimSpace(req.AltTexts[i])
+					}
+
+					mediaID, err := uploadImageToMastodon(instanceURL, accessToken, blob.URL, fileHeader.Filename, altText)
 					if err != nil {
 						fmt.Printf("DEBUG: Error uploading to Mastodon: %v\n", err)
 						http.Error(w, "Failed to upload media to Mastodon", http.StatusInternalServerError)
@@ -235,105 +269,247 @@ func PostToMastodonHandler(db *sql.DB) http.HandlerFunc {
 			}
 		}
 
-		tootPayload := map[string]interface{}{
-			"status":     message,
-			"visibility": visibility,
-		}
-		if len(mediaIDs) > 0 {
-			tootPayload["media_ids"] = mediaIDs
-		}
+		client := &http.Client{Timeout: 30 * time.Second}
 
-		payloadBytes, err := json.Marshal(tootPayload)
-		if err != nil {
-			fmt.Printf("DEBUG: Error marshaling payload: %v\n", err)
-			http.Error(w, "Failed to prepare toot payload", http.StatusInternalServerError)
-			return
+		// Each status after the first replies to the one before it
+		replyTo := req.InReplyToID
+		var posted []MastodonPostResponse
+		var threadErr error
+		for i, status := range statuses {
+			tootPayload := map[string]interface{}{
+				"status":     status,
+				"visibility": visibility,
+			}
+			if replyTo != "" {
+				tootPayload["in_reply_to_id"] = replyTo
+			}
+			if req.SpoilerText != "" {
+				tootPayload["spoiler_text"] = req.SpoilerText
+			}
+			if req.Sensitive {
+				tootPayload["sensitive"] = true
+			}
+			if req.Language != "" {
+				tootPayload["language"] = req.Language
+			}
+			// Media and polls belong to the opening status
+			if i == 0 {
+				if len(mediaIDs) > 0 {
+					tootPayload["media_ids"] = mediaIDs
+				}
+				if req.Poll != nil {
+					tootPayload["poll"] = req.Poll
+				}
+			}
+
+			fmt.Printf("DEBUG: Posting status %d of %d\n", i+1, len(statuses))
+			toot, err := postMastodonStatus(client, instanceURL, accessToken, tootPayload)
+			if err != nil {
+				if i == 0 {
+					fmt.Printf("DEBUG: Error posting toot: %v\n", err)
+					if apiErr, ok := err.(*mastodonAPIError); ok {
+						http.Error(w, apiErr.Error(), apiErr.StatusCode)
+						return
+					}
+					http.Error(w, "Failed to publish toot", http.StatusInternalServerError)
+					return
+				}
+				threadErr = err
+				break
+			}
+			posted = append(posted, *toot)
+			replyTo = toot.ID
+		}
+
+		fmt.Printf("DEBUG: Success! %d toot(s) posted\n", len(posted))
+		first := posted[0]
+		tootIDs := make([]string, 0, len(posted))
+		for _, toot := range posted {
+			tootIDs = append(tootIDs, toot.ID)
+		}
+		recordPublishedThread(db, req.DraftID, "mastodon", userID, tootIDs, first.URL)
+
+		response := map[string]interface{}{
+			"message":    "Toot published successfully",
+			"tootId":     first.ID,
+			"content":    first.Content,
+			"url":        first.URL,
+			"visibility": first.Visibility,
+			"createdAt":  first.CreatedAt,
+			"mediaCount": len(first.MediaAttachments),
+		}
+		if len(statuses) > 1 {
+			thread := make([]map[string]string, 0, len(posted))
+			for _, toot := range posted {
+				thread = append(thread, map[string]string{"id": toot.ID, "url": toot.URL})
+			}
+			response["thread"] = thread
 		}
-		fmt.Printf("DEBUG: Payload prepared: %s\n", string(payloadBytes))
 
-		tootURL := instanceURL + "/api/v1/statuses"
-		fmt.Printf("DEBUG: Making request to: %s\n", tootURL)
-		req_mastodon, err := http.NewRequest("POST", tootURL, bytes.NewBuffer(payloadBytes))
-		if err != nil {
-			fmt.Printf("DEBUG: Error creating request: %v\n", err)
-			http.Error(w, "Failed to create request", http.StatusInternalServerError)
-			return
+		w.Header().Set("Content-Type", "application/json")
+		if threadErr != nil {
+			// The opening status is live, so report what was posted along with the failure
+			response["message"] = fmt.Sprintf("Thread partially published (%d of %d toots)", len(posted), len(statuses))
+			response["error"] = threadErr.Error()
+			w.WriteHeader(http.StatusBadGateway)
+		} else {
+			w.WriteHeader(http.StatusOK)
 		}
+		json.NewEncoder(w).Encode(response)
+	}
+}
 
-		req_mastodon.Header.Set("Content-Type", "application/json")
-		req_mastodon.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+// mastodonCharLimit is the default status length on Mastodon instances
+const mastodonCharLimit = 500
 
-		client := &http.Client{Timeout: 30 * time.Second}
+// mastodonAPIError is an error returned by the Mastodon API
+type mastodonAPIError struct {
+	StatusCode int
+	Message    string
+}
 
-		fmt.Printf("DEBUG: Sending request to Mastodon API\n")
-		resp, err := client.Do(req_mastodon)
-		if err != nil {
-			fmt.Printf("DEBUG: Error making request to Mastodon: %v\n", err)
-			http.Error(w, "Failed to publish toot", http.StatusInternalServerError)
-			return
-		}
-		defer resp.Body.Close()
+func (e *mastodonAPIError) Error() string {
+	return fmt.Sprintf("Mastodon API error: %s", e.Message)
+}
 
-		fmt.Printf("DEBUG: Mastodon API response status: %d\n", resp.StatusCode)
+// postMastodonStatus publishes one status and returns it
+func postMastodonStatus(client *http.Client, instanceURL, accessToken string, payload map[string]interface{}) (*MastodonPostResponse, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
 
-		if resp.StatusCode == http.StatusOK {
-			fmt.Printf("DEBUG: Success! Toot posted successfully\n")
-			var mastodonResp MastodonPostResponse
-			if err := json.NewDecoder(resp.Body).Decode(&mastodonResp); err != nil {
-				w.WriteHeader(http.StatusOK)
-				w.Write([]byte("Toot published successfully"))
-				return
-			}
+	req, err := http.NewRequest("POST", instanceURL+"/api/v1/statuses", bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
 
-			response := map[string]interface{}{
-				"message":    "Toot published successfully",
-				"tootId":     mastodonResp.ID,
-				"content":    mastodonResp.Content,
-				"url":        mastodonResp.URL,
-				"visibility": mastodonResp.Visibility,
-				"createdAt":  mastodonResp.CreatedAt,
-				"mediaCount": len(mastodonResp.MediaAttachments),
-			}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(response)
-			return
+	if resp.StatusCode != http.StatusOK {
+		var errorResp MastodonErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errorResp); err != nil || errorResp.Error == "" {
+			return nil, &mastodonAPIError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("status %d", resp.StatusCode)}
 		}
+		errorMsg := errorResp.Error
+		if errorResp.ErrorDescription != "" {
+			errorMsg = errorResp.ErrorDescription
+		}
+		return nil, &mastodonAPIError{StatusCode: resp.StatusCode, Message: errorMsg}
+	}
 
-		fmt.Printf("DEBUG: Mastodon API returned error status: %d\n", resp.StatusCode)
-		var errorResp MastodonErrorResponse
-		if err := json.NewDecoder(resp.Body).Decode(&errorResp); err != nil {
-			fmt.Printf("DEBUG: Error decoding error response: %v\n", err)
-			http.Error(w, fmt.Sprintf("Mastodon API error (status: %d)", resp.StatusCode), resp.StatusCode)
-			return
+	var toot MastodonPostResponse
+	if err := json.NewDecoder(resp.Body).Decode(&toot); err != nil {
+		return nil, fmt.Errorf("toot posted but the response could not be read: %v", err)
+	}
+	return &toot, nil
+}
+
+// buildMastodonThread returns the statuses to post in order. A message over the limit is
+// split into a numbered thread when split is set and rejected otherwise. Mastodon counts
+// the content warning, which every status carries, toward each status's limit.
+func buildMastodonThread(message string, thread []string, split bool, spoilerText string) ([]string, error) {
+	limit := mastodonCharLimit - utf8.RuneCountInString(spoilerText)
+	if limit <= 0 {
+		return nil, fmt.Errorf("Content warning leaves no room for the message within Mastodon's 500 character limit")
+	}
+
+	var statuses []string
+	if utf8.RuneCountInString(message) > limit {
+		if !split {
+			return nil, fmt.Errorf("Message and content warning exceed Mastodon's 500 character limit")
 		}
+		if limit <= 2*mastodonCounterWidth {
+			return nil, fmt.Errorf("Content warning leaves too little room to split the message into a thread")
+		}
+		statuses = splitMastodonThread(message, limit)
+	} else {
+		statuses = []string{message}
+	}
 
-		if errorResp.Error != "" {
-			errorMsg := errorResp.Error
-			if errorResp.ErrorDescription != "" {
-				errorMsg = errorResp.ErrorDescription
+	for i, status := range thread {
+		status = strings.TrimSpace(status)
+		if status == "" {
+			continue
+		}
+		if utf8.RuneCountInString(status) > limit {
+			return nil, fmt.Errorf("Thread post %d and content warning exceed Mastodon's 500 character limit", i+1)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// mastodonCounterWidth is room kept for the " (n/total)" counter on split statuses
+const mastodonCounterWidth = len(" (100/100)")
+
+// splitMastodonThread breaks text into parts of at most limit characters, each ending in
+// a " (n/total)" counter. Parts break on whitespace where possible.
+func splitMastodonThread(text string, limit int) []string {
+	max := limit - mastodonCounterWidth
+
+	var parts []string
+	remaining := []rune(text)
+	for len(remaining) > max {
+		cut := max
+		for j := max; j > max/2; j-- {
+			if unicode.IsSpace(remaining[j]) {
+				cut = j
+				break
 			}
-			fmt.Printf("DEBUG: Mastodon API error: %s\n", errorMsg)
-			http.Error(w, fmt.Sprintf("Mastodon API error: %s", errorMsg), resp.StatusCode)
-			return
 		}
+		parts = append(parts, strings.TrimSpace(string(remaining[:cut])))
+		remaining = []rune(strings.TrimSpace(string(remaining[cut:])))
+	}
+	if len(remaining) > 0 {
+		parts = append(parts, string(remaining))
+	}
+
+	for i := range parts {
+		parts[i] = fmt.Sprintf("%s (%d/%d)", parts[i], i+1, len(parts))
+	}
+	return parts
+}
 
-		fmt.Printf("DEBUG: Unknown Mastodon API error\n")
-		http.Error(w, "Unknown Mastodon API error", resp.StatusCode)
+// validateMastodonPoll checks a poll against Mastodon's default instance limits
+func validateMastodonPoll(poll *MastodonPoll) error {
+	if len(poll.Options) < 2 || len(poll.Options) > 4 {
+		return fmt.Errorf("Mastodon polls need between 2 and 4 options")
+	}
+	for _, option := range poll.Options {
+		if strings.TrimSpace(option) == "" {
+			return fmt.Errorf("Poll options cannot be empty")
+		}
+		if utf8.RuneCountInString(option) > 50 {
+			return fmt.Errorf("Poll options cannot exceed 50 characters")
+		}
 	}
+	if poll.ExpiresIn == 0 {
+		poll.ExpiresIn = 24 * 60 * 60
+	}
+	if poll.ExpiresIn < 5*60 || poll.ExpiresIn > 30*24*60*60 {
+		return fmt.Errorf("Poll duration must be between 5 minutes and 30 days")
+	}
+	return nil
 }
 
-// uploadImageToMastodon uploads an image/video to Mastodon and returns the media ID
-func uploadImageToMastodon(instanceURL, accessToken, imageURL, filename string) (string, error) {
+// uploadImageToMastodon uploads an image/video to Mastodon and returns the media ID.
+// altText becomes the media description; the filename is used when it is empty.
+func uploadImageToMastodon(instanceURL, accessToken, imageURL, filename, altText string) (string, error) {
 	resp, err := http.Get(imageURL)
 	if err != nil {
-		return "", fmt.Errorf("failed to download media from Cloudinary: %v", err)
+		return "", fmt.Errorf("failed to download media from storage: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to download media from Cloudinary: status %d", resp.StatusCode)
+		return "", fmt.Errorf("failed to download media from storage: status %d", resp.StatusCode)
 	}
 
 	var b bytes.Buffer
@@ -349,12 +525,15 @@ func uploadImageToMastodon(instanceURL, accessToken, imageURL, filename string)
 		return "", err
 	}
 
-	if filename != "" {
+	if altText == "" {
+		altText = filename
+	}
+	if altText != "" {
 		descField, err := writer.CreateFormField("description")
 		if err != nil {
 			return "", err
 		}
-		descField.Write([]byte(filename))
+		descField.Write([]byte(altText))
 	}
 
 	writer.Close()
@@ -388,6 +567,27 @@ func uploadImageToMastodon(instanceURL, accessToken, imageURL, filename string)
 	return mediaResp.ID, nil
 }
 
+// mastodonInstanceURL extracts the instance base URL from a Mastodon social_id
+// ("https://instance:accountID" or the older "instance:accountID")
+func mastodonInstanceURL(socialID string) (string, error) {
+	if strings.Contains(socialID, "://") {
+		lastColonIndex := strings.LastIndex(socialID, ":")
+		if lastColonIndex == -1 {
+			return "", fmt.Errorf("invalid Mastodon social_id: %s", socialID)
+		}
+		return socialID[:lastColonIndex], nil
+	}
+	parts := strings.Split(socialID, ":")
+	if len(parts) < 2 {
+		return "", fmt.Errorf("invalid Mastodon social_id: %s", socialID)
+	}
+	instanceURL := parts[0]
+	if !strings.HasPrefix(instanceURL, "http://") && !strings.HasPrefix(instanceURL, "https://") {
+		instanceURL = "https://" + instanceURL
+	}
+	return instanceURL, nil
+}
+
 // isValidImageFile checks if the file has a valid image extension
 func isValidImageFile(filename string) bool {
 	ext := strings.ToLower(filename)
@@ -442,25 +642,10 @@ func GetMastodonPostsHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Extract instance URL from social_id
-		var instanceURL string
-		if strings.Contains(socialID, "://") {
-			lastColonIndex := strings.LastIndex(socialID, ":")
-			if lastColonIndex == -1 {
-				http.Error(w, "Invalid Mastodon account data", http.StatusInternalServerError)
-				return
-			}
-			instanceURL = socialID[:lastColonIndex]
-		} else {
-			parts := strings.Split(socialID, ":")
-			if len(parts) < 2 {
-				http.Error(w, "Invalid Mastodon account data", http.StatusInternalServerError)
-				return
-			}
-			instanceURL = parts[0]
-			if !strings.HasPrefix(instanceURL, "http://") && !strings.HasPrefix(instanceURL, "https://") {
-				instanceURL = "https://" + instanceURL
-			}
+		instanceURL, err := mastodonInstanceURL(socialID)
+		if err != nil {
+			http.Error(w, "Invalid Mastodon account data", http.StatusInternalServerError)
+			return
 		}
 
 		// Step 1: Get the user's Mastodon account ID
@@ -686,6 +871,7 @@ func GetMastodonAnalyticsHandler(db *sql.DB) http.HandlerFunc {
 			"totalBoosts":     totalBoosts,
 			"totalReplies":    totalReplies,
 			"topPosts":        topPosts,
+			"totalClicks":     countUserLinkClicks(db, userID, "mastodon"),
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(result)
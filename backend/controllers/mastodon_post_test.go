@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestBuildMastodonThread(t *testing.T) {
+	long := strings.Repeat("word ", 150) // 750 characters
+	tests := []struct {
+		name        string
+		message     string
+		thread      []string
+		split       bool
+		spoilerText string
+		wantCount   int
+		wantErr     bool
+	}{
+		{name: "short message", message: "hello", wantCount: 1},
+		{name: "exactly the limit", message: strings.Repeat("a", mastodonCharLimit), wantCount: 1},
+		{name: "over the limit without split", message: long, wantErr: true},
+		{name: "over the limit with split", message: long, split: true, wantCount: 2},
+		{name: "content warning counts toward the limit", message: strings.Repeat("a", 450), spoilerText: strings.Repeat("b", 60), wantErr: true},
+		{name: "content warning fills the limit", message: "hi", spoilerText: strings.Repeat("b", mastodonCharLimit), wantErr: true},
+		{name: "content warning leaves too little to split", message: long, split: true, spoilerText: strings.Repeat("b", 485), wantErr: true},
+		{name: "extra thread posts", message: "first", thread: []string{"second", "  ", "third"}, wantCount: 3},
+		{name: "thread post over the limit", message: "first", thread: []string{strings.Repeat("a", 501)}, wantErr: true},
+		{name: "multibyte characters count once", message: strings.Repeat("é", mastodonCharLimit), wantCount: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statuses, err := buildMastodonThread(tt.message, tt.thread, tt.split, tt.spoilerText)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %d statuses", len(statuses))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(statuses) != tt.wantCount {
+				t.Fatalf("got %d statuses, want %d", len(statuses), tt.wantCount)
+			}
+			limit := mastodonCharLimit - utf8.RuneCountInString(tt.spoilerText)
+			for i, s := range statuses {
+				if n := utf8.RuneCountInString(s); n > limit {
+					t.Errorf("status %d has %d characters, over %d", i+1, n, limit)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildMastodonThreadNumbersSplitParts(t *testing.T) {
+	statuses, err := buildMastodonThread(strings.Repeat("word ", 150), []string{"after"}, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 3 {
+		t.Fatalf("got %d statuses, want 3", len(statuses))
+	}
+	for i, suffix := range []string{" (1/2)", " (2/2)"} {
+		if !strings.HasSuffix(statuses[i], suffix) {
+			t.Errorf("status %d = %q, want suffix %q", i+1, statuses[i], suffix)
+		}
+	}
+	if statuses[2] != "after" {
+		t.Errorf("thread post = %q, want it unnumbered", statuses[2])
+	}
+}
@@ -1,21 +1,27 @@
 package controllers
 
 import (
+	"context"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
-	"path/filepath"
+	"os"
 	"social-sync-backend/lib"
 	"social-sync-backend/middleware"
 	"social-sync-backend/models"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	"github.com/lib/pq"
 )
 
 // MediaUploadRequest represents the request for uploading media
@@ -25,8 +31,38 @@ type MediaUploadRequest struct {
 
 // MediaListResponse represents the response for listing media
 type MediaListResponse struct {
-	Media []models.Media `json:"media"`
-	Total int            `json:"total"`
+	Media      []models.Media `json:"media"`
+	Total      int            `json:"total"`
+	NextCursor string         `json:"next_cursor,omitempty"` // empty on the last page
+}
+
+// maxMediaPageSize caps the limit query param of ListMedia
+const maxMediaPageSize = 200
+
+// mediaSelect reads library items with their uploader's name (scanMedia); callers append
+// the WHERE clause
+const mediaSelect = `
+	SELECT m.id, m.workspace_id, m.uploaded_by, m.filename, m.original_name,
+	       m.file_url, m.file_type, m.mime_type, m.file_size, m.width, m.height,
+	       m.duration, m.video_codec, m.audio_codec, m.frame_rate, m.bit_rate,
+	       m.tags, m.folder_id, m.content_hash, m.source, m.source_url, m.source_post_id,
+	       m.cloudinary_public_id, m.license_type, m.rights_credit, m.allowed_platforms, m.rights_expires_at,
+	       m.created_at, m.updated_at,
+	       COALESCE(u.name, '') as uploader_name
+	FROM media m
+	LEFT JOIN users u ON m.uploaded_by = u.id`
+
+func scanMedia(row rowScanner, media *models.Media) error {
+	return row.Scan(
+		&media.ID, &media.WorkspaceID, &media.UploadedBy, &media.Filename,
+		&media.OriginalName, &media.FileURL, &media.FileType, &media.MimeType,
+		&media.FileSize, &media.Width, &media.Height, &media.Duration,
+		&media.VideoCodec, &media.AudioCodec, &media.FrameRate, &media.BitRate,
+		&media.Tags, &media.FolderID, &media.ContentHash, &media.Source, &media.SourceURL, &media.SourcePostID,
+		&media.CloudinaryPublicID, &media.LicenseType, &media.RightsCredit, &media.AllowedPlatforms, &media.RightsExpiresAt,
+		&media.CreatedAt, &media.UpdatedAt,
+		&media.UploaderName,
+	)
 }
 
 // UploadMedia handles media upload to workspace
@@ -61,131 +97,269 @@ func UploadMedia(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Validate file type
-	fileType := getFileType(header.Filename)
-	if fileType == "" {
-		log.Println("Unsupported file type")
+	// Optional folder to file the upload in
+	var folderID *string
+	if id := r.FormValue("folder_id"); id != "" {
+		if ok, err := mediaFolderExists(lib.DB, workspaceID, id); err != nil || !ok {
+			http.Error(w, "Folder not found", http.StatusBadRequest)
+			return
+		}
+		folderID = &id
+	}
+
+	// Validate the file type from its content; the extension and the client's
+	// Content-Type can't be trusted
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(file, head)
+	mimeType := lib.SniffContentType(head[:n])
+	fileType, ok := mediaMimeTypes[mimeType]
+	if !ok {
+		log.Printf("Unsupported file type %s for %s", mimeType, header.Filename)
 		http.Error(w, "Unsupported file type. Supported: images (jpg,jpeg,png,gif,webp) and videos (mp4,mov,avi,mkv,wmv,flv,webm)", http.StatusBadRequest)
 		return
 	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, "Failed to read uploaded file", http.StatusInternalServerError)
+		return
+	}
+
+	// An exact copy already in the library is offered back instead of being stored again,
+	// unless the client insists with allow_duplicate=true
+	contentHash, err := lib.ContentHash(file)
+	if err != nil {
+		http.Error(w, "Failed to read uploaded file", http.StatusInternalServerError)
+		return
+	}
+	if r.FormValue("allow_duplicate") != "true" {
+		existing, err := findDuplicateMedia(workspaceID, contentHash)
+		if err != nil {
+			log.Println("Failed to check for duplicate media:", err)
+		} else if existing != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":     "This file is already in the media library; pass allow_duplicate=true to upload it again",
+				"duplicate": existing,
+			})
+			return
+		}
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, "Failed to read uploaded file", http.StatusInternalServerError)
+		return
+	}
+
+	// Generate unique filename. The extension follows the sniffed type, not the client's
+	// filename, since stores that serve files themselves pick the content type from it.
+	filename := uuid.New().String() + mediaExtensions[mimeType]
+	storageKey := fmt.Sprintf("socialsync_uploads/workspaces/%s/media/%s", workspaceID, filename)
+
+	blob, err := lib.Blobs.Put(r.Context(), storageKey, file, header.Size, mimeType)
+	if err != nil {
+		log.Println("Failed to upload media to blob store:", err)
+		http.Error(w, "Failed to upload media: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	// Generate unique filename
-	filename := uuid.New().String() + filepath.Ext(header.Filename)
-	publicID := fmt.Sprintf("workspaces/%s/media/%s", workspaceID, filename)
+	meta := probeUploadedMedia(r.Context(), file, fileType, blob)
+	var phash *int64
+	if fileType == "image" {
+		phash = perceptualHashOf(file)
+	}
 
-	// Upload to Cloudinary
-	cloudinaryURL, err := lib.UploadToCloudinary(file, "socialsync_uploads", publicID)
+	media, err := createMedia(newMediaFile{
+		WorkspaceID:  workspaceID,
+		UploadedBy:   userID,
+		Filename:     filename,
+		OriginalName: header.Filename,
+		StorageKey:   storageKey,
+		URL:          blob.URL,
+		FileType:     fileType,
+		MimeType:     mimeType,
+		FileSize:     header.Size,
+		Meta:         meta,
+		Tags:         tags,
+		FolderID:     folderID,
+		ContentHash:  contentHash,
+		PHash:        phash,
+	})
 	if err != nil {
-		log.Println("Failed to upload to Cloudinary:", err)
-		http.Error(w, "Failed to upload to Cloudinary: "+err.Error(), http.StatusInternalServerError)
+		log.Println("Failed to save media record:", err)
+		http.Error(w, "Failed to save media record: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Get file size
-	fileSize := header.Size
+	// Return the created media
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(media)
+}
+
+// newMediaFile is a file already in the blob store, to be added to the library by createMedia
+type newMediaFile struct {
+	WorkspaceID  string
+	UploadedBy   string
+	Filename     string
+	OriginalName string
+	StorageKey   string
+	URL          string
+	FileType     string // image or video
+	MimeType     string
+	FileSize     int64
+	Meta         lib.MediaMetadata
+	Tags         []string
+	FolderID     *string
+	ContentHash  string
+	PHash        *int64
+	Source       string // defaults to upload
+	SourceURL    string
+	SourcePostID string
+}
 
-	// Create media record in database
+// createMedia records a stored file in the media library, queues its platform renditions
+// and tells the workspace about it
+func createMedia(f newMediaFile) (*models.Media, error) {
+	if f.Tags == nil {
+		f.Tags = []string{}
+	}
+	if f.Source == "" {
+		f.Source = "upload"
+	}
 	mediaID := uuid.New().String()
 	now := time.Now()
 
-	_, err = lib.DB.Exec(`
+	_, err := lib.DB.Exec(`
 		INSERT INTO media (
 			id, workspace_id, uploaded_by, filename, original_name, file_url, 
-			file_type, mime_type, file_size, tags, cloudinary_public_id, 
-			created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
-	`, mediaID, workspaceID, userID, filename, header.Filename, cloudinaryURL,
-		fileType, header.Header.Get("Content-Type"), fileSize, tags, publicID, now, now)
-
+			file_type, mime_type, file_size, width, height, duration,
+			video_codec, audio_codec, frame_rate, bit_rate, tags, cloudinary_public_id, 
+			created_at, updated_at, folder_id, content_hash, phash, hashed_at,
+			source, source_url, source_post_id
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $20,
+			$24, $25, $26)
+	`, mediaID, f.WorkspaceID, f.UploadedBy, f.Filename, f.OriginalName, f.URL,
+		f.FileType, f.MimeType, f.FileSize, nullIfZero(f.Meta.Width), nullIfZero(f.Meta.Height), nullIfZeroFloat(f.Meta.Duration),
+		nullIfEmpty(f.Meta.VideoCodec), nullIfEmpty(f.Meta.AudioCodec), nullIfZeroFloat(f.Meta.FrameRate), nullIfZero(int(f.Meta.BitRate)),
+		pq.Array(f.Tags), f.StorageKey, now, now, f.FolderID, nullIfEmpty(f.ContentHash), f.PHash,
+		f.Source, nullIfEmpty(f.SourceURL), nullIfEmpty(f.SourcePostID))
 	if err != nil {
-		log.Println("Failed to save media record:", err)
-		http.Error(w, "Failed to save media record: "+err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 
 	// Get the created media with uploader info
 	var media models.Media
-	err = lib.DB.QueryRow(`
-		SELECT m.id, m.workspace_id, m.uploaded_by, m.filename, m.original_name, 
-		       m.file_url, m.file_type, m.mime_type, m.file_size, m.width, m.height, 
-		       m.duration, m.tags, m.cloudinary_public_id, m.created_at, m.updated_at,
-		       u.name as uploader_name
-		FROM media m
-		LEFT JOIN users u ON m.uploaded_by = u.id
-		WHERE m.id = $1
-	`, mediaID).Scan(
-		&media.ID, &media.WorkspaceID, &media.UploadedBy, &media.Filename,
-		&media.OriginalName, &media.FileURL, &media.FileType, &media.MimeType,
-		&media.FileSize, &media.Width, &media.Height, &media.Duration,
-		&media.Tags, &media.CloudinaryPublicID, &media.CreatedAt, &media.UpdatedAt,
-		&media.UploaderName,
-	)
-
-	if err != nil {
-		log.Println("Failed to retrieve created media:", err)
-		http.Error(w, "Failed to retrieve created media: "+err.Error(), http.StatusInternalServerError)
-		return
+	if err := scanMedia(lib.DB.QueryRow(mediaSelect+` WHERE m.id = $1`, mediaID), &media); err != nil {
+		return nil, err
 	}
 
-	// Return the created media
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(media)
+	// Queue the platform renditions; the media itself has been created either way
+	if _, err := queueMediaRenditions(&media, nil); err != nil {
+		log.Printf("Failed to queue renditions for media %s: %v", media.ID, err)
+	}
 
 	// Broadcast the event to all workspace clients
 	msg, _ := json.Marshal(map[string]interface{}{
 		"type":  "media_uploaded",
 		"media": media,
 	})
-	hub.broadcast(workspaceID, websocket.TextMessage, msg)
+	hub.broadcast(f.WorkspaceID, websocket.TextMessage, msg)
+	return &media, nil
 }
 
-// ListMedia handles listing media for a workspace
+// ListMedia handles listing media for a workspace.
+// Optional query params: type, search, tag, folder (a folder ID, or "root" for media in
+// no folder), recursive (with folder, include its subfolders), rights ("expired", or
+// "expiring" within the warning period), limit (max 200) and cursor (next_cursor from the
+// previous page). Results are newest first.
 func ListMedia(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	workspaceID := vars["workspaceId"]
 
 	// Get query parameters
-	fileType := r.URL.Query().Get("type") // "image", "video", or empty for all
-	search := r.URL.Query().Get("search")
-	tag := r.URL.Query().Get("tag")
+	q := r.URL.Query()
+	fileType := q.Get("type") // "image", "video", or empty for all
+	search := q.Get("search")
+	tag := q.Get("tag")
+	folder := q.Get("folder")
 	limit := 50 // Default limit
-	offset := 0
-
-	// Build query
-	query := `
-		SELECT m.id, m.workspace_id, m.uploaded_by, m.filename, m.original_name, 
-		       m.file_url, m.file_type, m.mime_type, m.file_size, m.width, m.height, 
-		       m.duration, m.tags, m.cloudinary_public_id, m.created_at, m.updated_at,
-		       u.name as uploader_name
-		FROM media m
-		LEFT JOIN users u ON m.uploaded_by = u.id
-		WHERE m.workspace_id = $1
-	`
+	if l, err := strconv.Atoi(q.Get("limit")); err == nil && l > 0 && l <= maxMediaPageSize {
+		limit = l
+	}
+
+	// Filters shared by the page and the total count
+	where := " WHERE m.workspace_id = $1 AND m.deleted_at IS NULL"
 	args := []interface{}{workspaceID}
 	argIndex := 2
 
-	// Add filters
 	if fileType != "" {
-		query += fmt.Sprintf(" AND m.file_type = $%d", argIndex)
+		where += fmt.Sprintf(" AND m.file_type = $%d", argIndex)
 		args = append(args, fileType)
 		argIndex++
 	}
 
 	if search != "" {
-		query += fmt.Sprintf(" AND (m.original_name ILIKE $%d OR m.filename ILIKE $%d)", argIndex, argIndex)
+		where += fmt.Sprintf(" AND (m.original_name ILIKE $%d OR m.filename ILIKE $%d)", argIndex, argIndex)
 		args = append(args, "%"+search+"%")
 		argIndex++
 	}
 
 	if tag != "" {
-		query += fmt.Sprintf(" AND $%d = ANY(m.tags)", argIndex)
+		where += fmt.Sprintf(" AND $%d = ANY(m.tags)", argIndex)
 		args = append(args, tag)
 		argIndex++
 	}
 
-	// Add ordering and pagination
-	query += fmt.Sprintf(" ORDER BY m.created_at DESC LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
-	args = append(args, limit, offset)
+	switch {
+	case folder == "":
+	case folder == "root":
+		where += " AND m.folder_id IS NULL"
+	case q.Get("recursive") == "true":
+		where += fmt.Sprintf(` AND m.folder_id IN (
+			WITH RECURSIVE sub AS (
+				SELECT id FROM media_folders WHERE id = $%d AND workspace_id = $1
+				UNION ALL
+				SELECT f.id FROM media_folders f JOIN sub ON f.parent_id = sub.id
+			) SELECT id FROM sub)`, argIndex)
+		args = append(args, folder)
+		argIndex++
+	default:
+		where += fmt.Sprintf(" AND m.folder_id = $%d", argIndex)
+		args = append(args, folder)
+		argIndex++
+	}
+
+	switch q.Get("rights") {
+	case "expired":
+		where += " AND m.rights_expires_at <= now()"
+	case "expiring":
+		where += fmt.Sprintf(" AND m.rights_expires_at > now() AND m.rights_expires_at <= $%d", argIndex)
+		args = append(args, time.Now().Add(mediaRightsWarning()))
+		argIndex++
+	}
+
+	var total int
+	err := lib.DB.QueryRow(`SELECT COUNT(*) FROM media m`+where, args...).Scan(&total)
+	if err != nil {
+		log.Println("Failed to get media count:", err)
+		http.Error(w, "Failed to get media count: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Keyset pagination: continue after the last item of the previous page
+	if cursor := q.Get("cursor"); cursor != "" {
+		createdAt, id, err := decodeMediaCursor(cursor)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		where += fmt.Sprintf(" AND (m.created_at, m.id) < ($%d, $%d)", argIndex, argIndex+1)
+		args = append(args, createdAt, id)
+		argIndex += 2
+	}
+
+	// Fetch one extra row to know whether there is another page
+	query := mediaSelect + where +
+		fmt.Sprintf(" ORDER BY m.created_at DESC, m.id DESC LIMIT $%d", argIndex)
+	args = append(args, limit+1)
 
 	// Execute query
 	rows, err := lib.DB.Query(query, args...)
@@ -196,17 +370,10 @@ func ListMedia(w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
-	var mediaList []models.Media
+	mediaList := []models.Media{}
 	for rows.Next() {
 		var media models.Media
-		err := rows.Scan(
-			&media.ID, &media.WorkspaceID, &media.UploadedBy, &media.Filename,
-			&media.OriginalName, &media.FileURL, &media.FileType, &media.MimeType,
-			&media.FileSize, &media.Width, &media.Height, &media.Duration,
-			&media.Tags, &media.CloudinaryPublicID, &media.CreatedAt, &media.UpdatedAt,
-			&media.UploaderName,
-		)
-		if err != nil {
+		if err := scanMedia(rows, &media); err != nil {
 			log.Println("Failed to scan media row:", err)
 			http.Error(w, "Failed to scan media row: "+err.Error(), http.StatusInternalServerError)
 			return
@@ -214,50 +381,46 @@ func ListMedia(w http.ResponseWriter, r *http.Request) {
 		mediaList = append(mediaList, media)
 	}
 
-	// Get total count
-	countQuery := `
-		SELECT COUNT(*) FROM media m
-		WHERE m.workspace_id = $1
-	`
-	countArgs := []interface{}{workspaceID}
-	countArgIndex := 2
-
-	if fileType != "" {
-		countQuery += fmt.Sprintf(" AND m.file_type = $%d", countArgIndex)
-		countArgs = append(countArgs, fileType)
-		countArgIndex++
-	}
-
-	if search != "" {
-		countQuery += fmt.Sprintf(" AND (m.original_name ILIKE $%d OR m.filename ILIKE $%d)", countArgIndex, countArgIndex)
-		countArgs = append(countArgs, "%"+search+"%")
-		countArgIndex++
-	}
-
-	if tag != "" {
-		countQuery += fmt.Sprintf(" AND $%d = ANY(m.tags)", countArgIndex)
-		countArgs = append(countArgs, tag)
-		countArgIndex++
-	}
-
-	var total int
-	err = lib.DB.QueryRow(countQuery, countArgs...).Scan(&total)
-	if err != nil {
-		log.Println("Failed to get media count:", err)
-		http.Error(w, "Failed to get media count: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
 	response := MediaListResponse{
 		Media: mediaList,
 		Total: total,
 	}
+	if len(mediaList) > limit {
+		response.Media = mediaList[:limit]
+		last := response.Media[limit-1]
+		response.NextCursor = encodeMediaCursor(last.CreatedAt, last.ID)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-// DeleteMedia handles deleting media from workspace
+// encodeMediaCursor makes the opaque next_cursor for ListMedia from the last item on a page
+func encodeMediaCursor(createdAt time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt.UTC().Format(time.RFC3339Nano) + "|" + id))
+}
+
+func decodeMediaCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, "", fmt.Errorf("malformed cursor")
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return time.Time{}, "", err
+	}
+	return createdAt, id, nil
+}
+
+// DeleteMedia moves media to the workspace trash. Media used by unpublished drafts is
+// refused with 409 and the usage unless ?force=true is passed.
 func DeleteMedia(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value(middleware.UserIDKey).(string)
 	vars := mux.Vars(r)
@@ -265,11 +428,11 @@ func DeleteMedia(w http.ResponseWriter, r *http.Request) {
 	mediaID := vars["mediaId"]
 
 	// Check if user has permission to delete this media
-	var uploadedBy string
+	var uploadedBy, fileURL string
 	err := lib.DB.QueryRow(`
-		SELECT uploaded_by FROM media 
-		WHERE id = $1 AND workspace_id = $2
-	`, mediaID, workspaceID).Scan(&uploadedBy)
+		SELECT uploaded_by, file_url FROM media 
+		WHERE id = $1 AND workspace_id = $2 AND deleted_at IS NULL
+	`, mediaID, workspaceID).Scan(&uploadedBy, &fileURL)
 
 	if err == sql.ErrNoRows {
 		http.Error(w, "Media not found", http.StatusNotFound)
@@ -287,32 +450,53 @@ func DeleteMedia(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get cloudinary public ID for deletion
-	var cloudinaryPublicID string
-	err = lib.DB.QueryRow(`
-		SELECT cloudinary_public_id FROM media WHERE id = $1
-	`, mediaID).Scan(&cloudinaryPublicID)
-
+	usage, err := loadMediaUsageSummary(workspaceID, mediaID, fileURL)
 	if err != nil {
-		log.Println("Failed to get media info:", err)
-		http.Error(w, "Failed to get media info: "+err.Error(), http.StatusInternalServerError)
+		log.Println("Failed to check drafts using media:", err)
+		http.Error(w, "Failed to check media usage", http.StatusInternalServerError)
+		return
+	}
+	force := r.URL.Query().Get("force") == "true"
+	if usage.InUse() && !force {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":            usage.Warning() + "; pass force=true to move it to the trash anyway",
+			"scheduled_drafts": usage.ScheduledDrafts,
+			"usage":            usage,
+		})
 		return
 	}
 
-	// Delete from Cloudinary (optional - you might want to keep files for a while)
-	// if cloudinaryPublicID != "" {
-	//     // Add Cloudinary deletion logic here
-	// }
-
-	// Delete from database
-	_, err = lib.DB.Exec("DELETE FROM media WHERE id = $1", mediaID)
+	_, err = lib.DB.Exec(`
+		UPDATE media SET deleted_at = now(), deleted_by = $1, purge_attempts = 0, purge_error = NULL
+		WHERE id = $2
+	`, userID, mediaID)
 	if err != nil {
 		log.Println("Failed to delete media:", err)
 		http.Error(w, "Failed to delete media: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	msg, _ := json.Marshal(map[string]interface{}{
+		"type":    "media_deleted",
+		"mediaId": mediaID,
+	})
+	hub.broadcast(workspaceID, websocket.TextMessage, msg)
+
+	warning := usage.Warning()
+	if warning == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	// The purge job keeps the file while scheduled drafts still use it
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":          "Media moved to trash",
+		"warning":          warning,
+		"scheduled_drafts": usage.ScheduledDrafts,
+		"usage":            usage,
+	})
 }
 
 // UpdateMediaTags handles updating media tags
@@ -333,11 +517,11 @@ func UpdateMediaTags(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if user has permission to update this media
-	var uploadedBy string
+	var uploadedBy, fileURL string
 	err := lib.DB.QueryRow(`
-		SELECT uploaded_by FROM media 
-		WHERE id = $1 AND workspace_id = $2
-	`, mediaID, workspaceID).Scan(&uploadedBy)
+		SELECT uploaded_by, file_url FROM media 
+		WHERE id = $1 AND workspace_id = $2 AND deleted_at IS NULL
+	`, mediaID, workspaceID).Scan(&uploadedBy, &fileURL)
 
 	if err == sql.ErrNoRows {
 		http.Error(w, "Media not found", http.StatusNotFound)
@@ -366,27 +550,100 @@ func UpdateMediaTags(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	// Let the editor know the change reaches posts using this media
+	usage, err := loadMediaUsageSummary(workspaceID, mediaID, fileURL)
+	if err != nil {
+		log.Println("Failed to check drafts using media:", err)
+	}
+	if usage == nil || usage.Warning() == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"warning": usage.Warning(),
+		"usage":   usage,
+	})
 }
 
-// Helper function to determine file type
-func getFileType(filename string) string {
-	ext := strings.ToLower(filepath.Ext(filename))
+// mediaMimeTypes maps the sniffed content types we accept to the media file_type
+var mediaMimeTypes = map[string]string{
+	"image/jpeg":       "image",
+	"image/png":        "image",
+	"image/gif":        "image",
+	"image/webp":       "image",
+	"video/mp4":        "video",
+	"video/quicktime":  "video",
+	"video/x-m4v":      "video",
+	"video/avi":        "video",
+	"video/x-matroska": "video",
+	"video/x-ms-wmv":   "video",
+	"video/x-flv":      "video",
+	"video/webm":       "video",
+}
 
-	imageExts := []string{".jpg", ".jpeg", ".png", ".gif", ".webp"}
-	videoExts := []string{".mp4", ".mov", ".avi", ".mkv", ".wmv", ".flv", ".webm"}
+// probeUploadedMedia reads dimensions, and for videos duration, codecs and frame rate.
+// Cloudinary reports these in its upload response; other stores need a local probe.
+// Probe failures only leave the metadata empty.
+func probeUploadedMedia(ctx context.Context, file multipart.File, fileType string, blob *lib.BlobInfo) lib.MediaMetadata {
+	if m := blob.Metadata; m != nil && m.Width > 0 && (fileType == "image" || m.Duration > 0) {
+		return *m
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return lib.MediaMetadata{}
+	}
 
-	for _, imgExt := range imageExts {
-		if ext == imgExt {
-			return "image"
+	if fileType == "image" {
+		meta, err := lib.ProbeImage(file)
+		if err != nil {
+			log.Printf("Failed to read image dimensions for %s: %v", blob.Key, err)
+			return lib.MediaMetadata{}
 		}
+		return *meta
 	}
 
-	for _, vidExt := range videoExts {
-		if ext == vidExt {
-			return "video"
+	if !lib.VideoProbeAvailable() {
+		return lib.MediaMetadata{}
+	}
+	// ffprobe needs a seekable file; the moov atom is often at the end of an MP4.
+	// Files already on disk (direct uploads) are probed in place.
+	probePath := ""
+	if f, ok := file.(*os.File); ok {
+		probePath = f.Name()
+	} else {
+		tmp, err := os.CreateTemp("", "media-probe-*")
+		if err != nil {
+			return lib.MediaMetadata{}
+		}
+		defer os.Remove(tmp.Name())
+		_, err = io.Copy(tmp, file)
+		tmp.Close()
+		if err != nil {
+			return lib.MediaMetadata{}
 		}
+		probePath = tmp.Name()
 	}
 
-	return ""
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	meta, err := lib.ProbeVideo(ctx, probePath)
+	if err != nil {
+		log.Printf("Failed to probe video %s: %v", blob.Key, err)
+		return lib.MediaMetadata{}
+	}
+	return *meta
+}
+
+func nullIfZero(n int) *int {
+	if n == 0 {
+		return nil
+	}
+	return &n
+}
+
+func nullIfZeroFloat(f float64) *float64 {
+	if f == 0 {
+		return nil
+	}
+	return &f
 }
@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/lib/pq"
+)
+
+const maxMediaBulkItems = 500
+
+// MediaBulkRequest is the body of BulkUpdateMedia
+type MediaBulkRequest struct {
+	Action   string   `json:"action"` // tag, untag, move or delete
+	MediaIDs []string `json:"media_ids"`
+	Tags     []string `json:"tags"`      // tag and untag
+	FolderID *string  `json:"folder_id"` // move; null moves to the top level
+	Force    bool     `json:"force"`     // delete media used by scheduled drafts anyway
+}
+
+// BulkUpdateMedia tags, untags, moves or deletes many media items in one transaction:
+// either every item is changed or none is. Each item must be the caller's own upload
+// unless they are an admin or editor.
+func BulkUpdateMedia(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	workspaceID := mux.Vars(r)["workspaceId"]
+
+	var req MediaBulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.MediaIDs) == 0 {
+		http.Error(w, "media_ids is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.MediaIDs) > maxMediaBulkItems {
+		http.Error(w, fmt.Sprintf("At most %d media items per request", maxMediaBulkItems), http.StatusBadRequest)
+		return
+	}
+	for i, id := range req.MediaIDs {
+		parsed, err := uuid.Parse(id)
+		if err != nil {
+			http.Error(w, "Invalid media ID "+id, http.StatusBadRequest)
+			return
+		}
+		req.MediaIDs[i] = parsed.String() // matches the IDs scanned back from the database
+	}
+
+	tags := []string{}
+	for _, t := range req.Tags {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	switch req.Action {
+	case "tag", "untag":
+		if len(tags) == 0 {
+			http.Error(w, "tags is required", http.StatusBadRequest)
+			return
+		}
+	case "move", "delete":
+	default:
+		http.Error(w, "action must be tag, untag, move or delete", http.StatusBadRequest)
+		return
+	}
+
+	if !isWorkspaceMember(userID, workspaceID) {
+		http.Error(w, "Not a member of this workspace", http.StatusForbidden)
+		return
+	}
+	privileged := IsUserAdminOrEditor(userID, workspaceID)
+
+	tx, err := lib.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to update media", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the rows so a concurrent bulk request can't interleave with this one
+	rows, err := tx.Query(`
+		SELECT id, uploaded_by, file_url FROM media
+		WHERE workspace_id = $1 AND id = ANY($2::uuid[]) AND deleted_at IS NULL
+		FOR UPDATE
+	`, workspaceID, pq.Array(req.MediaIDs))
+	if err != nil {
+		log.Println("Failed to load media for bulk update:", err)
+		http.Error(w, "Failed to update media", http.StatusInternalServerError)
+		return
+	}
+	fileURLs := map[string]string{}
+	var forbidden []string
+	for rows.Next() {
+		var id, uploadedBy, fileURL string
+		if err := rows.Scan(&id, &uploadedBy, &fileURL); err != nil {
+			rows.Close()
+			log.Println("Failed to scan media for bulk update:", err)
+			http.Error(w, "Failed to update media", http.StatusInternalServerError)
+			return
+		}
+		fileURLs[id] = fileURL
+		if uploadedBy != userID && !privileged {
+			forbidden = append(forbidden, id)
+		}
+	}
+	rows.Close()
+
+	var missing []string
+	for _, id := range req.MediaIDs {
+		if _, ok := fileURLs[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		writeMediaBulkError(w, http.StatusNotFound, "Some media items were not found", "missing", missing)
+		return
+	}
+	if len(forbidden) > 0 {
+		writeMediaBulkError(w, http.StatusForbidden, "Unauthorized to change some media items", "forbidden", forbidden)
+		return
+	}
+
+	ids := pq.Array(req.MediaIDs)
+	var res sql.Result
+	switch req.Action {
+	case "tag":
+		// Append, keeping existing order and skipping tags the item already has
+		res, err = tx.Exec(`
+			UPDATE media SET tags = ARRAY(
+				SELECT t FROM unnest(COALESCE(tags, '{}') || $1::text[]) WITH ORDINALITY AS x(t, n)
+				GROUP BY t ORDER BY min(n)
+			)
+			WHERE id = ANY($2::uuid[])
+		`, pq.Array(tags), ids)
+	case "untag":
+		res, err = tx.Exec(`
+			UPDATE media SET tags = ARRAY(
+				SELECT t FROM unnest(COALESCE(tags, '{}')) WITH ORDINALITY AS x(t, n)
+				WHERE t <> ALL($1::text[]) ORDER BY n
+			)
+			WHERE id = ANY($2::uuid[])
+		`, pq.Array(tags), ids)
+	case "move":
+		if req.FolderID != nil {
+			if ok, err := mediaFolderExists(tx, workspaceID, *req.FolderID); err != nil || !ok {
+				http.Error(w, "Folder not found", http.StatusBadRequest)
+				return
+			}
+		}
+		res, err = tx.Exec(`UPDATE media SET folder_id = $1 WHERE id = ANY($2::uuid[])`, req.FolderID, ids)
+	case "delete":
+		inUse := map[string]*MediaUsageSummary{}
+		for _, id := range req.MediaIDs {
+			usage, err := loadMediaUsageSummary(workspaceID, id, fileURLs[id])
+			if err != nil {
+				log.Println("Failed to check drafts using media:", err)
+				http.Error(w, "Failed to check media usage", http.StatusInternalServerError)
+				return
+			}
+			if usage.InUse() {
+				inUse[id] = usage
+			}
+		}
+		if len(inUse) > 0 && !req.Force {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": "Some media is used by unpublished drafts; pass force=true to move it to the trash anyway",
+				"usage": inUse,
+			})
+			return
+		}
+		res, err = tx.Exec(`
+			UPDATE media SET deleted_at = now(), deleted_by = $1, purge_attempts = 0, purge_error = NULL
+			WHERE id = ANY($2::uuid[])
+		`, userID, ids)
+	}
+	if err != nil {
+		log.Printf("Failed to %s media in bulk: %v", req.Action, err)
+		http.Error(w, "Failed to update media", http.StatusInternalServerError)
+		return
+	}
+	updated, _ := res.RowsAffected()
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to update media", http.StatusInternalServerError)
+		return
+	}
+
+	if req.Action == "delete" {
+		for _, id := range req.MediaIDs {
+			msg, _ := json.Marshal(map[string]interface{}{
+				"type":    "media_deleted",
+				"mediaId": id,
+			})
+			hub.broadcast(workspaceID, websocket.TextMessage, msg)
+		}
+	} else {
+		msg, _ := json.Marshal(map[string]interface{}{
+			"type":     "media_updated",
+			"action":   req.Action,
+			"mediaIds": req.MediaIDs,
+		})
+		hub.broadcast(workspaceID, websocket.TextMessage, msg)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"action":  req.Action,
+		"updated": updated,
+	})
+}
+
+func writeMediaBulkError(w http.ResponseWriter, status int, message, key string, ids []string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": message,
+		key:     ids,
+	})
+}
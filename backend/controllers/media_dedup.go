@@ -0,0 +1,266 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultSimilarDistance = 10
+	maxSimilarDistance     = 20
+	maxSimilarResults      = 50
+	mediaHashBatchSize     = 20
+)
+
+// SimilarMedia is a near-duplicate found by ListSimilarMedia
+type SimilarMedia struct {
+	models.Media
+	Distance int `json:"distance"` // differing bits of 64 in the perceptual hash; 0 looks identical
+}
+
+// findDuplicateMedia returns the oldest library item in the workspace with the same
+// content, or nil
+func findDuplicateMedia(workspaceID, contentHash string) (*models.Media, error) {
+	var media models.Media
+	err := scanMedia(lib.DB.QueryRow(mediaSelect+`
+		WHERE m.workspace_id = $1 AND m.content_hash = $2 AND m.deleted_at IS NULL
+		ORDER BY m.created_at
+		LIMIT 1
+	`, workspaceID, contentHash), &media)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &media, nil
+}
+
+// perceptualHashOf hashes an uploaded image, or returns nil when it can't be decoded
+func perceptualHashOf(file multipart.File) *int64 {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil
+	}
+	h, err := lib.PerceptualHash(file)
+	if err != nil {
+		log.Printf("Failed to compute perceptual hash: %v", err)
+		return nil
+	}
+	v := int64(h)
+	return &v
+}
+
+// LookupMediaByHash finds library media by the SHA-256 of its file, so clients can check
+// for a duplicate before uploading a large file at all
+func LookupMediaByHash(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	workspaceID := mux.Vars(r)["workspaceId"]
+
+	if !isWorkspaceMember(userID, workspaceID) {
+		http.Error(w, "Not a member of this workspace", http.StatusForbidden)
+		return
+	}
+	contentHash := r.URL.Query().Get("content_hash")
+	if len(contentHash) != 64 {
+		http.Error(w, "content_hash must be a hex SHA-256", http.StatusBadRequest)
+		return
+	}
+
+	media, err := findDuplicateMedia(workspaceID, contentHash)
+	if err != nil {
+		log.Println("Failed to look up media by hash:", err)
+		http.Error(w, "Failed to look up media", http.StatusInternalServerError)
+		return
+	}
+	if media == nil {
+		http.Error(w, "No media with this content", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(media)
+}
+
+// ListSimilarMedia returns workspace images that look like the given one, closest first.
+// max_distance (default 10, at most 20) is the number of perceptual hash bits that may differ.
+func ListSimilarMedia(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	vars := mux.Vars(r)
+	workspaceID := vars["workspaceId"]
+	mediaID := vars["mediaId"]
+
+	if !isWorkspaceMember(userID, workspaceID) {
+		http.Error(w, "Not a member of this workspace", http.StatusForbidden)
+		return
+	}
+	maxDistance := defaultSimilarDistance
+	if d, err := strconv.Atoi(r.URL.Query().Get("max_distance")); err == nil && d >= 0 && d <= maxSimilarDistance {
+		maxDistance = d
+	}
+
+	var phash sql.NullInt64
+	err := lib.DB.QueryRow(`
+		SELECT phash FROM media WHERE id = $1 AND workspace_id = $2 AND deleted_at IS NULL
+	`, mediaID, workspaceID).Scan(&phash)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Media not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Failed to load media hash:", err)
+		http.Error(w, "Failed to find similar media", http.StatusInternalServerError)
+		return
+	}
+	if !phash.Valid {
+		http.Error(w, "Similar media is only available for images that have been analysed", http.StatusUnprocessableEntity)
+		return
+	}
+
+	// Hamming distance isn't indexable in plain Postgres; a workspace's hashes are small
+	// enough to compare here
+	rows, err := lib.DB.Query(`
+		SELECT id, phash FROM media
+		WHERE workspace_id = $1 AND id <> $2 AND phash IS NOT NULL AND deleted_at IS NULL
+	`, workspaceID, mediaID)
+	if err != nil {
+		log.Println("Failed to load media hashes:", err)
+		http.Error(w, "Failed to find similar media", http.StatusInternalServerError)
+		return
+	}
+	distances := map[string]int{}
+	for rows.Next() {
+		var id string
+		var other int64
+		if err := rows.Scan(&id, &other); err != nil {
+			rows.Close()
+			log.Println("Failed to scan media hash:", err)
+			http.Error(w, "Failed to find similar media", http.StatusInternalServerError)
+			return
+		}
+		if d := lib.HashDistance(uint64(phash.Int64), uint64(other)); d <= maxDistance {
+			distances[id] = d
+		}
+	}
+	rows.Close()
+
+	similar := []SimilarMedia{}
+	if len(distances) > 0 {
+		ids := make([]string, 0, len(distances))
+		for id := range distances {
+			ids = append(ids, id)
+		}
+		rows, err := lib.DB.Query(mediaSelect+` WHERE m.id = ANY($1::uuid[])`, pq.Array(ids))
+		if err != nil {
+			log.Println("Failed to load similar media:", err)
+			http.Error(w, "Failed to find similar media", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var s SimilarMedia
+			if err := scanMedia(rows, &s.Media); err != nil {
+				log.Println("Failed to scan similar media:", err)
+				http.Error(w, "Failed to find similar media", http.StatusInternalServerError)
+				return
+			}
+			s.Distance = distances[s.ID]
+			similar = append(similar, s)
+		}
+	}
+	sort.SliceStable(similar, func(i, j int) bool {
+		if similar[i].Distance != similar[j].Distance {
+			return similar[i].Distance < similar[j].Distance
+		}
+		return similar[i].CreatedAt.After(similar[j].CreatedAt)
+	})
+	if len(similar) > maxSimilarResults {
+		similar = similar[:maxSimilarResults]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(similar)
+}
+
+// BackfillMediaHashes hashes media uploaded before duplicate detection existed, a batch
+// per run. Rows are marked hashed even when hashing fails so they aren't retried forever.
+func BackfillMediaHashes(db *sql.DB) {
+	rows, err := db.Query(`
+		SELECT id, file_type, cloudinary_public_id FROM media
+		WHERE hashed_at IS NULL AND deleted_at IS NULL AND cloudinary_public_id IS NOT NULL
+		ORDER BY created_at
+		LIMIT $1
+	`, mediaHashBatchSize)
+	if err != nil {
+		log.Printf("Failed to load media to hash: %v", err)
+		return
+	}
+	type pending struct{ id, fileType, key string }
+	var batch []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.fileType, &p.key); err != nil {
+			log.Printf("Failed to scan media to hash: %v", err)
+			continue
+		}
+		batch = append(batch, p)
+	}
+	rows.Close()
+
+	for _, p := range batch {
+		contentHash, phash, err := hashStoredMedia(p.key, p.fileType)
+		if err != nil {
+			log.Printf("Failed to hash media %s: %v", p.id, err)
+		}
+		if _, err := db.Exec(`
+			UPDATE media SET content_hash = $1, phash = $2, hashed_at = now() WHERE id = $3
+		`, nullIfEmpty(contentHash), phash, p.id); err != nil {
+			log.Printf("Failed to save hashes for media %s: %v", p.id, err)
+		}
+	}
+}
+
+// hashStoredMedia reads a stored file once for its content hash, and for images its
+// perceptual hash
+func hashStoredMedia(key, fileType string) (string, *int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	body, _, err := lib.Blobs.Get(ctx, key)
+	if err != nil {
+		return "", nil, err
+	}
+	defer body.Close()
+
+	if fileType != "image" {
+		contentHash, err := lib.ContentHash(body)
+		return contentHash, nil, err
+	}
+
+	// Images are at most 50MB; keep one copy for both hashes
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", nil, err
+	}
+	contentHash, _ := lib.ContentHash(bytes.NewReader(data))
+	h, err := lib.PerceptualHash(bytes.NewReader(data))
+	if err != nil {
+		return contentHash, nil, err
+	}
+	v := int64(h)
+	return contentHash, &v, nil
+}
@@ -0,0 +1,361 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/lib/pq"
+)
+
+const maxMediaFolderNameLength = 100
+
+// ListMediaFolders returns every folder in the workspace library as a flat list; clients
+// build the tree from parent_id
+func ListMediaFolders(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	workspaceID := mux.Vars(r)["workspaceId"]
+
+	if !isWorkspaceMember(userID, workspaceID) {
+		http.Error(w, "Not a member of this workspace", http.StatusForbidden)
+		return
+	}
+
+	rows, err := lib.DB.Query(`
+		SELECT f.id, f.workspace_id, f.parent_id, f.name, f.created_by, f.created_at, f.updated_at,
+		       (SELECT COUNT(*) FROM media m WHERE m.folder_id = f.id AND m.deleted_at IS NULL)
+		FROM media_folders f
+		WHERE f.workspace_id = $1
+		ORDER BY lower(f.name)
+	`, workspaceID)
+	if err != nil {
+		log.Println("Failed to query media folders:", err)
+		http.Error(w, "Failed to fetch folders", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	folders := []models.MediaFolder{}
+	for rows.Next() {
+		var f models.MediaFolder
+		if err := rows.Scan(&f.ID, &f.WorkspaceID, &f.ParentID, &f.Name, &f.CreatedBy, &f.CreatedAt, &f.UpdatedAt,
+			&f.MediaCount); err != nil {
+			log.Println("Failed to scan media folder:", err)
+			http.Error(w, "Failed to fetch folders", http.StatusInternalServerError)
+			return
+		}
+		folders = append(folders, f)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(folders)
+}
+
+// CreateMediaFolder adds a folder at the top level or inside parent_id
+func CreateMediaFolder(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	workspaceID := mux.Vars(r)["workspaceId"]
+
+	if !isWorkspaceMember(userID, workspaceID) {
+		http.Error(w, "Not a member of this workspace", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Name     string  `json:"name"`
+		ParentID *string `json:"parent_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	name, msg := cleanMediaFolderName(req.Name)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if req.ParentID != nil {
+		if ok, err := mediaFolderExists(lib.DB, workspaceID, *req.ParentID); err != nil || !ok {
+			http.Error(w, "Parent folder not found", http.StatusBadRequest)
+			return
+		}
+	}
+	if taken, err := mediaFolderNameTaken(lib.DB, workspaceID, req.ParentID, name, ""); err != nil {
+		log.Println("Failed to check folder name:", err)
+		http.Error(w, "Failed to create folder", http.StatusInternalServerError)
+		return
+	} else if taken {
+		http.Error(w, "A folder with this name already exists here", http.StatusConflict)
+		return
+	}
+
+	var f models.MediaFolder
+	err := lib.DB.QueryRow(`
+		INSERT INTO media_folders (workspace_id, parent_id, name, created_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, workspace_id, parent_id, name, created_by, created_at, updated_at
+	`, workspaceID, req.ParentID, name, userID).Scan(&f.ID, &f.WorkspaceID, &f.ParentID, &f.Name, &f.CreatedBy,
+		&f.CreatedAt, &f.UpdatedAt)
+	if err != nil {
+		log.Println("Failed to create media folder:", err)
+		http.Error(w, "Failed to create folder", http.StatusInternalServerError)
+		return
+	}
+
+	broadcastMediaFolders(workspaceID, "media_folder_created", f.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(f)
+}
+
+// UpdateMediaFolder renames a folder and/or moves it. parent_id null moves it to the top
+// level; leaving parent_id out keeps it where it is.
+func UpdateMediaFolder(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	vars := mux.Vars(r)
+	workspaceID := vars["workspaceId"]
+	folderID := vars["folderId"]
+
+	var req struct {
+		Name     *string         `json:"name"`
+		ParentID json.RawMessage `json:"parent_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	folder, ok := loadMediaFolderForUser(w, userID, workspaceID, folderID)
+	if !ok {
+		return
+	}
+
+	name := folder.Name
+	if req.Name != nil {
+		var msg string
+		if name, msg = cleanMediaFolderName(*req.Name); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	}
+	parentID := folder.ParentID
+	if len(req.ParentID) > 0 {
+		parentID = nil
+		if string(req.ParentID) != "null" {
+			if err := json.Unmarshal(req.ParentID, &parentID); err != nil {
+				http.Error(w, "parent_id must be a folder ID or null", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	tx, err := lib.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to update folder", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if parentID != nil {
+		if ok, err := mediaFolderExists(tx, workspaceID, *parentID); err != nil || !ok {
+			http.Error(w, "Parent folder not found", http.StatusBadRequest)
+			return
+		}
+		// A folder can't move into itself or one of its own subfolders
+		var cycle bool
+		err := tx.QueryRow(`
+			WITH RECURSIVE sub AS (
+				SELECT id FROM media_folders WHERE id = $1
+				UNION ALL
+				SELECT f.id FROM media_folders f JOIN sub ON f.parent_id = sub.id
+			)
+			SELECT EXISTS (SELECT 1 FROM sub WHERE id = $2)
+		`, folderID, *parentID).Scan(&cycle)
+		if err != nil {
+			log.Println("Failed to check folder move:", err)
+			http.Error(w, "Failed to update folder", http.StatusInternalServerError)
+			return
+		}
+		if cycle {
+			http.Error(w, "A folder can't be moved into itself or its subfolders", http.StatusBadRequest)
+			return
+		}
+	}
+	if taken, err := mediaFolderNameTaken(tx, workspaceID, parentID, name, folderID); err != nil {
+		log.Println("Failed to check folder name:", err)
+		http.Error(w, "Failed to update folder", http.StatusInternalServerError)
+		return
+	} else if taken {
+		http.Error(w, "A folder with this name already exists there", http.StatusConflict)
+		return
+	}
+
+	err = tx.QueryRow(`
+		UPDATE media_folders SET name = $1, parent_id = $2, updated_at = now()
+		WHERE id = $3
+		RETURNING id, workspace_id, parent_id, name, created_by, created_at, updated_at
+	`, name, parentID, folderID).Scan(&folder.ID, &folder.WorkspaceID, &folder.ParentID, &folder.Name,
+		&folder.CreatedBy, &folder.CreatedAt, &folder.UpdatedAt)
+	if err != nil {
+		log.Println("Failed to update media folder:", err)
+		http.Error(w, "Failed to update folder", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to update folder", http.StatusInternalServerError)
+		return
+	}
+
+	broadcastMediaFolders(workspaceID, "media_folder_updated", folder.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(folder)
+}
+
+// DeleteMediaFolder removes a folder. Its media and subfolders move up to its parent,
+// so nothing in the library is deleted with it.
+func DeleteMediaFolder(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	vars := mux.Vars(r)
+	workspaceID := vars["workspaceId"]
+	folderID := vars["folderId"]
+
+	folder, ok := loadMediaFolderForUser(w, userID, workspaceID, folderID)
+	if !ok {
+		return
+	}
+
+	tx, err := lib.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to delete folder", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Subfolders can't land next to a folder with the same name
+	var clash string
+	err = tx.QueryRow(`
+		SELECT c.name FROM media_folders c
+		JOIN media_folders s ON s.workspace_id = c.workspace_id
+		  AND s.parent_id IS NOT DISTINCT FROM $2 AND s.id <> $1 AND lower(s.name) = lower(c.name)
+		WHERE c.parent_id = $1
+		LIMIT 1
+	`, folderID, folder.ParentID).Scan(&clash)
+	if err == nil {
+		http.Error(w, "Subfolder \""+clash+"\" has the same name as a folder it would move next to; rename it first", http.StatusConflict)
+		return
+	} else if err != sql.ErrNoRows {
+		log.Println("Failed to check subfolder names:", err)
+		http.Error(w, "Failed to delete folder", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.Exec(`UPDATE media SET folder_id = $1 WHERE folder_id = $2`, folder.ParentID, folderID); err != nil {
+		log.Println("Failed to move media out of folder:", err)
+		http.Error(w, "Failed to delete folder", http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec(`UPDATE media_folders SET parent_id = $1, updated_at = now() WHERE parent_id = $2`,
+		folder.ParentID, folderID); err != nil {
+		log.Println("Failed to move subfolders:", err)
+		http.Error(w, "Failed to delete folder", http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec(`DELETE FROM media_folders WHERE id = $1`, folderID); err != nil {
+		log.Println("Failed to delete media folder:", err)
+		http.Error(w, "Failed to delete folder", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to delete folder", http.StatusInternalServerError)
+		return
+	}
+
+	broadcastMediaFolders(workspaceID, "media_folder_deleted", folderID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadMediaFolderForUser loads a folder the user may change (its creator or an
+// admin/editor), writing the error response when there is none
+func loadMediaFolderForUser(w http.ResponseWriter, userID, workspaceID, folderID string) (*models.MediaFolder, bool) {
+	var f models.MediaFolder
+	err := lib.DB.QueryRow(`
+		SELECT id, workspace_id, parent_id, name, created_by, created_at, updated_at
+		FROM media_folders
+		WHERE id = $1 AND workspace_id = $2
+	`, folderID, workspaceID).Scan(&f.ID, &f.WorkspaceID, &f.ParentID, &f.Name, &f.CreatedBy, &f.CreatedAt, &f.UpdatedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Folder not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Println("Failed to load media folder:", err)
+		http.Error(w, "Failed to load folder", http.StatusInternalServerError)
+		return nil, false
+	}
+	if (f.CreatedBy == nil || *f.CreatedBy != userID) && !IsUserAdminOrEditor(userID, workspaceID) {
+		http.Error(w, "Unauthorized to change this folder", http.StatusForbidden)
+		return nil, false
+	}
+	return &f, true
+}
+
+// cleanMediaFolderName trims a folder name, returning a message when it isn't usable
+func cleanMediaFolderName(name string) (string, string) {
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "":
+		return "", "Folder name is required"
+	case len(name) > maxMediaFolderNameLength:
+		return "", "Folder name is too long"
+	case strings.ContainsAny(name, "/\\"):
+		return "", "Folder names can't contain slashes"
+	}
+	return name, ""
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func mediaFolderExists(q queryRower, workspaceID, folderID string) (bool, error) {
+	var exists bool
+	err := q.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM media_folders WHERE id = $1 AND workspace_id = $2)
+	`, folderID, workspaceID).Scan(&exists)
+	if err, ok := err.(*pq.Error); ok && err.Code == "22P02" {
+		return false, nil // not a UUID
+	}
+	return exists, err
+}
+
+// mediaFolderNameTaken reports whether a sibling under parentID already has the name,
+// ignoring the folder exceptID
+func mediaFolderNameTaken(q queryRower, workspaceID string, parentID *string, name, exceptID string) (bool, error) {
+	var taken bool
+	err := q.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM media_folders
+			WHERE workspace_id = $1 AND parent_id IS NOT DISTINCT FROM $2 AND lower(name) = lower($3)
+			  AND id::text <> $4
+		)
+	`, workspaceID, parentID, name, exceptID).Scan(&taken)
+	return taken, err
+}
+
+func broadcastMediaFolders(workspaceID, event, folderID string) {
+	msg, _ := json.Marshal(map[string]interface{}{
+		"type":     event,
+		"folderId": folderID,
+	})
+	hub.broadcast(workspaceID, websocket.TextMessage, msg)
+}
@@ -0,0 +1,429 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// mediaImportTimeout bounds resolving and downloading one import
+const mediaImportTimeout = 10 * time.Minute
+
+// MediaImportRequest is the body of ImportMedia: either url, or platform and post_id
+type MediaImportRequest struct {
+	URL            string   `json:"url"`
+	Platform       string   `json:"platform"` // instagram or facebook
+	PostID         string   `json:"post_id"`  // a post of the caller's connected account
+	Index          int      `json:"index"`    // item of a carousel or album post, from 0
+	Tags           []string `json:"tags"`
+	FolderID       *string  `json:"folder_id"`
+	AllowDuplicate bool     `json:"allow_duplicate"`
+}
+
+// importSource is a file to import and where it came from
+type importSource struct {
+	DownloadURL string
+	Name        string // original_name for the library
+	Source      string
+	SourceURL   string
+	PostID      string
+}
+
+// mediaExtensions names imported files, whose URLs rarely end in a useful extension
+var mediaExtensions = map[string]string{
+	"image/jpeg":       ".jpg",
+	"image/png":        ".png",
+	"image/gif":        ".gif",
+	"image/webp":       ".webp",
+	"video/mp4":        ".mp4",
+	"video/quicktime":  ".mov",
+	"video/x-m4v":      ".m4v",
+	"video/avi":        ".avi",
+	"video/x-matroska": ".mkv",
+	"video/x-ms-wmv":   ".wmv",
+	"video/x-flv":      ".flv",
+	"video/webm":       ".webm",
+}
+
+// ImportMedia downloads a file from a public URL, or the image or video of a post on the
+// caller's connected Instagram or Facebook account, into the media library. Imports get
+// the same checks as UploadMedia and record their source.
+func ImportMedia(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	workspaceID := mux.Vars(r)["workspaceId"]
+
+	var req MediaImportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.URL = strings.TrimSpace(req.URL)
+	req.PostID = strings.TrimSpace(req.PostID)
+	if (req.URL == "") == (req.PostID == "") {
+		http.Error(w, "Provide either url, or platform and post_id", http.StatusBadRequest)
+		return
+	}
+	if req.PostID != "" && req.Platform != "instagram" && req.Platform != "facebook" {
+		http.Error(w, "platform must be instagram or facebook", http.StatusBadRequest)
+		return
+	}
+	if req.Index < 0 {
+		http.Error(w, "index must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	if !isWorkspaceMember(userID, workspaceID) {
+		http.Error(w, "Not a member of this workspace", http.StatusForbidden)
+		return
+	}
+	if req.FolderID != nil {
+		if ok, err := mediaFolderExists(lib.DB, workspaceID, *req.FolderID); err != nil || !ok {
+			http.Error(w, "Folder not found", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), mediaImportTimeout)
+	defer cancel()
+
+	var src *importSource
+	var err error
+	if req.URL != "" {
+		src, err = urlImportSource(req.URL)
+	} else {
+		acc, accErr := loadPlatformAccount(lib.DB, userID, req.Platform)
+		if accErr == sql.ErrNoRows {
+			http.Error(w, "No "+req.Platform+" account connected", http.StatusBadRequest)
+			return
+		}
+		if accErr != nil {
+			log.Println("Failed to load social account:", accErr)
+			http.Error(w, "Failed to import media", http.StatusInternalServerError)
+			return
+		}
+		if req.Platform == "instagram" {
+			src, err = instagramImportSource(acc, req.PostID, req.Index)
+		} else {
+			src, err = facebookImportSource(acc, req.PostID, req.Index)
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tmp, size, err := downloadImport(ctx, src.DownloadURL)
+	if errors.Is(err, lib.ErrNonPublicAddress) {
+		http.Error(w, "url must point to a public server", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to download media import %s: %v", src.DownloadURL, err)
+		http.Error(w, "Failed to download media: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+	if size > maxDirectUploadBytes() {
+		http.Error(w, fmt.Sprintf("Files can be at most %d bytes", maxDirectUploadBytes()), http.StatusBadRequest)
+		return
+	}
+
+	mimeType, fileType, err := sniffMediaFile(tmp, size)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	contentHash, err := lib.ContentHash(tmp)
+	if err != nil {
+		http.Error(w, "Failed to read downloaded file", http.StatusInternalServerError)
+		return
+	}
+	if !req.AllowDuplicate {
+		existing, err := findDuplicateMedia(workspaceID, contentHash)
+		if err != nil {
+			log.Println("Failed to check for duplicate media:", err)
+		} else if existing != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":     "This file is already in the media library; pass allow_duplicate=true to import it again",
+				"duplicate": existing,
+			})
+			return
+		}
+	}
+
+	if plainExt(src.Name) == "" {
+		src.Name += mediaExtensions[mimeType]
+	}
+	filename := uuid.New().String() + mediaExtensions[mimeType]
+	storageKey := fmt.Sprintf("socialsync_uploads/workspaces/%s/media/%s", workspaceID, filename)
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, "Failed to read downloaded file", http.StatusInternalServerError)
+		return
+	}
+	blob, err := lib.Blobs.Put(ctx, storageKey, tmp, size, mimeType)
+	if err != nil {
+		log.Println("Failed to upload imported media to blob store:", err)
+		http.Error(w, "Failed to store media", http.StatusInternalServerError)
+		return
+	}
+
+	meta := probeUploadedMedia(ctx, tmp, fileType, blob)
+	var phash *int64
+	if fileType == "image" {
+		phash = perceptualHashOf(tmp)
+	}
+
+	media, err := createMedia(newMediaFile{
+		WorkspaceID:  workspaceID,
+		UploadedBy:   userID,
+		Filename:     filename,
+		OriginalName: src.Name,
+		StorageKey:   storageKey,
+		URL:          blob.URL,
+		FileType:     fileType,
+		MimeType:     mimeType,
+		FileSize:     size,
+		Meta:         meta,
+		Tags:         req.Tags,
+		FolderID:     req.FolderID,
+		ContentHash:  contentHash,
+		PHash:        phash,
+		Source:       src.Source,
+		SourceURL:    src.SourceURL,
+		SourcePostID: src.PostID,
+	})
+	if err != nil {
+		log.Println("Failed to save imported media record:", err)
+		if err := lib.Blobs.Delete(context.Background(), storageKey); err != nil {
+			log.Printf("Failed to delete orphaned import %s: %v", storageKey, err)
+		}
+		http.Error(w, "Failed to save media record", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(media)
+}
+
+// urlImportSource checks a user-supplied URL; whether it's reachable and public is
+// checked when it's downloaded
+func urlImportSource(rawURL string) (*importSource, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("url must be an http or https URL")
+	}
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		name = u.Hostname()
+	}
+	return &importSource{DownloadURL: u.String(), Name: name, Source: "url", SourceURL: u.String()}, nil
+}
+
+// instagramImportSource finds the file of an Instagram post, or of one carousel item
+func instagramImportSource(acc *platformAccount, postID string, index int) (*importSource, error) {
+	type igMedia struct {
+		ID        string `json:"id"`
+		MediaType string `json:"media_type"` // IMAGE, VIDEO or CAROUSEL_ALBUM
+		MediaURL  string `json:"media_url"`
+	}
+	var post struct {
+		igMedia
+		Permalink string `json:"permalink"`
+		Children  struct {
+			Data []igMedia `json:"data"`
+		} `json:"children"`
+	}
+	graphURL := lib.GraphURL("%s?fields=id,media_type,media_url,permalink,children{id,media_type,media_url}&access_token=%s",
+		url.PathEscape(postID), url.QueryEscape(acc.AccessToken))
+	if err := getJSON(graphURL, nil, &post); err != nil {
+		log.Printf("Failed to look up Instagram post %s: %v", postID, err)
+		return nil, errors.New("Instagram post not found on your connected account")
+	}
+
+	item := post.igMedia
+	if post.MediaType == "CAROUSEL_ALBUM" {
+		if index >= len(post.Children.Data) {
+			return nil, fmt.Errorf("The carousel has %d items", len(post.Children.Data))
+		}
+		item = post.Children.Data[index]
+	} else if index > 0 {
+		return nil, errors.New("index only applies to carousel posts")
+	}
+	if item.MediaURL == "" {
+		// Instagram withholds media_url for posts with copyrighted audio
+		return nil, errors.New("Instagram doesn't make this post's media available for download")
+	}
+	return &importSource{
+		DownloadURL: item.MediaURL,
+		Name:        fmt.Sprintf("instagram_%s", item.ID),
+		Source:      "instagram",
+		SourceURL:   post.Permalink,
+		PostID:      post.ID,
+	}, nil
+}
+
+// facebookImportSource finds the photo or video of a Facebook Page post, or of one album
+// item, at full size
+func facebookImportSource(acc *platformAccount, postID string, index int) (*importSource, error) {
+	type fbAttachment struct {
+		MediaType string `json:"media_type"` // photo, video or album
+		Media     struct {
+			Image struct {
+				Src string `json:"src"`
+			} `json:"image"`
+			Source string `json:"source"` // videos
+		} `json:"media"`
+		Target struct {
+			ID string `json:"id"`
+		} `json:"target"`
+	}
+	var post struct {
+		ID           string `json:"id"`
+		PermalinkURL string `json:"permalink_url"`
+		Attachments  struct {
+			Data []struct {
+				fbAttachment
+				Subattachments struct {
+					Data []fbAttachment `json:"data"`
+				} `json:"subattachments"`
+			} `json:"data"`
+		} `json:"attachments"`
+	}
+	graphURL := lib.GraphURL("%s?fields=id,permalink_url,attachments{media_type,media,target,subattachments}&access_token=%s",
+		url.PathEscape(postID), url.QueryEscape(acc.AccessToken))
+	if err := getJSON(graphURL, nil, &post); err != nil {
+		log.Printf("Failed to look up Facebook post %s: %v", postID, err)
+		return nil, errors.New("Facebook post not found on your connected Page")
+	}
+	if len(post.Attachments.Data) == 0 {
+		return nil, errors.New("This Facebook post has no photo or video")
+	}
+
+	first := post.Attachments.Data[0]
+	item := first.fbAttachment
+	if subs := first.Subattachments.Data; len(subs) > 0 {
+		if index >= len(subs) {
+			return nil, fmt.Errorf("The post has %d items", len(subs))
+		}
+		item = subs[index]
+	} else if index > 0 {
+		return nil, errors.New("index only applies to posts with several photos or videos")
+	}
+
+	downloadURL := item.Media.Image.Src // a preview size; replaced below when possible
+	switch {
+	case strings.Contains(item.MediaType, "video"):
+		downloadURL = item.Media.Source
+		if downloadURL == "" && item.Target.ID != "" {
+			var video struct {
+				Source string `json:"source"`
+			}
+			if err := getJSON(lib.GraphURL("%s?fields=source&access_token=%s", item.Target.ID, url.QueryEscape(acc.AccessToken)), nil, &video); err == nil {
+				downloadURL = video.Source
+			}
+		}
+	case item.MediaType == "photo" && item.Target.ID != "":
+		var photo struct {
+			Images []struct {
+				Width  int    `json:"width"`
+				Source string `json:"source"`
+			} `json:"images"`
+		}
+		if err := getJSON(lib.GraphURL("%s?fields=images&access_token=%s", item.Target.ID, url.QueryEscape(acc.AccessToken)), nil, &photo); err == nil {
+			width := 0
+			for _, img := range photo.Images {
+				if img.Width > width {
+					width, downloadURL = img.Width, img.Source
+				}
+			}
+		}
+	}
+	if downloadURL == "" {
+		return nil, errors.New("Facebook doesn't make this post's media available for download")
+	}
+
+	name := "facebook_" + post.ID
+	if item.Target.ID != "" {
+		name = "facebook_" + item.Target.ID
+	}
+	return &importSource{
+		DownloadURL: downloadURL,
+		Name:        name,
+		Source:      "facebook",
+		SourceURL:   post.PermalinkURL,
+		PostID:      post.ID,
+	}, nil
+}
+
+// downloadImport fetches an import to a temp file, only ever connecting to public
+// addresses. Reading stops just past the direct upload limit.
+func downloadImport(ctx context.Context, rawURL string) (*os.File, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := lib.PublicHTTPClient(mediaImportTimeout).Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("server answered %s", resp.Status)
+	}
+	limit := maxDirectUploadBytes()
+	if resp.ContentLength > limit {
+		return nil, 0, fmt.Errorf("file is larger than %d bytes", limit)
+	}
+	return downloadToTemp(resp.Body, limit)
+}
+
+// fetchPublicMedia downloads a client-supplied media URL to a temp file for re-uploading
+// to a platform. It only connects to public addresses and fails when the file is larger
+// than limit. It also returns the response's content type. The caller closes and removes
+// the file.
+func fetchPublicMedia(rawURL string, limit int64, timeout time.Duration) (*os.File, int64, string, error) {
+	resp, err := lib.PublicHTTPClient(timeout).Get(rawURL)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, "", fmt.Errorf("server answered %s", resp.Status)
+	}
+	if resp.ContentLength > limit {
+		return nil, 0, "", fmt.Errorf("file is larger than %d bytes", limit)
+	}
+	tmp, size, err := downloadToTemp(resp.Body, limit)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	if size > limit {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, 0, "", fmt.Errorf("file is larger than %d bytes", limit)
+	}
+	return tmp, size, resp.Header.Get("Content-Type"), nil
+}
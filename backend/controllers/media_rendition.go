@@ -0,0 +1,704 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/lib/pq"
+)
+
+const (
+	renditionBatchSize = 4
+	// A rendition left in processing this long is assumed abandoned (e.g. a restart) and retried
+	renditionStaleAfter  = 30 * time.Minute
+	maxRenditionAttempts = 3
+	renditionTimeout     = 15 * time.Minute
+)
+
+// builtinRenditionPresets are available in every workspace. A workspace can change their
+// settings, disable them, or add its own presets (workspace_rendition_presets).
+var builtinRenditionPresets = []models.RenditionPreset{
+	{Name: "instagram_feed_portrait", Platform: "instagram", Placement: "feed", MediaType: "image", Width: 1080, Height: 1350, Fit: lib.FitCrop, Format: "jpeg"},
+	{Name: "instagram_feed_square", Platform: "instagram", Placement: "feed", MediaType: "image", Width: 1080, Height: 1080, Fit: lib.FitCrop, Format: "jpeg"},
+	{Name: "instagram_story", Platform: "instagram", Placement: "story", MediaType: "image", Width: 1080, Height: 1920, Fit: lib.FitCrop, Format: "jpeg"},
+	{Name: "instagram_story_video", Platform: "instagram", Placement: "story", MediaType: "video", Width: 1080, Height: 1920, Fit: lib.FitCrop, Format: "mp4"},
+	{Name: "instagram_reel", Platform: "instagram", Placement: "reel", MediaType: "video", Width: 1080, Height: 1920, Fit: lib.FitCrop, Format: "mp4"},
+	{Name: "tiktok_video", Platform: "tiktok", Placement: "post", MediaType: "video", Width: 1080, Height: 1920, Fit: lib.FitCrop, Format: "mp4"},
+	{Name: "twitter_landscape", Platform: "twitter", Placement: "post", MediaType: "image", Width: 1600, Height: 900, Fit: lib.FitCrop, Format: "jpeg"},
+	{Name: "twitter_video", Platform: "twitter", Placement: "post", MediaType: "video", Width: 1280, Height: 720, Fit: lib.FitFit, Format: "mp4"},
+	{Name: "facebook_feed", Platform: "facebook", Placement: "feed", MediaType: "image", Width: 2048, Height: 2048, Fit: lib.FitFit, Format: "jpeg"},
+	{Name: "youtube_thumbnail", Platform: "youtube", Placement: "thumbnail", MediaType: "image", Width: 1280, Height: 720, Fit: lib.FitCrop, Format: "jpeg"},
+}
+
+var renditionPresetNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// workspaceRenditionPresets merges the built-in presets with the workspace's own settings
+func workspaceRenditionPresets(workspaceID string) ([]models.RenditionPreset, error) {
+	presets := make([]models.RenditionPreset, 0, len(builtinRenditionPresets))
+	index := map[string]int{}
+	for _, p := range builtinRenditionPresets {
+		p.Enabled, p.BuiltIn = true, true
+		index[p.Name] = len(presets)
+		presets = append(presets, p)
+	}
+
+	rows, err := lib.DB.Query(`
+		SELECT name, platform, placement, media_type, width, height, fit, format, quality, enabled
+		FROM workspace_rendition_presets
+		WHERE workspace_id = $1
+		ORDER BY name
+	`, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.RenditionPreset
+		if err := rows.Scan(&p.Name, &p.Platform, &p.Placement, &p.MediaType, &p.Width, &p.Height,
+			&p.Fit, &p.Format, &p.Quality, &p.Enabled); err != nil {
+			return nil, err
+		}
+		if i, ok := index[p.Name]; ok {
+			p.BuiltIn = true
+			presets[i] = p
+			continue
+		}
+		presets = append(presets, p)
+	}
+	return presets, rows.Err()
+}
+
+// ListRenditionPresets returns the presets in effect for the workspace
+func ListRenditionPresets(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	workspaceID := mux.Vars(r)["workspaceId"]
+
+	if !isWorkspaceMember(userID, workspaceID) {
+		http.Error(w, "Not a member of this workspace", http.StatusForbidden)
+		return
+	}
+
+	presets, err := workspaceRenditionPresets(workspaceID)
+	if err != nil {
+		log.Println("Failed to load rendition presets:", err)
+		http.Error(w, "Failed to load rendition presets", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(presets)
+}
+
+// UpdateRenditionPreset creates a workspace preset, or changes or disables a built-in one
+func UpdateRenditionPreset(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	vars := mux.Vars(r)
+	workspaceID := vars["workspaceId"]
+	name := vars["name"]
+
+	if !IsUserAdminOrEditor(userID, workspaceID) {
+		http.Error(w, "Only admins and editors can change rendition presets", http.StatusForbidden)
+		return
+	}
+	if !renditionPresetNameRe.MatchString(name) {
+		http.Error(w, "Preset names use lowercase letters, digits, - and _", http.StatusBadRequest)
+		return
+	}
+
+	var p models.RenditionPreset
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	p.Name = name
+	p.Platform = strings.ToLower(strings.TrimSpace(p.Platform))
+	p.Placement = strings.ToLower(strings.TrimSpace(p.Placement))
+	if err := validateRenditionPreset(&p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err := lib.DB.Exec(`
+		INSERT INTO workspace_rendition_presets
+			(workspace_id, name, platform, placement, media_type, width, height, fit, format, quality, enabled, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, now())
+		ON CONFLICT (workspace_id, name) DO UPDATE SET
+			platform = EXCLUDED.platform, placement = EXCLUDED.placement, media_type = EXCLUDED.media_type,
+			width = EXCLUDED.width, height = EXCLUDED.height, fit = EXCLUDED.fit, format = EXCLUDED.format,
+			quality = EXCLUDED.quality, enabled = EXCLUDED.enabled, updated_at = now()
+	`, workspaceID, p.Name, p.Platform, p.Placement, p.MediaType, p.Width, p.Height, p.Fit, p.Format, p.Quality, p.Enabled)
+	if err != nil {
+		log.Println("Failed to save rendition preset:", err)
+		http.Error(w, "Failed to save rendition preset", http.StatusInternalServerError)
+		return
+	}
+
+	for _, b := range builtinRenditionPresets {
+		if b.Name == p.Name {
+			p.BuiltIn = true
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// DeleteRenditionPreset removes a workspace preset, or resets a built-in one to its defaults.
+// Renditions already generated from it are kept.
+func DeleteRenditionPreset(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	vars := mux.Vars(r)
+	workspaceID := vars["workspaceId"]
+
+	if !IsUserAdminOrEditor(userID, workspaceID) {
+		http.Error(w, "Only admins and editors can change rendition presets", http.StatusForbidden)
+		return
+	}
+
+	res, err := lib.DB.Exec(`DELETE FROM workspace_rendition_presets WHERE workspace_id = $1 AND name = $2`,
+		workspaceID, vars["name"])
+	if err != nil {
+		log.Println("Failed to delete rendition preset:", err)
+		http.Error(w, "Failed to delete rendition preset", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Preset has no workspace settings", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func validateRenditionPreset(p *models.RenditionPreset) error {
+	if p.Platform == "" || p.Placement == "" {
+		return fmt.Errorf("platform and placement are required")
+	}
+	if p.Width < 16 || p.Height < 16 || p.Width > 4096 || p.Height > 4096 {
+		return fmt.Errorf("width and height must be between 16 and 4096")
+	}
+	if p.Fit != lib.FitCrop && p.Fit != lib.FitFit {
+		return fmt.Errorf("fit must be crop or fit")
+	}
+	switch p.MediaType {
+	case "image":
+		if p.Format != "jpeg" && p.Format != "png" {
+			return fmt.Errorf("image presets use jpeg or png")
+		}
+	case "video":
+		if p.Format != "mp4" {
+			return fmt.Errorf("video presets use mp4")
+		}
+	default:
+		return fmt.Errorf("media_type must be image or video")
+	}
+	if p.Quality != nil && (*p.Quality < 1 || *p.Quality > 100) {
+		return fmt.Errorf("quality must be between 1 and 100")
+	}
+	return nil
+}
+
+// ListMediaRenditions lists the renditions of a media item
+func ListMediaRenditions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	vars := mux.Vars(r)
+	workspaceID := vars["workspaceId"]
+
+	if !isWorkspaceMember(userID, workspaceID) {
+		http.Error(w, "Not a member of this workspace", http.StatusForbidden)
+		return
+	}
+
+	renditions, err := loadMediaRenditions(workspaceID, vars["mediaId"])
+	if err != nil {
+		log.Println("Failed to load renditions:", err)
+		http.Error(w, "Failed to load renditions", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(renditions)
+}
+
+// CreateMediaRenditions queues renditions of a media item: the named presets, or every
+// enabled preset for its media type. Existing renditions of those presets are regenerated
+// with the current preset settings.
+func CreateMediaRenditions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	vars := mux.Vars(r)
+	workspaceID := vars["workspaceId"]
+	mediaID := vars["mediaId"]
+
+	if !isWorkspaceMember(userID, workspaceID) {
+		http.Error(w, "Not a member of this workspace", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Presets []string `json:"presets"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	media, err := loadMediaFile(mediaID, workspaceID, "")
+	if err == sql.ErrNoRows {
+		http.Error(w, "Media not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Failed to load media:", err)
+		http.Error(w, "Failed to load media", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := queueMediaRenditions(media, req.Presets); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	renditions, err := loadMediaRenditions(workspaceID, mediaID)
+	if err != nil {
+		log.Println("Failed to load renditions:", err)
+		http.Error(w, "Failed to load renditions", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(renditions)
+}
+
+// queueMediaRenditions marks renditions of media as pending for ProcessMediaRenditions.
+// With no names every enabled preset matching the media type is queued. Returns the
+// number queued.
+func queueMediaRenditions(media *models.Media, names []string) (int, error) {
+	presets, err := workspaceRenditionPresets(media.WorkspaceID)
+	if err != nil {
+		return 0, err
+	}
+
+	var selected []models.RenditionPreset
+	if len(names) == 0 {
+		for _, p := range presets {
+			if p.Enabled && p.MediaType == media.FileType {
+				selected = append(selected, p)
+			}
+		}
+	} else {
+		byName := map[string]models.RenditionPreset{}
+		for _, p := range presets {
+			byName[p.Name] = p
+		}
+		for _, name := range names {
+			p, ok := byName[name]
+			if !ok {
+				return 0, fmt.Errorf("unknown preset %q", name)
+			}
+			if p.MediaType != media.FileType {
+				return 0, fmt.Errorf("preset %q is for %ss", name, p.MediaType)
+			}
+			selected = append(selected, p)
+		}
+	}
+
+	for _, p := range selected {
+		_, err := lib.DB.Exec(`
+			INSERT INTO media_renditions
+				(media_id, workspace_id, preset, platform, placement, width, height, fit, format, quality)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			ON CONFLICT (media_id, preset) DO UPDATE SET
+				platform = EXCLUDED.platform, placement = EXCLUDED.placement,
+				width = EXCLUDED.width, height = EXCLUDED.height, fit = EXCLUDED.fit,
+				format = EXCLUDED.format, quality = EXCLUDED.quality,
+				status = 'pending', error = NULL, attempts = 0, updated_at = now()
+		`, media.ID, media.WorkspaceID, p.Name, p.Platform, p.Placement, p.Width, p.Height, p.Fit, p.Format, p.Quality)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(selected), nil
+}
+
+func loadMediaRenditions(workspaceID, mediaID string) ([]models.MediaRendition, error) {
+	rows, err := lib.DB.Query(`
+		SELECT `+mediaRenditionColumns+`
+		FROM media_renditions
+		WHERE workspace_id = $1 AND media_id = $2
+		ORDER BY platform, placement, preset
+	`, workspaceID, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	renditions := []models.MediaRendition{}
+	for rows.Next() {
+		var mr models.MediaRendition
+		if err := scanMediaRendition(rows, &mr); err != nil {
+			return nil, err
+		}
+		renditions = append(renditions, mr)
+	}
+	return renditions, rows.Err()
+}
+
+const mediaRenditionColumns = `id, media_id, workspace_id, preset, platform, placement, width, height, fit, format,
+	quality, status, error, attempts, file_url, storage_key, mime_type, file_size,
+	output_width, output_height, duration, created_at, updated_at`
+
+func scanMediaRendition(row rowScanner, mr *models.MediaRendition) error {
+	return row.Scan(&mr.ID, &mr.MediaID, &mr.WorkspaceID, &mr.Preset, &mr.Platform, &mr.Placement,
+		&mr.Width, &mr.Height, &mr.Fit, &mr.Format, &mr.Quality, &mr.Status, &mr.Error, &mr.Attempts,
+		&mr.FileURL, &mr.StorageKey, &mr.MimeType, &mr.FileSize, &mr.OutputWidth, &mr.OutputHeight,
+		&mr.Duration, &mr.CreatedAt, &mr.UpdatedAt)
+}
+
+// ProcessMediaRenditions generates pending renditions. Rows are claimed with SKIP LOCKED
+// so several instances can run the job side by side.
+func ProcessMediaRenditions(db *sql.DB) {
+	rows, err := db.Query(`
+		UPDATE media_renditions
+		SET status = 'processing', attempts = attempts + 1, updated_at = now()
+		WHERE id IN (
+			SELECT id FROM media_renditions
+			WHERE (status = 'pending' OR (status = 'processing' AND updated_at < $1))
+			  AND attempts < $2
+			ORDER BY created_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+mediaRenditionColumns,
+		time.Now().Add(-renditionStaleAfter), maxRenditionAttempts, renditionBatchSize)
+	if err != nil {
+		log.Printf("Failed to claim media renditions: %v", err)
+		return
+	}
+	var claimed []models.MediaRendition
+	for rows.Next() {
+		var mr models.MediaRendition
+		if err := scanMediaRendition(rows, &mr); err != nil {
+			log.Printf("Failed to scan media rendition: %v", err)
+			continue
+		}
+		claimed = append(claimed, mr)
+	}
+	rows.Close()
+
+	for i := range claimed {
+		mr := &claimed[i]
+		if err := renderMediaRendition(db, mr); err != nil {
+			log.Printf("Rendition %s of media %s failed: %v", mr.Preset, mr.MediaID, err)
+			// Back to pending for another attempt until they run out
+			var status string
+			if dbErr := db.QueryRow(`
+				UPDATE media_renditions
+				SET status = CASE WHEN attempts < $1 THEN 'pending' ELSE 'failed' END,
+				    error = $2, updated_at = now()
+				WHERE id = $3
+				RETURNING status
+			`, maxRenditionAttempts, err.Error(), mr.ID).Scan(&status); dbErr != nil {
+				log.Printf("Failed to record rendition failure %s: %v", mr.ID, dbErr)
+			}
+			if status == "failed" {
+				broadcastRendition(mr.WorkspaceID, "media_rendition_failed", mr, err.Error())
+			}
+			continue
+		}
+		broadcastRendition(mr.WorkspaceID, "media_rendition_ready", mr, "")
+	}
+}
+
+// renderMediaRendition produces the rendition file, stores it and marks the row ready
+func renderMediaRendition(db *sql.DB, mr *models.MediaRendition) error {
+	ctx, cancel := context.WithTimeout(context.Background(), renditionTimeout)
+	defer cancel()
+
+	var fileType, sourceKey string
+	err := db.QueryRow(`
+		SELECT file_type, COALESCE(cloudinary_public_id, '') FROM media WHERE id = $1 AND deleted_at IS NULL
+	`, mr.MediaID).Scan(&fileType, &sourceKey)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("media no longer available")
+	} else if err != nil {
+		return err
+	}
+	if sourceKey == "" {
+		return fmt.Errorf("media has no stored file")
+	}
+
+	src, _, err := lib.Blobs.Get(ctx, sourceKey)
+	if err != nil {
+		return fmt.Errorf("read original: %v", err)
+	}
+	defer src.Close()
+
+	quality := 0
+	if mr.Quality != nil {
+		quality = *mr.Quality
+	}
+
+	var (
+		body          io.Reader
+		size          int64
+		width, height int
+		duration      *float64
+		contentType   string
+	)
+	switch fileType {
+	case "image":
+		data, w, h, err := lib.RenderImage(src, mr.Width, mr.Height, mr.Fit, mr.Format, quality)
+		if err != nil {
+			return err
+		}
+		body, size, width, height = bytes.NewReader(data), int64(len(data)), w, h
+		contentType = "image/" + mr.Format
+	case "video":
+		out, meta, err := transcodeRendition(ctx, src, mr)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(out.Name())
+		defer out.Close()
+		info, err := out.Stat()
+		if err != nil {
+			return err
+		}
+		body, size, contentType = out, info.Size(), "video/mp4"
+		if meta != nil {
+			width, height = meta.Width, meta.Height
+			duration = nullIfZeroFloat(meta.Duration)
+		}
+	default:
+		return fmt.Errorf("unsupported media type %q", fileType)
+	}
+
+	key := fmt.Sprintf("socialsync_uploads/workspaces/%s/renditions/%s/%s.%s",
+		mr.WorkspaceID, mr.MediaID, mr.Preset, renditionExtension(mr.Format))
+	blob, err := lib.Blobs.Put(ctx, key, body, size, contentType)
+	if err != nil {
+		return fmt.Errorf("store rendition: %v", err)
+	}
+
+	_, err = db.Exec(`
+		UPDATE media_renditions
+		SET status = 'ready', error = NULL, file_url = $1, storage_key = $2, mime_type = $3, file_size = $4,
+		    output_width = $5, output_height = $6, duration = $7, updated_at = now()
+		WHERE id = $8
+	`, blob.URL, key, contentType, size, nullIfZero(width), nullIfZero(height), duration, mr.ID)
+	if err != nil {
+		return err
+	}
+	mr.Status, mr.FileURL, mr.StorageKey = "ready", &blob.URL, &key
+	return nil
+}
+
+// transcodeRendition copies the original to a temp file, since ffmpeg needs to seek, and
+// transcodes it. The caller removes the returned file.
+func transcodeRendition(ctx context.Context, src io.Reader, mr *models.MediaRendition) (*os.File, *lib.MediaMetadata, error) {
+	in, err := os.CreateTemp("", "rendition-src-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.Remove(in.Name())
+	defer in.Close()
+	if _, err := io.Copy(in, src); err != nil {
+		return nil, nil, fmt.Errorf("read original: %v", err)
+	}
+
+	outPath := in.Name() + ".mp4"
+	if err := lib.TranscodeVideo(ctx, in.Name(), outPath, mr.Width, mr.Height, mr.Fit); err != nil {
+		os.Remove(outPath)
+		return nil, nil, err
+	}
+	out, err := os.Open(outPath)
+	if err != nil {
+		os.Remove(outPath)
+		return nil, nil, err
+	}
+
+	meta, err := lib.ProbeVideo(ctx, outPath)
+	if err != nil {
+		log.Printf("Failed to probe rendition %s of media %s: %v", mr.Preset, mr.MediaID, err)
+	}
+	return out, meta, nil
+}
+
+func renditionExtension(format string) string {
+	if format == "jpeg" {
+		return "jpg"
+	}
+	return format
+}
+
+func broadcastRendition(workspaceID, event string, mr *models.MediaRendition, errMsg string) {
+	payload := map[string]interface{}{
+		"type":    event,
+		"mediaId": mr.MediaID,
+		"preset":  mr.Preset,
+	}
+	if mr.FileURL != nil {
+		payload["fileUrl"] = *mr.FileURL
+	}
+	if errMsg != "" {
+		payload["error"] = errMsg
+	}
+	msg, _ := json.Marshal(payload)
+	hub.broadcast(workspaceID, websocket.TextMessage, msg)
+}
+
+// deleteRenditionFiles removes the stored rendition files of a media item; the rows go
+// with the media row
+func deleteRenditionFiles(ctx context.Context, mediaID string) error {
+	rows, err := lib.DB.Query(`
+		SELECT storage_key FROM media_renditions WHERE media_id = $1 AND storage_key IS NOT NULL
+	`, mediaID)
+	if err != nil {
+		return err
+	}
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return err
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+
+	for _, key := range keys {
+		if err := lib.Blobs.Delete(ctx, key); err != nil && err != lib.ErrBlobNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyRendition swaps a library file for its best ready rendition for the platform
+// placement, keeping the original when there is none. When several presets cover the
+// placement (Instagram feed has portrait and square) the one closest to the original's
+// aspect ratio wins, so as little as possible is cropped.
+func applyRendition(media *models.Media, platform, placement string) {
+	picked := pickRenditions([]*models.Media{media}, platform, placement)
+	if mr, ok := picked[media.ID]; ok {
+		media.FileURL = *mr.FileURL
+		if mr.MimeType != nil {
+			media.MimeType = *mr.MimeType
+		}
+		if mr.FileSize != nil {
+			media.FileSize = *mr.FileSize
+		}
+		media.Width, media.Height = mr.OutputWidth, mr.OutputHeight
+		if mr.Duration != nil {
+			media.Duration = mr.Duration
+		}
+	}
+}
+
+// renditionURLs maps media URLs from the library to their best ready rendition for the
+// platform placement. Other URLs are returned unchanged.
+func renditionURLs(urls []string, platform, placement string) []string {
+	out := append([]string(nil), urls...)
+	if len(urls) == 0 {
+		return out
+	}
+
+	rows, err := lib.DB.Query(`
+		SELECT id, file_url, width, height FROM media WHERE file_url = ANY($1) AND deleted_at IS NULL
+	`, pq.Array(urls))
+	if err != nil {
+		log.Printf("Failed to look up media for renditions: %v", err)
+		return out
+	}
+	var media []*models.Media
+	for rows.Next() {
+		m := &models.Media{}
+		if err := rows.Scan(&m.ID, &m.FileURL, &m.Width, &m.Height); err != nil {
+			log.Printf("Failed to scan media for renditions: %v", err)
+			continue
+		}
+		media = append(media, m)
+	}
+	rows.Close()
+
+	picked := pickRenditions(media, platform, placement)
+	byURL := map[string]string{}
+	for _, m := range media {
+		if mr, ok := picked[m.ID]; ok {
+			byURL[m.FileURL] = *mr.FileURL
+		}
+	}
+	for i, u := range out {
+		if r, ok := byURL[u]; ok {
+			out[i] = r
+		}
+	}
+	return out
+}
+
+// pickRenditions returns the best ready rendition per media ID (see applyRendition)
+func pickRenditions(media []*models.Media, platform, placement string) map[string]*models.MediaRendition {
+	picked := map[string]*models.MediaRendition{}
+	if len(media) == 0 {
+		return picked
+	}
+	ids := make([]string, len(media))
+	for i, m := range media {
+		ids[i] = m.ID
+	}
+
+	rows, err := lib.DB.Query(`
+		SELECT `+mediaRenditionColumns+`
+		FROM media_renditions
+		WHERE media_id = ANY($1) AND platform = $2 AND placement = $3 AND status = 'ready'
+		ORDER BY preset
+	`, pq.Array(ids), platform, placement)
+	if err != nil {
+		log.Printf("Failed to load renditions for %s %s: %v", platform, placement, err)
+		return picked
+	}
+	defer rows.Close()
+
+	byID := map[string]*models.Media{}
+	for _, m := range media {
+		byID[m.ID] = m
+	}
+	for rows.Next() {
+		mr := &models.MediaRendition{}
+		if err := scanMediaRendition(rows, mr); err != nil {
+			log.Printf("Failed to scan rendition: %v", err)
+			continue
+		}
+		m := byID[mr.MediaID]
+		if best, ok := picked[mr.MediaID]; !ok || aspectDistance(m, mr) < aspectDistance(m, best) {
+			picked[mr.MediaID] = mr
+		}
+	}
+	return picked
+}
+
+// aspectDistance compares aspect ratios on a log scale so 1:2 and 2:1 are equally far from 1:1
+func aspectDistance(m *models.Media, mr *models.MediaRendition) float64 {
+	if m == nil || m.Width == nil || m.Height == nil || *m.Width == 0 || *m.Height == 0 {
+		return 0
+	}
+	src := float64(*m.Width) / float64(*m.Height)
+	dst := float64(mr.Width) / float64(mr.Height)
+	return math.Abs(math.Log(src / dst))
+}
@@ -0,0 +1,285 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+	"social-sync-backend/utils"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/lib/pq"
+)
+
+const defaultMediaRightsWarningDays = 7
+
+// mediaLicenseTypes are the accepted license_type values
+var mediaLicenseTypes = map[string]bool{
+	"owned":            true,
+	"licensed":         true,
+	"royalty_free":     true,
+	"creative_commons": true,
+	"editorial":        true,
+	"influencer":       true,
+}
+
+// mediaRightsWarning is how far ahead of expiry admins are warned (MEDIA_RIGHTS_WARNING_DAYS)
+func mediaRightsWarning() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("MEDIA_RIGHTS_WARNING_DAYS"))
+	if err != nil || days < 1 {
+		days = defaultMediaRightsWarningDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// MediaRightsRequest is the body of UpdateMediaRights. It replaces all of the media's
+// rights; null or empty fields clear them.
+type MediaRightsRequest struct {
+	LicenseType      *string    `json:"license_type"`
+	Credit           *string    `json:"credit"`
+	AllowedPlatforms []string   `json:"allowed_platforms"` // empty allows every platform
+	ExpiresAt        *time.Time `json:"expires_at"`
+}
+
+// MediaRightsViolation is a reason a draft can't use a media item
+type MediaRightsViolation struct {
+	MediaID   string     `json:"media_id"`
+	Name      string     `json:"name"`
+	Reason    string     `json:"reason"`             // expired or platform_not_allowed
+	Platform  string     `json:"platform,omitempty"` // platform_not_allowed
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// UpdateMediaRights sets a media item's license, credit, allowed platforms and expiry.
+// Only admins and editors can change rights, since they decide what may be published.
+func UpdateMediaRights(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	vars := mux.Vars(r)
+	workspaceID := vars["workspaceId"]
+	mediaID := vars["mediaId"]
+
+	var req MediaRightsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.LicenseType != nil && *req.LicenseType != "" && !mediaLicenseTypes[*req.LicenseType] {
+		http.Error(w, "license_type must be owned, licensed, royalty_free, creative_commons, editorial or influencer", http.StatusBadRequest)
+		return
+	}
+	credit := ""
+	if req.Credit != nil {
+		credit = strings.TrimSpace(*req.Credit)
+	}
+	platforms := []string{}
+	seen := map[string]bool{}
+	for _, p := range req.AllowedPlatforms {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" && !seen[p] {
+			seen[p] = true
+			platforms = append(platforms, p)
+		}
+	}
+
+	if !IsUserAdminOrEditor(userID, workspaceID) {
+		http.Error(w, "Only admins and editors can change media rights", http.StatusForbidden)
+		return
+	}
+
+	// A new expiry gets a new advance warning
+	res, err := lib.DB.Exec(`
+		UPDATE media SET license_type = $1, rights_credit = $2, allowed_platforms = $3, rights_expires_at = $4,
+		       rights_expiry_notified_at = CASE WHEN rights_expires_at IS DISTINCT FROM $4 THEN NULL ELSE rights_expiry_notified_at END
+		WHERE id = $5 AND workspace_id = $6 AND deleted_at IS NULL
+	`, nullIfEmpty(derefString(req.LicenseType)), nullIfEmpty(credit), pq.Array(platforms), req.ExpiresAt, mediaID, workspaceID)
+	if err != nil {
+		log.Println("Failed to update media rights:", err)
+		http.Error(w, "Failed to update media rights", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Media not found", http.StatusNotFound)
+		return
+	}
+
+	var media models.Media
+	if err := scanMedia(lib.DB.QueryRow(mediaSelect+` WHERE m.id = $1`, mediaID), &media); err != nil {
+		log.Println("Failed to load media:", err)
+		http.Error(w, "Failed to load media", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(media)
+
+	msg, _ := json.Marshal(map[string]interface{}{
+		"type":     "media_updated",
+		"action":   "rights",
+		"mediaIds": []string{mediaID},
+	})
+	hub.broadcast(workspaceID, websocket.TextMessage, msg)
+}
+
+// checkMediaRights returns why the library media among urls can't be posted to platforms
+// at the given time: rights that have expired by then, or platforms they don't allow
+func checkMediaRights(workspaceID string, urls, platforms []string, at time.Time) ([]MediaRightsViolation, error) {
+	violations := []MediaRightsViolation{}
+	if len(urls) == 0 {
+		return violations, nil
+	}
+	rows, err := lib.DB.Query(`
+		SELECT id, original_name, allowed_platforms, rights_expires_at FROM media
+		WHERE workspace_id = $1 AND file_url = ANY($2::text[]) AND deleted_at IS NULL
+		  AND (rights_expires_at IS NOT NULL OR cardinality(allowed_platforms) > 0)
+		ORDER BY original_name
+	`, workspaceID, pq.Array(urls))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, name string
+		var allowed pq.StringArray
+		var expiresAt *time.Time
+		if err := rows.Scan(&id, &name, &allowed, &expiresAt); err != nil {
+			return nil, err
+		}
+		if expiresAt != nil && !at.Before(*expiresAt) {
+			violations = append(violations, MediaRightsViolation{MediaID: id, Name: name, Reason: "expired", ExpiresAt: expiresAt})
+			continue
+		}
+		if len(allowed) == 0 {
+			continue
+		}
+		for _, platform := range platforms {
+			if !containsFold(allowed, platform) {
+				violations = append(violations, MediaRightsViolation{MediaID: id, Name: name, Reason: "platform_not_allowed", Platform: platform})
+			}
+		}
+	}
+	return violations, rows.Err()
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeMediaRightsError answers a draft request that breaks media rights
+func writeMediaRightsError(w http.ResponseWriter, action string, violations []MediaRightsViolation) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":        fmt.Sprintf("Can't %s: some media's usage rights have expired or don't allow these platforms", action),
+		"media_rights": violations,
+	})
+}
+
+// NotifyExpiringMediaRights warns workspace admins, by email and on the workspace socket,
+// about media whose rights expire within the warning period. Each expiry is announced once,
+// when an email to an admin has gone through, or right away when email isn't set up.
+func NotifyExpiringMediaRights(db *sql.DB) {
+	rows, err := db.Query(`
+		SELECT m.id, m.workspace_id, w.name, m.original_name, m.rights_expires_at
+		FROM media m
+		JOIN workspaces w ON w.id = m.workspace_id
+		WHERE m.rights_expires_at > now() AND m.rights_expires_at <= $1
+		  AND m.rights_expiry_notified_at IS NULL AND m.deleted_at IS NULL
+		ORDER BY m.workspace_id, m.rights_expires_at
+		LIMIT 500
+	`, time.Now().Add(mediaRightsWarning()))
+	if err != nil {
+		log.Printf("Failed to load media with expiring rights: %v", err)
+		return
+	}
+	type expiring struct {
+		ID        string    `json:"mediaId"`
+		Name      string    `json:"name"`
+		ExpiresAt time.Time `json:"expiresAt"`
+	}
+	byWorkspace := map[string][]expiring{}
+	names := map[string]string{}
+	for rows.Next() {
+		var e expiring
+		var workspaceID, workspaceName string
+		if err := rows.Scan(&e.ID, &workspaceID, &workspaceName, &e.Name, &e.ExpiresAt); err != nil {
+			log.Printf("Failed to scan media with expiring rights: %v", err)
+			continue
+		}
+		byWorkspace[workspaceID] = append(byWorkspace[workspaceID], e)
+		names[workspaceID] = workspaceName
+	}
+	rows.Close()
+
+	for workspaceID, items := range byWorkspace {
+		msg, _ := json.Marshal(map[string]interface{}{
+			"type":  "media_rights_expiring",
+			"media": items,
+		})
+		hub.broadcast(workspaceID, websocket.TextMessage, msg)
+
+		// Without a successful email the warning is repeated on the next run
+		if os.Getenv("SMTP_HOST") != "" {
+			lines := make([]string, len(items))
+			for i, e := range items {
+				lines[i] = fmt.Sprintf("- %s: expires %s", e.Name, e.ExpiresAt.UTC().Format("2 Jan 2006 15:04 MST"))
+			}
+			emails := workspaceAdminEmails(db, workspaceID)
+			sent := len(emails) == 0
+			for _, email := range emails {
+				if utils.SendMediaRightsExpiryEmail(email, names[workspaceID], lines) == nil {
+					sent = true
+				}
+			}
+			if !sent {
+				continue
+			}
+		}
+
+		ids := make([]string, len(items))
+		for i, e := range items {
+			ids[i] = e.ID
+		}
+		if _, err := db.Exec(`
+			UPDATE media SET rights_expiry_notified_at = now() WHERE id = ANY($1::uuid[])
+		`, pq.Array(ids)); err != nil {
+			log.Printf("Failed to mark media rights warnings sent: %v", err)
+		}
+	}
+}
+
+// workspaceAdminEmails returns the email addresses of a workspace's admins
+func workspaceAdminEmails(db *sql.DB, workspaceID string) []string {
+	rows, err := db.Query(`
+		SELECT u.email FROM workspace_members wm
+		JOIN users u ON u.id = wm.user_id
+		WHERE wm.workspace_id = $1 AND wm.role = 'Admin' AND u.email IS NOT NULL AND u.email <> ''
+	`, workspaceID)
+	if err != nil {
+		log.Printf("Failed to load admins of workspace %s: %v", workspaceID, err)
+		return nil
+	}
+	defer rows.Close()
+
+	var emails []string
+	for rows.Next() {
+		var email string
+		if rows.Scan(&email) == nil {
+			emails = append(emails, email)
+		}
+	}
+	return emails
+}
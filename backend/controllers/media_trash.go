@@ -0,0 +1,286 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultMediaTrashDays = 30
+	// After this many failed purges media stays in the trash with its purge_error
+	maxMediaPurgeAttempts = 5
+	mediaPurgeBatchSize   = 100
+)
+
+// mediaTrashRetention is how long deleted media can be restored (MEDIA_TRASH_RETENTION_DAYS)
+func mediaTrashRetention() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("MEDIA_TRASH_RETENTION_DAYS"))
+	if err != nil || days < 0 {
+		days = defaultMediaTrashDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// ListMediaTrash lists the workspace's deleted media, newest first
+func ListMediaTrash(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	workspaceID := mux.Vars(r)["workspaceId"]
+
+	if !isWorkspaceMember(userID, workspaceID) {
+		http.Error(w, "Not a member of this workspace", http.StatusForbidden)
+		return
+	}
+
+	rows, err := lib.DB.Query(`
+		SELECT m.id, m.workspace_id, m.uploaded_by, m.filename, m.original_name,
+		       m.file_url, m.file_type, m.mime_type, m.file_size, m.width, m.height,
+		       m.duration, m.video_codec, m.audio_codec, m.frame_rate, m.bit_rate,
+		       m.tags, m.cloudinary_public_id, m.created_at, m.updated_at,
+		       m.deleted_at, m.deleted_by, m.purge_attempts, m.purge_error,
+		       u.name as uploader_name
+		FROM media m
+		LEFT JOIN users u ON m.uploaded_by = u.id
+		WHERE m.workspace_id = $1 AND m.deleted_at IS NOT NULL
+		ORDER BY m.deleted_at DESC
+	`, workspaceID)
+	if err != nil {
+		log.Println("Failed to query media trash:", err)
+		http.Error(w, "Failed to fetch trash", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	retention := mediaTrashRetention()
+	mediaList := []models.Media{}
+	for rows.Next() {
+		var media models.Media
+		if err := rows.Scan(
+			&media.ID, &media.WorkspaceID, &media.UploadedBy, &media.Filename,
+			&media.OriginalName, &media.FileURL, &media.FileType, &media.MimeType,
+			&media.FileSize, &media.Width, &media.Height, &media.Duration,
+			&media.VideoCodec, &media.AudioCodec, &media.FrameRate, &media.BitRate,
+			&media.Tags, &media.CloudinaryPublicID, &media.CreatedAt, &media.UpdatedAt,
+			&media.DeletedAt, &media.DeletedBy, &media.PurgeAttempts, &media.PurgeError,
+			&media.UploaderName,
+		); err != nil {
+			log.Println("Failed to scan media row:", err)
+			http.Error(w, "Failed to fetch trash", http.StatusInternalServerError)
+			return
+		}
+		purgeAt := media.DeletedAt.Add(retention)
+		media.PurgeAt = &purgeAt
+		mediaList = append(mediaList, media)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"media":          mediaList,
+		"retention_days": int(retention.Hours() / 24),
+	})
+}
+
+// RestoreMedia takes media back out of the trash (uploader or admin/editor)
+func RestoreMedia(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	vars := mux.Vars(r)
+	workspaceID := vars["workspaceId"]
+	mediaID := vars["mediaId"]
+
+	if _, ok := loadTrashedMediaForUser(w, userID, workspaceID, mediaID); !ok {
+		return
+	}
+
+	_, err := lib.DB.Exec(`
+		UPDATE media
+		SET deleted_at = NULL, deleted_by = NULL, purge_attempts = 0, purge_error = NULL, last_purge_attempt_at = NULL
+		WHERE id = $1
+	`, mediaID)
+	if err != nil {
+		log.Println("Failed to restore media:", err)
+		http.Error(w, "Failed to restore media", http.StatusInternalServerError)
+		return
+	}
+
+	msg, _ := json.Marshal(map[string]interface{}{
+		"type":    "media_restored",
+		"mediaId": mediaID,
+	})
+	hub.broadcast(workspaceID, websocket.TextMessage, msg)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PurgeMediaNow permanently deletes trashed media without waiting for the retention period
+func PurgeMediaNow(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	vars := mux.Vars(r)
+	workspaceID := vars["workspaceId"]
+	mediaID := vars["mediaId"]
+
+	media, ok := loadTrashedMediaForUser(w, userID, workspaceID, mediaID)
+	if !ok {
+		return
+	}
+
+	if err := purgeMedia(lib.DB, media); err != nil {
+		http.Error(w, "Failed to purge media: "+err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadTrashedMediaForUser loads media in the trash that the user may restore or purge,
+// writing the error response when there is none
+func loadTrashedMediaForUser(w http.ResponseWriter, userID, workspaceID, mediaID string) (*models.Media, bool) {
+	var media models.Media
+	err := lib.DB.QueryRow(`
+		SELECT id, workspace_id, uploaded_by, file_url, COALESCE(cloudinary_public_id, ''), purge_attempts
+		FROM media
+		WHERE id = $1 AND workspace_id = $2 AND deleted_at IS NOT NULL
+	`, mediaID, workspaceID).Scan(&media.ID, &media.WorkspaceID, &media.UploadedBy, &media.FileURL,
+		&media.CloudinaryPublicID, &media.PurgeAttempts)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Media not found in trash", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Println("Failed to load trashed media:", err)
+		http.Error(w, "Failed to load media", http.StatusInternalServerError)
+		return nil, false
+	}
+	if media.UploadedBy != userID && !IsUserAdminOrEditor(userID, workspaceID) {
+		http.Error(w, "Unauthorized to change this media", http.StatusForbidden)
+		return nil, false
+	}
+	return &media, true
+}
+
+// PurgeDeletedMedia removes media that has been in the trash longer than the retention
+// period: the stored file first, then the row. Failures are recorded on the row and
+// retried on later runs, up to maxMediaPurgeAttempts. Media that scheduled drafts still
+// use is skipped without counting as a failure.
+func PurgeDeletedMedia(db *sql.DB) {
+	rows, err := db.Query(`
+		SELECT id, workspace_id, file_url, COALESCE(cloudinary_public_id, ''), purge_attempts
+		FROM media
+		WHERE deleted_at IS NOT NULL AND deleted_at <= $1 AND purge_attempts < $2
+		ORDER BY last_purge_attempt_at NULLS FIRST, deleted_at
+		LIMIT $3
+	`, time.Now().Add(-mediaTrashRetention()), maxMediaPurgeAttempts, mediaPurgeBatchSize)
+	if err != nil {
+		log.Printf("Failed to load media to purge: %v", err)
+		return
+	}
+	var due []models.Media
+	for rows.Next() {
+		var m models.Media
+		if err := rows.Scan(&m.ID, &m.WorkspaceID, &m.FileURL, &m.CloudinaryPublicID, &m.PurgeAttempts); err != nil {
+			log.Printf("Failed to scan media to purge: %v", err)
+			continue
+		}
+		due = append(due, m)
+	}
+	rows.Close()
+
+	for i := range due {
+		var inUse mediaInUseError
+		if err := purgeMedia(db, &due[i]); errors.As(err, &inUse) {
+			log.Printf("Keeping trashed media %s for now: %v", due[i].ID, err)
+		} else if err != nil {
+			log.Printf("Failed to purge media %s: %v", due[i].ID, err)
+		}
+	}
+}
+
+// mediaInUseError means scheduled drafts still use the media. It isn't a failed purge:
+// the media is purged on a later run, once those drafts are published or changed.
+type mediaInUseError struct{ drafts int }
+
+func (e mediaInUseError) Error() string {
+	return fmt.Sprintf("still used by %d scheduled draft(s)", e.drafts)
+}
+
+// purgeMedia deletes the stored object and the media row, or records why it couldn't.
+// Media still used by scheduled drafts is kept, and a mediaInUseError returned.
+func purgeMedia(db *sql.DB, media *models.Media) error {
+	var inUse mediaInUseError
+	err := func() error {
+		draftIDs, err := scheduledDraftsUsingMedia(media.WorkspaceID, media.ID, media.FileURL)
+		if err != nil {
+			return err
+		}
+		if len(draftIDs) > 0 {
+			return mediaInUseError{drafts: len(draftIDs)}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := deleteRenditionFiles(ctx, media.ID); err != nil {
+			return fmt.Errorf("rendition delete failed: %v", err)
+		}
+		if media.CloudinaryPublicID != "" {
+			if err := lib.Blobs.Delete(ctx, media.CloudinaryPublicID); err != nil && err != lib.ErrBlobNotFound {
+				return fmt.Errorf("storage delete failed: %v", err)
+			}
+		}
+		_, err = db.Exec(`DELETE FROM media WHERE id = $1`, media.ID)
+		return err
+	}()
+	if err == nil {
+		return nil
+	}
+	if errors.As(err, &inUse) {
+		// Not an attempt, but it goes to the back of the queue so it doesn't hold up the batch
+		if _, dbErr := db.Exec(`UPDATE media SET last_purge_attempt_at = now() WHERE id = $1`, media.ID); dbErr != nil {
+			log.Printf("Failed to requeue media %s for purging: %v", media.ID, dbErr)
+		}
+		return err
+	}
+
+	if _, dbErr := db.Exec(`
+		UPDATE media
+		SET purge_attempts = purge_attempts + 1, purge_error = $1, last_purge_attempt_at = now()
+		WHERE id = $2
+	`, err.Error(), media.ID); dbErr != nil {
+		log.Printf("Failed to record purge failure for media %s: %v", media.ID, dbErr)
+	}
+	return err
+}
+
+// scheduledDraftsUsingMedia returns the scheduled drafts that use the media (see
+// draftUsesMediaCondition)
+func scheduledDraftsUsingMedia(workspaceID, mediaID, fileURL string) ([]string, error) {
+	rows, err := lib.DB.Query(`
+		SELECT d.id FROM draft_posts d
+		WHERE d.status = 'scheduled' AND `+draftUsesMediaCondition,
+		workspaceID, mediaID, pq.Array([]string{mediaID, fileURL}))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
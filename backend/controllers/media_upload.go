@@ -0,0 +1,642 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/lib/pq"
+)
+
+const (
+	// mediaUploadExpiry is how long the signed upload parameters work
+	mediaUploadExpiry = 15 * time.Minute
+	// mediaUploadGrace is how long after expiry an upload can still be completed, since an
+	// upload started just before expiry may take a while; after that ExpireMediaUploads
+	// deletes the file
+	mediaUploadGrace = 24 * time.Hour
+	// mediaUploadTimeout bounds one verification: copying, downloading and probing a file
+	// of up to maxDirectUploadBytes
+	mediaUploadTimeout = 30 * time.Minute
+	// mediaUploadStaleAfter is when a verification still marked processing is assumed to
+	// have died with its instance and is picked up again
+	mediaUploadStaleAfter  = 45 * time.Minute
+	maxMediaUploadAttempts = 3
+	mediaUploadBatchSize   = 5
+	// Images are decoded in memory for hashing and renditions, so they keep the
+	// UploadMedia limit
+	maxDirectImageBytes      = 50 << 20
+	defaultDirectUploadBytes = 5 << 30
+)
+
+// maxDirectUploadBytes caps direct video uploads (MEDIA_DIRECT_UPLOAD_MAX_BYTES, default 5GiB)
+func maxDirectUploadBytes() int64 {
+	n, err := strconv.ParseInt(os.Getenv("MEDIA_DIRECT_UPLOAD_MAX_BYTES"), 10, 64)
+	if err != nil || n <= 0 {
+		return defaultDirectUploadBytes
+	}
+	return n
+}
+
+// MediaUploadCreateRequest is the body of CreateMediaUpload
+type MediaUploadCreateRequest struct {
+	Filename string   `json:"filename"`
+	MimeType string   `json:"mime_type"`
+	Size     int64    `json:"size"` // bytes; the store refuses larger files where it can
+	Tags     []string `json:"tags"`
+	FolderID *string  `json:"folder_id"`
+}
+
+// MediaUploadResponse is returned by CreateMediaUpload
+type MediaUploadResponse struct {
+	Upload models.MediaUpload `json:"upload"`
+	Target *lib.UploadTarget  `json:"target"`
+}
+
+// CreateMediaUpload starts a direct-to-storage upload. The response's target says how to
+// send the file to the blob store; once that succeeds the client calls CompleteMediaUpload
+// to add it to the media library. Large videos never pass through this server this way.
+func CreateMediaUpload(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	workspaceID := mux.Vars(r)["workspaceId"]
+
+	var req MediaUploadCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Filename = strings.TrimSpace(req.Filename)
+	if req.Filename == "" {
+		http.Error(w, "filename is required", http.StatusBadRequest)
+		return
+	}
+	fileType, ok := mediaMimeTypes[req.MimeType]
+	if !ok {
+		http.Error(w, "Unsupported file type. Supported: images (jpg,jpeg,png,gif,webp) and videos (mp4,mov,avi,mkv,wmv,flv,webm)", http.StatusBadRequest)
+		return
+	}
+	maxSize := maxDirectUploadBytes()
+	if fileType == "image" {
+		maxSize = maxDirectImageBytes
+	}
+	if req.Size <= 0 || req.Size > maxSize {
+		http.Error(w, fmt.Sprintf("size must be between 1 and %d bytes for %ss", maxSize, fileType), http.StatusBadRequest)
+		return
+	}
+	if req.Tags == nil {
+		req.Tags = []string{}
+	}
+
+	if !isWorkspaceMember(userID, workspaceID) {
+		http.Error(w, "Not a member of this workspace", http.StatusForbidden)
+		return
+	}
+	if req.FolderID != nil {
+		if ok, err := mediaFolderExists(lib.DB, workspaceID, *req.FolderID); err != nil || !ok {
+			http.Error(w, "Folder not found", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// The key is ours, not the client's, and its extension follows the validated MIME type.
+	// It's a staging key: the media itself is stored under another key on completion.
+	filename := uuid.New().String() + mediaExtensions[req.MimeType]
+	storageKey := fmt.Sprintf("socialsync_uploads/workspaces/%s/uploads/%s", workspaceID, filename)
+
+	target, err := lib.Blobs.PresignUpload(r.Context(), storageKey, req.MimeType, req.Size, mediaUploadExpiry)
+	if err != nil {
+		log.Println("Failed to sign media upload:", err)
+		http.Error(w, "Failed to start upload", http.StatusInternalServerError)
+		return
+	}
+
+	var upload models.MediaUpload
+	err = scanMediaUpload(lib.DB.QueryRow(`
+		INSERT INTO media_uploads (workspace_id, user_id, storage_key, original_name, mime_type, size, tags, folder_id, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING `+mediaUploadColumns,
+		workspaceID, userID, storageKey, req.Filename, req.MimeType, req.Size, pq.Array(req.Tags), req.FolderID, target.ExpiresAt,
+	), &upload)
+	if err != nil {
+		log.Println("Failed to save media upload:", err)
+		http.Error(w, "Failed to start upload", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(MediaUploadResponse{Upload: upload, Target: target})
+}
+
+// CompleteMediaUpload queues a file sent to the blob store after CreateMediaUpload to be
+// added to the media library, and answers 202 with the upload. ProcessMediaUploads copies
+// the file to a key the client can't write, gives the copy the same checks as UploadMedia
+// and creates the media; clients follow it with GetMediaUpload or the media_upload_*
+// socket events. An exact duplicate leaves the upload pending with duplicate_media_id set,
+// unless the body has {"allow_duplicate": true}. Completing a completed upload returns its
+// media.
+func CompleteMediaUpload(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	vars := mux.Vars(r)
+	workspaceID := vars["workspaceId"]
+	uploadID := vars["uploadId"]
+
+	var req struct {
+		AllowDuplicate bool `json:"allow_duplicate"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	upload, err := loadMediaUpload(workspaceID, uploadID, userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Failed to load media upload:", err)
+		http.Error(w, "Failed to complete upload", http.StatusInternalServerError)
+		return
+	}
+
+	switch upload.Status {
+	case "completed":
+		var media models.Media
+		if upload.MediaID == nil {
+			http.Error(w, "The uploaded media has since been deleted", http.StatusGone)
+			return
+		}
+		if err := scanMedia(lib.DB.QueryRow(mediaSelect+` WHERE m.id = $1`, *upload.MediaID), &media); err != nil {
+			http.Error(w, "The uploaded media has since been deleted", http.StatusGone)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(media)
+		return
+	case "queued", "processing":
+		writeMediaUpload(w, http.StatusAccepted, upload)
+		return
+	case "failed":
+		msg := "This upload failed"
+		if upload.Error != nil {
+			msg += ": " + *upload.Error
+		}
+		http.Error(w, msg, http.StatusGone)
+		return
+	case "expired":
+		http.Error(w, "This upload has expired or been cancelled; start a new one", http.StatusGone)
+		return
+	}
+
+	// Only a quick look here; the file is read by ProcessMediaUploads
+	blob, err := lib.Blobs.Stat(r.Context(), upload.StorageKey)
+	if errors.Is(err, lib.ErrBlobNotFound) {
+		http.Error(w, "The file hasn't been uploaded yet", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to check uploaded file %s: %v", upload.StorageKey, err)
+		http.Error(w, "Failed to check uploaded file", http.StatusBadGateway)
+		return
+	}
+	if blob.Size > upload.Size {
+		failMediaUpload(upload, "file is larger than the declared size")
+		http.Error(w, "The uploaded file is larger than the declared size", http.StatusBadRequest)
+		return
+	}
+
+	// The status check stops two completions from both queueing the upload
+	mediaKey := fmt.Sprintf("socialsync_uploads/workspaces/%s/media/%s", workspaceID, uuid.New().String()+mediaExtensions[upload.MimeType])
+	err = scanMediaUpload(lib.DB.QueryRow(`
+		UPDATE media_uploads
+		SET status = 'queued', media_key = $1, allow_duplicate = $2, duplicate_media_id = NULL, error = NULL,
+		    attempts = 0, updated_at = now()
+		WHERE id = $3 AND status = 'pending'
+		RETURNING `+mediaUploadColumns,
+		mediaKey, req.AllowDuplicate, upload.ID,
+	), upload)
+	if err == sql.ErrNoRows {
+		http.Error(w, "This upload is already being completed", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println("Failed to queue media upload:", err)
+		http.Error(w, "Failed to complete upload", http.StatusInternalServerError)
+		return
+	}
+	writeMediaUpload(w, http.StatusAccepted, upload)
+}
+
+// GetMediaUpload returns one of the user's uploads, to follow a completion
+func GetMediaUpload(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	vars := mux.Vars(r)
+
+	upload, err := loadMediaUpload(vars["workspaceId"], vars["uploadId"], userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Failed to load media upload:", err)
+		http.Error(w, "Failed to load upload", http.StatusInternalServerError)
+		return
+	}
+	writeMediaUpload(w, http.StatusOK, upload)
+}
+
+func writeMediaUpload(w http.ResponseWriter, status int, upload *models.MediaUpload) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(upload)
+}
+
+// CancelMediaUpload abandons an upload that hasn't been completed and deletes its file
+func CancelMediaUpload(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	vars := mux.Vars(r)
+
+	upload, err := loadMediaUpload(vars["workspaceId"], vars["uploadId"], userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Failed to load media upload:", err)
+		http.Error(w, "Failed to cancel upload", http.StatusInternalServerError)
+		return
+	}
+
+	// Only an upload that isn't being completed can be cancelled. The row is kept, as
+	// expired, so ExpireMediaUploads deletes anything uploaded to the key again before the
+	// signed parameters stop working.
+	res, err := lib.DB.Exec(`
+		UPDATE media_uploads SET status = 'expired', updated_at = now()
+		WHERE id = $1 AND status IN ('pending', 'failed', 'expired')
+	`, upload.ID)
+	if err != nil {
+		log.Println("Failed to cancel media upload:", err)
+		http.Error(w, "Failed to cancel upload", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "This upload is being or has been completed; delete the media instead", http.StatusConflict)
+		return
+	}
+	if err := lib.Blobs.Delete(r.Context(), upload.StorageKey); err != nil && !errors.Is(err, lib.ErrBlobNotFound) {
+		log.Printf("Failed to delete cancelled upload %s: %v", upload.StorageKey, err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ProcessMediaUploads verifies queued upload completions. Rows are claimed with SKIP LOCKED
+// so several instances can run the job side by side.
+func ProcessMediaUploads(db *sql.DB) {
+	rows, err := db.Query(`
+		UPDATE media_uploads
+		SET status = 'processing', attempts = attempts + 1, updated_at = now()
+		WHERE id IN (
+			SELECT id FROM media_uploads
+			WHERE status = 'queued' OR (status = 'processing' AND updated_at < $1)
+			ORDER BY created_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+mediaUploadColumns,
+		time.Now().Add(-mediaUploadStaleAfter), mediaUploadBatchSize)
+	if err != nil {
+		log.Printf("Failed to claim media uploads: %v", err)
+		return
+	}
+	var claimed []models.MediaUpload
+	for rows.Next() {
+		var u models.MediaUpload
+		if err := scanMediaUpload(rows, &u); err != nil {
+			log.Printf("Failed to scan media upload: %v", err)
+			continue
+		}
+		claimed = append(claimed, u)
+	}
+	rows.Close()
+
+	for i := range claimed {
+		u := &claimed[i]
+		ctx, cancel := context.WithTimeout(context.Background(), mediaUploadTimeout)
+		media, duplicate, err := verifyMediaUpload(ctx, u)
+		cancel()
+
+		var rejection mediaUploadRejection
+		switch {
+		case errors.As(err, &rejection):
+			failMediaUpload(u, string(rejection))
+			broadcastMediaUpload(u.WorkspaceID, "media_upload_failed", u.ID, map[string]interface{}{"error": string(rejection)})
+		case err != nil && u.Attempts >= maxMediaUploadAttempts:
+			log.Printf("Giving up on media upload %s: %v", u.ID, err)
+			failMediaUpload(u, "the uploaded file couldn't be processed")
+			broadcastMediaUpload(u.WorkspaceID, "media_upload_failed", u.ID, map[string]interface{}{"error": "the uploaded file couldn't be processed"})
+		case err != nil:
+			log.Printf("Failed to verify media upload %s, will retry: %v", u.ID, err)
+			if _, err := db.Exec(`
+				UPDATE media_uploads SET status = 'queued', updated_at = now() WHERE id = $1 AND status = 'processing'
+			`, u.ID); err != nil {
+				log.Printf("Failed to requeue media upload %s: %v", u.ID, err)
+			}
+		case duplicate != nil:
+			// Back to pending: the client completes again with allow_duplicate or cancels
+			if _, err := db.Exec(`
+				UPDATE media_uploads SET status = 'pending', duplicate_media_id = $1, media_key = NULL, updated_at = now()
+				WHERE id = $2
+			`, duplicate.ID, u.ID); err != nil {
+				log.Printf("Failed to record duplicate of media upload %s: %v", u.ID, err)
+				continue
+			}
+			broadcastMediaUpload(u.WorkspaceID, "media_upload_duplicate", u.ID, map[string]interface{}{"duplicate": duplicate})
+		default:
+			if _, err := db.Exec(`
+				UPDATE media_uploads SET status = 'completed', media_id = $1, error = NULL, updated_at = now() WHERE id = $2
+			`, media.ID, u.ID); err != nil {
+				// Retried later; verifyMediaUpload finds the media it already created
+				log.Printf("Failed to mark media upload %s completed: %v", u.ID, err)
+				continue
+			}
+			broadcastMediaUpload(u.WorkspaceID, "media_upload_completed", u.ID, map[string]interface{}{"mediaId": media.ID})
+		}
+	}
+}
+
+// mediaUploadRejection is a problem with the uploaded file itself. It's shown to the
+// client, and the upload fails without a retry.
+type mediaUploadRejection string
+
+func (r mediaUploadRejection) Error() string { return string(r) }
+
+// verifyMediaUpload copies an upload's file to its media key and, if the copy passes the
+// UploadMedia checks, adds it to the library. Only the copy is read: the client can still
+// write the upload key until its signed parameters expire. It returns the library's copy
+// instead when the file is a duplicate the client hasn't allowed.
+func verifyMediaUpload(ctx context.Context, u *models.MediaUpload) (media, duplicate *models.Media, err error) {
+	if u.MediaKey == nil {
+		return nil, nil, fmt.Errorf("upload has no media key")
+	}
+	mediaKey := *u.MediaKey
+
+	// A run interrupted after creating the media has nothing left to do
+	var existing models.Media
+	err = scanMedia(lib.DB.QueryRow(mediaSelect+` WHERE m.workspace_id = $1 AND m.cloudinary_public_id = $2`,
+		u.WorkspaceID, mediaKey), &existing)
+	if err == nil {
+		return &existing, nil, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, nil, err
+	}
+
+	blob, err := lib.Blobs.Copy(ctx, u.StorageKey, mediaKey)
+	if errors.Is(err, lib.ErrBlobNotFound) {
+		return nil, nil, mediaUploadRejection("the uploaded file is gone")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("copy uploaded file: %v", err)
+	}
+	if blob.Size > u.Size {
+		return nil, nil, mediaUploadRejection("file is larger than the declared size")
+	}
+
+	// Copy the file locally once; sniffing, hashing and probing all read it
+	tmp, size, err := downloadBlob(ctx, mediaKey, u.Size)
+	if err != nil {
+		return nil, nil, fmt.Errorf("download uploaded file: %v", err)
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+	if size > u.Size {
+		return nil, nil, mediaUploadRejection("file is larger than the declared size")
+	}
+
+	mimeType, fileType, err := sniffMediaFile(tmp, size)
+	if err != nil {
+		return nil, nil, mediaUploadRejection(err.Error())
+	}
+	contentHash, err := lib.ContentHash(tmp)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !u.AllowDuplicate {
+		existing, err := findDuplicateMedia(u.WorkspaceID, contentHash)
+		if err != nil {
+			log.Println("Failed to check for duplicate media:", err)
+		} else if existing != nil {
+			if err := lib.Blobs.Delete(ctx, mediaKey); err != nil && !errors.Is(err, lib.ErrBlobNotFound) {
+				log.Printf("Failed to delete duplicate upload copy %s: %v", mediaKey, err)
+			}
+			return nil, existing, nil
+		}
+	}
+
+	meta := probeUploadedMedia(ctx, tmp, fileType, blob)
+	var phash *int64
+	if fileType == "image" {
+		phash = perceptualHashOf(tmp)
+	}
+
+	media, err = createMedia(newMediaFile{
+		WorkspaceID:  u.WorkspaceID,
+		UploadedBy:   u.UserID,
+		Filename:     path.Base(mediaKey),
+		OriginalName: u.OriginalName,
+		StorageKey:   mediaKey,
+		URL:          blob.URL,
+		FileType:     fileType,
+		MimeType:     mimeType,
+		FileSize:     size,
+		Meta:         meta,
+		Tags:         u.Tags,
+		FolderID:     u.FolderID,
+		ContentHash:  contentHash,
+		PHash:        phash,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("save media record: %v", err)
+	}
+	return media, nil, nil
+}
+
+func broadcastMediaUpload(workspaceID, event, uploadID string, fields map[string]interface{}) {
+	fields["type"] = event
+	fields["uploadId"] = uploadID
+	msg, _ := json.Marshal(fields)
+	hub.broadcast(workspaceID, websocket.TextMessage, msg)
+}
+
+// ExpireMediaUploads deletes upload files once nothing needs them: files of uploads never
+// completed, after a grace period so a slow upload can still be completed, and what's
+// left at the upload key of completed, failed and cancelled uploads once their signed
+// parameters have stopped working, so nothing uploaded there afterwards is kept.
+func ExpireMediaUploads(db *sql.DB) {
+	rows, err := db.Query(`
+		SELECT id, storage_key, status FROM media_uploads
+		WHERE staging_deleted_at IS NULL AND (
+			(status = 'pending' AND expires_at < $1) OR
+			(status IN ('completed', 'failed', 'expired') AND expires_at < now())
+		)
+		LIMIT 100
+	`, time.Now().Add(-mediaUploadGrace))
+	if err != nil {
+		log.Printf("Failed to load expired media uploads: %v", err)
+		return
+	}
+	type expired struct{ id, key, status string }
+	var batch []expired
+	for rows.Next() {
+		var e expired
+		if err := rows.Scan(&e.id, &e.key, &e.status); err != nil {
+			log.Printf("Failed to scan expired media upload: %v", err)
+			continue
+		}
+		batch = append(batch, e)
+	}
+	rows.Close()
+
+	for _, e := range batch {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		err := lib.Blobs.Delete(ctx, e.key)
+		cancel()
+		if err != nil && !errors.Is(err, lib.ErrBlobNotFound) {
+			log.Printf("Failed to delete expired upload %s: %v", e.key, err)
+			continue
+		}
+		// The status check skips an upload completed meanwhile
+		if _, err := db.Exec(`
+			UPDATE media_uploads
+			SET staging_deleted_at = now(), status = CASE WHEN status = 'pending' THEN 'expired' ELSE status END,
+			    updated_at = now()
+			WHERE id = $1 AND status = $2
+		`, e.id, e.status); err != nil {
+			log.Printf("Failed to expire media upload %s: %v", e.id, err)
+		}
+	}
+}
+
+const mediaUploadColumns = `id, workspace_id, user_id, storage_key, media_key, original_name, mime_type, size, tags,
+	folder_id, status, duplicate_media_id, allow_duplicate, attempts, media_id, error, expires_at, created_at, updated_at`
+
+func scanMediaUpload(row rowScanner, u *models.MediaUpload) error {
+	return row.Scan(&u.ID, &u.WorkspaceID, &u.UserID, &u.StorageKey, &u.MediaKey, &u.OriginalName, &u.MimeType, &u.Size,
+		&u.Tags, &u.FolderID, &u.Status, &u.DuplicateMediaID, &u.AllowDuplicate, &u.Attempts, &u.MediaID, &u.Error,
+		&u.ExpiresAt, &u.CreatedAt, &u.UpdatedAt)
+}
+
+// loadMediaUpload returns one of the user's uploads in the workspace
+func loadMediaUpload(workspaceID, uploadID, userID string) (*models.MediaUpload, error) {
+	if _, err := uuid.Parse(uploadID); err != nil {
+		return nil, sql.ErrNoRows
+	}
+	var upload models.MediaUpload
+	err := scanMediaUpload(lib.DB.QueryRow(`
+		SELECT `+mediaUploadColumns+` FROM media_uploads
+		WHERE id = $1 AND workspace_id = $2 AND user_id = $3
+	`, uploadID, workspaceID, userID), &upload)
+	if err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// failMediaUpload rejects an uploaded file for good and deletes the server's copy of it.
+// The upload key itself is left to ExpireMediaUploads.
+func failMediaUpload(upload *models.MediaUpload, reason string) {
+	if upload.MediaKey != nil {
+		if err := lib.Blobs.Delete(context.Background(), *upload.MediaKey); err != nil && !errors.Is(err, lib.ErrBlobNotFound) {
+			log.Printf("Failed to delete rejected upload %s: %v", *upload.MediaKey, err)
+		}
+	}
+	if _, err := lib.DB.Exec(`
+		UPDATE media_uploads SET status = 'failed', error = $1, updated_at = now() WHERE id = $2
+	`, reason, upload.ID); err != nil {
+		log.Printf("Failed to mark media upload %s failed: %v", upload.ID, err)
+	}
+}
+
+// plainExt returns the extension of a client-supplied filename if it's short and
+// alphanumeric, and "" otherwise
+func plainExt(name string) string {
+	ext := filepath.Ext(name)
+	if len(ext) < 2 || len(ext) > 10 {
+		return ""
+	}
+	for _, c := range ext[1:] {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9') {
+			return ""
+		}
+	}
+	return ext
+}
+
+// sniffMediaFile checks a downloaded file's content is a media type we accept, within the
+// image size limit, and leaves it rewound. Errors are meant for the client.
+func sniffMediaFile(f *os.File, size int64) (mimeType, fileType string, err error) {
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	mimeType = lib.SniffContentType(head[:n])
+	fileType, ok := mediaMimeTypes[mimeType]
+	if !ok {
+		return "", "", fmt.Errorf("Unsupported file type %s. Supported: images (jpg,jpeg,png,gif,webp) and videos (mp4,mov,avi,mkv,wmv,flv,webm)", mimeType)
+	}
+	if fileType == "image" && size > maxDirectImageBytes {
+		return "", "", fmt.Errorf("Images can be at most %d bytes", maxDirectImageBytes)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", "", err
+	}
+	return mimeType, fileType, nil
+}
+
+// downloadBlob copies a stored file to a temp file (see downloadToTemp)
+func downloadBlob(ctx context.Context, key string, limit int64) (*os.File, int64, error) {
+	body, _, err := lib.Blobs.Get(ctx, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer body.Close()
+	return downloadToTemp(body, limit)
+}
+
+// downloadToTemp copies body to a temp file, reading at most limit+1 bytes so an
+// oversized file shows as size > limit. The caller closes and removes the file.
+func downloadToTemp(body io.Reader, limit int64) (*os.File, int64, error) {
+	tmp, err := os.CreateTemp("", "media-download-*")
+	if err != nil {
+		return nil, 0, err
+	}
+	size, err := io.Copy(tmp, io.LimitReader(body, limit+1))
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, 0, err
+	}
+	return tmp, size, nil
+}
@@ -0,0 +1,27 @@
+package controllers
+
+import "testing"
+
+func TestPlainExt(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"photo.jpg", ".jpg"},
+		{"clip.MP4", ".MP4"},
+		{"archive.tar.gz", ".gz"},
+		{"noext", ""},
+		{"trailingdot.", ""},
+		{"page.html<script>", ""},
+		{"weird.j-pg", ""},
+		{"long.abcdefghijk", ""},
+		{"ten.abcdefghi", ".abcdefghi"},
+		{"unicode.jpé", ""},
+		{".hidden", ".hidden"},
+	}
+	for _, tt := range tests {
+		if got := plainExt(tt.name); got != tt.want {
+			t.Errorf("plainExt(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// MediaUsageSummary says which drafts use a media item. Deleting media used by unpublished
+// drafts breaks them; published posts already have their own copy on the platform.
+type MediaUsageSummary struct {
+	ScheduledDrafts []string `json:"scheduled_drafts"`
+	Drafts          []string `json:"drafts"`           // unpublished, unscheduled drafts
+	PublishedDrafts []string `json:"published_drafts"` // drafts that have been published
+}
+
+// InUse reports whether removing the media would break a draft that hasn't gone out yet
+func (s *MediaUsageSummary) InUse() bool {
+	return len(s.ScheduledDrafts) > 0 || len(s.Drafts) > 0
+}
+
+// Warning describes the usage for people about to change or delete the media, or "" when unused
+func (s *MediaUsageSummary) Warning() string {
+	var parts []string
+	if n := len(s.ScheduledDrafts); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d scheduled draft(s)", n))
+	}
+	if n := len(s.Drafts); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d unpublished draft(s)", n))
+	}
+	if n := len(s.PublishedDrafts); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d published post(s)", n))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "This media is used by " + strings.Join(parts, ", ")
+}
+
+// mediaUsageDraft is a draft listed by GetMediaUsage
+type mediaUsageDraft struct {
+	ID            string     `json:"id"`
+	Content       string     `json:"content"`
+	Status        string     `json:"status"`
+	Platforms     []string   `json:"platforms"`
+	ScheduledTime *time.Time `json:"scheduled_time"`
+	PublishedTime *time.Time `json:"published_time"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// mediaUsagePost is a live or removed platform post listed by GetMediaUsage
+type mediaUsagePost struct {
+	DraftID     string    `json:"draft_id"`
+	Platform    string    `json:"platform"`
+	RemoteID    string    `json:"remote_id"`
+	RemoteURL   *string   `json:"remote_url"`
+	Status      string    `json:"status"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// GetMediaUsage lists every draft and published post that uses a media item
+func GetMediaUsage(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	vars := mux.Vars(r)
+	workspaceID := vars["workspaceId"]
+	mediaID := vars["mediaId"]
+
+	if !isWorkspaceMember(userID, workspaceID) {
+		http.Error(w, "Not a member of this workspace", http.StatusForbidden)
+		return
+	}
+
+	var fileURL string
+	err := lib.DB.QueryRow(`SELECT file_url FROM media WHERE id = $1 AND workspace_id = $2`, mediaID, workspaceID).
+		Scan(&fileURL)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Media not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Failed to load media:", err)
+		http.Error(w, "Failed to load media usage", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := lib.DB.Query(`
+		SELECT d.id, COALESCE(d.content, ''), d.status, d.platforms, d.scheduled_time, d.published_time, d.updated_at
+		FROM draft_posts d
+		WHERE `+draftUsesMediaCondition+`
+		ORDER BY d.updated_at DESC
+	`, workspaceID, mediaID, pq.Array([]string{fileURL}))
+	if err != nil {
+		log.Println("Failed to query media usage:", err)
+		http.Error(w, "Failed to load media usage", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	drafts := []mediaUsageDraft{}
+	for rows.Next() {
+		var d mediaUsageDraft
+		var platforms pqStringArray
+		if err := rows.Scan(&d.ID, &d.Content, &d.Status, &platforms, &d.ScheduledTime, &d.PublishedTime, &d.UpdatedAt); err != nil {
+			log.Println("Failed to scan media usage:", err)
+			http.Error(w, "Failed to load media usage", http.StatusInternalServerError)
+			return
+		}
+		d.Platforms = []string(platforms)
+		drafts = append(drafts, d)
+	}
+
+	postRows, err := lib.DB.Query(`
+		SELECT p.draft_id, p.platform, p.remote_id, p.remote_url, p.status, p.published_at
+		FROM published_posts p
+		JOIN draft_posts d ON d.id = p.draft_id
+		WHERE `+draftUsesMediaCondition+`
+		ORDER BY p.published_at DESC
+	`, workspaceID, mediaID, pq.Array([]string{fileURL}))
+	if err != nil {
+		log.Println("Failed to query published media usage:", err)
+		http.Error(w, "Failed to load media usage", http.StatusInternalServerError)
+		return
+	}
+	defer postRows.Close()
+
+	posts := []mediaUsagePost{}
+	for postRows.Next() {
+		var p mediaUsagePost
+		if err := postRows.Scan(&p.DraftID, &p.Platform, &p.RemoteID, &p.RemoteURL, &p.Status, &p.PublishedAt); err != nil {
+			log.Println("Failed to scan published media usage:", err)
+			http.Error(w, "Failed to load media usage", http.StatusInternalServerError)
+			return
+		}
+		posts = append(posts, p)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"drafts":          drafts,
+		"published_posts": posts,
+	})
+}
+
+// draftUsesMediaCondition matches drafts d in workspace $1 that use media $2, either
+// linked in media_usages or, for drafts saved before it existed, by URL ($3, a text[])
+const draftUsesMediaCondition = `d.workspace_id = $1 AND (
+	EXISTS (SELECT 1 FROM media_usages u WHERE u.draft_id = d.id AND u.media_id = $2)
+	OR d.media ?| $3
+)`
+
+// loadMediaUsageSummary groups the drafts using a media item by status
+func loadMediaUsageSummary(workspaceID, mediaID, fileURL string) (*MediaUsageSummary, error) {
+	rows, err := lib.DB.Query(`
+		SELECT d.id, d.status FROM draft_posts d WHERE `+draftUsesMediaCondition,
+		workspaceID, mediaID, pq.Array([]string{fileURL}))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summary := &MediaUsageSummary{ScheduledDrafts: []string{}, Drafts: []string{}, PublishedDrafts: []string{}}
+	for rows.Next() {
+		var id, status string
+		if err := rows.Scan(&id, &status); err != nil {
+			return nil, err
+		}
+		switch status {
+		case "scheduled":
+			summary.ScheduledDrafts = append(summary.ScheduledDrafts, id)
+		case "published":
+			summary.PublishedDrafts = append(summary.PublishedDrafts, id)
+		default:
+			summary.Drafts = append(summary.Drafts, id)
+		}
+	}
+	return summary, rows.Err()
+}
+
+// resolveDraftMedia turns media library IDs into the URLs stored in draft_posts.media,
+// followed by any plain URLs not already included. IDs must be live media in the workspace.
+func resolveDraftMedia(workspaceID string, mediaIDs, urls []string) ([]string, error) {
+	out := []string{}
+	seen := map[string]bool{}
+	if len(mediaIDs) > 0 {
+		normalized := make([]string, len(mediaIDs))
+		for i, id := range mediaIDs {
+			parsed, err := uuid.Parse(id)
+			if err != nil {
+				return nil, fmt.Errorf("invalid media ID %s", id)
+			}
+			normalized[i] = parsed.String()
+		}
+		mediaIDs = normalized
+		rows, err := lib.DB.Query(`
+			SELECT id, file_url FROM media
+			WHERE workspace_id = $1 AND id = ANY($2::uuid[]) AND deleted_at IS NULL
+		`, workspaceID, pq.Array(mediaIDs))
+		if err != nil {
+			return nil, err
+		}
+		byID := map[string]string{}
+		for rows.Next() {
+			var id, fileURL string
+			if err := rows.Scan(&id, &fileURL); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			byID[id] = fileURL
+		}
+		rows.Close()
+
+		for _, id := range mediaIDs {
+			fileURL, ok := byID[id]
+			if !ok {
+				return nil, fmt.Errorf("media %s not found", id)
+			}
+			if !seen[fileURL] {
+				seen[fileURL] = true
+				out = append(out, fileURL)
+			}
+		}
+	}
+	for _, u := range urls {
+		if !seen[u] {
+			seen[u] = true
+			out = append(out, u)
+		}
+	}
+	return out, nil
+}
+
+// syncDraftMediaUsages replaces a draft's media_usages with the library items among its
+// media URLs and returns their IDs in draft order
+func syncDraftMediaUsages(workspaceID, draftID string, urls []string) ([]string, error) {
+	tx, err := lib.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM media_usages WHERE draft_id = $1`, draftID); err != nil {
+		return nil, err
+	}
+
+	if len(urls) > 0 {
+		_, err := tx.Exec(`
+			INSERT INTO media_usages (draft_id, media_id, workspace_id, position)
+			SELECT $1, m.id, m.workspace_id, MIN(e.n) - 1
+			FROM unnest($3::text[]) WITH ORDINALITY AS e(url, n)
+			JOIN media m ON m.workspace_id = $2 AND m.file_url = e.url
+			GROUP BY m.id, m.workspace_id
+		`, draftID, workspaceID, pq.Array(urls))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return draftMediaIDs(draftID)
+}
+
+// draftMediaIDs returns the library media a draft uses, in draft order
+func draftMediaIDs(draftID string) ([]string, error) {
+	var ids pqStringArray
+	err := lib.DB.QueryRow(`
+		SELECT ARRAY(SELECT media_id::text FROM media_usages WHERE draft_id = $1 ORDER BY position)
+	`, draftID).Scan(&ids)
+	return []string(ids), err
+}
+
+// trashedDraftMedia returns the names of media a draft uses that are in the trash
+func trashedDraftMedia(draftID string) ([]string, error) {
+	rows, err := lib.DB.Query(`
+		SELECT m.original_name FROM media_usages u
+		JOIN media m ON m.id = u.media_id
+		WHERE u.draft_id = $1 AND m.deleted_at IS NOT NULL
+		ORDER BY u.position
+	`, draftID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
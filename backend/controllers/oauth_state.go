@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"database/sql"
+	"time"
+
+	"social-sync-backend/lib"
+)
+
+// oauthStateTTL is how long a user has to finish a platform's consent screen
+const oauthStateTTL = 10 * time.Minute
+
+// newOAuthState stores a fresh state for a user starting a platform's OAuth flow. See
+// create_oauth_states_table.sql for the schema.
+func newOAuthState(platform, userID string) (string, error) {
+	// Clear out states from flows that were never finished
+	if _, err := lib.DB.Exec(`DELETE FROM oauth_states WHERE expires_at < now()`); err != nil {
+		return "", err
+	}
+	state := generateState()
+	_, err := lib.DB.Exec(`
+		INSERT INTO oauth_states (state, platform, user_id, expires_at) VALUES ($1, $2, $3, $4)
+	`, state, platform, userID, time.Now().Add(oauthStateTTL))
+	if err != nil {
+		return "", err
+	}
+	return state, nil
+}
+
+// consumeOAuthState returns the user a platform callback's state was issued to and
+// removes it, so each state works once. ok is false for unknown or expired states.
+func consumeOAuthState(platform, state string) (userID string, ok bool, err error) {
+	if state == "" {
+		return "", false, nil
+	}
+	err = lib.DB.QueryRow(`
+		DELETE FROM oauth_states
+		WHERE state = $1 AND platform = $2
+		RETURNING user_id, expires_at > now()
+	`, state, platform).Scan(&userID, &ok)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return userID, ok, nil
+}
@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"social-sync-backend/middleware"
+
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+)
+
+const (
+	pinterestAPIBase       = "https://api.pinterest.com/v5"
+	pinterestCheckInterval = 5 * time.Second
+	pinterestMaxChecks     = 60
+)
+
+func getPinterestOAuthConfig() *oauth2.Config {
+	redirectURL := os.Getenv("PINTEREST_REDIRECT_URL")
+	if redirectURL == "" {
+		log.Fatal("PINTEREST_REDIRECT_URL is empty!")
+	}
+
+	return &oauth2.Config{
+		ClientID:     os.Getenv("PINTEREST_APP_ID"),
+		ClientSecret: os.Getenv("PINTEREST_APP_SECRET"),
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"user_accounts:read", "boards:read", "pins:read", "pins:write"},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   "https://www.pinterest.com/oauth/",
+			TokenURL:  pinterestAPIBase + "/oauth/token",
+			AuthStyle: oauth2.AuthStyleInHeader,
+		},
+	}
+}
+
+// PinterestRedirectHandler initiates the OAuth flow and redirects to the Pinterest auth page
+func PinterestRedirectHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appUserIDStr, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated.", http.StatusUnauthorized)
+			return
+		}
+		if _, err := uuid.Parse(appUserIDStr); err != nil {
+			http.Error(w, "Invalid user ID format.", http.StatusInternalServerError)
+			return
+		}
+
+		state, err := newOAuthState("pinterest", appUserIDStr)
+		if err != nil {
+			log.Println("Failed to save Pinterest OAuth state:", err)
+			http.Error(w, "Failed to start Pinterest authorization", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, getPinterestOAuthConfig().AuthCodeURL(state), http.StatusTemporaryRedirect)
+	}
+}
+
+// PinterestCallbackHandler exchanges the code, saves the account and redirects to the frontend
+func PinterestCallbackHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appUserIDStr, ok, err := consumeOAuthState("pinterest", r.URL.Query().Get("state"))
+		if err != nil {
+			log.Println("Failed to check Pinterest OAuth state:", err)
+			http.Error(w, "Failed to check state parameter", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Invalid or expired state parameter", http.StatusBadRequest)
+			return
+		}
+
+		code := r.URL.Query().Get("code")
+		if code == "" {
+			http.Error(w, "Missing code parameter", http.StatusBadRequest)
+			return
+		}
+
+		token, err := getPinterestOAuthConfig().Exchange(context.Background(), code)
+		if err != nil {
+			http.Error(w, "Token exchange failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var user struct {
+			Username     string `json:"username"`
+			ProfileImage string `json:"profile_image"`
+			BusinessName string `json:"business_name"`
+		}
+		headers := map[string]string{"Authorization": "Bearer " + token.AccessToken}
+		if err := getJSON(pinterestAPIBase+"/user_account", headers, &user); err != nil {
+			http.Error(w, "Failed to fetch Pinterest profile: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		profileName := user.BusinessName
+		if profileName == "" {
+			profileName = user.Username
+		}
+		profileName = fmt.Sprintf("%s (@%s)", profileName, user.Username)
+
+		var expiresAt *time.Time
+		if !token.Expiry.IsZero() {
+			expiresAt = &token.Expiry
+		}
+
+		_, err = db.Exec(`
+			INSERT INTO social_accounts (
+				user_id, platform, social_id, access_token, access_token_expires_at,
+				refresh_token, profile_picture_url, profile_name, connected_at
+			) VALUES (
+				$1, 'pinterest', $2, $3, $4, $5, $6, $7, NOW()
+			)
+			ON CONFLICT (user_id, platform) DO UPDATE SET
+				access_token = EXCLUDED.access_token,
+				access_token_expires_at = EXCLUDED.access_token_expires_at,
+				refresh_token = EXCLUDED.refresh_token,
+				social_id = EXCLUDED.social_id,
+				profile_picture_url = EXCLUDED.profile_picture_url,
+				profile_name = EXCLUDED.profile_name,
+				connected_at = NOW()
+		`,
+			appUserIDStr,
+			user.Username,
+			token.AccessToken,
+			expiresAt,
+			token.RefreshToken,
+			nullIfEmpty(user.ProfileImage),
+			profileName,
+		)
+		if err != nil {
+			http.Error(w, "Failed to save Pinterest account: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "http://localhost:3000/home/manage-accounts?connected=pinterest", http.StatusSeeOther)
+	}
+}
+
+// GetPinterestBoardsHandler lists the boards (and their sections) pins can be saved to
+func GetPinterestBoardsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+		acc, err := oauthAccessToken(db, userID, "pinterest", getPinterestOAuthConfig())
+		if err != nil {
+			writePlatformAccountError(w, "Pinterest", err)
+			return
+		}
+
+		var boards struct {
+			Items []struct {
+				ID          string `json:"id"`
+				Name        string `json:"name"`
+				Description string `json:"description"`
+				Privacy     string `json:"privacy"`
+			} `json:"items"`
+		}
+		if err := getJSON(pinterestAPIBase+"/boards?page_size=100", pinterestHeaders(acc.AccessToken), &boards); err != nil {
+			http.Error(w, "Failed to fetch Pinterest boards: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		result := []map[string]interface{}{}
+		for _, b := range boards.Items {
+			var sections struct {
+				Items []struct {
+					ID   string `json:"id"`
+					Name string `json:"name"`
+				} `json:"items"`
+			}
+			if err := getJSON(fmt.Sprintf("%s/boards/%s/sections?page_size=100", pinterestAPIBase, b.ID),
+				pinterestHeaders(acc.AccessToken), &sections); err != nil {
+				log.Printf("Failed to fetch sections for Pinterest board %s: %v", b.ID, err)
+			}
+			result = append(result, map[string]interface{}{
+				"id":          b.ID,
+				"name":        b.Name,
+				"description": b.Description,
+				"privacy":     b.Privacy,
+				"sections":    sections.Items,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
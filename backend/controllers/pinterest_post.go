@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+)
+
+type PinterestPostRequest struct {
+	BoardID        string `json:"boardId"`
+	BoardSectionID string `json:"boardSectionId"`
+	Title          string `json:"title"`
+	Description    string `json:"description"`
+	Link           string `json:"link"` // destination URL the pin opens
+	AltText        string `json:"altText"`
+	MediaURL       string `json:"mediaUrl"`      // image or video
+	CoverImageURL  string `json:"coverImageUrl"` // required by Pinterest for video pins
+	DraftID        string `json:"draftId"`       // optional; links the pin to a draft for later edit/delete
+}
+
+// PostToPinterestHandler creates an image or video pin on a board
+func PostToPinterestHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		var req PinterestPostRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if req.BoardID == "" || req.MediaURL == "" {
+			http.Error(w, "boardId and mediaUrl are required", http.StatusBadRequest)
+			return
+		}
+		if len([]rune(req.Title)) > 100 || len([]rune(req.Description)) > 500 || len([]rune(req.AltText)) > 500 {
+			http.Error(w, "Pinterest limits titles to 100 characters and descriptions and alt text to 500", http.StatusBadRequest)
+			return
+		}
+
+		acc, err := oauthAccessToken(db, userID, "pinterest", getPinterestOAuthConfig())
+		if err != nil {
+			writePlatformAccountError(w, "Pinterest", err)
+			return
+		}
+
+		pin := map[string]interface{}{"board_id": req.BoardID}
+		setIfNotEmptyMap(pin, "board_section_id", req.BoardSectionID)
+		setIfNotEmptyMap(pin, "title", req.Title)
+		setIfNotEmptyMap(pin, "description", req.Description)
+		setIfNotEmptyMap(pin, "link", req.Link)
+		setIfNotEmptyMap(pin, "alt_text", req.AltText)
+
+		if strings.HasPrefix(detectMimeType(req.MediaURL), "video/") {
+			if req.CoverImageURL == "" {
+				http.Error(w, "coverImageUrl is required for video pins", http.StatusBadRequest)
+				return
+			}
+			mediaID, err := uploadPinterestVideo(acc.AccessToken, req.MediaURL)
+			if err != nil {
+				http.Error(w, "Pinterest video upload failed: "+err.Error(), http.StatusBadGateway)
+				return
+			}
+			pin["media_source"] = map[string]string{
+				"source_type":     "video_id",
+				"media_id":        mediaID,
+				"cover_image_url": req.CoverImageURL,
+			}
+		} else {
+			pin["media_source"] = map[string]string{"source_type": "image_url", "url": req.MediaURL}
+		}
+
+		var created struct {
+			ID string `json:"id"`
+		}
+		if err := sendPlatformJSON("POST", pinterestAPIBase+"/pins", acc.AccessToken, pin, &created); err != nil {
+			http.Error(w, "Pinterest API error: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		pinURL := "https://www.pinterest.com/pin/" + created.ID
+		recordPublishedPost(db, req.DraftID, "pinterest", userID, created.ID, pinURL)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Pin created successfully",
+			"id":      created.ID,
+			"url":     pinURL,
+		})
+	}
+}
+
+// uploadPinterestVideo registers a video upload, posts the file to the returned S3 form
+// and waits for Pinterest to finish processing it
+func uploadPinterestVideo(accessToken, videoURL string) (string, error) {
+	var registered struct {
+		MediaID          string            `json:"media_id"`
+		UploadURL        string            `json:"upload_url"`
+		UploadParameters map[string]string `json:"upload_parameters"`
+	}
+	if err := sendPlatformJSON("POST", pinterestAPIBase+"/media", accessToken, map[string]string{"media_type": "video"}, &registered); err != nil {
+		return "", err
+	}
+
+	// The video URL comes from the client, so only fetch it from a public address
+	source, err := lib.PublicHTTPClient(10 * time.Minute).Get(videoURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to download video: %v", err)
+	}
+	defer source.Body.Close()
+	if source.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download video: status %d", source.StatusCode)
+	}
+
+	// Stream the multipart body so large videos aren't held in memory
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		for k, v := range registered.UploadParameters {
+			writer.WriteField(k, v)
+		}
+		part, err := writer.CreateFormFile("file", "video.mp4")
+		if err == nil {
+			_, err = io.Copy(part, source.Body)
+		}
+		if err == nil {
+			err = writer.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	uploadReq, err := http.NewRequest("POST", registered.UploadURL, pr)
+	if err != nil {
+		return "", err
+	}
+	uploadReq.Header.Set("Content-Type", writer.FormDataContentType())
+	if err := doPlatformRequest(uploadReq); err != nil {
+		return "", err
+	}
+
+	for i := 0; i < pinterestMaxChecks; i++ {
+		var media struct {
+			Status string `json:"status"`
+		}
+		if err := getJSON(pinterestAPIBase+"/media/"+registered.MediaID, pinterestHeaders(accessToken), &media); err != nil {
+			return "", err
+		}
+		switch media.Status {
+		case "succeeded":
+			return registered.MediaID, nil
+		case "failed":
+			return "", fmt.Errorf("Pinterest could not process the video")
+		}
+		time.Sleep(pinterestCheckInterval)
+	}
+	return "", fmt.Errorf("video not processed after %d checks", pinterestMaxChecks)
+}
+
+func pinterestHeaders(accessToken string) map[string]string {
+	return map[string]string{"Authorization": "Bearer " + accessToken}
+}
+
+func setIfNotEmptyMap(m map[string]interface{}, key, value string) {
+	if value != "" {
+		m[key] = value
+	}
+}
+
+// writePlatformAccountError answers a failed account lookup or token refresh
+func writePlatformAccountError(w http.ResponseWriter, platform string, err error) {
+	if err == sql.ErrNoRows {
+		http.Error(w, platform+" account not connected", http.StatusBadRequest)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusUnauthorized)
+}
+
+// editPinterestPin replaces the pin description
+func editPinterestPin(db *sql.DB, acc *platformAccount, post *models.PublishedPost, content string) error {
+	refreshed, err := oauthAccessToken(db, acc.UserID, "pinterest", getPinterestOAuthConfig())
+	if err != nil {
+		return err
+	}
+	return sendPlatformJSON("PATCH", pinterestAPIBase+"/pins/"+url.PathEscape(post.RemoteID), refreshed.AccessToken,
+		map[string]string{"description": content}, nil)
+}
+
+func deletePinterestPin(db *sql.DB, acc *platformAccount, post *models.PublishedPost) error {
+	refreshed, err := oauthAccessToken(db, acc.UserID, "pinterest", getPinterestOAuthConfig())
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("DELETE", pinterestAPIBase+"/pins/"+url.PathEscape(post.RemoteID), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+refreshed.AccessToken)
+	return doPlatformRequest(req)
+}
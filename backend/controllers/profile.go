@@ -148,23 +148,23 @@ func ProfileImageHandler(w http.ResponseWriter, r *http.Request) {
             return
         }
 
-        file, _, err := r.FormFile("profileImage")
+        file, header, err := r.FormFile("profileImage")
         if err != nil {
             http.Error(w, "Failed to get file 'profileImage': "+err.Error(), http.StatusBadRequest)
             return
         }
         defer file.Close()
 
-        folderName := "user_profile_pictures"
-        imagePublicID := userID + "_main_profile_pic"
+        key := "user_profile_pictures/" + userID + "_main_profile_pic"
 
-        imageURL, err := lib.UploadToCloudinary(file, folderName, imagePublicID)
+        blob, err := lib.Blobs.Put(r.Context(), key, file, header.Size, header.Header.Get("Content-Type"))
         if err != nil {
-            log.Printf("Cloudinary upload error: %v", err)
+            log.Printf("Profile image upload error: %v", err)
             http.Error(w, "Failed to upload image", http.StatusInternalServerError)
             return
         }
 
+        imageURL := blob.URL
         _, err = lib.DB.Exec("UPDATE users SET profile_picture = $1 WHERE id = $2", imageURL, userID)
         if err != nil {
             log.Printf("Error saving image URL to DB: %v", err)
@@ -0,0 +1,665 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"golang.org/x/oauth2"
+)
+
+// platformAccount is a connected social account used to call a platform API on a user's behalf
+type platformAccount struct {
+	UserID       string
+	Platform     string
+	SocialID     string
+	AccessToken  string
+	RefreshToken string
+}
+
+// errNotSupported is returned when a platform has no API for an operation
+var errNotSupported = errors.New("not supported by this platform")
+
+// errThreadNotEditable refuses edits of posts that were split into a thread; the new
+// content would have to be split again and can't be matched to the existing replies
+var errThreadNotEditable = errors.New("this post was split into a thread and can't be edited")
+
+type publishedPostEditor func(db *sql.DB, acc *platformAccount, post *models.PublishedPost, content string) error
+type publishedPostDeleter func(db *sql.DB, acc *platformAccount, post *models.PublishedPost) error
+
+// Platforms missing from these maps answer "not_supported"
+var publishedPostEditors = map[string]publishedPostEditor{
+	"mastodon":        editMastodonStatus,
+	"facebook":        editFacebookPost,
+	"youtube":         editYouTubeVideo,
+	"linkedin":        editLinkedInPost,
+	"pinterest":       editPinterestPin,
+	"google_business": editGoogleBusinessPost,
+	webhookPlatform:   editWebhookPost,
+}
+
+var publishedPostDeleters = map[string]publishedPostDeleter{
+	"mastodon":        deleteMastodonStatus,
+	"facebook":        deleteFacebookPost,
+	"youtube":         deleteYouTubeVideo,
+	"twitter":         deleteTweet,
+	"linkedin":        deleteLinkedInPost,
+	"bluesky":         deleteBlueskyPost,
+	"threads":         deleteThreadsPost,
+	"pinterest":       deletePinterestPin,
+	"google_business": deleteGoogleBusinessPost,
+	webhookPlatform:   deleteWebhookPost,
+}
+
+// publishedPostResult is the outcome of an edit or delete on one platform
+type publishedPostResult struct {
+	Result string `json:"result"` // ok, failed, not_supported
+	Error  string `json:"error,omitempty"`
+}
+
+// ListPublishedPosts lists the live and deleted platform posts created from a draft
+func ListPublishedPosts(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	vars := mux.Vars(r)
+	if !isWorkspaceMember(userID, vars["workspaceId"]) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	posts, err := loadPublishedPosts(vars["workspaceId"], vars["draftId"], nil)
+	if err != nil {
+		log.Println("Failed to load published posts:", err)
+		http.Error(w, "Failed to fetch published posts", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(posts)
+}
+
+// EditPublishedPost edits the live posts of a published draft on every platform that allows it
+// (admin/editor only). Body: {"content": "...", "platforms": ["mastodon"]}; platforms is optional.
+func EditPublishedPost(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	vars := mux.Vars(r)
+	workspaceID := vars["workspaceId"]
+	draftID := vars["draftId"]
+
+	if !IsUserAdminOrEditor(userID, workspaceID) {
+		http.Error(w, "Not authorized to edit published posts", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Content   string   `json:"content"`
+		Platforms []string `json:"platforms"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		http.Error(w, "Content cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	posts, err := loadPublishedPosts(workspaceID, draftID, req.Platforms)
+	if err != nil {
+		log.Println("Failed to load published posts:", err)
+		http.Error(w, "Failed to fetch published posts", http.StatusInternalServerError)
+		return
+	}
+	if len(posts) == 0 {
+		http.Error(w, "Draft has no published posts", http.StatusNotFound)
+		return
+	}
+
+	results := map[string]publishedPostResult{}
+	edited := false
+	for i := range posts {
+		post := &posts[i]
+		if post.Status != "live" {
+			continue
+		}
+		content, err := rewriteContentLinks(workspaceID, draftID, userID, post.Platform, req.Content)
+		if err != nil {
+			log.Printf("Failed to rewrite links for draft %s on %s: %v", draftID, post.Platform, err)
+			content = req.Content
+		}
+		err = runPublishedPostAction(post, func(acc *platformAccount) error {
+			edit, ok := publishedPostEditors[post.Platform]
+			if !ok {
+				return errNotSupported
+			}
+			if len(post.ThreadRemoteIDs) > 0 {
+				return errThreadNotEditable
+			}
+			return edit(lib.DB, acc, post, content)
+		})
+		mergePublishedPostResult(results, post.Platform, recordPublishedPostAction(post, "edit", err))
+		edited = edited || err == nil
+	}
+
+	if edited {
+		if _, err := lib.DB.Exec(`UPDATE draft_posts SET content = $1, updated_at = $2 WHERE id = $3`, req.Content, time.Now(), draftID); err != nil {
+			log.Println("Failed to update draft content after edit:", err)
+		}
+	}
+
+	writePublishedPostResults(w, workspaceID, draftID, "published_post_edited", results)
+}
+
+// DeletePublishedPost takes the live posts of a published draft down from their platforms
+// (admin/editor only). Optional query param: platform.
+func DeletePublishedPost(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	vars := mux.Vars(r)
+	workspaceID := vars["workspaceId"]
+	draftID := vars["draftId"]
+
+	if !IsUserAdminOrEditor(userID, workspaceID) {
+		http.Error(w, "Not authorized to delete published posts", http.StatusForbidden)
+		return
+	}
+
+	var platforms []string
+	if platform := r.URL.Query().Get("platform"); platform != "" {
+		platforms = []string{platform}
+	}
+	posts, err := loadPublishedPosts(workspaceID, draftID, platforms)
+	if err != nil {
+		log.Println("Failed to load published posts:", err)
+		http.Error(w, "Failed to fetch published posts", http.StatusInternalServerError)
+		return
+	}
+	if len(posts) == 0 {
+		http.Error(w, "Draft has no published posts", http.StatusNotFound)
+		return
+	}
+
+	results := map[string]publishedPostResult{}
+	for i := range posts {
+		post := &posts[i]
+		if post.Status != "live" {
+			continue
+		}
+		err := runPublishedPostAction(post, func(acc *platformAccount) error {
+			del, ok := publishedPostDeleters[post.Platform]
+			if !ok {
+				return errNotSupported
+			}
+			return deletePublishedThread(del, acc, post)
+		})
+		mergePublishedPostResult(results, post.Platform, recordPublishedPostAction(post, "delete", err))
+	}
+
+	writePublishedPostResults(w, workspaceID, draftID, "published_post_deleted", results)
+}
+
+// recordPublishedPost stores a platform post created for a draft; a draft can have several
+// on one platform. The draft ID comes from the client, so it's only recorded when the
+// user belongs to the draft's workspace. Failures are only logged because the post is
+// already live by the time this runs.
+func recordPublishedPost(db *sql.DB, draftID, platform, userID, remoteID, remoteURL string) {
+	recordPublishedThread(db, draftID, platform, userID, []string{remoteID}, remoteURL)
+}
+
+// recordPublishedThread is recordPublishedPost for a post split into a thread: remoteIDs
+// holds every post of the thread, opening post first
+func recordPublishedThread(db *sql.DB, draftID, platform, userID string, remoteIDs []string, remoteURL string) {
+	if draftID == "" || len(remoteIDs) == 0 || remoteIDs[0] == "" {
+		return
+	}
+	remoteID := remoteIDs[0]
+	res, err := db.Exec(`
+		INSERT INTO published_posts (draft_id, workspace_id, platform, remote_id, thread_remote_ids, remote_url, published_by, status, published_at, updated_at)
+		SELECT d.id, d.workspace_id, $2, $3, $6, $4, $5, 'live', now(), now()
+		FROM draft_posts d
+		JOIN workspace_members wm ON wm.workspace_id = d.workspace_id AND wm.user_id = $5
+		WHERE d.id = $1
+		ON CONFLICT (draft_id, platform, remote_id) DO UPDATE SET
+			thread_remote_ids = EXCLUDED.thread_remote_ids,
+			remote_url = EXCLUDED.remote_url,
+			published_by = EXCLUDED.published_by,
+			status = 'live',
+			last_action = NULL,
+			last_result = NULL,
+			last_error = NULL,
+			published_at = now(),
+			updated_at = now()
+	`, draftID, platform, remoteID, nullIfEmpty(remoteURL), userID, pqStringArray(remoteIDs[1:]))
+	if err != nil {
+		log.Printf("Failed to record %s post %s for draft %s: %v", platform, remoteID, draftID, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		log.Printf("Not recording %s post %s: draft %s isn't in a workspace of user %s", platform, remoteID, draftID, userID)
+	}
+}
+
+// loadPlatformAccount loads a user's connected account for a platform
+func loadPlatformAccount(db *sql.DB, userID, platform string) (*platformAccount, error) {
+	acc := &platformAccount{UserID: userID, Platform: platform}
+	err := db.QueryRow(`
+		SELECT social_id, access_token, COALESCE(refresh_token, '')
+		FROM social_accounts
+		WHERE user_id = $1 AND platform = $2
+	`, userID, platform).Scan(&acc.SocialID, &acc.AccessToken, &acc.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	return acc, nil
+}
+
+// oauthAccessToken loads a user's account and refreshes its access token through config
+// when it has expired, saving the new tokens. Providers that rotate refresh tokens get
+// the new one stored too.
+func oauthAccessToken(db *sql.DB, userID, platform string, config *oauth2.Config) (*platformAccount, error) {
+	acc, err := loadPlatformAccount(db, userID, platform)
+	if err != nil {
+		return nil, err
+	}
+	var expiresAt *time.Time
+	if err := db.QueryRow(`SELECT access_token_expires_at FROM social_accounts WHERE user_id = $1 AND platform = $2`,
+		userID, platform).Scan(&expiresAt); err != nil {
+		return nil, err
+	}
+	if expiresAt == nil || time.Now().Before(expiresAt.Add(-time.Minute)) {
+		return acc, nil
+	}
+	if acc.RefreshToken == "" {
+		return nil, fmt.Errorf("%s access token expired and no refresh token is stored", platform)
+	}
+
+	token, err := config.TokenSource(context.Background(), &oauth2.Token{
+		RefreshToken: acc.RefreshToken,
+		Expiry:       time.Now().Add(-time.Minute),
+	}).Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh %s token: %v", platform, err)
+	}
+	if token.RefreshToken != "" {
+		acc.RefreshToken = token.RefreshToken
+	}
+	acc.AccessToken = token.AccessToken
+
+	var newExpiry *time.Time
+	if !token.Expiry.IsZero() {
+		newExpiry = &token.Expiry
+	}
+	_, err = db.Exec(`
+		UPDATE social_accounts
+		SET access_token = $1, access_token_expires_at = $2, refresh_token = $3, last_synced_at = NOW()
+		WHERE user_id = $4 AND platform = $5
+	`, acc.AccessToken, newExpiry, acc.RefreshToken, userID, platform)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save refreshed %s token: %v", platform, err)
+	}
+	return acc, nil
+}
+
+func loadPublishedPosts(workspaceID, draftID string, platforms []string) ([]models.PublishedPost, error) {
+	query := `
+		SELECT id, draft_id, workspace_id, platform, remote_id, thread_remote_ids, remote_url, published_by, status,
+		       last_action, last_result, last_error, published_at, updated_at
+		FROM published_posts
+		WHERE workspace_id = $1 AND draft_id = $2
+	`
+	args := []interface{}{workspaceID, draftID}
+	if len(platforms) > 0 {
+		query += " AND platform = ANY($3)"
+		args = append(args, pqStringArray(platforms))
+	}
+	query += " ORDER BY platform, published_at"
+
+	rows, err := lib.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []models.PublishedPost{}
+	for rows.Next() {
+		var p models.PublishedPost
+		var threadIDs pqStringArray
+		if err := rows.Scan(&p.ID, &p.DraftID, &p.WorkspaceID, &p.Platform, &p.RemoteID, &threadIDs, &p.RemoteURL,
+			&p.PublishedBy, &p.Status, &p.LastAction, &p.LastResult, &p.LastError, &p.PublishedAt, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		p.ThreadRemoteIDs = []string(threadIDs)
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
+
+// runPublishedPostAction runs action with the social account that published the post
+func runPublishedPostAction(post *models.PublishedPost, action func(acc *platformAccount) error) error {
+	if post.PublishedBy == nil {
+		return fmt.Errorf("the account that published this post is unknown")
+	}
+	// Webhook posts belong to the workspace, not to a connected account
+	if post.Platform == webhookPlatform {
+		return action(&platformAccount{UserID: *post.PublishedBy, Platform: webhookPlatform})
+	}
+	acc, err := loadPlatformAccount(lib.DB, *post.PublishedBy, post.Platform)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("the %s account that published this post is no longer connected", post.Platform)
+	}
+	if err != nil {
+		return err
+	}
+	return action(acc)
+}
+
+// deletePublishedThread deletes a post and, if it was split into a thread, its replies.
+// Replies go first, last to first, and each is dropped from the row once deleted, so a
+// retry after a failure picks up where this one stopped.
+func deletePublishedThread(del publishedPostDeleter, acc *platformAccount, post *models.PublishedPost) error {
+	for len(post.ThreadRemoteIDs) > 0 {
+		last := len(post.ThreadRemoteIDs) - 1
+		reply := *post
+		reply.RemoteID = post.ThreadRemoteIDs[last]
+		if err := del(lib.DB, acc, &reply); err != nil {
+			return fmt.Errorf("failed to delete reply %s of the thread: %v", reply.RemoteID, err)
+		}
+		post.ThreadRemoteIDs = post.ThreadRemoteIDs[:last]
+		if _, err := lib.DB.Exec(`
+			UPDATE published_posts SET thread_remote_ids = $1, updated_at = now() WHERE id = $2
+		`, pqStringArray(post.ThreadRemoteIDs), post.ID); err != nil {
+			log.Printf("Failed to update thread of published post %s: %v", post.ID, err)
+		}
+	}
+	return del(lib.DB, acc, post)
+}
+
+// recordPublishedPostAction stores the outcome of an edit or delete on the post row
+func recordPublishedPostAction(post *models.PublishedPost, action string, actionErr error) publishedPostResult {
+	res := publishedPostResult{Result: "ok"}
+	if errors.Is(actionErr, errNotSupported) {
+		res = publishedPostResult{Result: "not_supported", Error: fmt.Sprintf("%s %s", post.Platform, errNotSupported)}
+	} else if actionErr != nil {
+		log.Printf("Failed to %s %s post %s: %v", action, post.Platform, post.RemoteID, actionErr)
+		res = publishedPostResult{Result: "failed", Error: actionErr.Error()}
+	}
+
+	status := post.Status
+	if action == "delete" && res.Result == "ok" {
+		status = "deleted"
+	}
+	if _, err := lib.DB.Exec(`
+		UPDATE published_posts
+		SET status = $1, last_action = $2, last_result = $3, last_error = $4, updated_at = now()
+		WHERE id = $5
+	`, status, action, res.Result, nullIfEmpty(res.Error), post.ID); err != nil {
+		log.Println("Failed to record published post action:", err)
+	}
+	return res
+}
+
+// mergePublishedPostResult adds one post's result to its platform's. When a platform has
+// several posts for the draft, the first one that didn't succeed is what's reported.
+func mergePublishedPostResult(results map[string]publishedPostResult, platform string, res publishedPostResult) {
+	if prev, ok := results[platform]; ok && prev.Result != "ok" {
+		return
+	}
+	results[platform] = res
+}
+
+func writePublishedPostResults(w http.ResponseWriter, workspaceID, draftID, eventType string, results map[string]publishedPostResult) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"draftId": draftID,
+		"results": results,
+	})
+
+	msg, _ := json.Marshal(map[string]interface{}{
+		"type":    eventType,
+		"draftId": draftID,
+		"results": results,
+	})
+	hub.broadcast(workspaceID, websocket.TextMessage, msg)
+}
+
+// --- Mastodon ---
+
+// editMastodonStatus replaces a status's text. Mastodon's edit replaces the whole status,
+// so the current media, content warning and poll are read back and sent again.
+func editMastodonStatus(db *sql.DB, acc *platformAccount, post *models.PublishedPost, content string) error {
+	instanceURL, err := mastodonInstanceURL(acc.SocialID)
+	if err != nil {
+		return err
+	}
+	statusURL := instanceURL + "/api/v1/statuses/" + url.PathEscape(post.RemoteID)
+
+	var current struct {
+		SpoilerText      string `json:"spoiler_text"`
+		Sensitive        bool   `json:"sensitive"`
+		MediaAttachments []struct {
+			ID string `json:"id"`
+		} `json:"media_attachments"`
+		Poll *struct {
+			ExpiresAt *time.Time `json:"expires_at"`
+			Expired   bool       `json:"expired"`
+			Multiple  bool       `json:"multiple"`
+			Options   []struct {
+				Title string `json:"title"`
+			} `json:"options"`
+		} `json:"poll"`
+	}
+	if err := getJSON(statusURL, map[string]string{"Authorization": "Bearer " + acc.AccessToken}, &current); err != nil {
+		return fmt.Errorf("failed to load the status: %v", err)
+	}
+
+	mediaIDs := []string{}
+	for _, m := range current.MediaAttachments {
+		mediaIDs = append(mediaIDs, m.ID)
+	}
+	body := map[string]interface{}{
+		"status":       content,
+		"spoiler_text": current.SpoilerText,
+		"sensitive":    current.Sensitive,
+		"media_ids":    mediaIDs,
+	}
+	if poll := current.Poll; poll != nil {
+		// Resending the poll restarts its clock, which would reopen a closed poll
+		if poll.Expired || poll.ExpiresAt == nil {
+			return fmt.Errorf("Mastodon can't edit a status whose poll has closed without removing the poll")
+		}
+		options := []string{}
+		for _, o := range poll.Options {
+			options = append(options, o.Title)
+		}
+		// Mastodon's shortest poll is five minutes
+		expiresIn := max(int(time.Until(*poll.ExpiresAt).Seconds()), 300)
+		body["poll"] = map[string]interface{}{
+			"options":    options,
+			"expires_in": expiresIn,
+			"multiple":   poll.Multiple,
+		}
+	}
+	return sendPlatformJSON("PUT", statusURL, acc.AccessToken, body, nil)
+}
+
+func deleteMastodonStatus(db *sql.DB, acc *platformAccount, post *models.PublishedPost) error {
+	instanceURL, err := mastodonInstanceURL(acc.SocialID)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("DELETE", instanceURL+"/api/v1/statuses/"+url.PathEscape(post.RemoteID), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+acc.AccessToken)
+	return doPlatformRequest(req)
+}
+
+// --- Facebook ---
+
+func editFacebookPost(db *sql.DB, acc *platformAccount, post *models.PublishedPost, content string) error {
+	form := url.Values{}
+	form.Set("message", content)
+	form.Set("access_token", acc.AccessToken)
+	return postGraphForm(lib.GraphURL("%s", post.RemoteID), form)
+}
+
+func deleteFacebookPost(db *sql.DB, acc *platformAccount, post *models.PublishedPost) error {
+	req, err := http.NewRequest("DELETE", lib.GraphURL("%s?access_token=%s", post.RemoteID, url.QueryEscape(acc.AccessToken)), nil)
+	if err != nil {
+		return err
+	}
+	return doPlatformRequest(req)
+}
+
+// --- YouTube ---
+
+// editYouTubeVideo replaces the video description, keeping the rest of the snippet
+func editYouTubeVideo(db *sql.DB, acc *platformAccount, post *models.PublishedPost, content string) error {
+	videoURL := "https://www.googleapis.com/youtube/v3/videos?part=snippet&id=" + url.QueryEscape(post.RemoteID)
+	resp, err := doYouTubeRequest(db, acc.UserID, &acc.AccessToken, acc.RefreshToken, func(token string) (*http.Request, error) {
+		req, err := http.NewRequest("GET", videoURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("YouTube API error (status %d): %s", resp.StatusCode, body)
+	}
+	var videos struct {
+		Items []struct {
+			Snippet map[string]interface{} `json:"snippet"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&videos); err != nil {
+		return err
+	}
+	if len(videos.Items) == 0 {
+		return fmt.Errorf("YouTube video %s not found", post.RemoteID)
+	}
+
+	snippet := videos.Items[0].Snippet
+	snippet["description"] = content
+	// Read-only snippet fields are rejected on update
+	for _, key := range []string{"publishedAt", "channelId", "thumbnails", "channelTitle", "liveBroadcastContent", "localized"} {
+		delete(snippet, key)
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":      post.RemoteID,
+		"snippet": snippet,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp2, err := doYouTubeRequest(db, acc.UserID, &acc.AccessToken, acc.RefreshToken, func(token string) (*http.Request, error) {
+		req, err := http.NewRequest("PUT", "https://www.googleapis.com/youtube/v3/videos?part=snippet", bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	return checkPlatformResponse(resp2)
+}
+
+func deleteYouTubeVideo(db *sql.DB, acc *platformAccount, post *models.PublishedPost) error {
+	resp, err := doYouTubeRequest(db, acc.UserID, &acc.AccessToken, acc.RefreshToken, func(token string) (*http.Request, error) {
+		req, err := http.NewRequest("DELETE", "https://www.googleapis.com/youtube/v3/videos?id="+url.QueryEscape(post.RemoteID), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	return checkPlatformResponse(resp)
+}
+
+// --- X (Twitter) ---
+
+func deleteTweet(db *sql.DB, acc *platformAccount, post *models.PublishedPost) error {
+	accessToken, _, err := twitterAccessToken(db, acc.UserID)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("DELETE", twitterAPIBase+"/tweets/"+url.PathEscape(post.RemoteID), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	return doPlatformRequest(req)
+}
+
+// --- Helpers ---
+
+// doPlatformRequest sends req and fails on any non-2xx response
+func doPlatformRequest(req *http.Request) error {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return checkPlatformResponse(resp)
+}
+
+// sendPlatformJSON sends a JSON body with a bearer token and decodes the JSON response
+// into out, when out is non-nil
+func sendPlatformJSON(method, endpoint, accessToken string, body, out interface{}) error {
+	payload, _ := json.Marshal(body)
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return checkPlatformResponse(resp)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("API error (status %d): %s", resp.StatusCode, raw)
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// checkPlatformResponse closes resp and turns a non-2xx status into an error
+func checkPlatformResponse(resp *http.Response) error {
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API error (status %d): %s", resp.StatusCode, body)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"social-sync-backend/middleware"
+
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+)
+
+const threadsAPIBase = "https://graph.threads.net/v1.0"
+
+// getThreadsOAuthConfig returns the OAuth2 config for Threads. Threads is a separate use
+// case on the Meta app with its own app ID and secret, and Facebook Login tokens are not
+// accepted by graph.threads.net, so it has its own connect flow.
+func getThreadsOAuthConfig() *oauth2.Config {
+	redirectURL := os.Getenv("THREADS_REDIRECT_URL")
+	if redirectURL == "" {
+		log.Fatal("THREADS_REDIRECT_URL is empty!")
+	}
+
+	return &oauth2.Config{
+		ClientID:     os.Getenv("THREADS_APP_ID"),
+		ClientSecret: os.Getenv("THREADS_APP_SECRET"),
+		RedirectURL:  redirectURL,
+		Scopes: []string{
+			"threads_basic", "threads_content_publish",
+			"threads_manage_insights", "threads_manage_replies",
+		},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   "https://threads.net/oauth/authorize",
+			TokenURL:  "https://graph.threads.net/oauth/access_token",
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}
+}
+
+// ThreadsRedirectHandler initiates the OAuth flow and redirects to the Threads auth page
+func ThreadsRedirectHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appUserIDStr, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated.", http.StatusUnauthorized)
+			return
+		}
+		if _, err := uuid.Parse(appUserIDStr); err != nil {
+			http.Error(w, "Invalid user ID format.", http.StatusInternalServerError)
+			return
+		}
+
+		state, err := newOAuthState("threads", appUserIDStr)
+		if err != nil {
+			log.Println("Failed to save Threads OAuth state:", err)
+			http.Error(w, "Failed to start Threads authorization", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, getThreadsOAuthConfig().AuthCodeURL(state), http.StatusTemporaryRedirect)
+	}
+}
+
+// ThreadsCallbackHandler exchanges the code for a long-lived token, saves the profile
+// and redirects to the frontend
+func ThreadsCallbackHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appUserIDStr, ok, err := consumeOAuthState("threads", r.URL.Query().Get("state"))
+		if err != nil {
+			log.Println("Failed to check Threads OAuth state:", err)
+			http.Error(w, "Failed to check state parameter", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Invalid or expired state parameter", http.StatusBadRequest)
+			return
+		}
+
+		code := r.URL.Query().Get("code")
+		if code == "" {
+			http.Error(w, "Missing code parameter", http.StatusBadRequest)
+			return
+		}
+
+		config := getThreadsOAuthConfig()
+		shortLived, err := config.Exchange(context.Background(), code)
+		if err != nil {
+			http.Error(w, "Token exchange failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Short-lived tokens last an hour; swap for a 60-day token
+		var longLived struct {
+			AccessToken string `json:"access_token"`
+			ExpiresIn   int    `json:"expires_in"`
+		}
+		exchangeURL := fmt.Sprintf("https://graph.threads.net/access_token?grant_type=th_exchange_token&client_secret=%s&access_token=%s",
+			url.QueryEscape(config.ClientSecret), url.QueryEscape(shortLived.AccessToken))
+		if err := getJSON(exchangeURL, nil, &longLived); err != nil {
+			http.Error(w, "Failed to get long-lived Threads token: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var profile struct {
+			ID                string `json:"id"`
+			Username          string `json:"username"`
+			Name              string `json:"name"`
+			ProfilePictureURL string `json:"threads_profile_picture_url"`
+		}
+		profileURL := fmt.Sprintf("%s/me?fields=id,username,name,threads_profile_picture_url&access_token=%s",
+			threadsAPIBase, url.QueryEscape(longLived.AccessToken))
+		if err := getJSON(profileURL, nil, &profile); err != nil {
+			http.Error(w, "Failed to fetch Threads profile: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		profileName := profile.Name
+		if profileName == "" {
+			profileName = profile.Username
+		}
+		profileName = fmt.Sprintf("%s (@%s)", profileName, profile.Username)
+
+		_, err = db.Exec(`
+			INSERT INTO social_accounts (
+				user_id, platform, social_id, access_token, access_token_expires_at,
+				profile_picture_url, profile_name, connected_at
+			) VALUES (
+				$1, 'threads', $2, $3, $4, $5, $6, NOW()
+			)
+			ON CONFLICT (user_id, platform) DO UPDATE SET
+				access_token = EXCLUDED.access_token,
+				access_token_expires_at = EXCLUDED.access_token_expires_at,
+				social_id = EXCLUDED.social_id,
+				profile_picture_url = EXCLUDED.profile_picture_url,
+				profile_name = EXCLUDED.profile_name,
+				connected_at = NOW()
+		`,
+			appUserIDStr,
+			profile.ID,
+			longLived.AccessToken,
+			time.Now().Add(time.Duration(longLived.ExpiresIn)*time.Second),
+			nullIfEmpty(profile.ProfilePictureURL),
+			profileName,
+		)
+		if err != nil {
+			http.Error(w, "Failed to save Threads account: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "http://localhost:3000/home/manage-accounts?connected=threads", http.StatusSeeOther)
+	}
+}
+
+// threadsAccessToken returns the stored long-lived token, refreshing it once it is past
+// half its life. Long-lived tokens can be refreshed any time after they are a day old.
+func threadsAccessToken(db *sql.DB, userID string) (string, string, error) {
+	var accessToken, threadsUserID string
+	var expiresAt *time.Time
+	err := db.QueryRow(`
+		SELECT access_token, access_token_expires_at, social_id
+		FROM social_accounts
+		WHERE user_id = $1 AND platform = 'threads'
+	`, userID).Scan(&accessToken, &expiresAt, &threadsUserID)
+	if err != nil {
+		return "", "", err
+	}
+	if expiresAt == nil || time.Until(*expiresAt) > 30*24*time.Hour {
+		return accessToken, threadsUserID, nil
+	}
+	if time.Now().After(*expiresAt) {
+		return "", "", fmt.Errorf("Threads access token expired, reconnect Threads")
+	}
+
+	var refreshed struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	refreshURL := "https://graph.threads.net/refresh_access_token?grant_type=th_refresh_token&access_token=" + url.QueryEscape(accessToken)
+	if err := getJSON(refreshURL, nil, &refreshed); err != nil {
+		// The current token still works until it expires
+		log.Printf("Failed to refresh Threads token for user %s: %v", userID, err)
+		return accessToken, threadsUserID, nil
+	}
+	_, err = db.Exec(`
+		UPDATE social_accounts
+		SET access_token = $1, access_token_expires_at = $2, last_synced_at = NOW()
+		WHERE user_id = $3 AND platform = 'threads'
+	`, refreshed.AccessToken, time.Now().Add(time.Duration(refreshed.ExpiresIn)*time.Second), userID)
+	if err != nil {
+		log.Printf("Failed to save refreshed Threads token for user %s: %v", userID, err)
+	}
+	return refreshed.AccessToken, threadsUserID, nil
+}
@@ -0,0 +1,373 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+)
+
+const (
+	threadsCharLimit     = 500
+	threadsMaxCarousel   = 20
+	threadsCheckInterval = 5 * time.Second
+	// Videos usually finish within a minute or two
+	threadsMaxChecks = 60
+)
+
+var threadsReplyControls = map[string]bool{
+	"everyone":            true,
+	"accounts_you_follow": true,
+	"mentioned_only":      true,
+}
+
+type ThreadsPostRequest struct {
+	Text         string   `json:"text"`
+	MediaUrls    []string `json:"mediaUrls"`    // images or videos; several make a carousel
+	AltTexts     []string `json:"altTexts"`     // alt text per item, in mediaUrls order
+	ReplyControl string   `json:"replyControl"` // everyone (default), accounts_you_follow or mentioned_only
+	ReplyToID    string   `json:"replyToId"`    // post this as a reply to a Threads post
+	DraftID      string   `json:"draftId"`      // optional; links the post to a draft for later delete
+}
+
+// PostToThreadsHandler publishes a text, image, video or carousel post with the same
+// two-step container flow as Instagram: create containers, wait until they finish
+// processing, then publish
+func PostToThreadsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		var req ThreadsPostRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		if strings.TrimSpace(req.Text) == "" && len(req.MediaUrls) == 0 {
+			http.Error(w, "Text cannot be empty", http.StatusBadRequest)
+			return
+		}
+		if utf8.RuneCountInString(req.Text) > threadsCharLimit {
+			http.Error(w, "Text exceeds Threads' 500 character limit", http.StatusBadRequest)
+			return
+		}
+		if len(req.MediaUrls) > threadsMaxCarousel {
+			http.Error(w, "Threads carousels hold at most 20 items", http.StatusBadRequest)
+			return
+		}
+		if req.ReplyControl != "" && !threadsReplyControls[req.ReplyControl] {
+			http.Error(w, "replyControl must be everyone, accounts_you_follow or mentioned_only", http.StatusBadRequest)
+			return
+		}
+
+		accessToken, threadsUserID, err := threadsAccessToken(db, userID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Threads account not connected", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		// Step 1: Create the post container (and carousel items)
+		form := url.Values{}
+		form.Set("text", req.Text)
+		if req.ReplyControl != "" {
+			form.Set("reply_control", req.ReplyControl)
+		}
+		if req.ReplyToID != "" {
+			form.Set("reply_to_id", req.ReplyToID)
+		}
+
+		switch len(req.MediaUrls) {
+		case 0:
+			form.Set("media_type", "TEXT")
+		case 1:
+			setThreadsMedia(form, req.MediaUrls[0], altTextAt(req.AltTexts, 0))
+		default:
+			var children []string
+			for i, mediaURL := range req.MediaUrls {
+				item := url.Values{}
+				item.Set("is_carousel_item", "true")
+				setThreadsMedia(item, mediaURL, altTextAt(req.AltTexts, i))
+				childID, err := createThreadsContainer(threadsUserID, accessToken, item)
+				if err != nil {
+					http.Error(w, fmt.Sprintf("Carousel item %d failed: %v", i+1, err), http.StatusBadGateway)
+					return
+				}
+				children = append(children, childID)
+			}
+			// Step 2: Every item must finish before the carousel container is created
+			for i, childID := range children {
+				if err := waitForThreadsContainer(childID, accessToken); err != nil {
+					http.Error(w, fmt.Sprintf("Carousel item %d failed to process: %v", i+1, err), http.StatusBadGateway)
+					return
+				}
+			}
+			form.Set("media_type", "CAROUSEL")
+			form.Set("children", strings.Join(children, ","))
+		}
+
+		containerID, err := createThreadsContainer(threadsUserID, accessToken, form)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Threads container creation failed: %v", err), http.StatusBadGateway)
+			return
+		}
+		if err := waitForThreadsContainer(containerID, accessToken); err != nil {
+			http.Error(w, fmt.Sprintf("Threads post failed to process: %v", err), http.StatusBadGateway)
+			return
+		}
+
+		// Step 3: Publish
+		publishForm := url.Values{}
+		publishForm.Set("creation_id", containerID)
+		publishForm.Set("access_token", accessToken)
+		postID, err := postInstagramForm(fmt.Sprintf("%s/%s/threads_publish", threadsAPIBase, threadsUserID), publishForm)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Threads publish failed: %v", err), http.StatusBadGateway)
+			return
+		}
+
+		var post struct {
+			Permalink string `json:"permalink"`
+		}
+		permalinkURL := fmt.Sprintf("%s/%s?fields=permalink&access_token=%s", threadsAPIBase, postID, url.QueryEscape(accessToken))
+		if err := getJSON(permalinkURL, nil, &post); err != nil {
+			log.Printf("Failed to fetch permalink for Threads post %s: %v", postID, err)
+		}
+		recordPublishedPost(db, req.DraftID, "threads", userID, postID, post.Permalink)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message":   "Posted to Threads successfully",
+			"id":        postID,
+			"permalink": post.Permalink,
+		})
+	}
+}
+
+// setThreadsMedia sets the media fields for an image or video URL
+func setThreadsMedia(form url.Values, mediaURL, altText string) {
+	if strings.HasPrefix(detectMimeType(mediaURL), "video/") {
+		form.Set("media_type", "VIDEO")
+		form.Set("video_url", mediaURL)
+	} else {
+		form.Set("media_type", "IMAGE")
+		form.Set("image_url", mediaURL)
+	}
+	if altText != "" {
+		form.Set("alt_text", altText)
+	}
+}
+
+func altTextAt(altTexts []string, i int) string {
+	if i < len(altTexts) {
+		return altTexts[i]
+	}
+	return ""
+}
+
+func createThreadsContainer(threadsUserID, accessToken string, form url.Values) (string, error) {
+	form.Set("access_token", accessToken)
+	return postInstagramForm(fmt.Sprintf("%s/%s/threads", threadsAPIBase, threadsUserID), form)
+}
+
+// waitForThreadsContainer polls a container until it is FINISHED
+func waitForThreadsContainer(containerID, accessToken string) error {
+	statusURL := fmt.Sprintf("%s/%s?fields=status,error_message&access_token=%s", threadsAPIBase, containerID, url.QueryEscape(accessToken))
+	for i := 0; i < threadsMaxChecks; i++ {
+		var container struct {
+			Status       string `json:"status"`
+			ErrorMessage string `json:"error_message"`
+		}
+		if err := getJSON(statusURL, nil, &container); err != nil {
+			return err
+		}
+		switch container.Status {
+		case "FINISHED", "PUBLISHED":
+			return nil
+		case "ERROR", "EXPIRED":
+			return fmt.Errorf("container %s: %s", strings.ToLower(container.Status), container.ErrorMessage)
+		}
+		time.Sleep(threadsCheckInterval)
+	}
+	return fmt.Errorf("media not ready after %d checks", threadsMaxChecks)
+}
+
+// GetThreadsPostsHandler fetches the user's recent Threads posts
+func GetThreadsPostsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+		accessToken, threadsUserID, err := threadsAccessToken(db, userID)
+		if err != nil {
+			writeThreadsFetchError(w, err)
+			return
+		}
+		posts, err := fetchThreadsPosts(accessToken, threadsUserID, 25)
+		if err != nil {
+			writeThreadsFetchError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": posts})
+	}
+}
+
+// GetThreadsAnalyticsHandler returns per-post insights for recent posts plus the
+// account's follower count
+func GetThreadsAnalyticsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+		accessToken, threadsUserID, err := threadsAccessToken(db, userID)
+		if err != nil {
+			writeThreadsFetchError(w, err)
+			return
+		}
+		posts, err := fetchThreadsPosts(accessToken, threadsUserID, 25)
+		if err != nil {
+			writeThreadsFetchError(w, err)
+			return
+		}
+
+		totals := map[string]int{}
+		postsWithEngagement := []map[string]interface{}{}
+		for _, post := range posts {
+			postID, _ := post["id"].(string)
+			insights, err := fetchThreadsInsights(fmt.Sprintf("%s/%s/insights", threadsAPIBase, postID),
+				"views,likes,replies,reposts,quotes,shares", accessToken)
+			if err != nil {
+				log.Printf("Failed to fetch insights for Threads post %s: %v", postID, err)
+				continue
+			}
+			for metric, value := range insights {
+				totals[metric] += value
+			}
+			postsWithEngagement = append(postsWithEngagement, map[string]interface{}{
+				"id":         postID,
+				"text":       post["text"],
+				"permalink":  post["permalink"],
+				"timestamp":  post["timestamp"],
+				"views":      insights["views"],
+				"likes":      insights["likes"],
+				"replies":    insights["replies"],
+				"reposts":    insights["reposts"],
+				"quotes":     insights["quotes"],
+				"shares":     insights["shares"],
+				"engagement": insights["likes"] + insights["replies"] + insights["reposts"] + insights["quotes"],
+			})
+		}
+
+		sort.SliceStable(postsWithEngagement, func(i, j int) bool {
+			return postsWithEngagement[i]["engagement"].(int) > postsWithEngagement[j]["engagement"].(int)
+		})
+		topN := 5
+		if len(postsWithEngagement) < topN {
+			topN = len(postsWithEngagement)
+		}
+
+		followers := 0
+		if account, err := fetchThreadsInsights(fmt.Sprintf("%s/%s/threads_insights", threadsAPIBase, threadsUserID),
+			"followers_count", accessToken); err == nil {
+			followers = account["followers_count"]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"totalPosts":     len(postsWithEngagement),
+			"totalViews":     totals["views"],
+			"totalLikes":     totals["likes"],
+			"totalReplies":   totals["replies"],
+			"totalReposts":   totals["reposts"],
+			"totalQuotes":    totals["quotes"],
+			"totalShares":    totals["shares"],
+			"followersCount": followers,
+			"topPosts":       postsWithEngagement[:topN],
+			"totalClicks":    countUserLinkClicks(db, userID, "threads"),
+		})
+	}
+}
+
+func fetchThreadsPosts(accessToken, threadsUserID string, limit int) ([]map[string]interface{}, error) {
+	var res struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	postsURL := fmt.Sprintf("%s/%s/threads?fields=id,text,media_type,media_url,permalink,timestamp&limit=%d&access_token=%s",
+		threadsAPIBase, threadsUserID, limit, url.QueryEscape(accessToken))
+	if err := getJSON(postsURL, nil, &res); err != nil {
+		return nil, err
+	}
+	if res.Data == nil {
+		res.Data = []map[string]interface{}{}
+	}
+	return res.Data, nil
+}
+
+// fetchThreadsInsights reads metrics from an insights edge. Metrics come back either as
+// a time series ("values") or, for totals such as followers_count, as "total_value".
+func fetchThreadsInsights(endpoint, metrics, accessToken string) (map[string]int, error) {
+	var res struct {
+		Data []struct {
+			Name   string `json:"name"`
+			Values []struct {
+				Value int `json:"value"`
+			} `json:"values"`
+			TotalValue struct {
+				Value int `json:"value"`
+			} `json:"total_value"`
+		} `json:"data"`
+	}
+	insightsURL := fmt.Sprintf("%s?metric=%s&access_token=%s", endpoint, metrics, url.QueryEscape(accessToken))
+	if err := getJSON(insightsURL, nil, &res); err != nil {
+		return nil, err
+	}
+	values := map[string]int{}
+	for _, m := range res.Data {
+		value := m.TotalValue.Value
+		for _, v := range m.Values {
+			value += v.Value
+		}
+		values[m.Name] = value
+	}
+	return values, nil
+}
+
+func writeThreadsFetchError(w http.ResponseWriter, err error) {
+	if err == sql.ErrNoRows {
+		http.Error(w, "Threads account not connected", http.StatusBadRequest)
+		return
+	}
+	http.Error(w, "Failed to fetch Threads posts: "+err.Error(), http.StatusBadGateway)
+}
+
+func deleteThreadsPost(db *sql.DB, acc *platformAccount, post *models.PublishedPost) error {
+	accessToken, _, err := threadsAccessToken(db, acc.UserID)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/%s?access_token=%s", threadsAPIBase, post.RemoteID, url.QueryEscape(accessToken)), nil)
+	if err != nil {
+		return err
+	}
+	return doPlatformRequest(req)
+}
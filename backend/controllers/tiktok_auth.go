@@ -0,0 +1,228 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"social-sync-backend/middleware"
+
+	"github.com/google/uuid"
+)
+
+// TikTok calls the client id "client_key", so the flow is built by hand instead of with oauth2.Config
+const (
+	tiktokAuthURL  = "https://www.tiktok.com/v2/auth/authorize/"
+	tiktokTokenURL = "https://open.tiktokapis.com/v2/oauth/token/"
+	tiktokScopes   = "user.info.basic,user.info.profile,video.publish,video.upload,video.list"
+)
+
+func getTikTokRedirectURL() string {
+	redirectURL := os.Getenv("TIKTOK_REDIRECT_URL")
+	if redirectURL == "" {
+		log.Fatal("TIKTOK_REDIRECT_URL is empty!")
+	}
+	return redirectURL
+}
+
+// TikTokRedirectHandler initiates the OAuth flow and redirects to the TikTok auth page
+func TikTokRedirectHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appUserIDStr, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated.", http.StatusUnauthorized)
+			return
+		}
+		if _, err := uuid.Parse(appUserIDStr); err != nil {
+			http.Error(w, "Invalid user ID format.", http.StatusInternalServerError)
+			return
+		}
+
+		state, err := newOAuthState("tiktok", appUserIDStr)
+		if err != nil {
+			log.Println("Failed to save TikTok OAuth state:", err)
+			http.Error(w, "Failed to start TikTok authorization", http.StatusInternalServerError)
+			return
+		}
+
+		params := url.Values{}
+		params.Set("client_key", os.Getenv("TIKTOK_CLIENT_KEY"))
+		params.Set("response_type", "code")
+		params.Set("scope", tiktokScopes)
+		params.Set("redirect_uri", getTikTokRedirectURL())
+		params.Set("state", state)
+
+		http.Redirect(w, r, tiktokAuthURL+"?"+params.Encode(), http.StatusTemporaryRedirect)
+	}
+}
+
+// TikTokCallbackHandler exchanges the code, saves the creator account and redirects to the frontend
+func TikTokCallbackHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appUserIDStr, ok, err := consumeOAuthState("tiktok", r.URL.Query().Get("state"))
+		if err != nil {
+			log.Println("Failed to check TikTok OAuth state:", err)
+			http.Error(w, "Failed to check state parameter", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Invalid or expired state parameter", http.StatusBadRequest)
+			return
+		}
+
+		if errMsg := r.URL.Query().Get("error_description"); errMsg != "" {
+			http.Error(w, "TikTok authorization failed: "+errMsg, http.StatusBadRequest)
+			return
+		}
+		code := r.URL.Query().Get("code")
+		if code == "" {
+			http.Error(w, "Missing code parameter", http.StatusBadRequest)
+			return
+		}
+
+		form := url.Values{}
+		form.Set("code", code)
+		form.Set("grant_type", "authorization_code")
+		form.Set("redirect_uri", getTikTokRedirectURL())
+		token, err := requestTikTokToken(form)
+		if err != nil {
+			http.Error(w, "Token exchange failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var userInfo struct {
+			User struct {
+				OpenID      string `json:"open_id"`
+				DisplayName string `json:"display_name"`
+				Username    string `json:"username"`
+				AvatarURL   string `json:"avatar_url"`
+			} `json:"user"`
+		}
+		err = callTikTokAPI("GET", "/user/info/?fields=open_id,display_name,username,avatar_url", token.AccessToken, nil, &userInfo)
+		if err != nil {
+			log.Printf("TikTok user info error: %v", err)
+			http.Error(w, "Failed to fetch TikTok profile", http.StatusInternalServerError)
+			return
+		}
+
+		profileName := userInfo.User.DisplayName
+		if userInfo.User.Username != "" {
+			profileName = fmt.Sprintf("%s (@%s)", userInfo.User.DisplayName, userInfo.User.Username)
+		}
+
+		_, err = db.Exec(`
+			INSERT INTO social_accounts (
+				user_id, platform, social_id, access_token, access_token_expires_at,
+				refresh_token, profile_picture_url, profile_name, connected_at
+			) VALUES (
+				$1, 'tiktok', $2, $3, $4, $5, $6, $7, NOW()
+			)
+			ON CONFLICT (user_id, platform) DO UPDATE SET
+				access_token = EXCLUDED.access_token,
+				access_token_expires_at = EXCLUDED.access_token_expires_at,
+				refresh_token = EXCLUDED.refresh_token,
+				social_id = EXCLUDED.social_id,
+				profile_picture_url = EXCLUDED.profile_picture_url,
+				profile_name = EXCLUDED.profile_name,
+				connected_at = NOW()
+		`,
+			appUserIDStr,
+			token.OpenID,
+			token.AccessToken,
+			token.expiresAt(),
+			token.RefreshToken,
+			nullIfEmpty(userInfo.User.AvatarURL),
+			profileName,
+		)
+		if err != nil {
+			http.Error(w, "Failed to save TikTok account: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "http://localhost:3000/home/manage-accounts?connected=tiktok", http.StatusSeeOther)
+	}
+}
+
+type tiktokToken struct {
+	AccessToken  string `json:"access_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	OpenID       string `json:"open_id"`
+	Error        string `json:"error"`
+	ErrorDesc    string `json:"error_description"`
+}
+
+func (t *tiktokToken) expiresAt() *time.Time {
+	if t.ExpiresIn <= 0 {
+		return nil
+	}
+	expiry := time.Now().Add(time.Duration(t.ExpiresIn) * time.Second)
+	return &expiry
+}
+
+// requestTikTokToken posts to the token endpoint with the client credentials added
+func requestTikTokToken(form url.Values) (*tiktokToken, error) {
+	form.Set("client_key", os.Getenv("TIKTOK_CLIENT_KEY"))
+	form.Set("client_secret", os.Getenv("TIKTOK_CLIENT_SECRET"))
+	resp, err := http.Post(tiktokTokenURL, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var token tiktokToken
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, err
+	}
+	if token.Error != "" || token.AccessToken == "" {
+		return nil, fmt.Errorf("%s: %s", token.Error, token.ErrorDesc)
+	}
+	return &token, nil
+}
+
+// tiktokAccessToken returns a valid access token and open_id, refreshing the token if it
+// has expired. TikTok access tokens last a day and refresh tokens a year.
+func tiktokAccessToken(db *sql.DB, userID string) (string, string, error) {
+	var accessToken, openID string
+	var tokenExpiry *time.Time
+	var refreshToken sql.NullString
+	err := db.QueryRow(`
+		SELECT access_token, access_token_expires_at, refresh_token, social_id
+		FROM social_accounts
+		WHERE user_id = $1 AND platform = 'tiktok'
+	`, userID).Scan(&accessToken, &tokenExpiry, &refreshToken, &openID)
+	if err != nil {
+		return "", "", err
+	}
+
+	if tokenExpiry == nil || time.Now().Before(tokenExpiry.Add(-time.Minute)) {
+		return accessToken, openID, nil
+	}
+	if !refreshToken.Valid || refreshToken.String == "" {
+		return "", "", fmt.Errorf("tiktok access token expired and no refresh token is stored")
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken.String)
+	token, err := requestTikTokToken(form)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to refresh tiktok token: %v", err)
+	}
+
+	_, err = db.Exec(`
+		UPDATE social_accounts
+		SET access_token = $1, access_token_expires_at = $2, refresh_token = $3, last_synced_at = NOW()
+		WHERE user_id = $4 AND platform = 'tiktok'
+	`, token.AccessToken, token.expiresAt(), token.RefreshToken, userID)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to save refreshed tiktok token: %v", err)
+	}
+	return token.AccessToken, openID, nil
+}
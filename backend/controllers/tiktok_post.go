@@ -0,0 +1,499 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+)
+
+const (
+	tiktokAPIBase = "https://open.tiktokapis.com/v2"
+	// TikTok accepts 5MB-64MB chunks; the last chunk takes the remainder (up to 128MB)
+	tiktokChunkSize     = 10 << 20
+	tiktokChunkAttempts = 3
+	// Bounds each read of the source video, including a whole chunk when retrying
+	tiktokSourceTimeout = 5 * time.Minute
+)
+
+var tiktokPrivacyLevels = map[string]bool{
+	"PUBLIC_TO_EVERYONE":    true,
+	"MUTUAL_FOLLOW_FRIENDS": true,
+	"FOLLOWER_OF_CREATOR":   true,
+	"SELF_ONLY":             true,
+}
+
+type TikTokPostRequest struct {
+	Title       string `json:"title"`
+	VideoURL    string `json:"videoUrl"`
+	MediaID     string `json:"mediaId"`     // media library video, used instead of videoUrl
+	WorkspaceID string `json:"workspaceId"` // required with mediaId
+	DraftID     string `json:"draftId"`     // optional; links the post to a draft
+
+	// UploadMode "pull" lets TikTok download videoUrl itself, which needs the URL's domain
+	// verified in the TikTok developer portal; "chunk" (default) streams it through us
+	UploadMode string `json:"uploadMode"`
+	// PostMode "direct" (default) publishes; "inbox" sends the video to the creator's
+	// TikTok inbox to finish editing in the app
+	PostMode string `json:"postMode"`
+
+	PrivacyLevel     string `json:"privacyLevel"` // required for direct posts; one of the creator's privacy_level_options
+	DisableDuet      bool   `json:"disableDuet"`
+	DisableStitch    bool   `json:"disableStitch"`
+	DisableComment   bool   `json:"disableComment"`
+	CoverTimestampMs *int   `json:"coverTimestampMs"`
+}
+
+// tiktokCreatorInfo is what TikTok allows this creator to post right now
+type tiktokCreatorInfo struct {
+	CreatorNickname         string   `json:"creator_nickname"`
+	CreatorAvatarURL        string   `json:"creator_avatar_url"`
+	PrivacyLevelOptions     []string `json:"privacy_level_options"`
+	CommentDisabled         bool     `json:"comment_disabled"`
+	DuetDisabled            bool     `json:"duet_disabled"`
+	StitchDisabled          bool     `json:"stitch_disabled"`
+	MaxVideoPostDurationSec int      `json:"max_video_post_duration_sec"`
+}
+
+// GetTikTokCreatorInfoHandler returns the creator's privacy options and interaction
+// settings, which TikTok requires the post form to offer
+func GetTikTokCreatorInfoHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+		accessToken, _, err := tiktokAccessToken(db, userID)
+		if err != nil {
+			writeTikTokAccountError(w, err)
+			return
+		}
+
+		var info tiktokCreatorInfo
+		if err := callTikTokAPI("POST", "/post/publish/creator_info/query/", accessToken, struct{}{}, &info); err != nil {
+			http.Error(w, "Failed to fetch TikTok creator info: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+	}
+}
+
+// PostToTikTokHandler starts a TikTok Content Posting API upload and queues a job that
+// polls the publish status (ProcessTikTokPublishJobs). It answers 202 with the job.
+func PostToTikTokHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		var req TikTokPostRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		uploadMode := req.UploadMode
+		if uploadMode == "" {
+			uploadMode = "chunk"
+		}
+		postMode := req.PostMode
+		if postMode == "" {
+			postMode = "direct"
+		}
+		if uploadMode != "chunk" && uploadMode != "pull" {
+			http.Error(w, "uploadMode must be chunk or pull", http.StatusBadRequest)
+			return
+		}
+		if postMode != "direct" && postMode != "inbox" {
+			http.Error(w, "postMode must be direct or inbox", http.StatusBadRequest)
+			return
+		}
+		if postMode == "direct" && !tiktokPrivacyLevels[req.PrivacyLevel] {
+			http.Error(w, "privacyLevel is required: PUBLIC_TO_EVERYONE, MUTUAL_FOLLOW_FRIENDS, FOLLOWER_OF_CREATOR or SELF_ONLY", http.StatusBadRequest)
+			return
+		}
+		if len([]rune(req.Title)) > 2200 {
+			http.Error(w, "Title exceeds TikTok's 2200 character limit", http.StatusBadRequest)
+			return
+		}
+
+		// Resolve the video from the media library or a URL
+		videoURL := req.VideoURL
+		var videoSize int64
+		var videoDuration *float64
+		contentType := "video/mp4"
+		if req.MediaID != "" {
+			if req.WorkspaceID == "" || !isWorkspaceMember(userID, req.WorkspaceID) {
+				http.Error(w, "workspaceId is missing or you are not a member of it", http.StatusForbidden)
+				return
+			}
+			media, err := loadMediaFile(req.MediaID, req.WorkspaceID, "video")
+			if err != nil {
+				http.Error(w, "Video not found in media library", http.StatusBadRequest)
+				return
+			}
+			applyRendition(media, "tiktok", "post")
+			videoURL, videoSize, videoDuration, contentType = media.FileURL, media.FileSize, media.Duration, media.MimeType
+		}
+		if videoURL == "" {
+			http.Error(w, "videoUrl or mediaId is required", http.StatusBadRequest)
+			return
+		}
+		// Client-supplied URLs may only point at public addresses
+		videoClient := &http.Client{Timeout: tiktokSourceTimeout}
+		if req.MediaID == "" {
+			videoClient = lib.PublicHTTPClient(tiktokSourceTimeout)
+		}
+		if uploadMode == "chunk" && videoSize == 0 {
+			videoSize, err = remoteContentLength(videoClient, videoURL)
+			if err != nil {
+				http.Error(w, "Could not determine video size: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		accessToken, _, err := tiktokAccessToken(db, userID)
+		if err != nil {
+			writeTikTokAccountError(w, err)
+			return
+		}
+
+		initBody := map[string]interface{}{}
+		initPath := "/post/publish/inbox/video/init/"
+		if postMode == "direct" {
+			initPath = "/post/publish/video/init/"
+
+			var creator tiktokCreatorInfo
+			if err := callTikTokAPI("POST", "/post/publish/creator_info/query/", accessToken, struct{}{}, &creator); err != nil {
+				http.Error(w, "Failed to fetch TikTok creator info: "+err.Error(), http.StatusBadGateway)
+				return
+			}
+			if !containsString(creator.PrivacyLevelOptions, req.PrivacyLevel) {
+				http.Error(w, fmt.Sprintf("privacyLevel %s is not available for this account; options: %s",
+					req.PrivacyLevel, strings.Join(creator.PrivacyLevelOptions, ", ")), http.StatusBadRequest)
+				return
+			}
+			if videoDuration != nil && creator.MaxVideoPostDurationSec > 0 && *videoDuration > float64(creator.MaxVideoPostDurationSec) {
+				http.Error(w, fmt.Sprintf("Video is longer than this account's %d second limit", creator.MaxVideoPostDurationSec), http.StatusBadRequest)
+				return
+			}
+
+			// Settings the creator has turned off in the app can't be turned back on per post
+			postInfo := map[string]interface{}{
+				"title":           req.Title,
+				"privacy_level":   req.PrivacyLevel,
+				"disable_duet":    req.DisableDuet || creator.DuetDisabled,
+				"disable_stitch":  req.DisableStitch || creator.StitchDisabled,
+				"disable_comment": req.DisableComment || creator.CommentDisabled,
+			}
+			if req.CoverTimestampMs != nil {
+				postInfo["video_cover_timestamp_ms"] = *req.CoverTimestampMs
+			}
+			initBody["post_info"] = postInfo
+		}
+
+		source := "FILE_UPLOAD"
+		var chunkSize, chunkCount int64
+		if uploadMode == "pull" {
+			source = "PULL_FROM_URL"
+			initBody["source_info"] = map[string]interface{}{"source": source, "video_url": videoURL}
+		} else {
+			chunkSize, chunkCount = tiktokChunkLayout(videoSize)
+			initBody["source_info"] = map[string]interface{}{
+				"source":            source,
+				"video_size":        videoSize,
+				"chunk_size":        chunkSize,
+				"total_chunk_count": chunkCount,
+			}
+		}
+
+		var initRes struct {
+			PublishID string `json:"publish_id"`
+			UploadURL string `json:"upload_url"`
+		}
+		if err := callTikTokAPI("POST", initPath, accessToken, initBody, &initRes); err != nil {
+			http.Error(w, "TikTok upload init failed: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		if source == "FILE_UPLOAD" {
+			src := urlUploadSource{url: videoURL, client: videoClient}
+			if err := uploadTikTokChunks(initRes.UploadURL, src, contentType, videoSize, chunkSize, chunkCount); err != nil {
+				http.Error(w, "TikTok video upload failed: "+err.Error(), http.StatusBadGateway)
+				return
+			}
+		}
+
+		job := &models.TikTokPublishJob{
+			UserID:    userID,
+			DraftID:   nullIfEmpty(req.DraftID),
+			PublishID: initRes.PublishID,
+			PostMode:  postMode,
+			Source:    source,
+			Status:    "processing",
+		}
+		if req.WorkspaceID != "" {
+			job.WorkspaceID = &req.WorkspaceID
+		}
+		if err := createTikTokPublishJob(db, job); err != nil {
+			http.Error(w, "Failed to queue TikTok post", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "TikTok is processing the video",
+			"job_id":  job.ID,
+			"job":     job,
+		})
+	}
+}
+
+// tiktokChunkLayout splits a video into TikTok's chunk layout. Videos up to one chunk go
+// in a single request; otherwise the last chunk absorbs the remainder.
+func tiktokChunkLayout(size int64) (chunkSize, chunkCount int64) {
+	if size <= tiktokChunkSize {
+		return size, 1
+	}
+	return tiktokChunkSize, size / tiktokChunkSize
+}
+
+// uploadTikTokChunks PUTs the video to the upload URL chunk by chunk, retrying a failed
+// chunk from the source
+func uploadTikTokChunks(uploadURL string, src youtubeUploadSource, contentType string, size, chunkSize, chunkCount int64) error {
+	client := &http.Client{Timeout: 5 * time.Minute}
+	buf := make([]byte, 2*chunkSize)
+	for i := int64(0); i < chunkCount; i++ {
+		start := i * chunkSize
+		end := start + chunkSize
+		if i == chunkCount-1 {
+			end = size
+		}
+
+		var lastErr error
+		for attempt := 1; attempt <= tiktokChunkAttempts; attempt++ {
+			n, err := readYouTubeChunk(src, start, buf[:end-start])
+			if err != nil || int64(n) != end-start {
+				lastErr = fmt.Errorf("failed to read video at byte %d: %v", start, err)
+				continue
+			}
+			req, err := http.NewRequest("PUT", uploadURL, bytes.NewReader(buf[:n]))
+			if err != nil {
+				return err
+			}
+			req.ContentLength = int64(n)
+			req.Header.Set("Content-Type", contentType)
+			req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, size))
+			resp, err := client.Do(req)
+			if err != nil {
+				lastErr = err
+				time.Sleep(time.Duration(attempt) * time.Second)
+				continue
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusCreated || resp.StatusCode == http.StatusPartialContent || resp.StatusCode == http.StatusOK {
+				lastErr = nil
+				break
+			}
+			lastErr = fmt.Errorf("chunk %d/%d rejected (status %d): %s", i+1, chunkCount, resp.StatusCode, body)
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		if lastErr != nil {
+			return lastErr
+		}
+	}
+	return nil
+}
+
+// GetTikTokPostsHandler lists the creator's recent TikTok videos with their metrics
+func GetTikTokPostsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+		videos, err := fetchTikTokVideos(db, userID, 20)
+		if err != nil {
+			writeTikTokAccountError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": videos})
+	}
+}
+
+// GetTikTokAnalyticsHandler summarises views and engagement over recent TikTok videos
+func GetTikTokAnalyticsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+		videos, err := fetchTikTokVideos(db, userID, 20)
+		if err != nil {
+			writeTikTokAccountError(w, err)
+			return
+		}
+
+		totalViews, totalLikes, totalComments, totalShares := 0, 0, 0, 0
+		postsWithEngagement := []map[string]interface{}{}
+		for _, v := range videos {
+			views := intFromMap(v, "view_count")
+			likes := intFromMap(v, "like_count")
+			comments := intFromMap(v, "comment_count")
+			shares := intFromMap(v, "share_count")
+			totalViews += views
+			totalLikes += likes
+			totalComments += comments
+			totalShares += shares
+			postsWithEngagement = append(postsWithEngagement, map[string]interface{}{
+				"id":            v["id"],
+				"title":         v["title"],
+				"share_url":     v["share_url"],
+				"create_time":   v["create_time"],
+				"view_count":    views,
+				"like_count":    likes,
+				"comment_count": comments,
+				"share_count":   shares,
+				"engagement":    likes + comments + shares,
+			})
+		}
+
+		sort.SliceStable(postsWithEngagement, func(i, j int) bool {
+			return postsWithEngagement[i]["engagement"].(int) > postsWithEngagement[j]["engagement"].(int)
+		})
+		topN := 5
+		if len(postsWithEngagement) < topN {
+			topN = len(postsWithEngagement)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"totalPosts":    len(postsWithEngagement),
+			"totalViews":    totalViews,
+			"totalLikes":    totalLikes,
+			"totalComments": totalComments,
+			"totalShares":   totalShares,
+			"topPosts":      postsWithEngagement[:topN],
+			"totalClicks":   countUserLinkClicks(db, userID, "tiktok"),
+		})
+	}
+}
+
+const tiktokVideoFields = "id,title,video_description,create_time,cover_image_url,share_url,duration,view_count,like_count,comment_count,share_count"
+
+func fetchTikTokVideos(db *sql.DB, userID string, maxCount int) ([]map[string]interface{}, error) {
+	accessToken, _, err := tiktokAccessToken(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		Videos []map[string]interface{} `json:"videos"`
+	}
+	err = callTikTokAPI("POST", "/video/list/?fields="+tiktokVideoFields, accessToken, map[string]int{"max_count": maxCount}, &res)
+	if err != nil {
+		return nil, err
+	}
+	if res.Videos == nil {
+		res.Videos = []map[string]interface{}{}
+	}
+	return res.Videos, nil
+}
+
+// callTikTokAPI sends a request to the v2 API and decodes the "data" envelope into out.
+// TikTok reports failures in the "error" envelope, sometimes with a 200 status.
+func callTikTokAPI(method, path, accessToken string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, tiktokAPIBase+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+
+	var envelope struct {
+		Data  json.RawMessage `json:"data"`
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+			LogID   string `json:"log_id"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return fmt.Errorf("unexpected TikTok response (status %d): %s", resp.StatusCode, raw)
+	}
+	if envelope.Error.Code != "" && envelope.Error.Code != "ok" {
+		return fmt.Errorf("%s: %s (log id %s)", envelope.Error.Code, envelope.Error.Message, envelope.Error.LogID)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("TikTok API error (status %d): %s", resp.StatusCode, raw)
+	}
+	if out != nil && len(envelope.Data) > 0 {
+		return json.Unmarshal(envelope.Data, out)
+	}
+	return nil
+}
+
+func writeTikTokAccountError(w http.ResponseWriter, err error) {
+	if err == sql.ErrNoRows {
+		http.Error(w, "TikTok account not connected", http.StatusBadRequest)
+		return
+	}
+	http.Error(w, "TikTok API error: "+err.Error(), http.StatusBadGateway)
+}
+
+// remoteContentLength asks the server how large a file is
+func remoteContentLength(client *http.Client, fileURL string) (int64, error) {
+	resp, err := client.Head(fileURL)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ContentLength <= 0 {
+		return 0, fmt.Errorf("no content length (status %d)", resp.StatusCode)
+	}
+	return resp.ContentLength, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package controllers
+
+import "testing"
+
+func TestTikTokChunkLayout(t *testing.T) {
+	tests := []struct {
+		name          string
+		size          int64
+		wantChunkSize int64
+		wantCount     int64
+	}{
+		{"small video is one chunk", 1 << 20, 1 << 20, 1},
+		{"exactly one chunk", tiktokChunkSize, tiktokChunkSize, 1},
+		{"just over one chunk goes in the last chunk", tiktokChunkSize + 1, tiktokChunkSize, 1},
+		{"two chunks", 2 * tiktokChunkSize, tiktokChunkSize, 2},
+		{"remainder joins the last chunk", 2*tiktokChunkSize + tiktokChunkSize/2, tiktokChunkSize, 2},
+		{"large video", 100 * tiktokChunkSize, tiktokChunkSize, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunkSize, count := tiktokChunkLayout(tt.size)
+			if chunkSize != tt.wantChunkSize || count != tt.wantCount {
+				t.Errorf("tiktokChunkLayout(%d) = (%d, %d), want (%d, %d)", tt.size, chunkSize, count, tt.wantChunkSize, tt.wantCount)
+			}
+			// The last chunk takes the remainder and must stay within TikTok's 128MB cap
+			if last := tt.size - (count-1)*chunkSize; last > 128<<20 {
+				t.Errorf("last chunk is %d bytes", last)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	tiktokCheckInterval = 10 * time.Second
+	// TikTok can take a while to download and moderate longer videos
+	tiktokMaxChecks = 120
+)
+
+const tiktokJobColumns = `
+	id, user_id, workspace_id, draft_id, publish_id, post_mode, source, status, tiktok_status,
+	post_id, share_url, checks, next_check_at, error, created_at, updated_at`
+
+// GetTikTokPublishJobHandler reports the progress of a queued TikTok post
+func GetTikTokPublishJobHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		row := db.QueryRow(`SELECT `+tiktokJobColumns+` FROM tiktok_publish_jobs WHERE id = $1 AND user_id = $2`,
+			mux.Vars(r)["jobId"], userID)
+		job, err := scanTikTokPublishJob(row)
+		if err == sql.ErrNoRows {
+			http.Error(w, "TikTok post not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch TikTok post", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(job)
+	}
+}
+
+// ProcessTikTokPublishJobs polls the publish status of every due TikTok post.
+// It runs from the cron in main.go.
+func ProcessTikTokPublishJobs(db *sql.DB) {
+	rows, err := db.Query(`
+		SELECT ` + tiktokJobColumns + `
+		FROM tiktok_publish_jobs
+		WHERE status = 'processing' AND next_check_at <= now()
+		ORDER BY next_check_at
+		LIMIT 25
+	`)
+	if err != nil {
+		log.Println("Failed to load TikTok publish jobs:", err)
+		return
+	}
+	var jobs []*models.TikTokPublishJob
+	for rows.Next() {
+		job, err := scanTikTokPublishJob(rows)
+		if err != nil {
+			log.Println("Failed to scan TikTok publish job:", err)
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	rows.Close()
+
+	for _, job := range jobs {
+		advanceTikTokPublishJob(db, job)
+	}
+}
+
+func advanceTikTokPublishJob(db *sql.DB, job *models.TikTokPublishJob) {
+	accessToken, _, err := tiktokAccessToken(db, job.UserID)
+	if err != nil {
+		failTikTokPublishJob(db, job, fmt.Errorf("TikTok account unavailable: %v", err))
+		return
+	}
+
+	var status struct {
+		Status     string  `json:"status"`
+		FailReason string  `json:"fail_reason"`
+		PostIDs    []int64 `json:"publicaly_available_post_id"` // sic, TikTok's spelling
+	}
+	err = callTikTokAPI("POST", "/post/publish/status/fetch/", accessToken, map[string]string{"publish_id": job.PublishID}, &status)
+	if err != nil {
+		retryTikTokPublishJob(db, job, err)
+		return
+	}
+	job.TikTokStatus = &status.Status
+
+	switch status.Status {
+	case "FAILED":
+		failTikTokPublishJob(db, job, fmt.Errorf("TikTok rejected the video: %s", status.FailReason))
+
+	case "SEND_TO_USER_INBOX":
+		job.Status = "sent_to_inbox"
+		saveTikTokPublishJob(db, job)
+
+	case "PUBLISH_COMPLETE":
+		job.Status = "published"
+		// Private and under-review posts complete without a public id
+		if len(status.PostIDs) > 0 {
+			postID := strconv.FormatInt(status.PostIDs[0], 10)
+			job.PostID = &postID
+			if shareURL := fetchTikTokShareURL(accessToken, postID); shareURL != "" {
+				job.ShareURL = &shareURL
+			}
+			recordPublishedPost(db, derefString(job.DraftID), "tiktok", job.UserID, postID, derefString(job.ShareURL))
+		}
+		saveTikTokPublishJob(db, job)
+
+	default:
+		// PROCESSING_UPLOAD or PROCESSING_DOWNLOAD
+		retryTikTokPublishJob(db, job, nil)
+	}
+}
+
+func fetchTikTokShareURL(accessToken, postID string) string {
+	var res struct {
+		Videos []struct {
+			ShareURL string `json:"share_url"`
+		} `json:"videos"`
+	}
+	body := map[string]interface{}{"filters": map[string][]string{"video_ids": {postID}}}
+	if err := callTikTokAPI("POST", "/video/query/?fields=id,share_url", accessToken, body, &res); err != nil {
+		log.Printf("Failed to fetch share URL for TikTok video %s: %v", postID, err)
+		return ""
+	}
+	if len(res.Videos) == 0 {
+		return ""
+	}
+	return res.Videos[0].ShareURL
+}
+
+// retryTikTokPublishJob schedules another status check, giving up after tiktokMaxChecks
+func retryTikTokPublishJob(db *sql.DB, job *models.TikTokPublishJob, checkErr error) {
+	job.Checks++
+	if job.Checks >= tiktokMaxChecks {
+		failTikTokPublishJob(db, job, fmt.Errorf("video not published after %d checks", job.Checks))
+		return
+	}
+	if checkErr != nil {
+		log.Printf("TikTok publish job %s status check failed: %v", job.ID, checkErr)
+	}
+	job.NextCheckAt = time.Now().Add(tiktokCheckInterval)
+	saveTikTokPublishJob(db, job)
+}
+
+func failTikTokPublishJob(db *sql.DB, job *models.TikTokPublishJob, err error) {
+	log.Printf("TikTok publish job %s failed: %v", job.ID, err)
+	msg := err.Error()
+	job.Status = "failed"
+	job.Error = &msg
+	saveTikTokPublishJob(db, job)
+}
+
+func createTikTokPublishJob(db *sql.DB, job *models.TikTokPublishJob) error {
+	return db.QueryRow(`
+		INSERT INTO tiktok_publish_jobs (user_id, workspace_id, draft_id, publish_id, post_mode, source, status, next_check_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, now() + interval '5 seconds')
+		RETURNING id, next_check_at, created_at, updated_at
+	`, job.UserID, job.WorkspaceID, job.DraftID, job.PublishID, job.PostMode, job.Source, job.Status).
+		Scan(&job.ID, &job.NextCheckAt, &job.CreatedAt, &job.UpdatedAt)
+}
+
+// saveTikTokPublishJob persists the job and broadcasts its status to the workspace
+func saveTikTokPublishJob(db *sql.DB, job *models.TikTokPublishJob) {
+	_, err := db.Exec(`
+		UPDATE tiktok_publish_jobs
+		SET status = $1, tiktok_status = $2, post_id = $3, share_url = $4, checks = $5, next_check_at = $6,
+		    error = $7, updated_at = now()
+		WHERE id = $8
+	`, job.Status, job.TikTokStatus, job.PostID, job.ShareURL, job.Checks, job.NextCheckAt, job.Error, job.ID)
+	if err != nil {
+		log.Printf("Failed to save TikTok publish job %s: %v", job.ID, err)
+	}
+
+	if job.WorkspaceID == nil {
+		return
+	}
+	msg, _ := json.Marshal(map[string]interface{}{
+		"type":     "tiktok_publish_status",
+		"jobId":    job.ID,
+		"draftId":  job.DraftID,
+		"status":   job.Status,
+		"shareUrl": job.ShareURL,
+		"error":    job.Error,
+	})
+	hub.broadcast(*job.WorkspaceID, websocket.TextMessage, msg)
+}
+
+func scanTikTokPublishJob(row rowScanner) (*models.TikTokPublishJob, error) {
+	var j models.TikTokPublishJob
+	err := row.Scan(&j.ID, &j.UserID, &j.WorkspaceID, &j.DraftID, &j.PublishID, &j.PostMode, &j.Source, &j.Status,
+		&j.TikTokStatus, &j.PostID, &j.ShareURL, &j.Checks, &j.NextCheckAt, &j.Error, &j.CreatedAt, &j.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
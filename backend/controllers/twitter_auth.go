@@ -49,7 +49,8 @@ func getTwitterOAuthConfig() *oauth2.Config {
 		RedirectURL:  redirectURL,
 		// If you want email, uncomment the next line and ensure your app is approved for users.email
 		// Scopes:       []string{"tweet.read", "tweet.write", "users.read", "users.email"},
-		Scopes: []string{"tweet.read", "tweet.write", "users.read"},
+		// media.write for attachments, offline.access for a refresh token so scheduled posts keep working
+		Scopes: []string{"tweet.read", "tweet.write", "users.read", "media.write", "offline.access"},
 		Endpoint: oauth2.Endpoint{
 			AuthURL:  "https://twitter.com/i/oauth2/authorize",
 			TokenURL: "https://api.twitter.com/2/oauth2/token",
@@ -2,19 +2,48 @@ package controllers
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
+	"social-sync-backend/lib"
 	"social-sync-backend/middleware"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	twitterAPIBase    = "https://api.twitter.com/2"
+	twitterCharLimit  = 280
+	twitterChunkSize  = 4 << 20 // 4MB per APPEND segment
+	twitterMaxImages  = 4
+	twitterStatusWait = 5 * time.Minute
+	// X's upload limits per media category
+	twitterMaxImageBytes = 5 << 20
+	twitterMaxGIFBytes   = 15 << 20
+	twitterMaxVideoBytes = 512 << 20
+	// twitterDownloadTimeout allows for fetching a video of up to twitterMaxVideoBytes
+	twitterDownloadTimeout = 5 * time.Minute
 )
 
 type TwitterPostRequest struct {
-	Message string `json:"message"`
+	Message   string   `json:"message"`
+	DraftID   string   `json:"draftId"`   // optional; links the post to a draft for later edit/delete
+	MediaUrls []string `json:"mediaUrls"` // up to 4 images, or a single video or GIF
+	AltTexts  []string `json:"altTexts"`  // alt text per media URL, in the same order
+	Thread    []string `json:"thread"`    // follow-up tweets, each a reply to the previous one
+	ReplyToID string   `json:"replyToId"` // optional tweet the first tweet replies to
 }
 
 type TwitterPostResponse struct {
@@ -29,6 +58,17 @@ type TwitterErrorResponse struct {
 		Message string `json:"message"`
 		Code    int    `json:"code"`
 	} `json:"errors"`
+	Detail string `json:"detail"`
+}
+
+// twitterAPIError is a failed X API call, already mapped to a user-facing message
+type twitterAPIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *twitterAPIError) Error() string {
+	return e.Message
 }
 
 func PostToTwitterHandler(db *sql.DB) http.HandlerFunc {
@@ -52,280 +92,596 @@ func PostToTwitterHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Check Twitter character limit (280 characters)
-		if len(message) > 280 {
-			http.Error(w, "Message exceeds Twitter's 280 character limit", http.StatusBadRequest)
-			return
+		// Check Twitter character limit (280 characters) for every tweet in the thread
+		tweets := []string{message}
+		for _, t := range req.Thread {
+			if t = strings.TrimSpace(t); t != "" {
+				tweets = append(tweets, t)
+			}
 		}
-
-		// Get Twitter account details
-		var accessToken string
-		var tokenExpiry *time.Time
-		var refreshToken *string
-
-		err = db.QueryRow(`
-			SELECT access_token, access_token_expires_at, refresh_token
-			FROM social_accounts
-			WHERE user_id = $1 AND platform = 'twitter'
-		`, userID).Scan(&accessToken, &tokenExpiry, &refreshToken)
-
-		if err != nil {
-			if err == sql.ErrNoRows {
-				http.Error(w, "Twitter account not connected", http.StatusBadRequest)
+		for i, t := range tweets {
+			if utf8.RuneCountInString(t) > twitterCharLimit {
+				if i == 0 {
+					http.Error(w, "Message exceeds Twitter's 280 character limit", http.StatusBadRequest)
+				} else {
+					http.Error(w, fmt.Sprintf("Thread tweet %d exceeds Twitter's 280 character limit", i), http.StatusBadRequest)
+				}
 				return
 			}
-			http.Error(w, "Failed to retrieve Twitter account", http.StatusInternalServerError)
-			return
 		}
 
-		// Debug: Print the access token (first 10 chars for privacy)
-		fmt.Printf("DEBUG: Twitter access token (first 10 chars): %s\n", accessToken[:10])
-		fmt.Printf("DEBUG: Twitter message content: %q\n", message)
-
-		// Check if token is expired (if expiry is set)
-		if tokenExpiry != nil && time.Now().After(*tokenExpiry) {
-			// In a production app, you'd refresh the token here
-			// For now, we'll return an error
-			http.Error(w, "Twitter access token has expired. Please reconnect your account.", http.StatusUnauthorized)
+		if len(req.MediaUrls) > twitterMaxImages {
+			http.Error(w, "Twitter allows at most 4 media items per tweet", http.StatusBadRequest)
 			return
 		}
 
-		// Prepare tweet payload
-		tweetPayload := map[string]interface{}{
-			"text": message,
-		}
-
-		payloadBytes, err := json.Marshal(tweetPayload)
-		if err != nil {
-			http.Error(w, "Failed to prepare tweet payload", http.StatusInternalServerError)
+		// Get Twitter account details, refreshing the token if it has expired
+		accessToken, _, err := twitterAccessToken(db, userID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Twitter account not connected", http.StatusBadRequest)
 			return
 		}
-
-		// Debug: Print the payload being sent
-		fmt.Printf("DEBUG: Twitter payload: %s\n", string(payloadBytes))
-
-		// Create HTTP request to Twitter API
-		tweetURL := "https://api.twitter.com/2/tweets"
-		req_twitter, err := http.NewRequest("POST", tweetURL, bytes.NewBuffer(payloadBytes))
 		if err != nil {
-			http.Error(w, "Failed to create request", http.StatusInternalServerError)
+			fmt.Printf("DEBUG: Twitter token error: %v\n", err)
+			http.Error(w, "Twitter access token has expired. Please reconnect your account.", http.StatusUnauthorized)
 			return
 		}
 
-		// Set headers - Use OAuth 2.0 Bearer token
-		req_twitter.Header.Set("Content-Type", "application/json")
-		req_twitter.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
-		req_twitter.Header.Set("User-Agent", "SocialSync/1.0")
-		req_twitter.Header.Set("Accept", "application/json")
-
-		// Debug: Print request details
-		fmt.Printf("DEBUG: Twitter request URL: %s\n", tweetURL)
-		fmt.Printf("DEBUG: Twitter request headers: %v\n", req_twitter.Header)
+		fmt.Printf("DEBUG: Twitter message content: %q (%d tweet(s), %d media)\n", message, len(tweets), len(req.MediaUrls))
 
-		// Make the request
 		client := &http.Client{
 			Timeout: 30 * time.Second,
 		}
 
-		// Simple retry mechanism
-		var resp *http.Response
-		for attempt := 1; attempt <= 2; attempt++ {
-			resp, err = client.Do(req_twitter)
+		// Upload attachments for the first tweet, using the X renditions of library media
+		req.MediaUrls = renditionURLs(req.MediaUrls, "twitter", "post")
+		var mediaIDs []string
+		hasVideo := false
+		for i, mediaURL := range req.MediaUrls {
+			altText := ""
+			if i < len(req.AltTexts) {
+				altText = strings.TrimSpace(req.AltTexts[i])
+			}
+			mediaID, category, err := uploadTwitterMedia(client, accessToken, mediaURL, altText)
 			if err != nil {
-				if attempt == 2 {
+				fmt.Printf("DEBUG: Twitter media upload failed: %v\n", err)
+				http.Error(w, fmt.Sprintf("Failed to upload media to Twitter: %v", err), http.StatusBadGateway)
+				return
+			}
+			if category != "tweet_image" {
+				hasVideo = true
+			}
+			mediaIDs = append(mediaIDs, mediaID)
+		}
+		if hasVideo && len(mediaIDs) > 1 {
+			http.Error(w, "Twitter allows a single video or GIF per tweet, without other media", http.StatusBadRequest)
+			return
+		}
+
+		// Each tweet after the first replies to the one before it
+		replyTo := req.ReplyToID
+		var posted []TwitterPostResponse
+		var threadErr error
+		for i, text := range tweets {
+			tweetPayload := map[string]interface{}{
+				"text": text,
+			}
+			if replyTo != "" {
+				tweetPayload["reply"] = map[string]string{"in_reply_to_tweet_id": replyTo}
+			}
+			if i == 0 && len(mediaIDs) > 0 {
+				tweetPayload["media"] = map[string]interface{}{"media_ids": mediaIDs}
+			}
+
+			tweet, err := postTweet(client, accessToken, tweetPayload)
+			if err != nil {
+				if i == 0 {
+					if apiErr, ok := err.(*twitterAPIError); ok {
+						http.Error(w, apiErr.Message, apiErr.StatusCode)
+						return
+					}
 					http.Error(w, "Failed to publish tweet", http.StatusInternalServerError)
 					return
 				}
-				time.Sleep(2 * time.Second)
-				continue
+				threadErr = err
+				break
 			}
+			posted = append(posted, *tweet)
+			replyTo = tweet.Data.ID
+		}
 
-			// If we get a 500 error, retry once
-			if resp.StatusCode == 500 && attempt == 1 {
-				fmt.Printf("DEBUG: Twitter API 500 error, retrying...\n")
-				resp.Body.Close()
-				time.Sleep(2 * time.Second)
-				continue
+		first := posted[0]
+		tweetIDs := make([]string, 0, len(posted))
+		for _, tweet := range posted {
+			tweetIDs = append(tweetIDs, tweet.Data.ID)
+		}
+		recordPublishedThread(db, req.DraftID, "twitter", userID, tweetIDs, "https://x.com/i/web/status/"+first.Data.ID)
+
+		// Return success with tweet ID
+		response := map[string]interface{}{
+			"message":    "Tweet published successfully",
+			"tweetId":    first.Data.ID,
+			"text":       first.Data.Text,
+			"mediaCount": len(mediaIDs),
+		}
+		if len(tweets) > 1 {
+			thread := make([]string, 0, len(posted))
+			for _, t := range posted {
+				thread = append(thread, t.Data.ID)
 			}
+			response["thread"] = thread
+		}
 
-			break
+		w.Header().Set("Content-Type", "application/json")
+		if threadErr != nil {
+			// The first tweet is live, so report what was posted along with the failure
+			response["message"] = fmt.Sprintf("Thread partially published (%d of %d tweets)", len(posted), len(tweets))
+			response["error"] = threadErr.Error()
+			w.WriteHeader(http.StatusBadGateway)
+		} else {
+			w.WriteHeader(http.StatusOK)
 		}
-		defer resp.Body.Close()
+		json.NewEncoder(w).Encode(response)
+	}
+}
 
-		// Handle response
-		if resp.StatusCode == http.StatusCreated {
-			// Success - Tweet posted
-			var twitterResp TwitterPostResponse
-			if err := json.NewDecoder(resp.Body).Decode(&twitterResp); err != nil {
-				// Even if we can't decode response, the tweet was posted successfully
-				w.WriteHeader(http.StatusOK)
-				w.Write([]byte("Tweet published successfully"))
-				return
+// postTweet creates one tweet, retrying once on a Twitter 500
+func postTweet(client *http.Client, accessToken string, payload map[string]interface{}) (*TwitterPostResponse, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("DEBUG: Twitter payload: %s\n", string(payloadBytes))
+
+	var resp *http.Response
+	for attempt := 1; attempt <= 2; attempt++ {
+		req, err := http.NewRequest("POST", twitterAPIBase+"/tweets", bytes.NewReader(payloadBytes))
+		if err != nil {
+			return nil, err
+		}
+		// Set headers - Use OAuth 2.0 Bearer token
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+		req.Header.Set("User-Agent", "SocialSync/1.0")
+		req.Header.Set("Accept", "application/json")
+
+		resp, err = client.Do(req)
+		if err != nil {
+			if attempt == 2 {
+				return nil, err
 			}
+			time.Sleep(2 * time.Second)
+			continue
+		}
+
+		// If we get a 500 error, retry once
+		if resp.StatusCode == 500 && attempt == 1 {
+			fmt.Printf("DEBUG: Twitter API 500 error, retrying...\n")
+			resp.Body.Close()
+			time.Sleep(2 * time.Second)
+			continue
+		}
+		break
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+
+	if resp.StatusCode == http.StatusCreated {
+		var tweet TwitterPostResponse
+		if err := json.Unmarshal(bodyBytes, &tweet); err != nil {
+			return nil, fmt.Errorf("tweet posted but the response could not be read: %v", err)
+		}
+		return &tweet, nil
+	}
+
+	fmt.Printf("DEBUG: Twitter API response status: %d, body: %s\n", resp.StatusCode, string(bodyBytes))
+	return nil, newTwitterAPIError(resp.StatusCode, bodyBytes)
+}
+
+// newTwitterAPIError maps an X API error response to a user-facing message
+func newTwitterAPIError(status int, body []byte) *twitterAPIError {
+	switch {
+	case status == 500:
+		// Twitter API internal server error - this is usually temporary
+		return &twitterAPIError{http.StatusServiceUnavailable, "Twitter API is experiencing temporary issues. Please try again in a few minutes."}
+	case status == 429:
+		return &twitterAPIError{http.StatusTooManyRequests, "Twitter API rate limit exceeded. Please wait a moment before trying again."}
+	case status == 400 && (strings.Contains(string(body), "cloudflare") || strings.Contains(string(body), "400 Bad Request")):
+		return &twitterAPIError{http.StatusBadRequest, "Twitter API request was blocked. This might be due to rate limiting or temporary issues. Please try again later."}
+	case strings.Contains(string(body), "The string did not match the expected pattern"):
+		// This error often occurs when the text format is invalid
+		return &twitterAPIError{http.StatusBadRequest, "Invalid tweet text format. Please check for special characters or formatting issues."}
+	}
+
+	var errorResp TwitterErrorResponse
+	if err := json.Unmarshal(body, &errorResp); err != nil {
+		return &twitterAPIError{status, fmt.Sprintf("Twitter API error (status: %d, body: %s)", status, string(body))}
+	}
+	if len(errorResp.Errors) > 0 {
+		return &twitterAPIError{status, fmt.Sprintf("Twitter API error: %s", errorResp.Errors[0].Message)}
+	}
+	if errorResp.Detail != "" {
+		return &twitterAPIError{status, fmt.Sprintf("Twitter API error: %s", errorResp.Detail)}
+	}
+	return &twitterAPIError{status, "Unknown Twitter API error"}
+}
+
+// twitterAccessToken returns a usable access token and the X user ID for a user,
+// refreshing and saving the token when it has expired
+func twitterAccessToken(db *sql.DB, userID string) (string, string, error) {
+	var accessToken, socialID string
+	var tokenExpiry *time.Time
+	var refreshToken sql.NullString
+	err := db.QueryRow(`
+		SELECT access_token, access_token_expires_at, refresh_token, social_id
+		FROM social_accounts
+		WHERE user_id = $1 AND platform = 'twitter'
+	`, userID).Scan(&accessToken, &tokenExpiry, &refreshToken, &socialID)
+	if err != nil {
+		return "", "", err
+	}
+
+	if tokenExpiry == nil || time.Now().Before(*tokenExpiry) {
+		return accessToken, socialID, nil
+	}
+	if !refreshToken.Valid || refreshToken.String == "" {
+		return "", "", fmt.Errorf("twitter access token expired and no refresh token is stored")
+	}
+
+	// X rotates refresh tokens, so both tokens are saved
+	token, err := getTwitterOAuthConfig().TokenSource(context.Background(), &oauth2.Token{
+		RefreshToken: refreshToken.String,
+		Expiry:       time.Now().Add(-time.Minute),
+	}).Token()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to refresh twitter token: %v", err)
+	}
+
+	var expiresAt *time.Time
+	if !token.Expiry.IsZero() {
+		expiresAt = &token.Expiry
+	}
+	_, err = db.Exec(`
+		UPDATE social_accounts
+		SET access_token = $1, access_token_expires_at = $2, refresh_token = $3, last_synced_at = NOW()
+		WHERE user_id = $4 AND platform = 'twitter'
+	`, token.AccessToken, expiresAt, token.RefreshToken, userID)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to save refreshed twitter token: %v", err)
+	}
+	return token.AccessToken, socialID, nil
+}
+
+// uploadTwitterMedia uploads a media URL through the chunked INIT/APPEND/FINALIZE flow,
+// waits for video processing and sets alt text. It returns the media ID and category.
+func uploadTwitterMedia(client *http.Client, accessToken, mediaURL, altText string) (string, string, error) {
+	// Download to a temp file first: INIT needs the total size and videos can be large.
+	// The URL comes from the client, so only public addresses are fetched.
+	resp, err := lib.PublicHTTPClient(twitterDownloadTimeout).Get(mediaURL)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to download media: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("failed to download media: status %d", resp.StatusCode)
+	}
+
+	tmp, err := os.CreateTemp("", "twitter-media-*")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// One byte over the largest limit is enough to tell the file is too big
+	size, err := io.Copy(tmp, io.LimitReader(resp.Body, twitterMaxVideoBytes+1))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to download media: %v", err)
+	}
+
+	mediaType := resp.Header.Get("Content-Type")
+	if mediaType == "" || mediaType == "application/octet-stream" {
+		head := make([]byte, 512)
+		n, _ := tmp.ReadAt(head, 0)
+		mediaType = http.DetectContentType(head[:n])
+	}
+	mediaType = strings.TrimSpace(strings.Split(mediaType, ";")[0])
+
+	category, maxBytes := "tweet_image", int64(twitterMaxImageBytes)
+	switch {
+	case mediaType == "image/gif":
+		category, maxBytes = "tweet_gif", twitterMaxGIFBytes
+	case strings.HasPrefix(mediaType, "video/"):
+		category, maxBytes = "tweet_video", twitterMaxVideoBytes
+	case !strings.HasPrefix(mediaType, "image/"):
+		return "", "", fmt.Errorf("unsupported media type %s", mediaType)
+	}
+	if size > maxBytes {
+		return "", "", fmt.Errorf("media is larger than X's %dMB limit for %s", maxBytes>>20, strings.TrimPrefix(category, "tweet_"))
+	}
+
+	// INIT
+	var initResp struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	initBody, _ := json.Marshal(map[string]interface{}{
+		"media_type":     mediaType,
+		"total_bytes":    size,
+		"media_category": category,
+	})
+	if err := twitterMediaRequest(client, accessToken, "POST", twitterAPIBase+"/media/upload/initialize", "application/json", bytes.NewReader(initBody), &initResp); err != nil {
+		return "", "", fmt.Errorf("INIT failed: %v", err)
+	}
+	mediaID := initResp.Data.ID
+	if mediaID == "" {
+		return "", "", fmt.Errorf("INIT returned no media ID")
+	}
 
-			// Return success with tweet ID
-			response := map[string]interface{}{
-				"message": "Tweet published successfully",
-				"tweetId": twitterResp.Data.ID,
-				"text":    twitterResp.Data.Text,
+	// APPEND
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", "", err
+	}
+	chunk := make([]byte, twitterChunkSize)
+	for segment := 0; ; segment++ {
+		n, readErr := io.ReadFull(tmp, chunk)
+		if n == 0 {
+			break
+		}
+
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		writer.WriteField("segment_index", strconv.Itoa(segment))
+		part, err := writer.CreateFormFile("media", "chunk")
+		if err != nil {
+			return "", "", err
+		}
+		part.Write(chunk[:n])
+		writer.Close()
+
+		appendURL := fmt.Sprintf("%s/media/upload/%s/append", twitterAPIBase, mediaID)
+		if err := twitterMediaRequest(client, accessToken, "POST", appendURL, writer.FormDataContentType(), &body, nil); err != nil {
+			return "", "", fmt.Errorf("APPEND segment %d failed: %v", segment, err)
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return "", "", readErr
+		}
+	}
+
+	// FINALIZE
+	var status twitterMediaStatus
+	finalizeURL := fmt.Sprintf("%s/media/upload/%s/finalize", twitterAPIBase, mediaID)
+	if err := twitterMediaRequest(client, accessToken, "POST", finalizeURL, "", nil, &status); err != nil {
+		return "", "", fmt.Errorf("FINALIZE failed: %v", err)
+	}
+
+	// Videos and GIFs are processed asynchronously
+	deadline := time.Now().Add(twitterStatusWait)
+	for status.Data.ProcessingInfo != nil {
+		info := status.Data.ProcessingInfo
+		if info.State == "succeeded" {
+			break
+		}
+		if info.State == "failed" {
+			msg := "processing failed"
+			if info.Error != nil && info.Error.Message != "" {
+				msg = info.Error.Message
 			}
+			return "", "", fmt.Errorf("media %s: %s", mediaID, msg)
+		}
+		if time.Now().After(deadline) {
+			return "", "", fmt.Errorf("media %s still processing after %s", mediaID, twitterStatusWait)
+		}
+		wait := time.Duration(info.CheckAfterSecs) * time.Second
+		if wait <= 0 {
+			wait = 2 * time.Second
+		}
+		time.Sleep(wait)
 
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(response)
-			return
+		statusURL := fmt.Sprintf("%s/media/upload?command=STATUS&media_id=%s", twitterAPIBase, url.QueryEscape(mediaID))
+		status = twitterMediaStatus{}
+		if err := twitterMediaRequest(client, accessToken, "GET", statusURL, "", nil, &status); err != nil {
+			return "", "", fmt.Errorf("STATUS failed: %v", err)
+		}
+	}
+
+	if altText != "" {
+		metaBody, _ := json.Marshal(map[string]interface{}{
+			"id": mediaID,
+			"metadata": map[string]interface{}{
+				"alt_text": map[string]string{"text": altText},
+			},
+		})
+		if err := twitterMediaRequest(client, accessToken, "POST", twitterAPIBase+"/media/metadata", "application/json", bytes.NewReader(metaBody), nil); err != nil {
+			// The media is still usable without alt text
+			fmt.Printf("DEBUG: Failed to set Twitter alt text for %s: %v\n", mediaID, err)
 		}
+	}
+
+	return mediaID, category, nil
+}
+
+type twitterMediaStatus struct {
+	Data struct {
+		ID             string `json:"id"`
+		ProcessingInfo *struct {
+			State          string `json:"state"` // pending, in_progress, succeeded, failed
+			CheckAfterSecs int    `json:"check_after_secs"`
+			Error          *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"processing_info"`
+	} `json:"data"`
+}
+
+// twitterMediaRequest calls a media upload endpoint and decodes the JSON reply into out, if given
+func twitterMediaRequest(client *http.Client, accessToken, method, endpoint, contentType string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
 
-		// Handle errors
-		fmt.Printf("DEBUG: Twitter API response status: %d\n", resp.StatusCode)
+	// Uploads can take longer than the default tweet timeout
+	uploadClient := *client
+	uploadClient.Timeout = 2 * time.Minute
+	resp, err := uploadClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return newTwitterAPIError(resp.StatusCode, respBody)
+	}
+	if out != nil && len(respBody) > 0 {
+		return json.Unmarshal(respBody, out)
+	}
+	return nil
+}
 
-		// Read the full response body for debugging
-		bodyBytes, err := io.ReadAll(resp.Body)
+// GetTwitterPostsHandler fetches the user's recent tweets with metrics and media
+func GetTwitterPostsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to read response body: %v", err), resp.StatusCode)
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
 			return
 		}
 
-		fmt.Printf("DEBUG: Twitter API response body: %s\n", string(bodyBytes))
+		tweetsResp, err := fetchRecentTweets(db, userID, 20)
+		if err != nil {
+			writeTwitterFetchError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tweetsResp)
+	}
+}
 
-		// Handle specific error cases
-		if resp.StatusCode == 500 {
-			// Twitter API internal server error - this is usually temporary
-			http.Error(w, "Twitter API is experiencing temporary issues. Please try again in a few minutes.", http.StatusServiceUnavailable)
+// GetTwitterAnalyticsHandler aggregates engagement over the user's recent tweets
+func GetTwitterAnalyticsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
 			return
 		}
 
-		if resp.StatusCode == 429 {
-			// Rate limiting
-			http.Error(w, "Twitter API rate limit exceeded. Please wait a moment before trying again.", http.StatusTooManyRequests)
+		tweetsResp, err := fetchRecentTweets(db, userID, 40)
+		if err != nil {
+			writeTwitterFetchError(w, err)
 			return
 		}
 
-		if resp.StatusCode == 400 {
-			// Check if it's a Cloudflare response
-			if strings.Contains(string(bodyBytes), "cloudflare") || strings.Contains(string(bodyBytes), "400 Bad Request") {
-				http.Error(w, "Twitter API request was blocked. This might be due to rate limiting or temporary issues. Please try again later.", http.StatusBadRequest)
-				return
+		tweets, _ := tweetsResp["data"].([]interface{})
+		totalLikes, totalRetweets, totalReplies, totalQuotes, totalImpressions := 0, 0, 0, 0, 0
+		postsWithEngagement := []map[string]interface{}{}
+		for _, t := range tweets {
+			tweet, ok := t.(map[string]interface{})
+			if !ok {
+				continue
 			}
+			metrics, _ := tweet["public_metrics"].(map[string]interface{})
+			likes := intFromMap(metrics, "like_count")
+			retweets := intFromMap(metrics, "retweet_count")
+			replies := intFromMap(metrics, "reply_count")
+			quotes := intFromMap(metrics, "quote_count")
+			impressions := intFromMap(metrics, "impression_count")
+			totalLikes += likes
+			totalRetweets += retweets
+			totalReplies += replies
+			totalQuotes += quotes
+			totalImpressions += impressions
+			postsWithEngagement = append(postsWithEngagement, map[string]interface{}{
+				"id":               tweet["id"],
+				"text":             tweet["text"],
+				"created_at":       tweet["created_at"],
+				"like_count":       likes,
+				"retweet_count":    retweets,
+				"reply_count":      replies,
+				"quote_count":      quotes,
+				"impression_count": impressions,
+				"engagement":       likes + retweets + replies + quotes,
+			})
 		}
 
-		// Check for specific error patterns
-		if strings.Contains(string(bodyBytes), "The string did not match the expected pattern") {
-			// This error often occurs when the text format is invalid
-			http.Error(w, "Invalid tweet text format. Please check for special characters or formatting issues.", http.StatusBadRequest)
-			return
+		sort.SliceStable(postsWithEngagement, func(i, j int) bool {
+			return postsWithEngagement[i]["engagement"].(int) > postsWithEngagement[j]["engagement"].(int)
+		})
+		topN := 5
+		if len(postsWithEngagement) < topN {
+			topN = len(postsWithEngagement)
 		}
 
-		var errorResp TwitterErrorResponse
-		if err := json.Unmarshal(bodyBytes, &errorResp); err != nil {
-			http.Error(w, fmt.Sprintf("Twitter API error (status: %d, body: %s)", resp.StatusCode, string(bodyBytes)), resp.StatusCode)
-			return
+		result := map[string]interface{}{
+			"totalPosts":       len(postsWithEngagement),
+			"totalLikes":       totalLikes,
+			"totalRetweets":    totalRetweets,
+			"totalReplies":     totalReplies,
+			"totalQuotes":      totalQuotes,
+			"totalImpressions": totalImpressions,
+			"topPosts":         postsWithEngagement[:topN],
+			"totalClicks":      countUserLinkClicks(db, userID, "twitter"),
 		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
 
-		// Return specific error message
-		if len(errorResp.Errors) > 0 {
-			errorMsg := errorResp.Errors[0].Message
-			http.Error(w, fmt.Sprintf("Twitter API error: %s", errorMsg), resp.StatusCode)
-			return
-		}
+// fetchRecentTweets returns the raw /users/{id}/tweets response with metrics and media expanded
+func fetchRecentTweets(db *sql.DB, userID string, limit int) (map[string]interface{}, error) {
+	accessToken, twitterUserID, err := twitterAccessToken(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tweetsURL := fmt.Sprintf("%s/users/%s/tweets?max_results=%d&tweet.fields=public_metrics,created_at,attachments,conversation_id&expansions=attachments.media_keys&media.fields=preview_image_url,url,type,alt_text",
+		twitterAPIBase, url.PathEscape(twitterUserID), limit)
+	req, err := http.NewRequest("GET", tweetsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 
-		http.Error(w, "Unknown Twitter API error", resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, newTwitterAPIError(resp.StatusCode, body)
 	}
+	var tweetsResp map[string]interface{}
+	if err := json.Unmarshal(body, &tweetsResp); err != nil {
+		return nil, fmt.Errorf("failed to decode Twitter posts: %v", err)
+	}
+	return tweetsResp, nil
 }
 
-// GetTwitterPostsHandler fetches the user's recent tweets with metrics and media
-// func GetTwitterPostsHandler(db *sql.DB) http.HandlerFunc {
-// 	return func(w http.ResponseWriter, r *http.Request) {
-// 		userID, err := middleware.GetUserIDFromContext(r)
-// 		if err != nil {
-// 			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
-// 			return
-// 		}
-
-// 		// Get Twitter access token
-// 		var accessToken string
-// 		var tokenExpiry *time.Time
-// 		var refreshToken *string
-// 		err = db.QueryRow(`
-// 			SELECT access_token, access_token_expires_at, refresh_token
-// 			FROM social_accounts
-// 			WHERE user_id = $1 AND platform = 'twitter'
-// 		`, userID).Scan(&accessToken, &tokenExpiry, &refreshToken)
-// 		if err != nil {
-// 			if err == sql.ErrNoRows {
-// 				http.Error(w, "Twitter account not connected", http.StatusBadRequest)
-// 				return
-// 			}
-// 			http.Error(w, "Failed to retrieve Twitter account", http.StatusInternalServerError)
-// 			return
-// 		}
-// 		if tokenExpiry != nil && time.Now().After(*tokenExpiry) {
-// 			http.Error(w, "Twitter access token has expired. Please reconnect your account.", http.StatusUnauthorized)
-// 			return
-// 		}
-
-// 		// Step 1: Get the user's Twitter ID
-// 		userURL := "https://api.twitter.com/2/users/me?user.fields=id,name,username,profile_image_url"
-// 		reqUser, err := http.NewRequest("GET", userURL, nil)
-// 		if err != nil {
-// 			http.Error(w, "Failed to create request to Twitter API", http.StatusInternalServerError)
-// 			return
-// 		}
-// 		reqUser.Header.Set("Authorization", "Bearer "+accessToken)
-// 		client := &http.Client{Timeout: 30 * time.Second}
-// 		respUser, err := client.Do(reqUser)
-// 		if err != nil {
-// 			http.Error(w, "Failed to contact Twitter API", http.StatusInternalServerError)
-// 			return
-// 		}
-// 		defer respUser.Body.Close()
-// 		if respUser.StatusCode != http.StatusOK {
-// 			body, _ := io.ReadAll(respUser.Body)
-// 			http.Error(w, "Failed to get Twitter user: "+string(body), respUser.StatusCode)
-// 			return
-// 		}
-// 		var userResp struct {
-// 			Data struct {
-// 				ID              string `json:"id"`
-// 				Name            string `json:"name"`
-// 				Username        string `json:"username"`
-// 				ProfileImageURL string `json:"profile_image_url"`
-// 			} `json:"data"`
-// 		}
-// 		if err := json.NewDecoder(respUser.Body).Decode(&userResp); err != nil {
-// 			http.Error(w, "Failed to decode Twitter user response", http.StatusInternalServerError)
-// 			return
-// 		}
-// 		if userResp.Data.ID == "" {
-// 			http.Error(w, "Could not get Twitter user ID", http.StatusInternalServerError)
-// 			return
-// 		}
-
-// 		// Step 2: Fetch tweets with metrics and media
-// 		tweetsURL := fmt.Sprintf("https://api.twitter.com/2/users/%s/tweets?max_results=20&tweet.fields=public_metrics,created_at,attachments&expansions=attachments.media_keys&media.fields=preview_image_url,url,type", userResp.Data.ID)
-// 		reqTweets, err := http.NewRequest("GET", tweetsURL, nil)
-// 		if err != nil {
-// 			http.Error(w, "Failed to create request to Twitter API", http.StatusInternalServerError)
-// 			return
-// 		}
-// 		reqTweets.Header.Set("Authorization", "Bearer "+accessToken)
-// 		respTweets, err := client.Do(reqTweets)
-// 		if err != nil {
-// 			http.Error(w, "Failed to contact Twitter API", http.StatusInternalServerError)
-// 			return
-// 		}
-// 		defer respTweets.Body.Close()
-// 		if respTweets.StatusCode != http.StatusOK {
-// 			body, _ := io.ReadAll(respTweets.Body)
-// 			http.Error(w, "Failed to fetch Twitter posts: "+string(body), respTweets.StatusCode)
-// 			return
-// 		}
-// 		var tweetsResp map[string]interface{}
-// 		if err := json.NewDecoder(respTweets.Body).Decode(&tweetsResp); err != nil {
-// 			http.Error(w, "Failed to decode Twitter posts", http.StatusInternalServerError)
-// 			return
-// 		}
-// 		w.Header().Set("Content-Type", "application/json")
-// 		json.NewEncoder(w).Encode(tweetsResp)
-// 	}
-// }
+func writeTwitterFetchError(w http.ResponseWriter, err error) {
+	if err == sql.ErrNoRows {
+		http.Error(w, "Twitter account not connected", http.StatusBadRequest)
+		return
+	}
+	if apiErr, ok := err.(*twitterAPIError); ok {
+		http.Error(w, "Failed to fetch Twitter posts: "+apiErr.Message, apiErr.StatusCode)
+		return
+	}
+	http.Error(w, "Failed to fetch Twitter posts", http.StatusInternalServerError)
+}
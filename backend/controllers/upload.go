@@ -14,18 +14,17 @@ func UploadImageHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	file, _, err := r.FormFile("file")
+	file, header, err := r.FormFile("file")
 	if err != nil {
 		http.Error(w, "Failed to get file from request: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 	defer file.Close()
 
-	// Generate a unique public ID for Cloudinary
-	publicID := uuid.New().String()
+	// Generate a unique storage key
+	key := "socialsync_uploads/" + uuid.New().String()
 
-	// Call your helper
-	uploadedURL, err := lib.UploadToCloudinary(file, "socialsync_uploads", publicID)
+	blob, err := lib.Blobs.Put(r.Context(), key, file, header.Size, header.Header.Get("Content-Type"))
 	if err != nil {
 		http.Error(w, "Failed to upload image: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -34,5 +33,5 @@ func UploadImageHandler(w http.ResponseWriter, r *http.Request) {
 	// Return JSON with URL
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"url":"` + uploadedURL + `"}`))
+	w.Write([]byte(`{"url":"` + blob.URL + `"}`))
 }
@@ -0,0 +1,503 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+
+	"github.com/gorilla/mux"
+)
+
+// webhookPlatform is the draft platform value that publishes to the workspace webhook
+const webhookPlatform = "webhook"
+
+// Responses are read only for the {"id", "url"} reply to post.published; anything past
+// this is cut off. Bodies aren't stored or shown to members, so a webhook can't be used
+// to read other servers' responses.
+const webhookMaxResponseBody = 4 * 1024
+
+// webhookPayload is the data a payload template renders, and the default payload body
+type webhookPayload struct {
+	Event       string    `json:"event"`
+	DeliveryID  string    `json:"delivery_id"`
+	WorkspaceID string    `json:"workspace_id"`
+	DraftID     string    `json:"draft_id,omitempty"`
+	RemoteID    string    `json:"remote_id,omitempty"` // set on post.updated and post.deleted
+	Content     string    `json:"content"`
+	MediaURLs   []string  `json:"media_urls"`
+	Platforms   []string  `json:"platforms"`
+	PublishedBy string    `json:"published_by,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+var webhookTemplateFuncs = template.FuncMap{
+	// json renders a value as a JSON literal, so templates can embed text safely:
+	// {"text": {{json .Content}}}
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"join": strings.Join,
+}
+
+// GetWebhook returns the workspace webhook settings. The signing secret is never returned
+// after it is first issued.
+func GetWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	workspaceID := mux.Vars(r)["workspaceId"]
+
+	if !isWorkspaceMember(userID, workspaceID) {
+		http.Error(w, "Not a member of this workspace", http.StatusForbidden)
+		return
+	}
+
+	hook, err := loadWorkspaceWebhook(workspaceID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No webhook configured", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Failed to load webhook:", err)
+		http.Error(w, "Failed to fetch webhook", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hook)
+}
+
+// UpdateWebhook creates or updates the workspace webhook (admin/editor only). A signing
+// secret is generated on creation or when rotateSecret is set, and returned only then.
+func UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	workspaceID := mux.Vars(r)["workspaceId"]
+
+	if !IsUserAdminOrEditor(userID, workspaceID) {
+		http.Error(w, "Not authorized to change the webhook", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		URL             string  `json:"url"`
+		PayloadTemplate *string `json:"payload_template"`
+		Enabled         *bool   `json:"enabled"` // defaults to true
+		RotateSecret    bool    `json:"rotate_secret"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := validateWebhookURL(req.URL); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.PayloadTemplate != nil && strings.TrimSpace(*req.PayloadTemplate) == "" {
+		req.PayloadTemplate = nil
+	}
+	if req.PayloadTemplate != nil {
+		sample := webhookPayload{
+			Event: "webhook.test", WorkspaceID: workspaceID, Content: "Sample \"post\"\nwith a line break",
+			MediaURLs: []string{"https://example.com/image.jpg"}, Platforms: []string{webhookPlatform}, Timestamp: time.Now(),
+		}
+		if _, err := renderWebhookPayload(req.PayloadTemplate, sample); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	enabled := req.Enabled == nil || *req.Enabled
+
+	existing, err := loadWorkspaceWebhook(workspaceID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println("Failed to load webhook:", err)
+		http.Error(w, "Failed to update webhook", http.StatusInternalServerError)
+		return
+	}
+	secret, newSecret := "", ""
+	if existing != nil {
+		secret = existing.Secret
+	}
+	if secret == "" || req.RotateSecret {
+		if newSecret, err = generateWebhookSecret(); err != nil {
+			http.Error(w, "Failed to generate signing secret", http.StatusInternalServerError)
+			return
+		}
+		secret = newSecret
+	}
+
+	_, err = lib.DB.Exec(`
+		INSERT INTO workspace_webhooks (workspace_id, url, secret, payload_template, enabled, updated_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, now(), now())
+		ON CONFLICT (workspace_id) DO UPDATE SET
+			url = EXCLUDED.url,
+			secret = EXCLUDED.secret,
+			payload_template = EXCLUDED.payload_template,
+			enabled = EXCLUDED.enabled,
+			updated_by = EXCLUDED.updated_by,
+			updated_at = now()
+	`, workspaceID, req.URL, secret, req.PayloadTemplate, enabled, userID)
+	if err != nil {
+		log.Println("Failed to save webhook:", err)
+		http.Error(w, "Failed to update webhook", http.StatusInternalServerError)
+		return
+	}
+
+	hook, err := loadWorkspaceWebhook(workspaceID)
+	if err != nil {
+		http.Error(w, "Failed to fetch webhook", http.StatusInternalServerError)
+		return
+	}
+	resp := map[string]interface{}{"webhook": hook}
+	if newSecret != "" {
+		resp["secret"] = newSecret
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// DeleteWebhook removes the workspace webhook (admin/editor only)
+func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	workspaceID := mux.Vars(r)["workspaceId"]
+
+	if !IsUserAdminOrEditor(userID, workspaceID) {
+		http.Error(w, "Not authorized to change the webhook", http.StatusForbidden)
+		return
+	}
+	if _, err := lib.DB.Exec(`DELETE FROM workspace_webhooks WHERE workspace_id = $1`, workspaceID); err != nil {
+		log.Println("Failed to delete webhook:", err)
+		http.Error(w, "Failed to delete webhook", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TestWebhook sends a webhook.test event and returns the recorded delivery
+func TestWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	workspaceID := mux.Vars(r)["workspaceId"]
+
+	if !IsUserAdminOrEditor(userID, workspaceID) {
+		http.Error(w, "Not authorized to test the webhook", http.StatusForbidden)
+		return
+	}
+
+	hook, err := loadWorkspaceWebhook(workspaceID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No webhook configured", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch webhook", http.StatusInternalServerError)
+		return
+	}
+
+	delivery, _ := deliverWebhook(hook, webhookPayload{
+		Event:       "webhook.test",
+		WorkspaceID: workspaceID,
+		Content:     "This is a test event from SocialSync",
+		MediaURLs:   []string{},
+		Platforms:   []string{webhookPlatform},
+		PublishedBy: userID,
+	})
+	if delivery == nil {
+		http.Error(w, "Failed to send test event", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(delivery)
+}
+
+// ListWebhookDeliveries returns the latest deliveries (newest first).
+// Optional query params: draft_id, limit (default 50, max 200).
+func ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	workspaceID := mux.Vars(r)["workspaceId"]
+
+	if !isWorkspaceMember(userID, workspaceID) {
+		http.Error(w, "Not a member of this workspace", http.StatusForbidden)
+		return
+	}
+
+	limit := 50
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 200 {
+		limit = l
+	}
+	query := `
+		SELECT id, workspace_id, draft_id, event, url, request_body, response_status,
+		       error, duration_ms, delivered_at
+		FROM webhook_deliveries
+		WHERE workspace_id = $1`
+	args := []interface{}{workspaceID}
+	if draftID := r.URL.Query().Get("draft_id"); draftID != "" {
+		args = append(args, draftID)
+		query += fmt.Sprintf(" AND draft_id = $%d", len(args))
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY delivered_at DESC LIMIT $%d", len(args))
+
+	rows, err := lib.DB.Query(query, args...)
+	if err != nil {
+		log.Println("Failed to query webhook deliveries:", err)
+		http.Error(w, "Failed to fetch webhook deliveries", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.WorkspaceID, &d.DraftID, &d.Event, &d.URL, &d.RequestBody, &d.ResponseStatus,
+			&d.Error, &d.DurationMs, &d.DeliveredAt); err != nil {
+			log.Println("Failed to scan webhook delivery:", err)
+			http.Error(w, "Failed to fetch webhook deliveries", http.StatusInternalServerError)
+			return
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// publishDraftToWebhook delivers a post.published event for a draft and records the
+// published post when the endpoint answers 2xx. The endpoint may reply with JSON
+// {"id": "...", "url": "..."} to give the post a remote id and link; otherwise the
+// delivery id is used.
+func publishDraftToWebhook(workspaceID, draftID, userID, content string, media, platforms []string) (*models.WebhookDelivery, error) {
+	hook, err := loadWorkspaceWebhook(workspaceID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no webhook is configured for this workspace")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !hook.Enabled {
+		return nil, fmt.Errorf("the workspace webhook is disabled")
+	}
+
+	delivery, err := deliverWebhook(hook, webhookPayload{
+		Event:       "post.published",
+		WorkspaceID: workspaceID,
+		DraftID:     draftID,
+		Content:     content,
+		MediaURLs:   media,
+		Platforms:   platforms,
+		PublishedBy: userID,
+	})
+	if err != nil {
+		return delivery, err
+	}
+
+	remoteID, remoteURL := delivery.ID, ""
+	if delivery.ResponseBody != nil {
+		var reply struct {
+			ID  interface{} `json:"id"`
+			URL string      `json:"url"`
+		}
+		if json.Unmarshal([]byte(*delivery.ResponseBody), &reply) == nil {
+			if reply.ID != nil {
+				remoteID = fmt.Sprint(reply.ID)
+			}
+			remoteURL = reply.URL
+		}
+	}
+	recordPublishedPost(lib.DB, draftID, webhookPlatform, userID, remoteID, remoteURL)
+	return delivery, nil
+}
+
+// editWebhookPost and deleteWebhookPost forward edits and takedowns as events so the
+// receiving system can apply them
+func editWebhookPost(db *sql.DB, acc *platformAccount, post *models.PublishedPost, content string) error {
+	return sendWebhookPostEvent(post, "post.updated", content, acc.UserID)
+}
+
+func deleteWebhookPost(db *sql.DB, acc *platformAccount, post *models.PublishedPost) error {
+	return sendWebhookPostEvent(post, "post.deleted", "", acc.UserID)
+}
+
+func sendWebhookPostEvent(post *models.PublishedPost, event, content, userID string) error {
+	hook, err := loadWorkspaceWebhook(post.WorkspaceID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("the workspace webhook has been removed")
+	}
+	if err != nil {
+		return err
+	}
+	if !hook.Enabled {
+		return fmt.Errorf("the workspace webhook is disabled")
+	}
+	_, err = deliverWebhook(hook, webhookPayload{
+		Event:       event,
+		WorkspaceID: post.WorkspaceID,
+		DraftID:     post.DraftID,
+		RemoteID:    post.RemoteID,
+		Content:     content,
+		MediaURLs:   []string{},
+		Platforms:   []string{webhookPlatform},
+		PublishedBy: userID,
+	})
+	return err
+}
+
+// deliverWebhook renders and signs the payload, POSTs it and records the delivery. The
+// returned delivery is nil only if it couldn't be recorded; err is set for any failure,
+// including a non-2xx response.
+//
+// Receivers verify X-SocialSync-Signature, which is "sha256=" followed by the hex
+// HMAC-SHA256 of "{X-SocialSync-Timestamp}.{body}" keyed with the signing secret.
+func deliverWebhook(hook *models.WorkspaceWebhook, payload webhookPayload) (*models.WebhookDelivery, error) {
+	var deliveryID string
+	if err := lib.DB.QueryRow(`SELECT gen_random_uuid()`).Scan(&deliveryID); err != nil {
+		return nil, err
+	}
+	payload.DeliveryID = deliveryID
+	payload.Timestamp = time.Now().UTC()
+	if payload.MediaURLs == nil {
+		payload.MediaURLs = []string{}
+	}
+
+	delivery := &models.WebhookDelivery{
+		ID:          deliveryID,
+		WorkspaceID: hook.WorkspaceID,
+		DraftID:     nullIfEmpty(payload.DraftID),
+		Event:       payload.Event,
+		URL:         hook.URL,
+		DeliveredAt: payload.Timestamp,
+	}
+
+	body, deliverErr := renderWebhookPayload(hook.PayloadTemplate, payload)
+	delivery.RequestBody = string(body)
+	if deliverErr == nil {
+		deliverErr = postWebhook(hook, delivery, body)
+	}
+	if deliverErr != nil {
+		msg := deliverErr.Error()
+		delivery.Error = &msg
+	}
+
+	_, err := lib.DB.Exec(`
+		INSERT INTO webhook_deliveries (
+			id, workspace_id, draft_id, event, url, request_body, response_status,
+			error, duration_ms, delivered_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`, delivery.ID, delivery.WorkspaceID, delivery.DraftID, delivery.Event, delivery.URL, delivery.RequestBody,
+		delivery.ResponseStatus, delivery.Error, delivery.DurationMs, delivery.DeliveredAt)
+	if err != nil {
+		log.Printf("Failed to record webhook delivery %s: %v", deliveryID, err)
+	}
+	return delivery, deliverErr
+}
+
+func postWebhook(hook *models.WorkspaceWebhook, delivery *models.WebhookDelivery, body []byte) error {
+	timestamp := strconv.FormatInt(delivery.DeliveredAt.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(hook.Secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	req, err := http.NewRequest("POST", hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SocialSync-Webhook/1.0")
+	req.Header.Set("X-SocialSync-Event", delivery.Event)
+	req.Header.Set("X-SocialSync-Delivery", delivery.ID)
+	req.Header.Set("X-SocialSync-Timestamp", timestamp)
+	req.Header.Set("X-SocialSync-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	start := time.Now()
+	resp, err := lib.PublicHTTPClient(15 * time.Second).Do(req)
+	duration := int(time.Since(start).Milliseconds())
+	delivery.DurationMs = &duration
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, webhookMaxResponseBody))
+	status, respBody := resp.StatusCode, string(raw)
+	delivery.ResponseStatus = &status
+	delivery.ResponseBody = &respBody
+	if status < 200 || status > 299 {
+		return fmt.Errorf("webhook answered status %d", status)
+	}
+	return nil
+}
+
+// renderWebhookPayload renders the workspace template, or the default JSON payload when
+// there is none. Template output must be valid JSON.
+func renderWebhookPayload(tmpl *string, payload webhookPayload) ([]byte, error) {
+	if tmpl == nil {
+		return json.Marshal(payload)
+	}
+	t, err := template.New("payload").Funcs(webhookTemplateFuncs).Option("missingkey=error").Parse(*tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload template: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, payload); err != nil {
+		return nil, fmt.Errorf("payload template failed: %v", err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		return buf.Bytes(), fmt.Errorf("payload template did not produce valid JSON; wrap text fields with json, e.g. {{json .Content}}")
+	}
+	return buf.Bytes(), nil
+}
+
+func loadWorkspaceWebhook(workspaceID string) (*models.WorkspaceWebhook, error) {
+	hook := &models.WorkspaceWebhook{}
+	err := lib.DB.QueryRow(`
+		SELECT workspace_id, url, secret, payload_template, enabled, updated_by, created_at, updated_at
+		FROM workspace_webhooks
+		WHERE workspace_id = $1
+	`, workspaceID).Scan(&hook.WorkspaceID, &hook.URL, &hook.Secret, &hook.PayloadTemplate, &hook.Enabled,
+		&hook.UpdatedBy, &hook.CreatedAt, &hook.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http(s) URL")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := lib.CheckPublicHost(ctx, u.Hostname()); err != nil {
+		if errors.Is(err, lib.ErrNonPublicAddress) {
+			return fmt.Errorf("url must point to a public server")
+		}
+		return fmt.Errorf("url host could not be resolved")
+	}
+	return nil
+}
+
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
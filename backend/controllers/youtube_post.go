@@ -1,19 +1,20 @@
 package controllers
 
 import (
-	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io"
-	"mime/multipart"
+	"log"
 	"net/http"
 	"social-sync-backend/lib"
+	"strconv"
 	"strings"
 	"time"
 
 	"social-sync-backend/middleware"
+	"social-sync-backend/models"
 
 	"golang.org/x/oauth2"
 )
@@ -28,7 +29,10 @@ type YouTubeVideoMetadata struct {
 		CategoryID  string   `json:"categoryId"`
 	} `json:"snippet"`
 	Status struct {
-		PrivacyStatus string `json:"privacyStatus"`
+		PrivacyStatus           string `json:"privacyStatus"`
+		PublishAt               string `json:"publishAt,omitempty"` // RFC 3339; requires privacyStatus "private"
+		SelfDeclaredMadeForKids bool   `json:"selfDeclaredMadeForKids"`
+		License                 string `json:"license,omitempty"` // youtube or creativeCommon
 	} `json:"status"`
 }
 
@@ -56,7 +60,15 @@ type YouTubeUploadResponse struct {
 	} `json:"status"`
 }
 
-// PostToYouTubeHandler handles video upload to YouTube
+// PostToYouTubeHandler handles video upload to YouTube. The video is either posted as
+// "video" or picked from the workspace media library with "media_id" and "workspace_id".
+// It is sent in resumable chunks; progress goes to the workspace WebSocket and an
+// interrupted upload can be continued through ResumeYouTubeUploadHandler.
+//
+// Optional fields: publish_at (RFC 3339, defaults to the draft's scheduled_time),
+// made_for_kids, license, thumbnail_media_id (a media library image), playlist_ids
+// (repeated or comma-separated), and width/height/duration for direct uploads so
+// Shorts can be detected.
 func PostToYouTubeHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, err := middleware.GetUserIDFromContext(r)
@@ -65,29 +77,21 @@ func PostToYouTubeHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		err = r.ParseMultipartForm(100 << 20)
+		// Anything over 32MB is spooled to a temp file instead of memory
+		err = r.ParseMultipartForm(32 << 20)
 		if err != nil {
 			http.Error(w, "failed to parse form data", http.StatusBadRequest)
 			return
 		}
 
-		file, fileHeader, err := r.FormFile("video")
-		if err != nil {
-			http.Error(w, "video file is required", http.StatusBadRequest)
-			return
-		}
-		defer file.Close()
-
-		if !isValidVideoFile(fileHeader.Filename) {
-			http.Error(w, "invalid video file format. supported: mp4, mov, avi, wmv, flv, webm, mkv", http.StatusBadRequest)
-			return
-		}
-
 		title := r.FormValue("title")
 		description := r.FormValue("description")
 		tags := r.FormValue("tags")
 		privacy := r.FormValue("privacy")
 		categoryID := r.FormValue("category_id")
+		draftID := r.FormValue("draft_id")
+		workspaceID := r.FormValue("workspace_id")
+		mediaID := r.FormValue("media_id")
 
 		if title == "" {
 			http.Error(w, "title is required", http.StatusBadRequest)
@@ -101,13 +105,149 @@ func PostToYouTubeHandler(db *sql.DB) http.HandlerFunc {
 			categoryID = "22"
 		}
 
-		var accessToken, refreshToken string
-		err = db.QueryRow(`
-			SELECT access_token, refresh_token 
-			FROM social_accounts 
-			WHERE user_id = $1 AND platform = 'youtube'
-		`, userID).Scan(&accessToken, &refreshToken)
+		license := r.FormValue("license")
+		if license != "" && license != "youtube" && license != "creativeCommon" {
+			http.Error(w, "license must be youtube or creativeCommon", http.StatusBadRequest)
+			return
+		}
+
+		var playlistIDs []string
+		for _, v := range r.MultipartForm.Value["playlist_ids"] {
+			for _, id := range strings.Split(v, ",") {
+				if id = strings.TrimSpace(id); id != "" {
+					playlistIDs = append(playlistIDs, id)
+				}
+			}
+		}
+
+		var draftScheduledTime *time.Time
+		if draftID != "" {
+			var draftWorkspaceID string
+			lib.DB.QueryRow(`SELECT workspace_id, scheduled_time FROM draft_posts WHERE id = $1`, draftID).Scan(&draftWorkspaceID, &draftScheduledTime)
+			if workspaceID == "" {
+				workspaceID = draftWorkspaceID
+			}
+		}
+		if workspaceID != "" && !isWorkspaceMember(userID, workspaceID) {
+			http.Error(w, "not a member of this workspace", http.StatusForbidden)
+			return
+		}
+
+		// Scheduled videos stay private until YouTube publishes them at publishAt
+		var publishAt *time.Time
+		if v := r.FormValue("publish_at"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, "publish_at must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+			if !t.After(time.Now()) {
+				http.Error(w, "publish_at must be in the future", http.StatusBadRequest)
+				return
+			}
+			publishAt = &t
+		} else if draftScheduledTime != nil && draftScheduledTime.After(time.Now()) {
+			publishAt = draftScheduledTime
+		}
+		if publishAt != nil {
+			privacy = "private"
+		}
+
+		thumbnailMediaID := r.FormValue("thumbnail_media_id")
+		if thumbnailMediaID != "" {
+			if workspaceID == "" {
+				http.Error(w, "workspace_id is required with thumbnail_media_id", http.StatusBadRequest)
+				return
+			}
+			thumb, err := loadMediaFile(thumbnailMediaID, workspaceID, "image")
+			if err == sql.ErrNoRows {
+				http.Error(w, "thumbnail media not found", http.StatusNotFound)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			applyRendition(thumb, "youtube", "thumbnail")
+			if thumb.FileSize > youtubeThumbnailMaxBytes {
+				http.Error(w, "thumbnail must be 2MB or smaller", http.StatusBadRequest)
+				return
+			}
+		}
 
+		// Dimensions and duration for Shorts detection; the media library may already know them
+		width, _ := strconv.Atoi(r.FormValue("width"))
+		height, _ := strconv.Atoi(r.FormValue("height"))
+		duration, _ := strconv.ParseFloat(r.FormValue("duration"), 64)
+
+		upload := &models.YouTubeUpload{UserID: userID}
+		var src youtubeUploadSource
+		if mediaID != "" {
+			if workspaceID == "" {
+				http.Error(w, "workspace_id is required with media_id", http.StatusBadRequest)
+				return
+			}
+			media, err := loadMediaFile(mediaID, workspaceID, "video")
+			if err == sql.ErrNoRows {
+				http.Error(w, "media not found", http.StatusNotFound)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			upload.MediaID = &media.ID
+			upload.SourceURL = &media.FileURL
+			upload.SourceName = media.OriginalName
+			upload.MimeType = media.MimeType
+			upload.TotalBytes = media.FileSize
+			src = urlUploadSource{url: media.FileURL}
+			if media.Width != nil && media.Height != nil {
+				width, height = *media.Width, *media.Height
+			}
+			if media.Duration != nil {
+				duration = *media.Duration
+			}
+		} else {
+			file, fileHeader, err := r.FormFile("video")
+			if err != nil {
+				http.Error(w, "video file is required", http.StatusBadRequest)
+				return
+			}
+			defer file.Close()
+
+			if !isValidVideoFile(fileHeader.Filename) {
+				http.Error(w, "invalid video file format. supported: mp4, mov, avi, wmv, flv, webm, mkv", http.StatusBadRequest)
+				return
+			}
+			upload.SourceName = fileHeader.Filename
+			upload.MimeType = fileHeader.Header.Get("Content-Type")
+			upload.TotalBytes = fileHeader.Size
+			src = multipartUploadSource{file: file}
+		}
+		if upload.MimeType == "" || upload.MimeType == "application/octet-stream" {
+			upload.MimeType = "video/*"
+		}
+		if upload.TotalBytes <= 0 {
+			http.Error(w, "video file is empty", http.StatusBadRequest)
+			return
+		}
+		if workspaceID != "" {
+			upload.WorkspaceID = &workspaceID
+		}
+		if draftID != "" {
+			upload.DraftID = &draftID
+		}
+		if thumbnailMediaID != "" {
+			upload.ThumbnailMediaID = &thumbnailMediaID
+		}
+		upload.PlaylistIDs = playlistIDs
+
+		// YouTube classifies Shorts itself; the tag makes them show up in the Shorts feed sooner
+		isShort := isYouTubeShort(width, height, duration)
+		if isShort && !strings.Contains(strings.ToLower(title+" "+description), "#shorts") {
+			description = strings.TrimSpace(description + "\n\n#Shorts")
+		}
+
+		acc, err := loadPlatformAccount(db, userID, "youtube")
 		if err == sql.ErrNoRows {
 			http.Error(w, "YouTube account not connected", http.StatusBadRequest)
 			return
@@ -116,54 +256,44 @@ func PostToYouTubeHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		cloudinaryURL, err := lib.UploadToCloudinary(file, "videos", fileHeader.Filename)
+		metadata := buildYouTubeMetadata(title, description, tags, privacy, categoryID)
+		metadata.Status.SelfDeclaredMadeForKids = r.FormValue("made_for_kids") == "true"
+		metadata.Status.License = license
+		if publishAt != nil {
+			metadata.Status.PublishAt = publishAt.UTC().Format(time.RFC3339)
+		}
+		upload.Metadata, err = json.Marshal(metadata)
 		if err != nil {
-			http.Error(w, "failed to upload video to storage", http.StatusInternalServerError)
+			http.Error(w, "failed to prepare video metadata", http.StatusInternalServerError)
+			return
+		}
+		if err := createYouTubeUpload(db, upload); err != nil {
+			log.Printf("Failed to create YouTube upload: %v", err)
+			http.Error(w, "failed to start upload", http.StatusInternalServerError)
 			return
 		}
 
-		file.Seek(0, 0)
-
-		videoID, err := uploadVideoToYouTube(file, title, description, tags, privacy, categoryID, accessToken)
+		videoID, err := runYouTubeUpload(db, acc, upload, src)
 		if err != nil {
-			if strings.Contains(err.Error(), "401") && refreshToken != "" {
-				newAccessToken, err := refreshYouTubeToken(refreshToken)
-				if err != nil {
-					http.Error(w, "failed to refresh YouTube token", http.StatusUnauthorized)
-					return
-				}
-
-				_, err = db.Exec(`
-					UPDATE social_accounts 
-					SET access_token = $1, last_synced_at = $2
-					WHERE user_id = $3 AND platform = 'youtube'
-				`, newAccessToken, time.Now(), userID)
-				if err != nil {
-					http.Error(w, "failed to update access token", http.StatusInternalServerError)
-					return
-				}
-
-				file.Seek(0, 0)
-				videoID, err = uploadVideoToYouTube(file, title, description, tags, privacy, categoryID, newAccessToken)
-				if err != nil {
-					http.Error(w, fmt.Sprintf("failed to upload to YouTube: %v", err), http.StatusInternalServerError)
-					return
-				}
-			} else {
-				http.Error(w, fmt.Sprintf("failed to upload to YouTube: %v", err), http.StatusInternalServerError)
-				return
-			}
+			writeYouTubeUploadError(w, upload, err)
+			return
 		}
 
 		videoURL := fmt.Sprintf("https://www.youtube.com/watch?v=%s", videoID)
+		recordPublishedPost(db, draftID, "youtube", userID, videoID, videoURL)
+		warnings := finishYouTubeUpload(db, acc, upload, videoID)
 
 		response := map[string]interface{}{
 			"message":    "video uploaded successfully to YouTube",
+			"upload_id":  upload.ID,
 			"video_id":   videoID,
 			"video_url":  videoURL,
-			"backup_url": cloudinaryURL,
 			"title":      title,
 			"privacy":    privacy,
+			"publish_at": publishAt,
+			"is_short":   isShort,
+			"playlists":  playlistIDs,
+			"warnings":   warnings,
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -172,7 +302,8 @@ func PostToYouTubeHandler(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-func uploadVideoToYouTube(file multipart.File, title, description, tags, privacy, categoryID, accessToken string) (string, error) {
+// buildYouTubeMetadata builds the snippet/status body sent when an upload session starts
+func buildYouTubeMetadata(title, description, tags, privacy, categoryID string) YouTubeVideoMetadata {
 	metadata := YouTubeVideoMetadata{}
 	metadata.Snippet.Title = title
 	metadata.Snippet.Description = description
@@ -186,92 +317,57 @@ func uploadVideoToYouTube(file multipart.File, title, description, tags, privacy
 		}
 		metadata.Snippet.Tags = tagList
 	}
+	return metadata
+}
 
-	metadataJSON, err := json.Marshal(metadata)
-	if err != nil {
-		return "", err
-	}
-
-	fmt.Printf("DEBUG: Sending metadata to YouTube: %s\n", string(metadataJSON))
-
-	initURL := "https://www.googleapis.com/upload/youtube/v3/videos?uploadType=resumable&part=snippet,status"
-	initReq, err := http.NewRequest("POST", initURL, bytes.NewReader(metadataJSON))
+func refreshYouTubeToken(refreshToken string) (string, error) {
+	config := getYouTubeOAuthConfig()
+	token := &oauth2.Token{RefreshToken: refreshToken}
+	tokenSource := config.TokenSource(context.Background(), token)
+	newToken, err := tokenSource.Token()
 	if err != nil {
 		return "", err
 	}
+	return newToken.AccessToken, nil
+}
 
-	initReq.Header.Set("Authorization", "Bearer "+accessToken)
-	initReq.Header.Set("Content-Type", "application/json")
-	initReq.Header.Set("X-Upload-Content-Type", "video/*")
-	initReq.Header.Set("X-Upload-Content-Length", "0")
+// doYouTubeRequest sends a YouTube API request built for the account's access token,
+// refreshing the token once and retrying when YouTube answers 401.
+func doYouTubeRequest(db *sql.DB, userID string, accessToken *string, refreshToken string, build func(token string) (*http.Request, error)) (*http.Response, error) {
+	return doYouTubeRequestWithClient(&http.Client{Timeout: 30 * time.Second}, db, userID, accessToken, refreshToken, build)
+}
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	initResp, err := client.Do(initReq)
+// doYouTubeRequestWithClient is doYouTubeRequest with a caller-supplied client, for uploads
+// that need a longer timeout
+func doYouTubeRequestWithClient(client *http.Client, db *sql.DB, userID string, accessToken *string, refreshToken string, build func(token string) (*http.Request, error)) (*http.Response, error) {
+	req, err := build(*accessToken)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer initResp.Body.Close()
-
-	fmt.Printf("DEBUG: Init response status: %d\n", initResp.StatusCode)
-
-	if initResp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(initResp.Body)
-		fmt.Printf("DEBUG: Init error response: %s\n", string(bodyBytes))
-		return "", fmt.Errorf("failed to initialize upload: %d - %s", initResp.StatusCode, string(bodyBytes))
-	}
-
-	uploadURL := initResp.Header.Get("Location")
-	if uploadURL == "" {
-		return "", fmt.Errorf("no upload URL received from YouTube")
-	}
-
-	fmt.Printf("DEBUG: Upload URL: %s\n", uploadURL)
-
-	file.Seek(0, 0)
-
-	uploadReq, err := http.NewRequest("PUT", uploadURL, file)
-	if err != nil {
-		return "", err
+	resp, err := client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || refreshToken == "" {
+		return resp, err
 	}
+	resp.Body.Close()
 
-	uploadReq.Header.Set("Content-Type", "video/*")
-	uploadReq.Header.Set("Content-Length", "0")
-
-	uploadClient := &http.Client{Timeout: 300 * time.Second}
-	uploadResp, err := uploadClient.Do(uploadReq)
+	newAccessToken, err := refreshYouTubeToken(refreshToken)
 	if err != nil {
-		return "", err
-	}
-	defer uploadResp.Body.Close()
-
-	fmt.Printf("DEBUG: Upload response status: %d\n", uploadResp.StatusCode)
-
-	if uploadResp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(uploadResp.Body)
-		fmt.Printf("DEBUG: Upload error response: %s\n", string(bodyBytes))
-		return "", fmt.Errorf("failed to upload video: %d - %s", uploadResp.StatusCode, string(bodyBytes))
+		return nil, fmt.Errorf("failed to refresh YouTube token: %w", err)
 	}
-
-	var uploadRespData YouTubeUploadResponse
-	if err := json.NewDecoder(uploadResp.Body).Decode(&uploadRespData); err != nil {
-		return "", err
+	if _, err := db.Exec(`
+		UPDATE social_accounts
+		SET access_token = $1, last_synced_at = $2
+		WHERE user_id = $3 AND platform = 'youtube'
+	`, newAccessToken, time.Now(), userID); err != nil {
+		return nil, fmt.Errorf("failed to update access token: %w", err)
 	}
+	*accessToken = newAccessToken
 
-	fmt.Printf("DEBUG: YouTube response - Title: %s, Privacy: %s\n", uploadRespData.Snippet.Title, uploadRespData.Status.PrivacyStatus)
-	fmt.Printf("DEBUG: Full YouTube response: %+v\n", uploadRespData)
-
-	return uploadRespData.ID, nil
-}
-
-func refreshYouTubeToken(refreshToken string) (string, error) {
-	config := getYouTubeOAuthConfig()
-	token := &oauth2.Token{RefreshToken: refreshToken}
-	tokenSource := config.TokenSource(context.Background(), token)
-	newToken, err := tokenSource.Token()
+	req, err = build(newAccessToken)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return newToken.AccessToken, nil
+	return client.Do(req)
 }
 
 func isValidVideoFile(filename string) bool {
@@ -465,3 +561,74 @@ func GetYouTubePostsHandler(db *sql.DB) http.HandlerFunc {
 		json.NewEncoder(w).Encode(statsResp)
 	}
 }
+
+// GetYouTubePlaylistsHandler lists the channel's playlists so uploads can be added to them
+func GetYouTubePlaylistsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "user not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		acc, err := loadPlatformAccount(db, userID, "youtube")
+		if err == sql.ErrNoRows {
+			http.Error(w, "YouTube account not connected", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, "failed to get YouTube account", http.StatusInternalServerError)
+			return
+		}
+
+		resp, err := doYouTubeRequest(db, userID, &acc.AccessToken, acc.RefreshToken, func(token string) (*http.Request, error) {
+			req, err := http.NewRequest("GET", "https://www.googleapis.com/youtube/v3/playlists?part=snippet,contentDetails,status&mine=true&maxResults=50", nil)
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+			return req, nil
+		})
+		if err != nil {
+			http.Error(w, "failed to fetch playlists", http.StatusInternalServerError)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			http.Error(w, fmt.Sprintf("failed to fetch playlists: %s", body), resp.StatusCode)
+			return
+		}
+
+		var playlistsResp struct {
+			Items []struct {
+				ID      string `json:"id"`
+				Snippet struct {
+					Title string `json:"title"`
+				} `json:"snippet"`
+				ContentDetails struct {
+					ItemCount int `json:"itemCount"`
+				} `json:"contentDetails"`
+				Status struct {
+					PrivacyStatus string `json:"privacyStatus"`
+				} `json:"status"`
+			} `json:"items"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&playlistsResp); err != nil {
+			http.Error(w, "failed to decode playlists", http.StatusInternalServerError)
+			return
+		}
+
+		playlists := make([]map[string]interface{}, 0, len(playlistsResp.Items))
+		for _, p := range playlistsResp.Items {
+			playlists = append(playlists, map[string]interface{}{
+				"id":         p.ID,
+				"title":      p.Snippet.Title,
+				"item_count": p.ContentDetails.ItemCount,
+				"privacy":    p.Status.PrivacyStatus,
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(playlists)
+	}
+}
@@ -0,0 +1,644 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Chunks must be a multiple of 256KB except for the last one
+	youtubeChunkSize    = 32 * 256 * 1024 // 8MB
+	youtubeMaxRetries   = 5
+	youtubeChunkTimeout = 5 * time.Minute
+
+	youtubeThumbnailMaxBytes = 2 << 20
+	youtubeShortMaxSeconds   = 180
+)
+
+// errYouTubeSessionExpired means the resumable session is gone and the upload must start over
+var errYouTubeSessionExpired = errors.New("YouTube upload session expired")
+
+// youtubeUploadSource supplies video bytes starting at an offset, so a chunk can be re-read
+// after a failure without holding the whole file in memory
+type youtubeUploadSource interface {
+	OpenAt(offset int64) (io.ReadCloser, error)
+}
+
+// multipartUploadSource reads a file posted with the request (spooled to disk by ParseMultipartForm)
+type multipartUploadSource struct {
+	file multipart.File
+}
+
+func (s multipartUploadSource) OpenAt(offset int64) (io.ReadCloser, error) {
+	if _, err := s.file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(s.file), nil
+}
+
+// urlUploadSource streams a media library file over HTTP using Range requests. client
+// overrides the HTTP client, e.g. to restrict client-supplied URLs to public addresses.
+type urlUploadSource struct {
+	url    string
+	client *http.Client
+}
+
+// urlSourceClient reads urlUploadSource files by default. Each OpenAt is read for one
+// chunk, so the timeout matches a chunk upload's.
+var urlSourceClient = &http.Client{Timeout: youtubeChunkTimeout}
+
+func (s urlUploadSource) OpenAt(offset int64) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	client := s.client
+	if client == nil {
+		client = urlSourceClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		return resp.Body, nil
+	case resp.StatusCode == http.StatusOK:
+		// Server ignored the Range header; skip ahead by reading
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		return resp.Body, nil
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to read media: status %d", resp.StatusCode)
+	}
+}
+
+// GetYouTubeUploadHandler reports an upload's progress, asking YouTube how much of an
+// unfinished session it has received
+func GetYouTubeUploadHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "user not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		upload, err := loadYouTubeUpload(db, mux.Vars(r)["uploadId"], userID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "upload not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "failed to fetch upload", http.StatusInternalServerError)
+			return
+		}
+
+		if upload.Status != "completed" && upload.SessionURI != nil {
+			acc, err := loadPlatformAccount(db, userID, "youtube")
+			if err == nil {
+				offset, videoID, err := queryYouTubeUploadOffset(db, acc, upload)
+				switch {
+				case err == nil && videoID != "":
+					upload.BytesUploaded = upload.TotalBytes
+					upload.Status = "completed"
+					upload.VideoID = &videoID
+					saveYouTubeUploadProgress(db, upload)
+				case err == nil:
+					upload.BytesUploaded = offset
+					saveYouTubeUploadProgress(db, upload)
+				case errors.Is(err, errYouTubeSessionExpired):
+					upload.SessionURI = nil
+					upload.BytesUploaded = 0
+					saveYouTubeUploadProgress(db, upload)
+				default:
+					log.Printf("Failed to query YouTube upload %s: %v", upload.ID, err)
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(upload)
+	}
+}
+
+// ResumeYouTubeUploadHandler continues an interrupted upload from the last byte YouTube
+// received. Media library uploads stream again from the library; direct uploads must
+// re-attach the same file as "video".
+func ResumeYouTubeUploadHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "user not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		upload, err := loadYouTubeUpload(db, mux.Vars(r)["uploadId"], userID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "upload not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "failed to fetch upload", http.StatusInternalServerError)
+			return
+		}
+		if upload.Status == "completed" {
+			http.Error(w, "upload already completed", http.StatusConflict)
+			return
+		}
+
+		var src youtubeUploadSource
+		if strings.Contains(r.Header.Get("Content-Type"), "multipart/form-data") {
+			if err := r.ParseMultipartForm(32 << 20); err != nil {
+				http.Error(w, "failed to parse form data", http.StatusBadRequest)
+				return
+			}
+			file, fileHeader, err := r.FormFile("video")
+			if err != nil {
+				http.Error(w, "video file is required", http.StatusBadRequest)
+				return
+			}
+			defer file.Close()
+			if fileHeader.Size != upload.TotalBytes {
+				http.Error(w, "video file does not match the interrupted upload", http.StatusBadRequest)
+				return
+			}
+			src = multipartUploadSource{file: file}
+		} else if upload.SourceURL != nil {
+			src = urlUploadSource{url: *upload.SourceURL}
+		} else {
+			http.Error(w, "re-attach the video file to resume this upload", http.StatusBadRequest)
+			return
+		}
+
+		acc, err := loadPlatformAccount(db, userID, "youtube")
+		if err == sql.ErrNoRows {
+			http.Error(w, "YouTube account not connected", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, "failed to get YouTube account", http.StatusInternalServerError)
+			return
+		}
+
+		videoID, err := runYouTubeUpload(db, acc, upload, src)
+		if err != nil {
+			writeYouTubeUploadError(w, upload, err)
+			return
+		}
+		recordPublishedPost(db, derefString(upload.DraftID), "youtube", userID, videoID, "https://www.youtube.com/watch?v="+videoID)
+		warnings := finishYouTubeUpload(db, acc, upload, videoID)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":   "video uploaded successfully to YouTube",
+			"upload_id": upload.ID,
+			"video_id":  videoID,
+			"video_url": "https://www.youtube.com/watch?v=" + videoID,
+			"warnings":  warnings,
+		})
+	}
+}
+
+// createYouTubeUpload stores a new upload before any bytes are sent
+func createYouTubeUpload(db *sql.DB, upload *models.YouTubeUpload) error {
+	return db.QueryRow(`
+		INSERT INTO youtube_uploads (user_id, workspace_id, draft_id, media_id, source_url, source_name, mime_type, total_bytes, metadata,
+		                             thumbnail_media_id, playlist_ids)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id, status, created_at, updated_at
+	`, upload.UserID, upload.WorkspaceID, upload.DraftID, upload.MediaID, upload.SourceURL, upload.SourceName,
+		upload.MimeType, upload.TotalBytes, upload.Metadata, upload.ThumbnailMediaID, pqStringArray(upload.PlaylistIDs)).Scan(&upload.ID, &upload.Status, &upload.CreatedAt, &upload.UpdatedAt)
+}
+
+func loadYouTubeUpload(db *sql.DB, uploadID, userID string) (*models.YouTubeUpload, error) {
+	var u models.YouTubeUpload
+	err := db.QueryRow(`
+		SELECT id, user_id, workspace_id, draft_id, media_id, source_url, source_name, mime_type, total_bytes,
+		       bytes_uploaded, metadata, session_uri, status, video_id, error, thumbnail_media_id, playlist_ids,
+		       created_at, updated_at
+		FROM youtube_uploads
+		WHERE id = $1 AND user_id = $2
+	`, uploadID, userID).Scan(&u.ID, &u.UserID, &u.WorkspaceID, &u.DraftID, &u.MediaID, &u.SourceURL, &u.SourceName,
+		&u.MimeType, &u.TotalBytes, &u.BytesUploaded, &u.Metadata, &u.SessionURI, &u.Status, &u.VideoID, &u.Error,
+		&u.ThumbnailMediaID, &u.PlaylistIDs, &u.CreatedAt, &u.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// runYouTubeUpload sends the remaining bytes of an upload in Content-Range chunks and
+// returns the video ID. Progress is saved after every chunk so it can be resumed later.
+func runYouTubeUpload(db *sql.DB, acc *platformAccount, upload *models.YouTubeUpload, src youtubeUploadSource) (string, error) {
+	// Claim the upload so two requests don't push chunks to the same session
+	res, err := db.Exec(`
+		UPDATE youtube_uploads SET status = 'uploading', error = NULL, updated_at = now()
+		WHERE id = $1 AND (status <> 'uploading' OR updated_at < now() - interval '10 minutes')
+	`, upload.ID)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", fmt.Errorf("upload is already in progress")
+	}
+	upload.Status = "uploading"
+	upload.Error = nil
+
+	videoID, err := sendYouTubeUpload(db, acc, upload, src)
+	if err != nil {
+		msg := err.Error()
+		upload.Status = "failed"
+		upload.Error = &msg
+		if errors.Is(err, errYouTubeSessionExpired) {
+			upload.SessionURI = nil
+			upload.BytesUploaded = 0
+		}
+		saveYouTubeUploadProgress(db, upload)
+		return "", err
+	}
+
+	upload.Status = "completed"
+	upload.BytesUploaded = upload.TotalBytes
+	upload.VideoID = &videoID
+	saveYouTubeUploadProgress(db, upload)
+	return videoID, nil
+}
+
+func sendYouTubeUpload(db *sql.DB, acc *platformAccount, upload *models.YouTubeUpload, src youtubeUploadSource) (string, error) {
+	client := &http.Client{Timeout: youtubeChunkTimeout}
+
+	if upload.SessionURI == nil {
+		sessionURI, err := startYouTubeUploadSession(db, acc, upload)
+		if err != nil {
+			return "", err
+		}
+		upload.SessionURI = &sessionURI
+		upload.BytesUploaded = 0
+		saveYouTubeUploadProgress(db, upload)
+	} else {
+		// Trust YouTube over our own record of how far we got
+		offset, videoID, err := queryYouTubeUploadOffset(db, acc, upload)
+		if err != nil {
+			return "", err
+		}
+		if videoID != "" {
+			return videoID, nil
+		}
+		upload.BytesUploaded = offset
+	}
+
+	buf := make([]byte, youtubeChunkSize)
+	failures := 0
+	for {
+		offset := upload.BytesUploaded
+		n, err := readYouTubeChunk(src, offset, buf)
+		if err != nil {
+			return "", fmt.Errorf("failed to read video at byte %d: %w", offset, err)
+		}
+		if n == 0 {
+			return "", fmt.Errorf("video source ended at byte %d of %d", offset, upload.TotalBytes)
+		}
+
+		chunk := buf[:n]
+		contentRange := fmt.Sprintf("bytes %d-%d/%d", offset, offset+int64(n)-1, upload.TotalBytes)
+		resp, err := doYouTubeRequestWithClient(client, db, acc.UserID, &acc.AccessToken, acc.RefreshToken, func(token string) (*http.Request, error) {
+			req, err := http.NewRequest("PUT", *upload.SessionURI, bytes.NewReader(chunk))
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+			req.Header.Set("Content-Type", upload.MimeType)
+			req.Header.Set("Content-Range", contentRange)
+			req.ContentLength = int64(n)
+			return req, nil
+		})
+
+		if err == nil && (resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated) {
+			defer resp.Body.Close()
+			var video YouTubeUploadResponse
+			if err := json.NewDecoder(resp.Body).Decode(&video); err != nil {
+				return "", fmt.Errorf("upload finished but the response could not be read: %w", err)
+			}
+			return video.ID, nil
+		}
+
+		if err == nil && resp.StatusCode == http.StatusPermanentRedirect {
+			// 308 Resume Incomplete: Range says what YouTube has stored. Only progress
+			// resets the retry count, so a session that keeps refusing the chunk gives up.
+			resp.Body.Close()
+			if committed := parseYouTubeRange(resp.Header.Get("Range")); committed > offset {
+				upload.BytesUploaded = committed
+				failures = 0
+				saveYouTubeUploadProgress(db, upload)
+				continue
+			}
+			err = fmt.Errorf("YouTube stored none of the chunk at byte %d", offset)
+		}
+
+		if err == nil {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+				return "", errYouTubeSessionExpired
+			}
+			if resp.StatusCode < 500 {
+				return "", fmt.Errorf("failed to upload video: %d - %s", resp.StatusCode, body)
+			}
+			err = fmt.Errorf("YouTube returned %d", resp.StatusCode)
+		}
+
+		// Network error, 5xx or no progress: back off, then ask YouTube where to continue from
+		failures++
+		if failures > youtubeMaxRetries {
+			return "", fmt.Errorf("upload interrupted at byte %d: %w", upload.BytesUploaded, err)
+		}
+		log.Printf("YouTube upload %s chunk failed (attempt %d): %v", upload.ID, failures, err)
+		time.Sleep(time.Duration(1<<uint(failures)) * time.Second)
+
+		offset, videoID, qerr := queryYouTubeUploadOffset(db, acc, upload)
+		if qerr != nil {
+			if errors.Is(qerr, errYouTubeSessionExpired) {
+				return "", qerr
+			}
+			continue
+		}
+		if videoID != "" {
+			return videoID, nil
+		}
+		upload.BytesUploaded = offset
+	}
+}
+
+// readYouTubeChunk fills buf from src starting at offset and returns the bytes read
+func readYouTubeChunk(src youtubeUploadSource, offset int64, buf []byte) (int, error) {
+	rc, err := src.OpenAt(offset)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	n, err := io.ReadFull(rc, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return n, err
+}
+
+// startYouTubeUploadSession opens a resumable session and returns its URI
+func startYouTubeUploadSession(db *sql.DB, acc *platformAccount, upload *models.YouTubeUpload) (string, error) {
+	resp, err := doYouTubeRequest(db, acc.UserID, &acc.AccessToken, acc.RefreshToken, func(token string) (*http.Request, error) {
+		req, err := http.NewRequest("POST", "https://www.googleapis.com/upload/youtube/v3/videos?uploadType=resumable&part=snippet,status", bytes.NewReader(upload.Metadata))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Upload-Content-Type", upload.MimeType)
+		req.Header.Set("X-Upload-Content-Length", strconv.FormatInt(upload.TotalBytes, 10))
+		return req, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("failed to initialize upload: %d - %s", resp.StatusCode, body)
+	}
+	sessionURI := resp.Header.Get("Location")
+	if sessionURI == "" {
+		return "", fmt.Errorf("no upload URL received from YouTube")
+	}
+	return sessionURI, nil
+}
+
+// queryYouTubeUploadOffset asks YouTube how many bytes of the session it holds.
+// A non-empty video ID means the upload already finished.
+func queryYouTubeUploadOffset(db *sql.DB, acc *platformAccount, upload *models.YouTubeUpload) (int64, string, error) {
+	resp, err := doYouTubeRequest(db, acc.UserID, &acc.AccessToken, acc.RefreshToken, func(token string) (*http.Request, error) {
+		req, err := http.NewRequest("PUT", *upload.SessionURI, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", upload.TotalBytes))
+		req.ContentLength = 0
+		return req, nil
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPermanentRedirect:
+		return parseYouTubeRange(resp.Header.Get("Range")), "", nil
+	case http.StatusOK, http.StatusCreated:
+		var video YouTubeUploadResponse
+		if err := json.NewDecoder(resp.Body).Decode(&video); err != nil {
+			return 0, "", err
+		}
+		return upload.TotalBytes, video.ID, nil
+	case http.StatusNotFound, http.StatusGone:
+		return 0, "", errYouTubeSessionExpired
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return 0, "", fmt.Errorf("failed to query upload status: %d - %s", resp.StatusCode, body)
+	}
+}
+
+// parseYouTubeRange turns a "bytes=0-N" Range header into the next offset (N+1).
+// No header means YouTube has nothing yet.
+func parseYouTubeRange(header string) int64 {
+	i := strings.LastIndex(header, "-")
+	if i == -1 {
+		return 0
+	}
+	last, err := strconv.ParseInt(header[i+1:], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return last + 1
+}
+
+// saveYouTubeUploadProgress persists the upload and broadcasts its progress to the workspace
+func saveYouTubeUploadProgress(db *sql.DB, upload *models.YouTubeUpload) {
+	_, err := db.Exec(`
+		UPDATE youtube_uploads
+		SET session_uri = $1, bytes_uploaded = $2, status = $3, video_id = $4, error = $5, updated_at = now()
+		WHERE id = $6
+	`, upload.SessionURI, upload.BytesUploaded, upload.Status, upload.VideoID, upload.Error, upload.ID)
+	if err != nil {
+		log.Printf("Failed to save YouTube upload %s progress: %v", upload.ID, err)
+	}
+
+	if upload.WorkspaceID == nil {
+		return
+	}
+	percent := 0
+	if upload.TotalBytes > 0 {
+		percent = int(upload.BytesUploaded * 100 / upload.TotalBytes)
+	}
+	msg, _ := json.Marshal(map[string]interface{}{
+		"type":          "youtube_upload_progress",
+		"uploadId":      upload.ID,
+		"draftId":       upload.DraftID,
+		"status":        upload.Status,
+		"bytesUploaded": upload.BytesUploaded,
+		"totalBytes":    upload.TotalBytes,
+		"percent":       percent,
+		"videoId":       upload.VideoID,
+		"error":         upload.Error,
+	})
+	hub.broadcast(*upload.WorkspaceID, websocket.TextMessage, msg)
+}
+
+// writeYouTubeUploadError reports a failed upload along with how to resume it
+func writeYouTubeUploadError(w http.ResponseWriter, upload *models.YouTubeUpload, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadGateway)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":          fmt.Sprintf("failed to upload to YouTube: %v", err),
+		"upload_id":      upload.ID,
+		"bytes_uploaded": upload.BytesUploaded,
+		"total_bytes":    upload.TotalBytes,
+		"resumable":      upload.SessionURI != nil || upload.SourceURL != nil,
+	})
+}
+
+// loadMediaFile loads a workspace media library file of the given type ("image" or "video", or "" for either)
+func loadMediaFile(mediaID, workspaceID, fileType string) (*models.Media, error) {
+	var m models.Media
+	err := lib.DB.QueryRow(`
+		SELECT id, workspace_id, original_name, file_url, file_type, mime_type, file_size, width, height, duration,
+		       video_codec, audio_codec, frame_rate, bit_rate
+		FROM media
+		WHERE id = $1 AND workspace_id = $2 AND deleted_at IS NULL
+	`, mediaID, workspaceID).Scan(&m.ID, &m.WorkspaceID, &m.OriginalName, &m.FileURL, &m.FileType, &m.MimeType, &m.FileSize,
+		&m.Width, &m.Height, &m.Duration, &m.VideoCodec, &m.AudioCodec, &m.FrameRate, &m.BitRate)
+	if err != nil {
+		return nil, err
+	}
+	if fileType != "" && m.FileType != fileType {
+		return nil, fmt.Errorf("media %s is not an %s", mediaID, fileType)
+	}
+	return &m, nil
+}
+
+// finishYouTubeUpload applies the custom thumbnail and playlists once the video exists.
+// The video is already live, so failures come back as warnings instead of errors.
+func finishYouTubeUpload(db *sql.DB, acc *platformAccount, upload *models.YouTubeUpload, videoID string) []string {
+	warnings := []string{}
+	if upload.ThumbnailMediaID != nil && upload.WorkspaceID != nil {
+		if err := setYouTubeThumbnail(db, acc, videoID, *upload.ThumbnailMediaID, *upload.WorkspaceID); err != nil {
+			log.Printf("Failed to set thumbnail on YouTube video %s: %v", videoID, err)
+			warnings = append(warnings, fmt.Sprintf("thumbnail not set: %v", err))
+		}
+	}
+	for _, playlistID := range upload.PlaylistIDs {
+		if err := addToYouTubePlaylist(db, acc, videoID, playlistID); err != nil {
+			log.Printf("Failed to add YouTube video %s to playlist %s: %v", videoID, playlistID, err)
+			warnings = append(warnings, fmt.Sprintf("not added to playlist %s: %v", playlistID, err))
+		}
+	}
+	return warnings
+}
+
+// setYouTubeThumbnail streams a media library image to thumbnails.set
+func setYouTubeThumbnail(db *sql.DB, acc *platformAccount, videoID, mediaID, workspaceID string) error {
+	media, err := loadMediaFile(mediaID, workspaceID, "image")
+	if err != nil {
+		return err
+	}
+	applyRendition(media, "youtube", "thumbnail")
+	if media.FileSize > youtubeThumbnailMaxBytes {
+		return fmt.Errorf("thumbnail must be 2MB or smaller")
+	}
+
+	resp, err := doYouTubeRequest(db, acc.UserID, &acc.AccessToken, acc.RefreshToken, func(token string) (*http.Request, error) {
+		img, err := http.Get(media.FileURL)
+		if err != nil {
+			return nil, err
+		}
+		if img.StatusCode != http.StatusOK {
+			img.Body.Close()
+			return nil, fmt.Errorf("failed to read thumbnail: status %d", img.StatusCode)
+		}
+		req, err := http.NewRequest("POST", "https://www.googleapis.com/upload/youtube/v3/thumbnails/set?videoId="+url.QueryEscape(videoID), img.Body)
+		if err != nil {
+			img.Body.Close()
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", media.MimeType)
+		req.ContentLength = img.ContentLength
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	return checkPlatformResponse(resp)
+}
+
+// addToYouTubePlaylist appends a video to one of the channel's playlists
+func addToYouTubePlaylist(db *sql.DB, acc *platformAccount, videoID, playlistID string) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"snippet": map[string]interface{}{
+			"playlistId": playlistID,
+			"resourceId": map[string]string{
+				"kind":    "youtube#video",
+				"videoId": videoID,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := doYouTubeRequest(db, acc.UserID, &acc.AccessToken, acc.RefreshToken, func(token string) (*http.Request, error) {
+		req, err := http.NewRequest("POST", "https://www.googleapis.com/youtube/v3/playlistItems?part=snippet", bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	return checkPlatformResponse(resp)
+}
+
+// isYouTubeShort reports whether a video qualifies as a Short: vertical or square and
+// at most three minutes long. Unknown dimensions or duration never count as a Short.
+func isYouTubeShort(width, height int, duration float64) bool {
+	return width > 0 && height >= width && duration > 0 && duration <= youtubeShortMaxSeconds
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
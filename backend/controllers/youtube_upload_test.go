@@ -0,0 +1,23 @@
+package controllers
+
+import "testing"
+
+func TestParseYouTubeRange(t *testing.T) {
+	tests := []struct {
+		header string
+		want   int64
+	}{
+		{"bytes=0-8388607", 8388608},
+		{"bytes=0-0", 1},
+		{"0-99", 100},
+		{"", 0},
+		{"bytes=0", 0},
+		{"bytes=0-", 0},
+		{"bytes=0-abc", 0},
+	}
+	for _, tt := range tests {
+		if got := parseYouTubeRange(tt.header); got != tt.want {
+			t.Errorf("parseYouTubeRange(%q) = %d, want %d", tt.header, got, tt.want)
+		}
+	}
+}
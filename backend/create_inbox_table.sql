@@ -0,0 +1,24 @@
+-- Unified inbox of comments and replies collected from connected social accounts
+CREATE TABLE IF NOT EXISTS inbox_items (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+  account_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE, -- owner of the social account the item came from
+  platform TEXT NOT NULL,
+  external_id TEXT NOT NULL,  -- platform comment/reply ID
+  post_external_id TEXT,      -- post, media, video or status being commented on
+  author_name TEXT,
+  author_avatar TEXT,
+  content TEXT,
+  permalink TEXT,
+  is_read BOOLEAN NOT NULL DEFAULT false,
+  assignee_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  replied_at TIMESTAMP WITH TIME ZONE,
+  received_at TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  UNIQUE (workspace_id, platform, external_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_inbox_items_workspace_id ON inbox_items(workspace_id);
+CREATE INDEX IF NOT EXISTS idx_inbox_items_assignee_id ON inbox_items(assignee_id);
+CREATE INDEX IF NOT EXISTS idx_inbox_items_received_at ON inbox_items(received_at DESC);
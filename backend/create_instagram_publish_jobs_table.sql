@@ -0,0 +1,31 @@
+-- Instagram posts waiting for their media containers to finish processing.
+-- A background job polls the containers, publishes, then posts the first comment.
+CREATE TABLE IF NOT EXISTS instagram_publish_jobs (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  workspace_id UUID REFERENCES workspaces(id) ON DELETE SET NULL,
+  draft_id UUID REFERENCES draft_posts(id) ON DELETE SET NULL,
+  post_type TEXT NOT NULL CHECK (post_type IN ('feed', 'carousel', 'reel', 'story')),
+  caption TEXT,
+  child_container_ids TEXT[] NOT NULL DEFAULT '{}', -- carousel items
+  container_id TEXT,                                -- the container that gets published
+  status TEXT NOT NULL CHECK (status IN ('waiting_children', 'waiting_container', 'published', 'failed')),
+  ig_media_id TEXT,
+  permalink TEXT,
+  first_comment TEXT,
+  first_comment_delay INTEGER NOT NULL DEFAULT 0,   -- seconds after publishing
+  first_comment_at TIMESTAMP WITH TIME ZONE,
+  first_comment_status TEXT CHECK (first_comment_status IN ('pending', 'posted', 'failed')),
+  first_comment_id TEXT,
+  checks INTEGER NOT NULL DEFAULT 0,
+  next_check_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  error TEXT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_instagram_publish_jobs_due ON instagram_publish_jobs(status, next_check_at);
+CREATE INDEX IF NOT EXISTS idx_instagram_publish_jobs_user_id ON instagram_publish_jobs(user_id);
+
+-- Set while an instance of ProcessInstagramPublishJobs is working on the job
+ALTER TABLE instagram_publish_jobs ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMP WITH TIME ZONE;
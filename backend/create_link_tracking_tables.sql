@@ -0,0 +1,43 @@
+-- UTM settings applied to links in draft content at publish time.
+-- platform = 'default' is used for every platform without its own row.
+CREATE TABLE IF NOT EXISTS workspace_utm_settings (
+  workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+  platform TEXT NOT NULL,
+  enabled BOOLEAN NOT NULL DEFAULT true,
+  utm_source TEXT,
+  utm_medium TEXT,
+  utm_campaign TEXT,
+  utm_term TEXT,
+  utm_content TEXT,
+  use_short_links BOOLEAN NOT NULL DEFAULT false,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  PRIMARY KEY (workspace_id, platform)
+);
+
+-- Short links served by the /r/{code} redirector
+CREATE TABLE IF NOT EXISTS short_links (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  code TEXT NOT NULL UNIQUE,
+  workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+  draft_id UUID REFERENCES draft_posts(id) ON DELETE SET NULL,
+  created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  platform TEXT NOT NULL,
+  target_url TEXT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+-- One row per redirect served
+CREATE TABLE IF NOT EXISTS link_clicks (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  short_link_id UUID NOT NULL REFERENCES short_links(id) ON DELETE CASCADE,
+  platform TEXT NOT NULL,
+  referrer TEXT,
+  user_agent TEXT,
+  clicked_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_short_links_workspace_id ON short_links(workspace_id);
+CREATE INDEX IF NOT EXISTS idx_short_links_draft_id ON short_links(draft_id);
+CREATE INDEX IF NOT EXISTS idx_short_links_created_by ON short_links(created_by);
+CREATE INDEX IF NOT EXISTS idx_link_clicks_short_link_id ON link_clicks(short_link_id);
+CREATE INDEX IF NOT EXISTS idx_link_clicks_clicked_at ON link_clicks(clicked_at DESC);
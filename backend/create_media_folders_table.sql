@@ -0,0 +1,20 @@
+-- Nested folders for the workspace media library; media sits in at most one folder
+CREATE TABLE IF NOT EXISTS media_folders (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+  parent_id UUID REFERENCES media_folders(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_folders_workspace ON media_folders(workspace_id, parent_id);
+-- Sibling folders have distinct names; top-level folders have no parent
+CREATE UNIQUE INDEX IF NOT EXISTS idx_media_folders_sibling_name
+  ON media_folders(workspace_id, COALESCE(parent_id, '00000000-0000-0000-0000-000000000000'), lower(name));
+
+ALTER TABLE media ADD COLUMN IF NOT EXISTS folder_id UUID REFERENCES media_folders(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_media_folder_id ON media(folder_id);
+-- Cursor pagination walks (created_at, id) newest first
+CREATE INDEX IF NOT EXISTS idx_media_workspace_created ON media(workspace_id, created_at DESC, id DESC);
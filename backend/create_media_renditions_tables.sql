@@ -0,0 +1,48 @@
+-- Derived copies of media sized for a platform placement (see controllers/media_rendition.go)
+CREATE TABLE IF NOT EXISTS media_renditions (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  media_id UUID NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+  workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+  preset TEXT NOT NULL,
+  platform TEXT NOT NULL,
+  placement TEXT NOT NULL,
+  -- Preset settings at the time the rendition was requested
+  width INTEGER NOT NULL,
+  height INTEGER NOT NULL,
+  fit TEXT NOT NULL CHECK (fit IN ('crop', 'fit')),
+  format TEXT NOT NULL CHECK (format IN ('jpeg', 'png', 'mp4')),
+  quality INTEGER,
+  status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'processing', 'ready', 'failed')),
+  error TEXT,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  -- Output
+  file_url TEXT,
+  storage_key TEXT,
+  mime_type TEXT,
+  file_size BIGINT,
+  output_width INTEGER,
+  output_height INTEGER,
+  duration FLOAT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  UNIQUE (media_id, preset)
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_renditions_pending ON media_renditions(created_at) WHERE status = 'pending';
+
+-- Workspace changes to the built-in presets, and workspace-only presets
+CREATE TABLE IF NOT EXISTS workspace_rendition_presets (
+  workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  platform TEXT NOT NULL,
+  placement TEXT NOT NULL,
+  media_type TEXT NOT NULL CHECK (media_type IN ('image', 'video')),
+  width INTEGER NOT NULL,
+  height INTEGER NOT NULL,
+  fit TEXT NOT NULL CHECK (fit IN ('crop', 'fit')),
+  format TEXT NOT NULL CHECK (format IN ('jpeg', 'png', 'mp4')),
+  quality INTEGER,
+  enabled BOOLEAN NOT NULL DEFAULT true,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  PRIMARY KEY (workspace_id, name)
+);
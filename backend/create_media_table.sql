@@ -37,4 +37,58 @@ $$ LANGUAGE plpgsql;
 CREATE TRIGGER trigger_update_media_updated_at
   BEFORE UPDATE ON media
   FOR EACH ROW
-  EXECUTE FUNCTION update_media_updated_at(); 
\ No newline at end of file
+  EXECUTE FUNCTION update_media_updated_at(); 
+-- Soft delete: deleted media stays in the workspace trash, restorable, until the purge
+-- job removes the stored file and the row (see controllers/media_trash.go)
+ALTER TABLE media ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE media ADD COLUMN IF NOT EXISTS deleted_by UUID REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE media ADD COLUMN IF NOT EXISTS purge_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE media ADD COLUMN IF NOT EXISTS purge_error TEXT;
+ALTER TABLE media ADD COLUMN IF NOT EXISTS last_purge_attempt_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_media_deleted_at ON media(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Probed on upload; width, height and duration above are filled in the same pass
+ALTER TABLE media ADD COLUMN IF NOT EXISTS video_codec TEXT;
+ALTER TABLE media ADD COLUMN IF NOT EXISTS audio_codec TEXT;
+ALTER TABLE media ADD COLUMN IF NOT EXISTS frame_rate FLOAT;
+ALTER TABLE media ADD COLUMN IF NOT EXISTS bit_rate BIGINT;
+
+-- Duplicate detection: SHA-256 of the file, and a 64-bit dHash for images.
+-- hashed_at marks rows the backfill job has processed (set on upload for new rows).
+ALTER TABLE media ADD COLUMN IF NOT EXISTS content_hash TEXT;
+ALTER TABLE media ADD COLUMN IF NOT EXISTS phash BIGINT;
+ALTER TABLE media ADD COLUMN IF NOT EXISTS hashed_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_media_content_hash ON media(workspace_id, content_hash) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_media_unhashed ON media(created_at) WHERE hashed_at IS NULL;
+
+-- Where the file came from: upload (the default, including direct uploads), or an import
+-- from a url, instagram or facebook. source_url is the imported URL or the post's
+-- permalink; source_post_id the platform post it was taken from.
+ALTER TABLE media ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT 'upload';
+ALTER TABLE media ADD COLUMN IF NOT EXISTS source_url TEXT;
+ALTER TABLE media ADD COLUMN IF NOT EXISTS source_post_id TEXT;
+
+-- Usage rights for licensed and influencer media. An empty allowed_platforms allows every
+-- platform and a NULL rights_expires_at never expires; drafts using media outside these
+-- can't be scheduled or published. rights_expiry_notified_at marks the advance warning
+-- sent to admins, and is cleared when the expiry changes.
+ALTER TABLE media ADD COLUMN IF NOT EXISTS license_type TEXT;
+ALTER TABLE media ADD COLUMN IF NOT EXISTS rights_credit TEXT;
+ALTER TABLE media ADD COLUMN IF NOT EXISTS allowed_platforms TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE media ADD COLUMN IF NOT EXISTS rights_expires_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE media ADD COLUMN IF NOT EXISTS rights_expiry_notified_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_media_rights_expires_at ON media(rights_expires_at) WHERE rights_expires_at IS NOT NULL;
+
+-- Uploads from before the blob store recorded workspaces/{ws}/media/{file} as their key,
+-- but Cloudinary filed them under the socialsync_uploads folder, so deletes and lookups
+-- by that key miss. Read the real public ID back from the delivery URL
+-- (.../upload/v123/{public_id}.{format}).
+UPDATE media
+SET cloudinary_public_id = regexp_replace(
+      regexp_replace(file_url, '^https?://res\.cloudinary\.com/[^/]+/(image|video)/upload/(v[0-9]+/)?', ''),
+      '\.[^./]*$', '')
+WHERE (cloudinary_public_id IS NULL OR cloudinary_public_id LIKE 'workspaces/%')
+  AND file_url ~ '^https?://res\.cloudinary\.com/[^/]+/(image|video)/upload/';
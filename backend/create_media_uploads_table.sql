@@ -0,0 +1,41 @@
+-- Direct-to-storage uploads: the client sends the file straight to the blob store with
+-- signed parameters, then asks the server to verify it and add it to the media library.
+-- The client can write storage_key until expires_at, so a background job copies the file
+-- to media_key, which only the server writes, and checks and keeps that copy.
+CREATE TABLE IF NOT EXISTS media_uploads (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  storage_key TEXT NOT NULL UNIQUE,
+  original_name TEXT NOT NULL,
+  mime_type TEXT NOT NULL,      -- as declared by the client; checked against the file on completion
+  size BIGINT NOT NULL,         -- declared size and the most the store accepts
+  tags TEXT[] NOT NULL DEFAULT '{}',
+  folder_id UUID REFERENCES media_folders(id) ON DELETE SET NULL,
+  status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'queued', 'processing', 'completed', 'failed', 'expired')),
+  media_id UUID REFERENCES media(id) ON DELETE SET NULL,
+  error TEXT,
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL, -- the signed parameters stop working at this time
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_uploads_workspace ON media_uploads(workspace_id, user_id);
+
+-- Completion is verified by ProcessMediaUploads: queued, then processing
+ALTER TABLE media_uploads DROP CONSTRAINT IF EXISTS media_uploads_status_check;
+UPDATE media_uploads SET status = 'pending' WHERE status = 'completing';
+ALTER TABLE media_uploads ADD CONSTRAINT media_uploads_status_check
+  CHECK (status IN ('pending', 'queued', 'processing', 'completed', 'failed', 'expired'));
+ALTER TABLE media_uploads ADD COLUMN IF NOT EXISTS media_key TEXT UNIQUE;
+ALTER TABLE media_uploads ADD COLUMN IF NOT EXISTS allow_duplicate BOOLEAN NOT NULL DEFAULT false;
+-- Set when verification found the file already in the library; completing with
+-- allow_duplicate adds it anyway
+ALTER TABLE media_uploads ADD COLUMN IF NOT EXISTS duplicate_media_id UUID REFERENCES media(id) ON DELETE SET NULL;
+ALTER TABLE media_uploads ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
+-- When storage_key was removed from the store, once the signed parameters stopped working
+ALTER TABLE media_uploads ADD COLUMN IF NOT EXISTS staging_deleted_at TIMESTAMP WITH TIME ZONE;
+
+DROP INDEX IF EXISTS idx_media_uploads_pending;
+CREATE INDEX IF NOT EXISTS idx_media_uploads_queue ON media_uploads(created_at) WHERE status IN ('queued', 'processing');
+CREATE INDEX IF NOT EXISTS idx_media_uploads_staging ON media_uploads(expires_at) WHERE staging_deleted_at IS NULL;
@@ -0,0 +1,23 @@
+-- Which drafts use which media library items. Drafts keep their media URLs in
+-- draft_posts.media for publishing; this is the relation behind it (controllers/media_usage.go).
+CREATE TABLE IF NOT EXISTS media_usages (
+  draft_id UUID NOT NULL REFERENCES draft_posts(id) ON DELETE CASCADE,
+  media_id UUID NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+  workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+  position INTEGER NOT NULL DEFAULT 0, -- order within the draft's media
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  PRIMARY KEY (draft_id, media_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_usages_media_id ON media_usages(media_id);
+
+-- Link existing drafts to library media by URL
+INSERT INTO media_usages (draft_id, media_id, workspace_id, position)
+SELECT d.id, m.id, d.workspace_id, MIN(e.n) - 1
+FROM draft_posts d
+CROSS JOIN LATERAL jsonb_array_elements_text(
+  CASE WHEN jsonb_typeof(d.media) = 'array' THEN d.media ELSE '[]'::jsonb END
+) WITH ORDINALITY AS e(url, n)
+JOIN media m ON m.workspace_id = d.workspace_id AND m.file_url = e.url
+GROUP BY d.id, m.id, d.workspace_id
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,12 @@
+-- OAuth state parameters handed out when a user starts connecting an account, checked
+-- and consumed by the platform's callback. Kept in the database so any instance can
+-- handle the callback; rows expire after a few minutes.
+CREATE TABLE IF NOT EXISTS oauth_states (
+  state TEXT PRIMARY KEY,
+  platform TEXT NOT NULL,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_oauth_states_expires_at ON oauth_states(expires_at);
@@ -0,0 +1,28 @@
+-- Platform posts created from drafts, used to edit or take down live posts
+CREATE TABLE IF NOT EXISTS published_posts (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  draft_id UUID NOT NULL REFERENCES draft_posts(id) ON DELETE CASCADE,
+  workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+  platform TEXT NOT NULL,
+  remote_id TEXT NOT NULL,      -- post, status, tweet, media or video ID on the platform
+  remote_url TEXT,
+  published_by UUID REFERENCES users(id) ON DELETE SET NULL, -- whose social account posted it
+  status TEXT NOT NULL DEFAULT 'live' CHECK (status IN ('live', 'deleted')),
+  last_action TEXT,             -- 'edit' or 'delete'
+  last_result TEXT,             -- 'ok', 'failed' or 'not_supported'
+  last_error TEXT,
+  published_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_published_posts_draft_id ON published_posts(draft_id);
+CREATE INDEX IF NOT EXISTS idx_published_posts_workspace_id ON published_posts(workspace_id);
+
+-- A draft can create several posts on one platform, such as a Facebook photo post plus
+-- one post per video, so each remote post gets its own row
+ALTER TABLE published_posts DROP CONSTRAINT IF EXISTS published_posts_draft_id_platform_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_published_posts_remote ON published_posts(draft_id, platform, remote_id);
+
+-- A post split into a thread is one row: remote_id is the opening post and
+-- thread_remote_ids the replies that continue it, in order
+ALTER TABLE published_posts ADD COLUMN IF NOT EXISTS thread_remote_ids TEXT[] NOT NULL DEFAULT '{}';
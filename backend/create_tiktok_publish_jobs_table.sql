@@ -0,0 +1,23 @@
+-- TikTok posts handed to the Content Posting API. TikTok processes them asynchronously,
+-- so a background job polls the publish status until it completes or fails.
+CREATE TABLE IF NOT EXISTS tiktok_publish_jobs (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  workspace_id UUID REFERENCES workspaces(id) ON DELETE SET NULL,
+  draft_id UUID REFERENCES draft_posts(id) ON DELETE SET NULL,
+  publish_id TEXT NOT NULL,      -- TikTok's id for the publish request
+  post_mode TEXT NOT NULL CHECK (post_mode IN ('direct', 'inbox')),
+  source TEXT NOT NULL CHECK (source IN ('PULL_FROM_URL', 'FILE_UPLOAD')),
+  status TEXT NOT NULL CHECK (status IN ('processing', 'sent_to_inbox', 'published', 'failed')),
+  tiktok_status TEXT,            -- last raw status, e.g. PROCESSING_DOWNLOAD
+  post_id TEXT,                  -- set once the video is publicly available
+  share_url TEXT,
+  checks INTEGER NOT NULL DEFAULT 0,
+  next_check_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  error TEXT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_tiktok_publish_jobs_due ON tiktok_publish_jobs(status, next_check_at);
+CREATE INDEX IF NOT EXISTS idx_tiktok_publish_jobs_user_id ON tiktok_publish_jobs(user_id);
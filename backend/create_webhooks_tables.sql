@@ -0,0 +1,31 @@
+-- Outbound webhook a workspace can publish drafts to, as the "webhook" platform
+CREATE TABLE IF NOT EXISTS workspace_webhooks (
+  workspace_id UUID PRIMARY KEY REFERENCES workspaces(id) ON DELETE CASCADE,
+  url TEXT NOT NULL,
+  secret TEXT NOT NULL,          -- HMAC-SHA256 signing key
+  payload_template TEXT,         -- Go text/template; NULL sends the default JSON payload
+  enabled BOOLEAN NOT NULL DEFAULT true,
+  updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+-- One row per POST made to a workspace webhook
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+  draft_id UUID REFERENCES draft_posts(id) ON DELETE SET NULL,
+  event TEXT NOT NULL,           -- post.published, post.updated, post.deleted, webhook.test
+  url TEXT NOT NULL,
+  request_body TEXT NOT NULL,
+  response_status INTEGER,
+  error TEXT,
+  duration_ms INTEGER,
+  delivered_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_workspace_id ON webhook_deliveries(workspace_id, delivered_at DESC);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_draft_id ON webhook_deliveries(draft_id);
+
+-- Response bodies are no longer kept; drop the ones recorded before
+ALTER TABLE webhook_deliveries DROP COLUMN IF EXISTS response_body;
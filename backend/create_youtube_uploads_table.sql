@@ -0,0 +1,27 @@
+-- Resumable YouTube upload sessions, so an interrupted upload continues where it stopped
+CREATE TABLE IF NOT EXISTS youtube_uploads (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  workspace_id UUID REFERENCES workspaces(id) ON DELETE SET NULL, -- progress is broadcast here
+  draft_id UUID REFERENCES draft_posts(id) ON DELETE SET NULL,
+  media_id UUID REFERENCES media(id) ON DELETE SET NULL,
+  source_url TEXT,              -- media library file to stream from; NULL for direct file uploads
+  source_name TEXT NOT NULL,
+  mime_type TEXT NOT NULL,
+  total_bytes BIGINT NOT NULL,
+  bytes_uploaded BIGINT NOT NULL DEFAULT 0,
+  metadata JSONB NOT NULL,      -- snippet/status sent when the session is (re)created
+  session_uri TEXT,             -- YouTube resumable session; NULL once expired or before it starts
+  status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'uploading', 'failed', 'completed')),
+  video_id TEXT,
+  error TEXT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_youtube_uploads_user_id ON youtube_uploads(user_id);
+CREATE INDEX IF NOT EXISTS idx_youtube_uploads_status ON youtube_uploads(status);
+
+-- Steps run once the video exists
+ALTER TABLE youtube_uploads ADD COLUMN IF NOT EXISTS thumbnail_media_id UUID REFERENCES media(id) ON DELETE SET NULL;
+ALTER TABLE youtube_uploads ADD COLUMN IF NOT EXISTS playlist_ids TEXT[] NOT NULL DEFAULT '{}';
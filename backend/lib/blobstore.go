@@ -0,0 +1,98 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// BlobStore is where uploaded media lives. Keys are slash-separated paths such as
+// "socialsync_uploads/workspaces/{id}/media/{file}"; each backend maps them onto its own
+// naming. The backend is picked by BLOB_STORE (see InitBlobStore).
+type BlobStore interface {
+	// Put stores body under key and returns the stored object. size may be -1 when unknown.
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) (*BlobInfo, error)
+	// Get opens the object for reading; the caller closes it
+	Get(ctx context.Context, key string) (io.ReadCloser, *BlobInfo, error)
+	Delete(ctx context.Context, key string) error
+	// Copy stores a copy of the object at srcKey under dstKey, without it passing through
+	// this server where the store allows
+	Copy(ctx context.Context, srcKey, dstKey string) (*BlobInfo, error)
+	// SignedURL returns a URL that grants read access to the object until expiry
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+	Stat(ctx context.Context, key string) (*BlobInfo, error)
+	// PresignUpload lets a client upload an object of at most maxSize bytes straight to
+	// the store under key until expiry, without the file passing through this server
+	PresignUpload(ctx context.Context, key, contentType string, maxSize int64, expiry time.Duration) (*UploadTarget, error)
+}
+
+// BlobInfo describes a stored object
+type BlobInfo struct {
+	Key          string
+	URL          string // public URL saved with the media record
+	ContentType  string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+	Metadata     *MediaMetadata // set by backends that analyse uploads (Cloudinary)
+}
+
+// UploadTarget is how a client sends a file directly to the store. With Fields set it's
+// a multipart form POST: the fields first, then the file in a part named "file".
+// Otherwise the body is the raw file, sent with Headers.
+type UploadTarget struct {
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// ErrBlobNotFound is returned by Get, Stat and Delete when the key doesn't exist
+var ErrBlobNotFound = errors.New("blob not found")
+
+// Blobs is the configured store (call InitBlobStore in main.go)
+var Blobs BlobStore
+
+// InitBlobStore sets up Blobs from BLOB_STORE: "cloudinary", "s3" or "local". When unset,
+// Cloudinary is used if CLOUDINARY_CLOUD_NAME is set, and local storage otherwise, so
+// development works without any cloud account.
+func InitBlobStore() error {
+	backend := strings.ToLower(strings.TrimSpace(os.Getenv("BLOB_STORE")))
+	if backend == "" {
+		backend = "local"
+		if os.Getenv("CLOUDINARY_CLOUD_NAME") != "" {
+			backend = "cloudinary"
+		}
+	}
+
+	var err error
+	switch backend {
+	case "cloudinary":
+		Blobs, err = newCloudinaryBlobStore()
+	case "s3", "minio":
+		Blobs, err = newS3BlobStore()
+	case "local":
+		Blobs, err = newLocalBlobStore()
+	default:
+		return fmt.Errorf("unknown BLOB_STORE %q (expected cloudinary, s3 or local)", backend)
+	}
+	if err != nil {
+		return fmt.Errorf("%s blob store: %w", backend, err)
+	}
+	log.Printf("Using %s blob store", backend)
+	return nil
+}
+
+// blobContentType falls back to a generic type when the uploader didn't send one
+func blobContentType(contentType string) string {
+	if contentType == "" {
+		return "application/octet-stream"
+	}
+	return contentType
+}
@@ -0,0 +1,234 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudinary/cloudinary-go/v2"
+	"github.com/cloudinary/cloudinary-go/v2/api"
+	"github.com/cloudinary/cloudinary-go/v2/api/admin"
+	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
+)
+
+// cloudinaryBlobStore keeps blobs as Cloudinary assets whose public ID is the key.
+// Cloudinary files assets under a resource type (image, video or raw) that isn't part
+// of the key, so lookups try each type in turn.
+type cloudinaryBlobStore struct {
+	cloud *cloudinary.Cloudinary
+}
+
+var cloudinaryResourceTypes = []string{"image", "video", "raw"}
+
+func newCloudinaryBlobStore() (*cloudinaryBlobStore, error) {
+	cloud, err := cloudinary.NewFromParams(
+		os.Getenv("CLOUDINARY_CLOUD_NAME"),
+		os.Getenv("CLOUDINARY_API_KEY"),
+		os.Getenv("CLOUDINARY_API_SECRET"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &cloudinaryBlobStore{cloud: cloud}, nil
+}
+
+func (s *cloudinaryBlobStore) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) (*BlobInfo, error) {
+	result, err := s.cloud.Upload.Upload(ctx, body, uploader.UploadParams{
+		PublicID:     key,
+		Overwrite:    api.Bool(true),
+		ResourceType: "auto", // auto-detects image, video, etc.
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Error.Message != "" {
+		return nil, fmt.Errorf("cloudinary upload failed: %s", result.Error.Message)
+	}
+	return &BlobInfo{
+		Key:          key,
+		URL:          result.SecureURL,
+		ContentType:  blobContentType(contentType),
+		Size:         int64(result.Bytes),
+		ETag:         result.Etag,
+		LastModified: result.CreatedAt,
+		Metadata:     cloudinaryMetadata(result),
+	}, nil
+}
+
+// cloudinaryMetadata reads dimensions, and for videos the probe Cloudinary runs on
+// upload, from the raw response; the typed result only carries width and height.
+func cloudinaryMetadata(result *uploader.UploadResult) *MediaMetadata {
+	meta := &MediaMetadata{Width: result.Width, Height: result.Height}
+	raw, ok := result.Response.(map[string]interface{})
+	if !ok {
+		return meta
+	}
+	meta.Duration = cloudinaryNumber(raw["duration"])
+	meta.FrameRate = cloudinaryNumber(raw["frame_rate"])
+	meta.BitRate = int64(cloudinaryNumber(raw["bit_rate"]))
+	if video, ok := raw["video"].(map[string]interface{}); ok {
+		meta.VideoCodec, _ = video["codec"].(string)
+	}
+	if audio, ok := raw["audio"].(map[string]interface{}); ok {
+		meta.AudioCodec, _ = audio["codec"].(string)
+	}
+	return meta
+}
+
+// cloudinaryNumber accepts numbers sent either as JSON numbers or strings
+func cloudinaryNumber(v interface{}) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case string:
+		f, _ := strconv.ParseFloat(n, 64)
+		return f
+	}
+	return 0
+}
+
+func (s *cloudinaryBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, *BlobInfo, error) {
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", info.URL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, nil, fmt.Errorf("cloudinary download failed: status %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		info.ContentType = ct
+	}
+	return resp.Body, info, nil
+}
+
+func (s *cloudinaryBlobStore) Delete(ctx context.Context, key string) error {
+	for _, resourceType := range cloudinaryResourceTypes {
+		result, err := s.cloud.Upload.Destroy(ctx, uploader.DestroyParams{
+			PublicID:     key,
+			ResourceType: resourceType,
+			Invalidate:   api.Bool(true),
+		})
+		if err != nil {
+			return err
+		}
+		if result.Error.Message != "" {
+			return fmt.Errorf("cloudinary delete failed: %s", result.Error.Message)
+		}
+		if result.Result == "ok" {
+			return nil
+		}
+	}
+	return ErrBlobNotFound
+}
+
+// Copy has Cloudinary fetch the source asset's delivery URL into a new asset
+func (s *cloudinaryBlobStore) Copy(ctx context.Context, srcKey, dstKey string) (*BlobInfo, error) {
+	src, err := s.Stat(ctx, srcKey)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.cloud.Upload.Upload(ctx, src.URL, uploader.UploadParams{
+		PublicID:     dstKey,
+		Overwrite:    api.Bool(false),
+		ResourceType: "auto",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Error.Message != "" {
+		return nil, fmt.Errorf("cloudinary copy failed: %s", result.Error.Message)
+	}
+	return &BlobInfo{
+		Key:          dstKey,
+		URL:          result.SecureURL,
+		ContentType:  src.ContentType,
+		Size:         int64(result.Bytes),
+		ETag:         result.Etag,
+		LastModified: result.CreatedAt,
+		Metadata:     cloudinaryMetadata(result),
+	}, nil
+}
+
+// SignedURL returns the delivery URL. Assets uploaded with the "upload" type are public
+// on Cloudinary's CDN, so there is nothing to sign and expiry doesn't apply.
+func (s *cloudinaryBlobStore) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	return info.URL, nil
+}
+
+// PresignUpload returns signed parameters for Cloudinary's upload API. Cloudinary can't
+// cap the size in the signature; callers check it once the upload is done.
+func (s *cloudinaryBlobStore) PresignUpload(ctx context.Context, key, contentType string, maxSize int64, expiry time.Duration) (*UploadTarget, error) {
+	// Cloudinary accepts a signature for an hour after its timestamp, so the timestamp is
+	// backdated to make the signature lapse at expiry. Without overwrite, an upload to a
+	// key that already holds a file doesn't replace it.
+	now := time.Now()
+	if expiry > time.Hour {
+		expiry = time.Hour
+	}
+	params := url.Values{
+		"public_id": {key},
+		"timestamp": {strconv.FormatInt(now.Add(expiry-time.Hour).Unix(), 10)},
+	}
+	signature, err := api.SignParameters(params, s.cloud.Config.Cloud.APISecret)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]string{"api_key": s.cloud.Config.Cloud.APIKey, "signature": signature}
+	for k := range params {
+		fields[k] = params.Get(k)
+	}
+	return &UploadTarget{
+		Method:    "POST",
+		URL:       strings.TrimRight(s.cloud.Config.API.UploadPrefix, "/") + "/v1_1/" + s.cloud.Config.Cloud.CloudName + "/auto/upload",
+		Fields:    fields,
+		ExpiresAt: now.Add(expiry),
+	}, nil
+}
+
+func (s *cloudinaryBlobStore) Stat(ctx context.Context, key string) (*BlobInfo, error) {
+	for _, resourceType := range cloudinaryResourceTypes {
+		asset, err := s.cloud.Admin.Asset(ctx, admin.AssetParams{
+			AssetType: api.AssetType(resourceType),
+			PublicID:  key,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if asset.Error.Message != "" || asset.PublicID == "" {
+			continue
+		}
+		contentType := resourceType + "/" + asset.Format
+		if resourceType == "raw" {
+			contentType = "application/octet-stream"
+		}
+		return &BlobInfo{
+			Key:          key,
+			URL:          asset.SecureURL,
+			ContentType:  contentType,
+			Size:         int64(asset.Bytes),
+			ETag:         asset.Etag,
+			LastModified: asset.CreatedAt,
+		}, nil
+	}
+	return nil, ErrBlobNotFound
+}
@@ -0,0 +1,282 @@
+package lib
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// localBlobStore keeps blobs on the local filesystem and serves them itself, for
+// self-hosted deployments and offline development.
+//
+// Configuration:
+//
+//	BLOB_LOCAL_DIR    directory files are written to; defaults to ./uploads
+//	BLOB_PUBLIC_URL   URL the files route is reachable at; defaults to
+//	                  http://localhost:{PORT}/files
+//	BLOB_SIGNING_KEY  key for signed URLs; a random key is used when unset, so
+//	                  signed URLs stop working after a restart
+type localBlobStore struct {
+	dir        string
+	publicURL  string
+	signingKey []byte
+}
+
+// LocalBlobRoutePrefix is the path the local store serves files under
+const LocalBlobRoutePrefix = "/files/"
+
+func newLocalBlobStore() (*localBlobStore, error) {
+	dir := os.Getenv("BLOB_LOCAL_DIR")
+	if dir == "" {
+		dir = "uploads"
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	publicURL := strings.TrimRight(os.Getenv("BLOB_PUBLIC_URL"), "/")
+	if publicURL == "" {
+		port := os.Getenv("PORT")
+		if port == "" {
+			port = "8080"
+		}
+		publicURL = "http://localhost:" + port + strings.TrimSuffix(LocalBlobRoutePrefix, "/")
+	}
+
+	signingKey := []byte(os.Getenv("BLOB_SIGNING_KEY"))
+	if len(signingKey) == 0 {
+		signingKey = make([]byte, 32)
+		if _, err := rand.Read(signingKey); err != nil {
+			return nil, err
+		}
+		log.Println("BLOB_SIGNING_KEY is not set; signed media URLs will not survive a restart")
+	}
+	return &localBlobStore{dir: dir, publicURL: publicURL, signingKey: signingKey}, nil
+}
+
+// path maps a key to a file under dir, refusing keys that would escape it
+func (s *localBlobStore) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(clean)), nil
+}
+
+func (s *localBlobStore) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) (*BlobInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return nil, err
+	}
+
+	// Write to a temp file first so readers never see a partial upload
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return nil, err
+	}
+	written, err := io.Copy(tmp, body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), p)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	info.Size = written
+	if contentType != "" {
+		info.ContentType = contentType
+	}
+	return info, nil
+}
+
+func (s *localBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, *BlobInfo, error) {
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, _ := s.path(key)
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, info, nil
+}
+
+func (s *localBlobStore) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); errors.Is(err, os.ErrNotExist) {
+		return ErrBlobNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *localBlobStore) Copy(ctx context.Context, srcKey, dstKey string) (*BlobInfo, error) {
+	src, info, err := s.Get(ctx, srcKey)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	return s.Put(ctx, dstKey, src, info.Size, info.ContentType)
+}
+
+// SignedURL returns the file URL with an expiry and an HMAC over key and expiry
+func (s *localBlobStore) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	if _, err := s.Stat(ctx, key); err != nil {
+		return "", err
+	}
+	expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+	q := url.Values{"expires": {expires}, "sig": {s.sign(key, expires)}}
+	return s.objectURL(key) + "?" + q.Encode(), nil
+}
+
+// PresignUpload returns a signed PUT URL on this server's files route
+func (s *localBlobStore) PresignUpload(ctx context.Context, key, contentType string, maxSize int64, expiry time.Duration) (*UploadTarget, error) {
+	if _, err := s.path(key); err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(expiry)
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	max := strconv.FormatInt(maxSize, 10)
+	q := url.Values{"expires": {expires}, "max": {max}, "sig": {s.sign("PUT\n"+key+"\n"+max, expires)}}
+	return &UploadTarget{
+		Method:    "PUT",
+		URL:       s.objectURL(key) + "?" + q.Encode(),
+		Headers:   map[string]string{"Content-Type": blobContentType(contentType)},
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func (s *localBlobStore) Stat(ctx context.Context, key string) (*BlobInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(p)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && fi.IsDir()) {
+		return nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &BlobInfo{
+		Key:          key,
+		URL:          s.objectURL(key),
+		ContentType:  blobContentType(mime.TypeByExtension(filepath.Ext(p))),
+		Size:         fi.Size(),
+		ETag:         fmt.Sprintf("\"%x-%x\"", fi.ModTime().UnixNano(), fi.Size()),
+		LastModified: fi.ModTime(),
+	}, nil
+}
+
+// ServeHTTP serves files under LocalBlobRoutePrefix. Requests carrying a signature must
+// have a valid, unexpired one; unsigned requests are served as public media URLs.
+// PUT stores a file and always needs a signature from PresignUpload.
+func (s *localBlobStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, LocalBlobRoutePrefix)
+	if r.Method == http.MethodPut {
+		s.serveUpload(w, r, key)
+		return
+	}
+	if sig := r.URL.Query().Get("sig"); sig != "" {
+		expires := r.URL.Query().Get("expires")
+		exp, err := strconv.ParseInt(expires, 10, 64)
+		if err != nil || time.Now().Unix() > exp || !hmac.Equal([]byte(sig), []byte(s.sign(key, expires))) {
+			http.Error(w, "Invalid or expired signature", http.StatusForbidden)
+			return
+		}
+	}
+
+	p, err := s.path(key)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if fi, err := os.Stat(p); err != nil || fi.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	// Anyone can fetch these, so nothing may render as a page on our origin: browsers
+	// mustn't sniff, and only images and videos are shown inline. SVG can carry scripts.
+	contentType := blobContentType(mime.TypeByExtension(filepath.Ext(p)))
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	inline := strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "video/")
+	if !inline || strings.HasPrefix(contentType, "image/svg") {
+		w.Header().Set("Content-Disposition", "attachment")
+	}
+	http.ServeFile(w, r, p)
+}
+
+func (s *localBlobStore) serveUpload(w http.ResponseWriter, r *http.Request, key string) {
+	q := r.URL.Query()
+	expires, max := q.Get("expires"), q.Get("max")
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	maxSize, maxErr := strconv.ParseInt(max, 10, 64)
+	if err != nil || maxErr != nil || time.Now().Unix() > exp ||
+		!hmac.Equal([]byte(q.Get("sig")), []byte(s.sign("PUT\n"+key+"\n"+max, expires))) {
+		http.Error(w, "Invalid or expired signature", http.StatusForbidden)
+		return
+	}
+	if r.ContentLength > maxSize {
+		http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxSize)
+	if _, err := s.Put(r.Context(), key, body, r.ContentLength, r.Header.Get("Content-Type")); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		log.Printf("Failed to store upload %s: %v", key, err)
+		http.Error(w, "Failed to store file", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *localBlobStore) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *localBlobStore) objectURL(key string) string {
+	return s.publicURL + "/" + (&url.URL{Path: key}).EscapedPath()
+}
@@ -0,0 +1,174 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3BlobStore keeps blobs in an S3-compatible bucket (AWS S3, MinIO, R2, ...).
+//
+// Configuration:
+//
+//	S3_ENDPOINT    host[:port], e.g. s3.amazonaws.com or localhost:9000
+//	S3_BUCKET      bucket name
+//	S3_ACCESS_KEY, S3_SECRET_KEY
+//	S3_REGION      optional
+//	S3_USE_SSL     "false" for plain HTTP (local MinIO); defaults to true
+//	S3_PUBLIC_URL  optional base URL objects are served from (CDN or public bucket);
+//	               defaults to the path-style bucket URL on the endpoint
+type s3BlobStore struct {
+	client    *minio.Client
+	bucket    string
+	publicURL string
+}
+
+func newS3BlobStore() (*s3BlobStore, error) {
+	endpoint := os.Getenv("S3_ENDPOINT")
+	bucket := os.Getenv("S3_BUCKET")
+	if endpoint == "" || bucket == "" {
+		return nil, fmt.Errorf("S3_ENDPOINT and S3_BUCKET are required")
+	}
+	useSSL := os.Getenv("S3_USE_SSL") != "false"
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(os.Getenv("S3_ACCESS_KEY"), os.Getenv("S3_SECRET_KEY"), ""),
+		Secure: useSSL,
+		Region: os.Getenv("S3_REGION"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	exists, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach bucket %s: %w", bucket, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("bucket %s does not exist", bucket)
+	}
+
+	publicURL := strings.TrimRight(os.Getenv("S3_PUBLIC_URL"), "/")
+	if publicURL == "" {
+		publicURL = client.EndpointURL().String() + "/" + bucket
+	}
+	return &s3BlobStore{client: client, bucket: bucket, publicURL: publicURL}, nil
+}
+
+func (s *s3BlobStore) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) (*BlobInfo, error) {
+	contentType = blobContentType(contentType)
+	result, err := s.client.PutObject(ctx, s.bucket, key, body, size, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return nil, err
+	}
+	return &BlobInfo{
+		Key:          key,
+		URL:          s.objectURL(key),
+		ContentType:  contentType,
+		Size:         result.Size,
+		ETag:         result.ETag,
+		LastModified: time.Now(),
+	}, nil
+}
+
+func (s *s3BlobStore) Get(ctx context.Context, key string) (io.ReadCloser, *BlobInfo, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, s.translateError(err)
+	}
+	// GetObject is lazy; Stat surfaces a missing key before the caller starts reading
+	stat, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, nil, s.translateError(err)
+	}
+	return obj, s.blobInfo(stat), nil
+}
+
+func (s *s3BlobStore) Delete(ctx context.Context, key string) error {
+	if _, err := s.Stat(ctx, key); err != nil {
+		return err
+	}
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+// Copy uses ComposeObject rather than CopyObject, since it falls back to a multipart copy
+// for objects over 5GiB
+func (s *s3BlobStore) Copy(ctx context.Context, srcKey, dstKey string) (*BlobInfo, error) {
+	if _, err := s.client.ComposeObject(ctx,
+		minio.CopyDestOptions{Bucket: s.bucket, Object: dstKey},
+		minio.CopySrcOptions{Bucket: s.bucket, Object: srcKey},
+	); err != nil {
+		return nil, s.translateError(err)
+	}
+	return s.Stat(ctx, dstKey)
+}
+
+func (s *s3BlobStore) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, expiry, url.Values{})
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// PresignUpload returns a presigned POST policy, which unlike a presigned PUT can cap the size
+func (s *s3BlobStore) PresignUpload(ctx context.Context, key, contentType string, maxSize int64, expiry time.Duration) (*UploadTarget, error) {
+	expiresAt := time.Now().Add(expiry)
+	policy := minio.NewPostPolicy()
+	for _, err := range []error{
+		policy.SetBucket(s.bucket),
+		policy.SetKey(key),
+		policy.SetExpires(expiresAt.UTC()),
+		policy.SetContentType(blobContentType(contentType)),
+		policy.SetContentLengthRange(1, maxSize),
+	} {
+		if err != nil {
+			return nil, err
+		}
+	}
+	u, fields, err := s.client.PresignedPostPolicy(ctx, policy)
+	if err != nil {
+		return nil, err
+	}
+	return &UploadTarget{Method: "POST", URL: u.String(), Fields: fields, ExpiresAt: expiresAt}, nil
+}
+
+func (s *s3BlobStore) Stat(ctx context.Context, key string) (*BlobInfo, error) {
+	stat, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, s.translateError(err)
+	}
+	return s.blobInfo(stat), nil
+}
+
+func (s *s3BlobStore) blobInfo(stat minio.ObjectInfo) *BlobInfo {
+	return &BlobInfo{
+		Key:          stat.Key,
+		URL:          s.objectURL(stat.Key),
+		ContentType:  stat.ContentType,
+		Size:         stat.Size,
+		ETag:         stat.ETag,
+		LastModified: stat.LastModified,
+	}
+}
+
+func (s *s3BlobStore) objectURL(key string) string {
+	return s.publicURL + "/" + (&url.URL{Path: key}).EscapedPath()
+}
+
+func (s *s3BlobStore) translateError(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return ErrBlobNotFound
+	}
+	return err
+}
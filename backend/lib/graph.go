@@ -0,0 +1,16 @@
+package lib
+
+import "fmt"
+
+// GraphAPIVersion is the Facebook Graph API version used for every Facebook and
+// Instagram call. Bump it here only.
+const GraphAPIVersion = "v20.0"
+
+// GraphBaseURL is the versioned Graph API root
+const GraphBaseURL = "https://graph.facebook.com/" + GraphAPIVersion
+
+// GraphURL formats a path under the versioned Graph API root,
+// e.g. GraphURL("%s/feed", pageID)
+func GraphURL(format string, args ...interface{}) string {
+	return GraphBaseURL + "/" + fmt.Sprintf(format, args...)
+}
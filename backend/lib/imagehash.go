@@ -0,0 +1,72 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"io"
+	"math/bits"
+
+	"golang.org/x/image/draw"
+)
+
+// maxDecodePixels bounds the images we decode; a small file can declare dimensions
+// that would take gigabytes to decode
+const maxDecodePixels = 50_000_000
+
+// decodeImage decodes an image after checking its declared size against maxDecodePixels
+func decodeImage(r io.Reader) (image.Image, error) {
+	var head bytes.Buffer
+	cfg, _, err := image.DecodeConfig(io.TeeReader(r, &head))
+	if err != nil {
+		return nil, err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxDecodePixels {
+		return nil, fmt.Errorf("image is %dx%d, over the %d pixel limit", cfg.Width, cfg.Height, maxDecodePixels)
+	}
+	src, _, err := image.Decode(io.MultiReader(&head, r))
+	return src, err
+}
+
+// ContentHash is the hex SHA-256 of everything read from r. Identical files have equal
+// hashes, whatever their name.
+func ContentHash(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// PerceptualHash decodes an image and returns its 64-bit difference hash (dHash).
+// Re-encoded, resized or slightly edited copies of an image hash to values a few bits
+// apart; compare them with HashDistance.
+func PerceptualHash(r io.Reader) (uint64, error) {
+	src, err := decodeImage(r)
+	if err != nil {
+		return 0, fmt.Errorf("decode image: %w", err)
+	}
+
+	// Shrink to 9x8 greyscale; each bit says whether a pixel is brighter than its right neighbour
+	small := image.NewGray(image.Rect(0, 0, 9, 8))
+	draw.BiLinear.Scale(small, small.Bounds(), src, src.Bounds(), draw.Src, nil)
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if small.GrayAt(x, y).Y > small.GrayAt(x+1, y).Y {
+				hash |= 1
+			}
+		}
+	}
+	return hash, nil
+}
+
+// HashDistance is the number of differing bits between two perceptual hashes. Up to
+// about 10 of 64 usually means the same picture.
+func HashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -0,0 +1,156 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	_ "golang.org/x/image/webp"
+)
+
+// MediaMetadata is what we know about an uploaded image or video beyond its bytes.
+// Zero values mean unknown.
+type MediaMetadata struct {
+	Width      int
+	Height     int
+	Duration   float64 // seconds
+	VideoCodec string
+	AudioCodec string
+	FrameRate  float64
+	BitRate    int64 // bits per second
+}
+
+// ErrProbeUnavailable is returned by ProbeVideo when ffprobe isn't installed
+var ErrProbeUnavailable = errors.New("ffprobe not available")
+
+// SniffContentType detects the MIME type from the first bytes of a file. It extends
+// http.DetectContentType with the video containers it doesn't know.
+func SniffContentType(head []byte) string {
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" {
+		switch string(head[8:12]) {
+		case "qt  ":
+			return "video/quicktime"
+		case "M4V ", "M4VH", "M4VP":
+			return "video/x-m4v"
+		}
+	}
+	if len(head) >= 4 && bytes.Equal(head[:4], []byte{0x1A, 0x45, 0xDF, 0xA3}) &&
+		bytes.Contains(head, []byte("matroska")) {
+		return "video/x-matroska"
+	}
+	if len(head) >= 3 && string(head[:3]) == "FLV" {
+		return "video/x-flv"
+	}
+	if len(head) >= 16 && bytes.Equal(head[:16], []byte{
+		0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11, 0xA6, 0xD9, 0x00, 0xAA, 0x00, 0x62, 0xCE, 0x6C,
+	}) {
+		return "video/x-ms-wmv"
+	}
+	contentType, _, _ := strings.Cut(http.DetectContentType(head), ";")
+	return contentType
+}
+
+// ProbeImage decodes only the image header to get its dimensions
+func ProbeImage(r io.Reader) (*MediaMetadata, error) {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	return &MediaMetadata{Width: cfg.Width, Height: cfg.Height}, nil
+}
+
+// ffprobeBinary is FFPROBE_PATH, or ffprobe on the PATH
+func ffprobeBinary() string {
+	if bin := os.Getenv("FFPROBE_PATH"); bin != "" {
+		return bin
+	}
+	return "ffprobe"
+}
+
+// VideoProbeAvailable reports whether ProbeVideo can run
+func VideoProbeAvailable() bool {
+	_, err := exec.LookPath(ffprobeBinary())
+	return err == nil
+}
+
+// ProbeVideo runs ffprobe on a local file or URL
+func ProbeVideo(ctx context.Context, source string) (*MediaMetadata, error) {
+	bin := ffprobeBinary()
+	if _, err := exec.LookPath(bin); err != nil {
+		return nil, ErrProbeUnavailable
+	}
+
+	out, err := exec.CommandContext(ctx, bin, "-v", "error", "-print_format", "json",
+		"-show_format", "-show_streams", source).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %v", err)
+	}
+
+	var probe struct {
+		Streams []struct {
+			CodecType    string `json:"codec_type"`
+			CodecName    string `json:"codec_name"`
+			Width        int    `json:"width"`
+			Height       int    `json:"height"`
+			AvgFrameRate string `json:"avg_frame_rate"`
+			Tags         struct {
+				Rotate string `json:"rotate"`
+			} `json:"tags"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+			BitRate  string `json:"bit_rate"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return nil, fmt.Errorf("unreadable ffprobe output: %v", err)
+	}
+
+	meta := &MediaMetadata{}
+	meta.Duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	meta.BitRate, _ = strconv.ParseInt(probe.Format.BitRate, 10, 64)
+	for _, s := range probe.Streams {
+		switch {
+		case s.CodecType == "video" && meta.VideoCodec == "":
+			meta.VideoCodec = s.CodecName
+			meta.Width, meta.Height = s.Width, s.Height
+			// Phones record portrait video as rotated landscape
+			if s.Tags.Rotate == "90" || s.Tags.Rotate == "270" || s.Tags.Rotate == "-90" {
+				meta.Width, meta.Height = s.Height, s.Width
+			}
+			meta.FrameRate = parseFrameRate(s.AvgFrameRate)
+		case s.CodecType == "audio" && meta.AudioCodec == "":
+			meta.AudioCodec = s.CodecName
+		}
+	}
+	return meta, nil
+}
+
+// parseFrameRate parses ffprobe's rational frame rates such as "30000/1001"
+func parseFrameRate(rate string) float64 {
+	num, den, ok := strings.Cut(rate, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	if !ok {
+		return n
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
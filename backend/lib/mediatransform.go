@@ -0,0 +1,143 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"golang.org/x/image/draw"
+)
+
+// ErrTranscodeUnavailable is returned by TranscodeVideo when ffmpeg isn't installed
+var ErrTranscodeUnavailable = errors.New("ffmpeg not available")
+
+// Resize modes for RenderImage and TranscodeVideo
+const (
+	FitCrop = "crop" // fill the frame exactly, cropping the centre of the source
+	FitFit  = "fit"  // scale down to fit inside the frame, keeping the aspect ratio
+)
+
+// RenderImage decodes an image, resizes it to width x height and encodes it as "jpeg" or
+// "png". quality applies to JPEG (0 means 85). Returns the encoded bytes and the output
+// dimensions, which are smaller than the frame for FitFit.
+func RenderImage(r io.Reader, width, height int, fit, format string, quality int) ([]byte, int, int, error) {
+	if width <= 0 || height <= 0 {
+		return nil, 0, 0, fmt.Errorf("invalid size %dx%d", width, height)
+	}
+	src, err := decodeImage(r)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("decode image: %w", err)
+	}
+
+	srcRect := src.Bounds()
+	sw, sh := srcRect.Dx(), srcRect.Dy()
+	if sw == 0 || sh == 0 {
+		return nil, 0, 0, errors.New("empty image")
+	}
+
+	switch fit {
+	case FitCrop:
+		// Cut the centre of the source to the frame's aspect ratio
+		if sw*height > sh*width {
+			cw := sh * width / height
+			x := srcRect.Min.X + (sw-cw)/2
+			srcRect = image.Rect(x, srcRect.Min.Y, x+cw, srcRect.Max.Y)
+		} else {
+			ch := sw * height / width
+			y := srcRect.Min.Y + (sh-ch)/2
+			srcRect = image.Rect(srcRect.Min.X, y, srcRect.Max.X, y+ch)
+		}
+	case FitFit:
+		// Never upscale; otherwise shrink along the tighter dimension
+		if sw <= width && sh <= height {
+			width, height = sw, sh
+		} else if sw*height > sh*width {
+			height = max(1, sh*width/sw)
+		} else {
+			width = max(1, sw*height/sh)
+		}
+	default:
+		return nil, 0, 0, fmt.Errorf("unknown fit %q", fit)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	if format == "jpeg" {
+		// JPEG has no alpha; flatten transparent areas onto white
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	}
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, srcRect, draw.Over, nil)
+
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		if quality <= 0 || quality > 100 {
+			quality = 85
+		}
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: quality})
+	case "png":
+		err = png.Encode(&buf, dst)
+	default:
+		return nil, 0, 0, fmt.Errorf("unsupported image format %q", format)
+	}
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("encode %s: %w", format, err)
+	}
+	return buf.Bytes(), width, height, nil
+}
+
+// ffmpegBinary is FFMPEG_PATH, or ffmpeg on the PATH
+func ffmpegBinary() string {
+	if bin := os.Getenv("FFMPEG_PATH"); bin != "" {
+		return bin
+	}
+	return "ffmpeg"
+}
+
+// TranscodeVideo converts a local video file to an H.264/AAC MP4 of width x height.
+// Dimensions are rounded down to even numbers, which H.264 requires.
+func TranscodeVideo(ctx context.Context, src, dst string, width, height int, fit string) error {
+	bin := ffmpegBinary()
+	if _, err := exec.LookPath(bin); err != nil {
+		return ErrTranscodeUnavailable
+	}
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("invalid size %dx%d", width, height)
+	}
+
+	w, h := strconv.Itoa(width&^1), strconv.Itoa(height&^1)
+	var filter string
+	switch fit {
+	case FitCrop:
+		filter = "scale=" + w + ":" + h + ":force_original_aspect_ratio=increase,crop=" + w + ":" + h
+	case FitFit:
+		filter = "scale='min(" + w + ",iw)':'min(" + h + ",ih)':force_original_aspect_ratio=decrease,scale=trunc(iw/2)*2:trunc(ih/2)*2"
+	default:
+		return fmt.Errorf("unknown fit %q", fit)
+	}
+
+	cmd := exec.CommandContext(ctx, bin, "-v", "error", "-y", "-i", src,
+		"-vf", filter+",setsar=1",
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", "yuv420p",
+		"-c:a", "aac", "-b:a", "128k",
+		"-movflags", "+faststart",
+		dst)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := bytes.TrimSpace(stderr.Bytes())
+		if len(msg) > 500 {
+			msg = msg[len(msg)-500:]
+		}
+		return fmt.Errorf("ffmpeg failed: %v: %s", err, msg)
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"os"
 
+	"social-sync-backend/controllers"
 	"social-sync-backend/lib"
 	"social-sync-backend/routes"
 	"social-sync-backend/utils"
@@ -49,11 +50,11 @@ func main() {
 	}()
 	log.Println("✅ Connected to PostgreSQL DB!")
 
-	// Initialize Cloudinary
-	if err := lib.InitCloudinary(); err != nil {
-		log.Fatalf("❌ Failed to initialize Cloudinary: %v", err)
+	// Initialize media storage (Cloudinary, S3 or local disk, see lib.InitBlobStore)
+	if err := lib.InitBlobStore(); err != nil {
+		log.Fatalf("❌ Failed to initialize blob store: %v", err)
 	}
-	log.Println("✅ Cloudinary initialized!")
+	log.Println("✅ Blob store initialized!")
 
 	// Setup cron job for social account sync
 	c := cron.New(cron.WithChain(
@@ -66,6 +67,46 @@ func main() {
 	}); err != nil {
 		log.Fatalf("❌ Failed to schedule cron: %v", err)
 	}
+	if _, err := c.AddFunc("@every 15s", func() {
+		controllers.ProcessInstagramPublishJobs(lib.DB)
+	}); err != nil {
+		log.Fatalf("❌ Failed to schedule Instagram publish job: %v", err)
+	}
+	if _, err := c.AddFunc("@every 15s", func() {
+		controllers.ProcessTikTokPublishJobs(lib.DB)
+	}); err != nil {
+		log.Fatalf("❌ Failed to schedule TikTok publish job: %v", err)
+	}
+	if _, err := c.AddFunc("@every 1h", func() {
+		controllers.PurgeDeletedMedia(lib.DB)
+	}); err != nil {
+		log.Fatalf("❌ Failed to schedule media purge job: %v", err)
+	}
+	if _, err := c.AddFunc("@every 15s", func() {
+		controllers.ProcessMediaRenditions(lib.DB)
+	}); err != nil {
+		log.Fatalf("❌ Failed to schedule media rendition job: %v", err)
+	}
+	if _, err := c.AddFunc("@every 10m", func() {
+		controllers.BackfillMediaHashes(lib.DB)
+	}); err != nil {
+		log.Fatalf("❌ Failed to schedule media hash backfill: %v", err)
+	}
+	if _, err := c.AddFunc("@every 15s", func() {
+		controllers.ProcessMediaUploads(lib.DB)
+	}); err != nil {
+		log.Fatalf("❌ Failed to schedule media upload job: %v", err)
+	}
+	if _, err := c.AddFunc("@every 1h", func() {
+		controllers.ExpireMediaUploads(lib.DB)
+	}); err != nil {
+		log.Fatalf("❌ Failed to schedule media upload expiry: %v", err)
+	}
+	if _, err := c.AddFunc("@every 1h", func() {
+		controllers.NotifyExpiringMediaRights(lib.DB)
+	}); err != nil {
+		log.Fatalf("❌ Failed to schedule media rights expiry warnings: %v", err)
+	}
 	c.Start()
 	defer c.Stop()
 	log.Println("✅ Cron job started (every 12h).")
@@ -23,7 +23,8 @@ type DraftPost struct {
 	WorkspaceID   string     `json:"workspace_id"`
 	CreatedBy     string     `json:"created_by"`
 	Content       string     `json:"content"`
-	Media         []string   `json:"media"` // or []Media if you want richer objects
+	Media         []string   `json:"media"`     // or []Media if you want richer objects
+	MediaIDs      []string   `json:"media_ids"` // library items among Media (media_usages)
 	Platforms     []string   `json:"platforms"`
 	Status        string     `json:"status"` // draft, scheduled, published
 	ScheduledTime *time.Time `json:"scheduled_time"`
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// InboxItem is a comment or reply collected from a connected social account
+// See create_inbox_table.sql for the schema.
+type InboxItem struct {
+	ID             string     `json:"id"`
+	WorkspaceID    string     `json:"workspace_id"`
+	AccountUserID  string     `json:"account_user_id"`
+	Platform       string     `json:"platform"` // facebook, instagram, youtube, mastodon
+	ExternalID     string     `json:"external_id"`
+	PostExternalID *string    `json:"post_external_id"`
+	AuthorName     *string    `json:"author_name"`
+	AuthorAvatar   *string    `json:"author_avatar"`
+	Content        *string    `json:"content"`
+	Permalink      *string    `json:"permalink"`
+	IsRead         bool       `json:"is_read"`
+	AssigneeID     *string    `json:"assignee_id"`
+	RepliedAt      *time.Time `json:"replied_at"`
+	ReceivedAt     *time.Time `json:"received_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// Joined fields
+	AssigneeName *string `json:"assignee_name,omitempty"`
+}
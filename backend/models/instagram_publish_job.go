@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// InstagramPublishJob is an Instagram post being processed in the background.
+// See create_instagram_publish_jobs_table.sql for the schema.
+type InstagramPublishJob struct {
+	ID                 string         `json:"id"`
+	UserID             string         `json:"user_id"`
+	WorkspaceID        *string        `json:"workspace_id"`
+	DraftID            *string        `json:"draft_id"`
+	PostType           string         `json:"post_type"` // feed, carousel, reel, story
+	Caption            *string        `json:"caption"`
+	ChildContainerIDs  pq.StringArray `json:"child_container_ids"`
+	ContainerID        *string        `json:"container_id"`
+	Status             string         `json:"status"` // waiting_children, waiting_container, published, failed
+	IGMediaID          *string        `json:"ig_media_id"`
+	Permalink          *string        `json:"permalink"`
+	FirstComment       *string        `json:"first_comment"`
+	FirstCommentDelay  int            `json:"first_comment_delay"`
+	FirstCommentAt     *time.Time     `json:"first_comment_at"`
+	FirstCommentStatus *string        `json:"first_comment_status"` // pending, posted, failed
+	FirstCommentID     *string        `json:"first_comment_id"`
+	Checks             int            `json:"checks"`
+	NextCheckAt        time.Time      `json:"next_check_at"`
+	Error              *string        `json:"error"`
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// UTMSetting holds the UTM parameters a workspace applies to links for one platform.
+// Platform "default" applies to every platform without its own row.
+// See create_link_tracking_tables.sql for the schema.
+type UTMSetting struct {
+	WorkspaceID   string    `json:"workspace_id"`
+	Platform      string    `json:"platform"`
+	Enabled       bool      `json:"enabled"`
+	UTMSource     *string   `json:"utm_source"`
+	UTMMedium     *string   `json:"utm_medium"`
+	UTMCampaign   *string   `json:"utm_campaign"`
+	UTMTerm       *string   `json:"utm_term"`
+	UTMContent    *string   `json:"utm_content"`
+	UseShortLinks bool      `json:"use_short_links"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// ShortLink is a redirect served at /r/{code}
+type ShortLink struct {
+	ID          string    `json:"id"`
+	Code        string    `json:"code"`
+	WorkspaceID string    `json:"workspace_id"`
+	DraftID     *string   `json:"draft_id"`
+	CreatedBy   *string   `json:"created_by"`
+	Platform    string    `json:"platform"`
+	TargetURL   string    `json:"target_url"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// Aggregated
+	Clicks int `json:"clicks"`
+}
+
+// LinkClick records a single redirect through a short link
+type LinkClick struct {
+	ID          string    `json:"id"`
+	ShortLinkID string    `json:"short_link_id"`
+	Platform    string    `json:"platform"`
+	Referrer    *string   `json:"referrer"`
+	UserAgent   *string   `json:"user_agent"`
+	ClickedAt   time.Time `json:"clicked_at"`
+}
@@ -22,9 +22,30 @@ import (
 //	height INTEGER, -- for images/videos
 //	duration FLOAT, -- for videos (in seconds)
 //	tags TEXT[],
-//	cloudinary_public_id TEXT,
+//	cloudinary_public_id TEXT, -- blob store key; the name predates the other backends
 //	created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
-//	updated_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+//	updated_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+//	deleted_at TIMESTAMP WITH TIME ZONE, -- set while the media is in the trash
+//	deleted_by UUID REFERENCES users(id) ON DELETE SET NULL,
+//	purge_attempts INTEGER NOT NULL DEFAULT 0,
+//	purge_error TEXT,
+//	last_purge_attempt_at TIMESTAMP WITH TIME ZONE,
+//	video_codec TEXT,
+//	audio_codec TEXT,
+//	frame_rate FLOAT,
+//	bit_rate BIGINT,
+//	folder_id UUID REFERENCES media_folders(id) ON DELETE SET NULL,
+//	content_hash TEXT, -- SHA-256 of the file
+//	phash BIGINT, -- perceptual hash, images only
+//	hashed_at TIMESTAMP WITH TIME ZONE,
+//	source TEXT NOT NULL DEFAULT 'upload', -- upload, url, instagram or facebook
+//	source_url TEXT,
+//	source_post_id TEXT,
+//	license_type TEXT, -- owned, licensed, royalty_free, creative_commons, editorial or influencer
+//	rights_credit TEXT,
+//	allowed_platforms TEXT[] NOT NULL DEFAULT '{}', -- empty allows every platform
+//	rights_expires_at TIMESTAMP WITH TIME ZONE,
+//	rights_expiry_notified_at TIMESTAMP WITH TIME ZONE
 //
 // );
 type Media struct {
@@ -40,12 +61,36 @@ type Media struct {
 	Width              *int           `json:"width,omitempty"`
 	Height             *int           `json:"height,omitempty"`
 	Duration           *float64       `json:"duration,omitempty"` // for videos
+	VideoCodec         *string        `json:"video_codec,omitempty"`
+	AudioCodec         *string        `json:"audio_codec,omitempty"`
+	FrameRate          *float64       `json:"frame_rate,omitempty"`
+	BitRate            *int64         `json:"bit_rate,omitempty"`
 	Tags               pq.StringArray `json:"tags" gorm:"type:text[]"`
-	CloudinaryPublicID string         `json:"cloudinary_public_id"`
-	CreatedAt          time.Time      `json:"created_at"`
-	UpdatedAt          time.Time      `json:"updated_at"`
+	FolderID           *string        `json:"folder_id"`
+	ContentHash        *string        `json:"content_hash,omitempty"`
+	PHash              *int64         `json:"-"`
+	Source             string         `json:"source"`                   // upload, url, instagram or facebook
+	SourceURL          *string        `json:"source_url,omitempty"`     // imported URL, or the platform post's permalink
+	SourcePostID       *string        `json:"source_post_id,omitempty"` // platform post the media was imported from
+	CloudinaryPublicID string         `json:"cloudinary_public_id"`     // key in lib.Blobs
+
+	// Usage rights, set with UpdateMediaRights
+	LicenseType      *string        `json:"license_type"`
+	RightsCredit     *string        `json:"rights_credit"`     // source or credit line
+	AllowedPlatforms pq.StringArray `json:"allowed_platforms"` // empty allows every platform
+	RightsExpiresAt  *time.Time     `json:"rights_expires_at"`
+
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	DeletedAt     *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy     *string    `json:"deleted_by,omitempty"`
+	PurgeAttempts int        `json:"purge_attempts,omitempty"`
+	PurgeError    *string    `json:"purge_error,omitempty"`
 
 	// Joined fields
 	UploaderName   string `json:"uploader_name,omitempty"`
 	UploaderAvatar string `json:"uploader_avatar,omitempty"`
+
+	// Trash listing: when the purge job will remove it for good
+	PurgeAt *time.Time `json:"purge_at,omitempty"`
 }
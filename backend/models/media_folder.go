@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// MediaFolder is a folder in a workspace media library. Folders nest through ParentID;
+// top-level folders have none. See create_media_folders_table.sql for the schema.
+type MediaFolder struct {
+	ID          string    `json:"id"`
+	WorkspaceID string    `json:"workspace_id"`
+	ParentID    *string   `json:"parent_id"`
+	Name        string    `json:"name"`
+	CreatedBy   *string   `json:"created_by,omitempty"`
+	MediaCount  int       `json:"media_count"` // media directly in this folder, excluding the trash
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// RenditionPreset describes a derived copy of media for one platform placement, e.g.
+// Instagram story images at 1080x1920. Built-in presets can be overridden or disabled
+// per workspace. See create_media_renditions_tables.sql for the schema.
+type RenditionPreset struct {
+	Name      string `json:"name"`
+	Platform  string `json:"platform"`
+	Placement string `json:"placement"`  // feed, story, reel, post, thumbnail, ...
+	MediaType string `json:"media_type"` // image or video
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Fit       string `json:"fit"`    // crop: fill the frame, cropping the centre; fit: scale down to fit inside it
+	Format    string `json:"format"` // jpeg or png for images, mp4 for videos
+	Quality   *int   `json:"quality,omitempty"`
+	Enabled   bool   `json:"enabled"`
+	BuiltIn   bool   `json:"built_in"`
+}
+
+// MediaRendition is one generated rendition of a media item
+type MediaRendition struct {
+	ID           string    `json:"id"`
+	MediaID      string    `json:"media_id"`
+	WorkspaceID  string    `json:"workspace_id"`
+	Preset       string    `json:"preset"`
+	Platform     string    `json:"platform"`
+	Placement    string    `json:"placement"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	Fit          string    `json:"fit"`
+	Format       string    `json:"format"`
+	Quality      *int      `json:"quality,omitempty"`
+	Status       string    `json:"status"` // pending, processing, ready, failed
+	Error        *string   `json:"error,omitempty"`
+	Attempts     int       `json:"attempts"`
+	FileURL      *string   `json:"file_url,omitempty"`
+	StorageKey   *string   `json:"-"`
+	MimeType     *string   `json:"mime_type,omitempty"`
+	FileSize     *int64    `json:"file_size,omitempty"`
+	OutputWidth  *int      `json:"output_width,omitempty"`
+	OutputHeight *int      `json:"output_height,omitempty"`
+	Duration     *float64  `json:"duration,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// MediaUpload is a direct-to-storage upload into a workspace media library.
+// See create_media_uploads_table.sql for the schema.
+type MediaUpload struct {
+	ID               string         `json:"id"`
+	WorkspaceID      string         `json:"workspace_id"`
+	UserID           string         `json:"user_id"`
+	StorageKey       string         `json:"-"`
+	MediaKey         *string        `json:"-"`
+	OriginalName     string         `json:"original_name"`
+	MimeType         string         `json:"mime_type"`
+	Size             int64          `json:"size"`
+	Tags             pq.StringArray `json:"tags"`
+	FolderID         *string        `json:"folder_id"`
+	Status           string         `json:"status"`             // pending, queued, processing, completed, failed, expired
+	DuplicateMediaID *string        `json:"duplicate_media_id"` // the file is already in the library; complete with allow_duplicate to add it anyway
+	AllowDuplicate   bool           `json:"-"`
+	Attempts         int            `json:"-"`
+	MediaID          *string        `json:"media_id"`
+	Error            *string        `json:"error"`
+	ExpiresAt        time.Time      `json:"expires_at"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// MediaUsage links a draft to a media library item it uses.
+// See create_media_usages_table.sql for the schema.
+type MediaUsage struct {
+	DraftID     string    `json:"draft_id"`
+	MediaID     string    `json:"media_id"`
+	WorkspaceID string    `json:"workspace_id"`
+	Position    int       `json:"position"`
+	CreatedAt   time.Time `json:"created_at"`
+}
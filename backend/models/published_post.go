@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// PublishedPost links a draft to a post it created on a platform. A draft can have several
+// posts on one platform, e.g. a Facebook photo post and one post per video. A post split
+// into a thread keeps its replies in ThreadRemoteIDs.
+// See create_published_posts_table.sql for the schema.
+type PublishedPost struct {
+	ID              string    `json:"id"`
+	DraftID         string    `json:"draft_id"`
+	WorkspaceID     string    `json:"workspace_id"`
+	Platform        string    `json:"platform"`
+	RemoteID        string    `json:"remote_id"`
+	ThreadRemoteIDs []string  `json:"thread_remote_ids"` // replies after RemoteID, in order
+	RemoteURL       *string   `json:"remote_url"`
+	PublishedBy     *string   `json:"published_by"`
+	Status          string    `json:"status"`      // live, deleted
+	LastAction      *string   `json:"last_action"` // edit, delete
+	LastResult      *string   `json:"last_result"` // ok, failed, not_supported
+	LastError       *string   `json:"last_error"`
+	PublishedAt     time.Time `json:"published_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
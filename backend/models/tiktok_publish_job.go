@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// TikTokPublishJob is a TikTok post being processed in the background.
+// See create_tiktok_publish_jobs_table.sql for the schema.
+type TikTokPublishJob struct {
+	ID           string    `json:"id"`
+	UserID       string    `json:"user_id"`
+	WorkspaceID  *string   `json:"workspace_id"`
+	DraftID      *string   `json:"draft_id"`
+	PublishID    string    `json:"publish_id"`
+	PostMode     string    `json:"post_mode"` // direct, inbox
+	Source       string    `json:"source"`    // PULL_FROM_URL, FILE_UPLOAD
+	Status       string    `json:"status"`    // processing, sent_to_inbox, published, failed
+	TikTokStatus *string   `json:"tiktok_status"`
+	PostID       *string   `json:"post_id"`
+	ShareURL     *string   `json:"share_url"`
+	Checks       int       `json:"checks"`
+	NextCheckAt  time.Time `json:"next_check_at"`
+	Error        *string   `json:"error"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// WorkspaceWebhook is the outbound webhook drafts are published to as the "webhook"
+// platform. See create_webhooks_tables.sql for the schema.
+type WorkspaceWebhook struct {
+	WorkspaceID     string    `json:"workspace_id"`
+	URL             string    `json:"url"`
+	Secret          string    `json:"-"`
+	PayloadTemplate *string   `json:"payload_template"`
+	Enabled         bool      `json:"enabled"`
+	UpdatedBy       *string   `json:"updated_by"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery records one POST to a workspace webhook and what it answered
+type WebhookDelivery struct {
+	ID             string    `json:"id"`
+	WorkspaceID    string    `json:"workspace_id"`
+	DraftID        *string   `json:"draft_id"`
+	Event          string    `json:"event"`
+	URL            string    `json:"url"`
+	RequestBody    string    `json:"request_body"`
+	ResponseStatus *int      `json:"response_status"`
+	ResponseBody   *string   `json:"-"` // read for the post.published reply, never stored or shown
+	Error          *string   `json:"error"`
+	DurationMs     *int      `json:"duration_ms"`
+	DeliveredAt    time.Time `json:"delivered_at"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// YouTubeUpload tracks a resumable YouTube upload session.
+// See create_youtube_uploads_table.sql for the schema.
+type YouTubeUpload struct {
+	ID            string  `json:"id"`
+	UserID        string  `json:"user_id"`
+	WorkspaceID   *string `json:"workspace_id"`
+	DraftID       *string `json:"draft_id"`
+	MediaID       *string `json:"media_id"`
+	SourceURL     *string `json:"source_url"`
+	SourceName    string  `json:"source_name"`
+	MimeType      string  `json:"mime_type"`
+	TotalBytes    int64   `json:"total_bytes"`
+	BytesUploaded int64   `json:"bytes_uploaded"`
+	Metadata      []byte  `json:"-"`
+	SessionURI    *string `json:"-"`      // acts as a credential for the upload, never sent to clients
+	Status        string  `json:"status"` // pending, uploading, failed, completed
+	VideoID       *string `json:"video_id"`
+	Error         *string `json:"error"`
+
+	// Applied after the upload completes
+	ThumbnailMediaID *string        `json:"thumbnail_media_id"`
+	PlaylistIDs      pq.StringArray `json:"playlist_ids"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
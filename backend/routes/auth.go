@@ -41,6 +41,9 @@ func AuthRoutes(r *mux.Router) {
 	r.Handle("/api/instagram/post", middleware.JWTMiddleware(
 		http.HandlerFunc(controllers.PostToInstagramHandler(lib.DB)),
 	)).Methods("POST")
+	r.Handle("/api/instagram/jobs/{jobId}", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetInstagramPublishJobHandler(lib.DB)),
+	)).Methods("GET")
 	// New: Fetch Instagram posts
 	r.Handle("/api/instagram/posts", middleware.JWTMiddleware(
 		http.HandlerFunc(controllers.GetInstagramPostsHandler(lib.DB)),
@@ -54,6 +57,15 @@ func AuthRoutes(r *mux.Router) {
 	r.Handle("/api/youtube/post", middleware.JWTMiddleware(
 		http.HandlerFunc(controllers.PostToYouTubeHandler(lib.DB)),
 	)).Methods("POST")
+	r.Handle("/api/youtube/playlists", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetYouTubePlaylistsHandler(lib.DB)),
+	)).Methods("GET")
+	r.Handle("/api/youtube/uploads/{uploadId}", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetYouTubeUploadHandler(lib.DB)),
+	)).Methods("GET")
+	r.Handle("/api/youtube/uploads/{uploadId}/resume", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.ResumeYouTubeUploadHandler(lib.DB)),
+	)).Methods("POST")
 	// New: Fetch YouTube posts
 	r.Handle("/api/youtube/posts", middleware.JWTMiddleware(
 		http.HandlerFunc(controllers.GetYouTubePostsHandler(lib.DB)),
@@ -67,11 +79,51 @@ func AuthRoutes(r *mux.Router) {
 	r.Handle("/api/twitter/post", middleware.JWTMiddleware(
 		http.HandlerFunc(controllers.PostToTwitterHandler(lib.DB)),
 	)).Methods("POST")
+	r.Handle("/api/twitter/posts", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetTwitterPostsHandler(lib.DB)),
+	)).Methods("GET")
+	r.Handle("/api/analytics/twitter", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetTwitterAnalyticsHandler(lib.DB)),
+	)).Methods("GET")
+
+	// ----------- LinkedIn OAuth ----------- //
+	r.Handle("/auth/linkedin/login", middleware.EnableCORS(middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.LinkedInRedirectHandler()),
+	))).Methods("GET")
+	r.HandleFunc("/auth/linkedin/callback", controllers.LinkedInCallbackHandler(lib.DB)).Methods("GET")
+	r.Handle("/api/linkedin/organizations", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetLinkedInOrganizationsHandler(lib.DB)),
+	)).Methods("GET")
+	r.Handle("/api/linkedin/organization", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.SelectLinkedInOrganizationHandler(lib.DB)),
+	)).Methods("PUT")
+	r.Handle("/api/linkedin/post", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.PostToLinkedInHandler(lib.DB)),
+	)).Methods("POST")
+	r.Handle("/api/analytics/linkedin", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetLinkedInAnalyticsHandler(lib.DB)),
+	)).Methods("GET")
 
-	// ----------- TikTok Upload ----------- //
-	// r.Handle("/api/tiktok/post", middleware.JWTMiddleware(
-	// 	http.HandlerFunc(controllers.PostToTikTokHandler(lib.DB)),
-	// )).Methods("POST")
+	// ----------- TikTok OAuth ----------- //
+	r.Handle("/auth/tiktok/login", middleware.EnableCORS(middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.TikTokRedirectHandler()),
+	))).Methods("GET")
+	r.HandleFunc("/auth/tiktok/callback", controllers.TikTokCallbackHandler(lib.DB)).Methods("GET")
+	r.Handle("/api/tiktok/creator-info", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetTikTokCreatorInfoHandler(lib.DB)),
+	)).Methods("GET")
+	r.Handle("/api/tiktok/post", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.PostToTikTokHandler(lib.DB)),
+	)).Methods("POST")
+	r.Handle("/api/tiktok/jobs/{jobId}", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetTikTokPublishJobHandler(lib.DB)),
+	)).Methods("GET")
+	r.Handle("/api/tiktok/posts", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetTikTokPostsHandler(lib.DB)),
+	)).Methods("GET")
+	r.Handle("/api/analytics/tiktok", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetTikTokAnalyticsHandler(lib.DB)),
+	)).Methods("GET")
 
 	// ----------- Mastodon OAuth ----------- //
 	r.Handle("/auth/mastodon/login", middleware.EnableCORS(middleware.JWTMiddleware(
@@ -91,6 +143,62 @@ func AuthRoutes(r *mux.Router) {
 		http.HandlerFunc(controllers.GetMastodonAnalyticsHandler(lib.DB)),
 	)).Methods("GET")
 
+	// ----------- Threads OAuth ----------- //
+	r.Handle("/auth/threads/login", middleware.EnableCORS(middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.ThreadsRedirectHandler()),
+	))).Methods("GET")
+	r.HandleFunc("/auth/threads/callback", controllers.ThreadsCallbackHandler(lib.DB)).Methods("GET")
+	r.Handle("/api/threads/post", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.PostToThreadsHandler(lib.DB)),
+	)).Methods("POST")
+	r.Handle("/api/threads/posts", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetThreadsPostsHandler(lib.DB)),
+	)).Methods("GET")
+	r.Handle("/api/analytics/threads", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetThreadsAnalyticsHandler(lib.DB)),
+	)).Methods("GET")
+
+	// ----------- Bluesky (app password) ----------- //
+	r.Handle("/connect/bluesky", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.ConnectBlueskyHandler(lib.DB)),
+	)).Methods("POST")
+	r.Handle("/api/bluesky/post", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.PostToBlueskyHandler(lib.DB)),
+	)).Methods("POST")
+	r.Handle("/api/bluesky/posts", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetBlueskyPostsHandler(lib.DB)),
+	)).Methods("GET")
+	r.Handle("/api/analytics/bluesky", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetBlueskyAnalyticsHandler(lib.DB)),
+	)).Methods("GET")
+
+	// ----------- Pinterest OAuth ----------- //
+	r.Handle("/auth/pinterest/login", middleware.EnableCORS(middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.PinterestRedirectHandler()),
+	))).Methods("GET")
+	r.HandleFunc("/auth/pinterest/callback", controllers.PinterestCallbackHandler(lib.DB)).Methods("GET")
+	r.Handle("/api/pinterest/boards", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetPinterestBoardsHandler(lib.DB)),
+	)).Methods("GET")
+	r.Handle("/api/pinterest/post", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.PostToPinterestHandler(lib.DB)),
+	)).Methods("POST")
+
+	// ----------- Google Business Profile OAuth ----------- //
+	r.Handle("/auth/google-business/login", middleware.EnableCORS(middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GoogleBusinessRedirectHandler()),
+	))).Methods("GET")
+	r.HandleFunc("/auth/google-business/callback", controllers.GoogleBusinessCallbackHandler(lib.DB)).Methods("GET")
+	r.Handle("/api/google-business/locations", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetGoogleBusinessLocationsHandler(lib.DB)),
+	)).Methods("GET")
+	r.Handle("/api/google-business/location", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.SelectGoogleBusinessLocationHandler(lib.DB)),
+	)).Methods("PUT")
+	r.Handle("/api/google-business/post", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.PostToGoogleBusinessHandler(lib.DB)),
+	)).Methods("POST")
+
 	// ----------- Social Account Management ----------- //
 	r.Handle("/api/social-accounts", middleware.EnableCORS(middleware.JWTMiddleware(
 		http.HandlerFunc(controllers.GetSocialAccountsHandler(lib.DB)),
@@ -15,4 +15,7 @@ func RegisterDraftPostRoutes(r *mux.Router) {
 	drafts.HandleFunc("/{draftId}", controllers.UpdateDraftPost).Methods("PATCH")
 	drafts.HandleFunc("/{draftId}", controllers.DeleteDraftPost).Methods("DELETE")
 	drafts.HandleFunc("/{draftId}/publish", controllers.PublishDraftPost).Methods("POST")
+	drafts.HandleFunc("/{draftId}/published", controllers.ListPublishedPosts).Methods("GET")
+	drafts.HandleFunc("/{draftId}/published", controllers.EditPublishedPost).Methods("PATCH")
+	drafts.HandleFunc("/{draftId}/published", controllers.DeletePublishedPost).Methods("DELETE")
 }
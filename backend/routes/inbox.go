@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"social-sync-backend/controllers"
+	"social-sync-backend/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+func RegisterInboxRoutes(r *mux.Router) {
+	inbox := r.PathPrefix("/api/workspaces/{workspaceId}/inbox").Subrouter()
+	inbox.Use(middleware.JWTMiddleware)
+
+	inbox.HandleFunc("", controllers.ListInboxItems).Methods("GET")
+	inbox.HandleFunc("/sync", controllers.SyncInbox).Methods("POST")
+	inbox.HandleFunc("/{itemId}", controllers.UpdateInboxItem).Methods("PATCH")
+	inbox.HandleFunc("/{itemId}/reply", controllers.ReplyToInboxItem).Methods("POST")
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"social-sync-backend/controllers"
+	"social-sync-backend/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+func RegisterLinkTrackingRoutes(r *mux.Router) {
+	// Public short-link redirector
+	r.HandleFunc("/r/{code}", controllers.ShortLinkRedirectHandler).Methods("GET")
+
+	links := r.PathPrefix("/api/workspaces/{workspaceId}").Subrouter()
+	links.Use(middleware.JWTMiddleware)
+	links.HandleFunc("/utm-settings", controllers.GetUTMSettings).Methods("GET")
+	links.HandleFunc("/utm-settings", controllers.UpdateUTMSettings).Methods("PUT")
+	links.HandleFunc("/analytics/links", controllers.GetLinkAnalytics).Methods("GET")
+}
@@ -1,18 +1,56 @@
 package routes
 
 import (
+	"net/http"
+
 	"social-sync-backend/controllers"
+	"social-sync-backend/lib"
 	"social-sync-backend/middleware"
 
 	"github.com/gorilla/mux"
 )
 
 func RegisterMediaRoutes(r *mux.Router) {
+	// Stores that keep files on this server (local disk) serve them here
+	if h, ok := lib.Blobs.(http.Handler); ok {
+		r.PathPrefix(lib.LocalBlobRoutePrefix).Handler(h).Methods("GET", "HEAD", "PUT")
+	}
+
 	media := r.PathPrefix("/api/workspaces/{workspaceId}/media").Subrouter()
 	media.Use(middleware.JWTMiddleware)
 
 	media.HandleFunc("", controllers.UploadMedia).Methods("POST")
 	media.HandleFunc("", controllers.ListMedia).Methods("GET")
+	media.HandleFunc("/bulk", controllers.BulkUpdateMedia).Methods("POST")
+	media.HandleFunc("/lookup", controllers.LookupMediaByHash).Methods("GET")
+	media.HandleFunc("/import", controllers.ImportMedia).Methods("POST")
+	media.HandleFunc("/uploads", controllers.CreateMediaUpload).Methods("POST")
+	media.HandleFunc("/uploads/{uploadId}/complete", controllers.CompleteMediaUpload).Methods("POST")
+	media.HandleFunc("/uploads/{uploadId}", controllers.GetMediaUpload).Methods("GET")
+	media.HandleFunc("/uploads/{uploadId}", controllers.CancelMediaUpload).Methods("DELETE")
+	media.HandleFunc("/trash", controllers.ListMediaTrash).Methods("GET")
+	media.HandleFunc("/trash/{mediaId}", controllers.PurgeMediaNow).Methods("DELETE")
 	media.HandleFunc("/{mediaId}", controllers.DeleteMedia).Methods("DELETE")
+	media.HandleFunc("/{mediaId}/restore", controllers.RestoreMedia).Methods("POST")
 	media.HandleFunc("/{mediaId}/tags", controllers.UpdateMediaTags).Methods("PATCH")
+	media.HandleFunc("/{mediaId}/rights", controllers.UpdateMediaRights).Methods("PUT")
+	media.HandleFunc("/{mediaId}/renditions", controllers.ListMediaRenditions).Methods("GET")
+	media.HandleFunc("/{mediaId}/renditions", controllers.CreateMediaRenditions).Methods("POST")
+	media.HandleFunc("/{mediaId}/similar", controllers.ListSimilarMedia).Methods("GET")
+	media.HandleFunc("/{mediaId}/usage", controllers.GetMediaUsage).Methods("GET")
+
+	folders := r.PathPrefix("/api/workspaces/{workspaceId}/media-folders").Subrouter()
+	folders.Use(middleware.JWTMiddleware)
+
+	folders.HandleFunc("", controllers.ListMediaFolders).Methods("GET")
+	folders.HandleFunc("", controllers.CreateMediaFolder).Methods("POST")
+	folders.HandleFunc("/{folderId}", controllers.UpdateMediaFolder).Methods("PATCH")
+	folders.HandleFunc("/{folderId}", controllers.DeleteMediaFolder).Methods("DELETE")
+
+	presets := r.PathPrefix("/api/workspaces/{workspaceId}/rendition-presets").Subrouter()
+	presets.Use(middleware.JWTMiddleware)
+
+	presets.HandleFunc("", controllers.ListRenditionPresets).Methods("GET")
+	presets.HandleFunc("/{name}", controllers.UpdateRenditionPreset).Methods("PUT")
+	presets.HandleFunc("/{name}", controllers.DeleteRenditionPreset).Methods("DELETE")
 }
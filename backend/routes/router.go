@@ -12,6 +12,9 @@ func InitRoutes() *mux.Router {
 	RegisterTaskRoutes(r)
 	RegisterDraftPostRoutes(r)
 	RegisterMediaRoutes(r)
+	RegisterLinkTrackingRoutes(r)
+	RegisterInboxRoutes(r)
+	RegisterWebhookRoutes(r)
 	// Add more like RegisterPostRoutes(r), etc.
 
 	return r
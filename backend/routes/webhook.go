@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"social-sync-backend/controllers"
+	"social-sync-backend/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+func RegisterWebhookRoutes(r *mux.Router) {
+	webhook := r.PathPrefix("/api/workspaces/{workspaceId}/webhook").Subrouter()
+	webhook.Use(middleware.JWTMiddleware)
+	webhook.HandleFunc("", controllers.GetWebhook).Methods("GET")
+	webhook.HandleFunc("", controllers.UpdateWebhook).Methods("PUT")
+	webhook.HandleFunc("", controllers.DeleteWebhook).Methods("DELETE")
+	webhook.HandleFunc("/test", controllers.TestWebhook).Methods("POST")
+	webhook.HandleFunc("/deliveries", controllers.ListWebhookDeliveries).Methods("GET")
+}
@@ -3,8 +3,10 @@ package utils
 import (
 	"fmt"
 	"log"
+	"mime"
 	"net/smtp"
 	"os"
+	"strings"
 )
 
 
@@ -23,6 +25,33 @@ func SendVerificationEmail(toEmail, token string) error {
 	msg := []byte(from + subject + "\r\n" + body)
 
 
+	err := smtp.SendMail(smtpHost+":"+smtpPort, auth, sender, []string{toEmail}, msg)
+	if err != nil {
+		log.Printf("Error sending email to %s: %v", toEmail, err)
+		return err
+	}
+	return nil
+}
+
+// SendMediaRightsExpiryEmail warns a workspace admin about media whose usage rights end soon.
+// Each line describes one media item.
+func SendMediaRightsExpiryEmail(toEmail, workspaceName string, lines []string) error {
+	smtpHost := os.Getenv("SMTP_HOST")
+	smtpPort := os.Getenv("SMTP_PORT")
+	smtpUser := os.Getenv("SMTP_USERNAME")
+	smtpPass := os.Getenv("SMTP_PASSWORD")
+	sender := os.Getenv("EMAIL_SENDER")
+
+	auth := smtp.PlainAuth("", smtpUser, smtpPass, smtpHost)
+
+	// Workspace names are user input; encoding keeps CR/LF in one from adding headers
+	subject := "Subject: " + mime.QEncoding.Encode("utf-8", "SocialSync: media rights expiring in "+workspaceName) + "\r\n"
+	from := fmt.Sprintf("From: SocialSync <%s>\r\n", sender)
+	body := fmt.Sprintf("Usage rights for the following media in %s expire soon:\r\n\r\n%s\r\n\r\n"+
+		"After expiry, drafts using this media can't be scheduled or published. Renew the rights or replace the media.\r\n",
+		workspaceName, strings.Join(lines, "\r\n"))
+	msg := []byte(from + subject + "\r\n" + body)
+
 	err := smtp.SendMail(smtpHost+":"+smtpPort, auth, sender, []string{toEmail}, msg)
 	if err != nil {
 		log.Printf("Error sending email to %s: %v", toEmail, err)
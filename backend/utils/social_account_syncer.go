@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"time"
 	// "golang.org/x/oauth2"
+	"social-sync-backend/lib"
 	"social-sync-backend/models"
 	 // Assuming your models package is correctly imported
 )
@@ -36,7 +37,7 @@ func FetchAndSyncFacebookProfile(db *sql.DB, account *models.SocialAccount) erro
     
     // A more direct HTTP client for making calls with existing access token:
     client := &http.Client{Timeout: 10 * time.Second}
-    req, err := http.NewRequest("GET", fmt.Sprintf("https://graph.facebook.com/v18.0/%s?fields=name,picture.type(large)", account.SocialID), nil)
+    req, err := http.NewRequest("GET", lib.GraphURL("%s?fields=name,picture.type(large)", account.SocialID), nil)
     if err != nil {
         return fmt.Errorf("failed to create request: %w", err)
     }